@@ -2,42 +2,88 @@ package api
 
 import (
 	"net/http"
-	"os"
-	"path/filepath"
 
 	"github.com/gorilla/handlers"
 
+	"memo/api/attachments"
+	"memo/api/audit"
 	"memo/api/auth"
+	"memo/api/backlinks"
+	"memo/api/collab"
+	"memo/api/comments"
+	"memo/api/export"
+	"memo/api/imports"
 	"memo/api/notes"
+	"memo/api/notes/metadata"
+	"memo/api/notes/models"
 	"memo/api/notes/repository"
+	"memo/api/notesync"
+	"memo/api/notifications"
+	"memo/api/publiclinks"
 	"memo/api/share"
+	"memo/api/stream"
+	"memo/api/templates"
+	"memo/api/webhooks"
+	"memo/api/workspaces"
+	"memo/pkg/avatar"
+	"memo/pkg/database"
+	"memo/pkg/events"
 	"memo/pkg/logger"
+	"memo/pkg/response"
 )
 
 type DI struct {
 	Logger    logger.Logger
 	NoteRepo  repository.NotesRepository
 	TodoRepo  repository.TodoNotesRepository
-	MovieRepo repository.MovieNotesRepository
+	Movies    metadata.MetadataProvider
+	NoteTypes *models.Registry
 	ShareRepo share.ShareRepository
+	LinkRepo  backlinks.LinkRepository
 	AuthStore auth.AuthStore
-}
+	Avatars   avatar.Config
+	// Transactor runs the bulk operations in a transaction when mongo supports it.
+	Transactor *database.Transactor
 
-func FileServer(root http.FileSystem) http.Handler {
-	fs := http.FileServer(root)
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		path := r.URL.Path
-		fullPath := filepath.Join("./public", path)
+	// InvitationRepo holds the invitations to notes shared by email.
+	InvitationRepo share.InvitationRepository
+	// WorkspaceRepo holds the workspaces, their members access the notes created in them.
+	WorkspaceRepo workspaces.WorkspaceRepository
 
-		// Check if path is a directory
-		fi, err := os.Stat(fullPath)
-		if err != nil || fi.IsDir() || os.IsNotExist(err) {
-			http.NotFound(w, r)
-			return
-		}
+	Events    *events.Hub
+	Publisher *stream.Publisher
+	Collab    *collab.Manager
 
-		fs.ServeHTTP(w, r)
-	})
+	AttachmentRepo attachments.AttachmentRepository
+	Attachments    *attachments.Service
+
+	TemplateRepo templates.TemplateRepository
+
+	// CommentRepo holds the comment threads of notes.
+	CommentRepo comments.CommentRepository
+
+	// Notifier puts what happens to a user in their inbox, kept by NotificationRepo.
+	NotificationRepo notifications.NotificationRepository
+	Notifier         notifications.Notifier
+
+	// WebhookRepo holds the webhooks of the users and their delivery log.
+	WebhookRepo webhooks.WebhookRepository
+	Webhooks    *webhooks.Dispatcher
+
+	// Audit records the security and sharing actions in the log kept by AuditRepo.
+	AuditRepo audit.AuditRepository
+	Audit     audit.Recorder
+
+	// PublicLinkRepo holds the read-only links of notes opened without an account.
+	PublicLinkRepo publiclinks.LinkRepository
+	PublicLinks    publiclinks.Config
+
+	// Syncer serves the change feed and the pushes of offline clients.
+	Syncer *notesync.Syncer
+
+	Exporter   *export.Exporter
+	ImportRepo imports.JobRepository
+	Importer   *imports.Importer
 }
 
 func addRoutes(mux *http.ServeMux, di DI) {
@@ -46,33 +92,131 @@ func addRoutes(mux *http.ServeMux, di DI) {
 		Store: di.AuthStore,
 	}
 
+	sharer := share.NewSharer(di.ShareRepo, di.Publisher, di.Notifier, di.Audit)
+
 	// serve files.
-	fs := FileServer(http.Dir("./public"))
+	fs := FileServer(http.Dir("./public"), FileServerOptions{Precompressed: true})
 	mux.Handle("/public/", http.StripPrefix("/public/", fs))
 
+	// private files, through signed urls.
+	mux.Handle("GET /files/attachments/{attachmentId}", attachments.HandleSignedDownload(di.Logger, di.AttachmentRepo, di.Attachments))
+
+	// public links of notes, the form of the page posts the password.
+	mux.Handle("GET /s/{token}", publiclinks.HandleView(di.Logger, di.NoteRepo, di.NoteTypes, di.PublicLinkRepo))
+	mux.Handle("POST /s/{token}", publiclinks.HandleView(di.Logger, di.NoteRepo, di.NoteTypes, di.PublicLinkRepo))
+
 	// auth
-	mux.Handle("POST /api/v1/login", auth.HandleLogin(di.AuthStore))
-	mux.Handle("POST /api/v1/register", auth.HandleRegister(di.AuthStore))
+	mux.Handle("POST /api/v1/login", auth.HandleLogin(di.AuthStore, di.Audit))
+	mux.Handle("POST /api/v1/register", auth.HandleRegister(di.AuthStore, di.Audit))
 
-	middleware.Handle("POST /api/v1/logout", auth.HandleLogout(di.AuthStore))
+	middleware.Handle("POST /api/v1/logout", auth.HandleLogout(di.AuthStore, di.Audit))
 
 	middleware.Handle("GET /api/v1/profile", auth.HandleProfile(di.AuthStore))
-	middleware.Handle("PUT /api/v1/profile", auth.HandleProfileUpdate(di.AuthStore))
+	middleware.Handle("PUT /api/v1/profile", auth.HandleProfileUpdate(di.Logger, di.AuthStore, di.Avatars, di.Audit))
+
+	middleware.Handle("GET /api/v1/stream", stream.HandleStream(di.Logger, di.Events))
 
 	middleware.Handle("GET /api/v1/notes", notes.HandleAll(di.Logger, di.NoteRepo))
-	middleware.Handle("GET /api/v1/notes/{id}", notes.HandleGet(di.Logger, di.NoteRepo))
+	middleware.Handle("GET /api/v1/notes/{id}", notes.HandleGet(di.Logger, di.NoteRepo, di.NoteTypes))
 
-	middleware.Handle("POST /api/v1/notes", notes.HandleAdd(di.Logger, di.NoteRepo))
-	middleware.Handle("PUT /api/v1/notes/{id}", notes.HandleUpdate(di.Logger, di.NoteRepo))
+	middleware.Handle("POST /api/v1/notes", notes.HandleAdd(di.Logger, di.NoteRepo, di.NoteTypes, di.WorkspaceRepo))
+	middleware.Handle("POST /api/v1/notes/bulk", notes.HandleBulk(di.Logger, di.NoteRepo, sharer, di.NoteTypes, di.Transactor))
+	middleware.Handle("PUT /api/v1/notes/{id}", notes.HandleUpdate(di.Logger, di.NoteRepo, di.NoteTypes))
 	middleware.Handle("DELETE /api/v1/notes/{id}", notes.HandleDelete(di.Logger, di.NoteRepo))
+	middleware.Handle("GET /api/v1/notes/{id}/collab", collab.HandleCollab(di.Logger, di.NoteRepo, di.Collab))
+	middleware.Handle("POST /api/v1/notes/{id}/duplicate", notes.HandleDuplicate(di.Logger, di.NoteRepo, di.NoteTypes))
+
+	middleware.Handle("GET /api/v1/templates", templates.HandleList(di.Logger, di.TemplateRepo))
+	middleware.Handle("POST /api/v1/templates", templates.HandleAdd(di.Logger, di.TemplateRepo, di.NoteTypes))
+	middleware.Handle("GET /api/v1/templates/{id}", templates.HandleGet(di.Logger, di.TemplateRepo))
+	middleware.Handle("PUT /api/v1/templates/{id}", templates.HandleUpdate(di.Logger, di.TemplateRepo, di.NoteTypes))
+	middleware.Handle("DELETE /api/v1/templates/{id}", templates.HandleDelete(di.Logger, di.TemplateRepo))
+	middleware.Handle("POST /api/v1/templates/{id}/notes", templates.HandleInstantiate(di.Logger, di.TemplateRepo, di.NoteRepo, di.NoteTypes))
+
+	middleware.Handle("GET /api/v1/notes/{id}/backlinks", backlinks.HandleBacklinks(di.Logger, di.NoteRepo, di.LinkRepo))
+	middleware.Handle("GET /api/v1/notes/links/dangling", backlinks.HandleDanglingLinks(di.Logger, di.LinkRepo))
 
-	middleware.Handle("PUT /api/v1/notes/todo/{id}", notes.HandleUpdateTodo(di.Logger, di.TodoRepo))
-	middleware.Handle("POST /api/v1/notes/todo/{id}", notes.HandleCreateTodo(di.Logger, di.TodoRepo))
+	middleware.Handle("GET /api/v1/notes/{id}/attachments", attachments.HandleList(di.Logger, di.NoteRepo, di.AttachmentRepo))
+	middleware.Handle("POST /api/v1/notes/{id}/attachments", attachments.HandleUpload(di.Logger, di.NoteRepo, di.Attachments))
+	middleware.Handle("GET /api/v1/notes/{id}/attachments/{attachmentId}", attachments.HandleDownload(di.Logger, di.NoteRepo, di.AttachmentRepo, di.Attachments))
+	middleware.Handle("POST /api/v1/notes/{id}/attachments/{attachmentId}/url", attachments.HandleSignedURL(di.Logger, di.NoteRepo, di.AttachmentRepo, di.Attachments))
+	middleware.Handle("DELETE /api/v1/notes/{id}/attachments/{attachmentId}", attachments.HandleDelete(di.Logger, di.NoteRepo, di.AttachmentRepo, di.Attachments))
 
-	middleware.Handle("PUT /api/v1/notes/movie/{id}", notes.HandleUpdateMovie(di.Logger, di.MovieRepo))
+	middleware.Handle("PUT /api/v1/notes/todo/{id}", notes.HandleUpdateTodo(di.Logger, di.NoteRepo, di.TodoRepo, di.Publisher))
+	// "POST /notes/todo/{id}" and "POST /notes/{id}/attachments" overlap and neither is more
+	// specific, so ServeMux refuses both; the typed note routes are picked by kind instead.
+	middleware.Handle("POST /api/v1/notes/{kind}/{id}", byKind(map[string]http.HandlerFunc{
+		"todo": notes.HandleCreateTodo(di.Logger, di.NoteRepo, di.TodoRepo, di.Publisher),
+	}))
+
+	middleware.Handle("PUT /api/v1/notes/movie/{id}", notes.HandleUpdateMovie(di.Logger, di.NoteRepo, di.NoteTypes))
+	middleware.Handle("POST /api/v1/notes/movie/{id}/enrich", notes.HandleEnrichMovie(di.Logger, di.NoteRepo, di.NoteTypes, di.Movies))
+	middleware.Handle("GET /api/v1/movies/suggest", notes.HandleSuggestMovies(di.Logger, di.Movies))
+
+	middleware.Handle("GET /api/v1/sync", notesync.HandlePull(di.Logger, di.Syncer))
+	middleware.Handle("POST /api/v1/sync", notesync.HandlePush(di.Logger, di.Syncer))
+
+	middleware.Handle("GET /api/v1/export", export.HandleExport(di.Logger, di.Exporter))
+	middleware.Handle("POST /api/v1/import", imports.HandleImport(di.Logger, di.Importer))
+	middleware.Handle("GET /api/v1/import/{id}", imports.HandleJob(di.Logger, di.ImportRepo))
+	middleware.Handle("GET /api/v1/import/{id}/items", imports.HandleItems(di.Logger, di.ImportRepo))
 
 	middleware.Handle("GET /api/v1/shared-notes", share.HandleGetShared(di.Logger, di.ShareRepo))
-	middleware.Handle("POST /api/v1/notes/share", share.HandleShareNote(di.Logger, di.ShareRepo))
+	middleware.Handle("POST /api/v1/notes/share", share.HandleShareNote(di.Logger, di.NoteRepo, sharer))
+
+	middleware.Handle("GET /api/v1/notes/{id}/collaborators", share.HandleCollaborators(di.Logger, di.ShareRepo, di.NoteRepo))
+	middleware.Handle("PUT /api/v1/notes/{id}/collaborators/{userId}", share.HandleChangePermission(di.Logger, di.ShareRepo, di.NoteRepo, di.Publisher, di.Notifier, di.Audit))
+	middleware.Handle("DELETE /api/v1/notes/{id}/collaborators/{userId}", share.HandleRevoke(di.Logger, di.ShareRepo, di.NoteRepo, di.Publisher, di.Audit))
+	middleware.Handle("POST /api/v1/notes/{id}/transfer", share.HandleTransfer(di.Logger, di.ShareRepo, di.NoteRepo, di.Publisher, di.Notifier, di.Audit))
+
+	middleware.Handle("GET /api/v1/notes/{id}/invitations", share.HandleNoteInvitations(di.Logger, di.NoteRepo, di.InvitationRepo))
+	middleware.Handle("POST /api/v1/notes/{id}/invitations", share.HandleInvite(di.Logger, di.NoteRepo, di.AuthStore, di.InvitationRepo, di.Notifier, di.Audit))
+	middleware.Handle("DELETE /api/v1/notes/{id}/invitations/{invitationId}", share.HandleCancelInvitation(di.Logger, di.NoteRepo, di.InvitationRepo))
+	middleware.Handle("GET /api/v1/invitations", share.HandleMyInvitations(di.Logger, di.AuthStore, di.InvitationRepo))
+	middleware.Handle("POST /api/v1/invitations/{id}/accept", share.HandleRespondInvitation(di.Logger, di.NoteRepo, di.AuthStore, di.InvitationRepo, sharer, true))
+	middleware.Handle("POST /api/v1/invitations/{id}/decline", share.HandleRespondInvitation(di.Logger, di.NoteRepo, di.AuthStore, di.InvitationRepo, sharer, false))
+
+	middleware.Handle("GET /api/v1/workspaces", workspaces.HandleList(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("POST /api/v1/workspaces", workspaces.HandleCreate(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("GET /api/v1/workspaces/invitations", workspaces.HandleInvitations(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("GET /api/v1/workspaces/{id}", workspaces.HandleGet(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("POST /api/v1/workspaces/{id}/accept", workspaces.HandleRespond(di.Logger, di.WorkspaceRepo, true))
+	middleware.Handle("POST /api/v1/workspaces/{id}/decline", workspaces.HandleRespond(di.Logger, di.WorkspaceRepo, false))
+	middleware.Handle("PUT /api/v1/workspaces/{id}", workspaces.HandleRename(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("DELETE /api/v1/workspaces/{id}", workspaces.HandleDelete(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("POST /api/v1/workspaces/{id}/members", workspaces.HandleInvite(di.Logger, di.WorkspaceRepo, di.AuthStore, di.Notifier))
+	middleware.Handle("PUT /api/v1/workspaces/{id}/members/{userId}", workspaces.HandleChangeRole(di.Logger, di.WorkspaceRepo))
+	middleware.Handle("DELETE /api/v1/workspaces/{id}/members/{userId}", workspaces.HandleRemoveMember(di.Logger, di.WorkspaceRepo))
+
+	middleware.Handle("GET /api/v1/notes/{id}/links", publiclinks.HandleList(di.Logger, di.NoteRepo, di.PublicLinkRepo))
+	middleware.Handle("POST /api/v1/notes/{id}/links", publiclinks.HandleCreate(di.Logger, di.NoteRepo, di.PublicLinkRepo, di.PublicLinks))
+	middleware.Handle("DELETE /api/v1/notes/{id}/links/{linkId}", publiclinks.HandleRevoke(di.Logger, di.NoteRepo, di.PublicLinkRepo))
+
+	middleware.Handle("GET /api/v1/notes/{id}/comments", comments.HandleList(di.Logger, di.NoteRepo, di.CommentRepo))
+	middleware.Handle("POST /api/v1/notes/{id}/comments", comments.HandleCreate(di.Logger, di.NoteRepo, di.CommentRepo, di.Publisher, di.Notifier))
+	middleware.Handle("PUT /api/v1/notes/{id}/comments/{commentId}", comments.HandleEdit(di.Logger, di.NoteRepo, di.CommentRepo, di.Publisher, di.Notifier))
+	middleware.Handle("DELETE /api/v1/notes/{id}/comments/{commentId}", comments.HandleDelete(di.Logger, di.NoteRepo, di.CommentRepo, di.Publisher))
+	middleware.Handle("POST /api/v1/notes/{id}/comments/{commentId}/resolve", comments.HandleResolve(di.Logger, di.NoteRepo, di.CommentRepo, di.Publisher, true))
+	middleware.Handle("POST /api/v1/notes/{id}/comments/{commentId}/unresolve", comments.HandleResolve(di.Logger, di.NoteRepo, di.CommentRepo, di.Publisher, false))
+
+	middleware.Handle("GET /api/v1/notifications", notifications.HandleList(di.Logger, di.NotificationRepo))
+	middleware.Handle("POST /api/v1/notifications/read", notifications.HandleMarkAllRead(di.Logger, di.NotificationRepo))
+	middleware.Handle("POST /api/v1/notifications/{id}/read", notifications.HandleMarkRead(di.Logger, di.NotificationRepo))
+	middleware.Handle("DELETE /api/v1/notifications/{id}", notifications.HandleDelete(di.Logger, di.NotificationRepo))
+	middleware.Handle("GET /api/v1/notifications/preferences", notifications.HandlePreferences(di.Logger, di.NotificationRepo))
+	middleware.Handle("PUT /api/v1/notifications/preferences", notifications.HandleSavePreferences(di.Logger, di.NotificationRepo))
+
+	middleware.Handle("GET /api/v1/webhooks", webhooks.HandleList(di.Logger, di.WebhookRepo))
+	middleware.Handle("POST /api/v1/webhooks", webhooks.HandleCreate(di.Logger, di.WebhookRepo))
+	middleware.Handle("GET /api/v1/webhooks/{id}", webhooks.HandleGet(di.Logger, di.WebhookRepo))
+	middleware.Handle("PUT /api/v1/webhooks/{id}", webhooks.HandleUpdate(di.Logger, di.WebhookRepo))
+	middleware.Handle("DELETE /api/v1/webhooks/{id}", webhooks.HandleDelete(di.Logger, di.WebhookRepo))
+	middleware.Handle("GET /api/v1/webhooks/{id}/deliveries", webhooks.HandleDeliveries(di.Logger, di.WebhookRepo))
+	middleware.Handle("GET /api/v1/webhooks/{id}/deliveries/{deliveryId}", webhooks.HandleDelivery(di.Logger, di.WebhookRepo))
+	middleware.Handle("POST /api/v1/webhooks/{id}/deliveries/{deliveryId}/replay", webhooks.HandleReplay(di.Logger, di.WebhookRepo, di.Webhooks))
+
+	middleware.Handle("GET /api/v1/audit", audit.HandleMine(di.Logger, di.AuditRepo))
+	middleware.Handle("GET /api/v1/admin/audit", audit.HandleAll(di.Logger, di.AuditRepo, di.AuthStore, di.Audit))
 }
 
 func New(di DI) http.Handler {
@@ -80,14 +224,33 @@ func New(di DI) http.Handler {
 
 	addRoutes(mux, di)
 
-	var handler http.Handler = mux
+	// the audit entries record the client of the request.
+	var handler http.Handler = audit.Middleware(mux)
+	// every request gets an id and a logger, and is logged once served.
+	if di.Logger != nil {
+		handler = logger.Middleware(di.Logger, handler)
+	}
 
 	corsMiddleware := handlers.CORS(
 		handlers.AllowedOrigins([]string{"http://localhost:5173"}),
 		handlers.AllowedMethods([]string{"GET", "POST", "OPTIONS", "PUT", "PATCH", "DELETE"}),
-		handlers.AllowedHeaders([]string{"Content-Type", "Authorization"}),
+		handlers.AllowedHeaders([]string{"Content-Type", "Authorization", logger.RequestIDHeader}),
+		handlers.ExposedHeaders([]string{logger.RequestIDHeader}),
 		handlers.AllowCredentials(),
 	)
 
 	return corsMiddleware(handler)
 }
+
+// byKind dispatches "/notes/{kind}/{id}" requests to the handler of the kind.
+func byKind(handlers map[string]http.HandlerFunc) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		handler, ok := handlers[r.PathValue("kind")]
+		if !ok {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		handler(w, r)
+	})
+}
@@ -0,0 +1,250 @@
+package attachments
+
+import (
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"time"
+
+	"memo/api/authz"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/security"
+)
+
+func HandleUpload(logger logger.Logger, notes repository.NotesRepository, svc *Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Edit)
+		if !ok {
+			return
+		}
+
+		// leave some room for the multipart headers.
+		r.Body = http.MaxBytesReader(w, r.Body, svc.Config().MaxSize+1<<20)
+
+		reader, err := r.MultipartReader()
+		if err != nil {
+			response.ValidationErr(w, map[string]string{"file": "required"})
+			return
+		}
+
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				response.ValidationErr(w, map[string]string{"file": "required"})
+				return
+			}
+
+			if err != nil {
+				respondUploadErr(w, err)
+				return
+			}
+
+			if part.FormName() != "file" {
+				part.Close()
+				continue
+			}
+
+			attachment, err := svc.Upload(note, userId, part.FileName(), part, r.Context())
+			part.Close()
+
+			if err != nil {
+				if !isClientErr(err) {
+					logger.For(r.Context()).Error("attachment upload issue", "error", err)
+				}
+				respondUploadErr(w, err)
+				return
+			}
+
+			response.Respond(w, attachment, http.StatusCreated)
+			return
+		}
+	})
+}
+
+func HandleList(logger logger.Logger, notes repository.NotesRepository, repo AttachmentRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		attachments, err := repo.ListByNote(note.ID, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("attachments list issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, attachments, http.StatusOK)
+	})
+}
+
+func HandleDownload(logger logger.Logger, notes repository.NotesRepository, repo AttachmentRepository, svc *Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		attachment, err := repo.Get(r.PathValue("attachmentId"), r.Context())
+		if err != nil || attachment.NoteID != note.ID {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		serve(w, r, logger, attachment, svc, "private, no-store")
+	})
+}
+
+// HandleSignedURL returns a download url that works without a session, until it expires.
+func HandleSignedURL(logger logger.Logger, notes repository.NotesRepository, repo AttachmentRepository, svc *Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		attachment, err := repo.Get(r.PathValue("attachmentId"), r.Context())
+		if err != nil || attachment.NoteID != note.ID {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		url, expires := svc.SignedURL(attachment)
+
+		response.Respond(w, map[string]any{
+			"url":        url,
+			"expires_at": expires,
+		}, http.StatusOK)
+	})
+}
+
+// HandleSignedDownload serves an attachment from a signed url, it's not behind the auth middleware.
+func HandleSignedDownload(logger logger.Logger, repo AttachmentRepository, svc *Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("attachmentId")
+
+		expires, err := svc.VerifyURL(id, r.URL.Query())
+		if errors.Is(err, security.ErrSignatureExpired) {
+			response.ErrMessage(w, "Link has expired", http.StatusGone)
+			return
+		}
+
+		if err != nil {
+			response.RespondErr(w, response.Forbidden())
+			return
+		}
+
+		attachment, err := repo.Get(id, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		maxAge := int(time.Until(expires).Seconds())
+		serve(w, r, logger, attachment, svc, "private, max-age="+strconv.Itoa(maxAge))
+	})
+}
+
+// HandleDelete removes an attachment of a note, for the user who uploaded it, the owner and the managers.
+func HandleDelete(logger logger.Logger, notes repository.NotesRepository, repo AttachmentRepository, svc *Service) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Edit)
+		if !ok {
+			return
+		}
+
+		attachment, err := repo.Get(r.PathValue("attachmentId"), r.Context())
+		if err != nil || attachment.NoteID != note.ID {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		// the editors only remove their own files, the owner and the managers remove any.
+		if attachment.UserID.Hex() != userId && !authz.Can(note, userId, authz.Share) {
+			response.ErrMessage(w, "Only the uploader, the owner and the managers of the note can remove this attachment", http.StatusForbidden)
+			return
+		}
+
+		if err := svc.Remove(attachment, r.Context()); err != nil {
+			logger.For(r.Context()).Error("attachment delete issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// serve writes the attachment file, range requests are supported when the blob store can seek.
+func serve(w http.ResponseWriter, r *http.Request, logger logger.Logger, attachment *Attachment, svc *Service, cacheControl string) {
+	file, err := svc.Open(attachment, r.Context())
+	if err != nil {
+		logger.For(r.Context()).Error("attachment download issue", "error", err)
+		response.RespondErr(w, response.NotFound())
+		return
+	}
+
+	defer file.Close()
+
+	header := w.Header()
+	header.Set("Content-Type", attachment.MimeType)
+	header.Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": attachment.Name}))
+	header.Set("X-Content-Type-Options", "nosniff")
+	header.Set("Cache-Control", cacheControl)
+	// attachments are never modified, the id identifies the content.
+	header.Set("ETag", `"`+attachment.ID.Hex()+`"`)
+
+	if seeker, ok := file.(io.ReadSeeker); ok {
+		http.ServeContent(w, r, "", attachment.CreatedAt, seeker)
+		return
+	}
+
+	header.Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.WriteHeader(http.StatusOK)
+
+	if r.Method == http.MethodHead {
+		return
+	}
+
+	if _, err := io.Copy(w, file); err != nil {
+		logger.For(r.Context()).Error("attachment download issue", "error", err)
+	}
+}
+
+func isClientErr(err error) bool {
+	var maxBytes *http.MaxBytesError
+	return errors.Is(err, ErrTooLarge) || errors.Is(err, ErrType) || errors.Is(err, ErrQuota) ||
+		errors.Is(err, ErrMissingFile) || errors.As(err, &maxBytes)
+}
+
+func respondUploadErr(w http.ResponseWriter, err error) {
+	var maxBytes *http.MaxBytesError
+
+	switch {
+	case errors.Is(err, ErrTooLarge), errors.As(err, &maxBytes):
+		response.ErrMessage(w, "File is too big", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrType):
+		response.ErrMessage(w, "File type is not allowed", http.StatusUnsupportedMediaType)
+	case errors.Is(err, ErrQuota):
+		response.ErrMessage(w, "Storage quota exceeded", http.StatusRequestEntityTooLarge)
+	case errors.Is(err, ErrMissingFile):
+		response.ValidationErr(w, map[string]string{"file": "required"})
+	default:
+		response.RespondErr(w, response.InternalServerError())
+	}
+}
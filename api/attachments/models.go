@@ -0,0 +1,69 @@
+package attachments
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Attachment struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	NoteID    primitive.ObjectID `bson:"note_id" json:"note_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name      string             `bson:"name" json:"name"`
+	MimeType  string             `bson:"mime_type" json:"mime_type"`
+	Size      int64              `bson:"size" json:"size"`
+	Key       string             `bson:"key" json:"-"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+type Config struct {
+	// MaxSize is the size limit of one attachment, in bytes.
+	MaxSize int64
+	// Quota is the total size of the attachments of a user, in bytes. 0 means no limit.
+	Quota int64
+	// AllowedTypes are the accepted mime types, detected from the file content.
+	AllowedTypes []string
+	// BaseURL prefixes the signed download urls, e.g. https://memo.example.com.
+	BaseURL string
+	// SigningKey signs the download urls, a random key is used when empty.
+	SigningKey []byte
+	// URLExpiry is how long a signed download url stays valid.
+	URLExpiry time.Duration
+}
+
+var DefaultConfig = Config{
+	MaxSize: 10 * 1000 * 1000, // 10Mb
+	Quota:   500 * 1000 * 1000,
+	AllowedTypes: []string{
+		"image/png", "image/jpeg", "image/gif", "image/webp",
+		"application/pdf", "application/zip",
+		"text/plain", "audio/mpeg", "video/mp4",
+	},
+	URLExpiry: 15 * time.Minute,
+}
+
+// LoadConfig reads ATTACHMENT_MAX_SIZE and ATTACHMENT_QUOTA (in bytes), ATTACHMENT_URL_EXPIRY
+// (a duration like 15m), URL_SIGNING_KEY and PUBLIC_URL, missing values keep the defaults.
+func LoadConfig(getEnv func(string) string) Config {
+	config := DefaultConfig
+
+	if size, err := strconv.ParseInt(getEnv("ATTACHMENT_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		config.MaxSize = size
+	}
+
+	if quota, err := strconv.ParseInt(getEnv("ATTACHMENT_QUOTA"), 10, 64); err == nil && quota >= 0 {
+		config.Quota = quota
+	}
+
+	if expiry, err := time.ParseDuration(getEnv("ATTACHMENT_URL_EXPIRY")); err == nil && expiry > 0 {
+		config.URLExpiry = expiry
+	}
+
+	config.BaseURL = strings.TrimSuffix(getEnv("PUBLIC_URL"), "/")
+	config.SigningKey = []byte(getEnv("URL_SIGNING_KEY"))
+
+	return config
+}
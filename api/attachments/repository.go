@@ -0,0 +1,163 @@
+package attachments
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+type AttachmentRepository interface {
+	Insert(attachment *Attachment, ctx context.Context) error
+	Get(id string, ctx context.Context) (*Attachment, error)
+	ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Attachment, error)
+	Delete(id primitive.ObjectID, ctx context.Context) error
+	DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error
+	// Usage returns the total size of the attachments uploaded by the user.
+	Usage(userId primitive.ObjectID, ctx context.Context) (int64, error)
+	// Reserve adds size to the storage used by the user if it stays within quota, it fails with
+	// ErrQuota otherwise. The check and the addition are a single update, so concurrent uploads
+	// can't both pass it.
+	Reserve(userId primitive.ObjectID, size, quota int64, ctx context.Context) error
+	// Release gives back size of the storage used by the user.
+	Release(userId primitive.ObjectID, size int64, ctx context.Context) error
+}
+
+type attachmentRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) AttachmentRepository {
+	return &attachmentRepository{client}
+}
+
+func (r *attachmentRepository) Insert(attachment *Attachment, ctx context.Context) error {
+	result, err := r.client.Collection("attachments").InsertOne(ctx, attachment)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		attachment.ID = id
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) Get(id string, ctx context.Context) (*Attachment, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var attachment *Attachment
+	if err := r.client.Collection("attachments").FindOne(ctx, bson.M{"_id": oId}).Decode(&attachment); err != nil {
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+func (r *attachmentRepository) ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Attachment, error) {
+	cursor, err := r.client.Collection("attachments").Find(ctx, bson.M{"note_id": noteId})
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	attachments := []*Attachment{}
+	if err = cursor.All(ctx, &attachments); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+func (r *attachmentRepository) Delete(id primitive.ObjectID, ctx context.Context) error {
+	result, err := r.client.Collection("attachments").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error {
+	_, err := r.client.Collection("attachments").DeleteMany(ctx, bson.M{"note_id": noteId})
+	return err
+}
+
+func (r *attachmentRepository) Usage(userId primitive.ObjectID, ctx context.Context) (int64, error) {
+	pipeline := mongo.Pipeline{
+		{{Key: "$match", Value: bson.M{"user_id": userId}}},
+		{{Key: "$group", Value: bson.M{"_id": nil, "total": bson.M{"$sum": "$size"}}}},
+	}
+
+	cursor, err := r.client.Collection("attachments").Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+
+	defer cursor.Close(ctx)
+
+	var result []struct {
+		Total int64 `bson:"total"`
+	}
+
+	if err := cursor.All(ctx, &result); err != nil {
+		return 0, err
+	}
+
+	if len(result) == 0 {
+		return 0, nil
+	}
+
+	return result[0].Total, nil
+}
+
+func (r *attachmentRepository) Reserve(userId primitive.ObjectID, size, quota int64, ctx context.Context) error {
+	usage := r.client.Collection("attachment_usage")
+
+	filter := bson.M{"_id": userId, "used": bson.M{"$lte": quota - size}}
+	update := bson.M{"$inc": bson.M{"used": size}}
+
+	result, err := usage.UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		// either the quota is exceeded or the user has no counter yet. It starts from the size of
+		// the attachments uploaded so far, a concurrent upload may have created it meanwhile.
+		used, err := r.Usage(userId, ctx)
+		if err != nil {
+			return err
+		}
+
+		if _, err := usage.InsertOne(ctx, bson.M{"_id": userId, "used": used}); err != nil && !mongo.IsDuplicateKeyError(err) {
+			return err
+		}
+
+		if result, err = usage.UpdateOne(ctx, filter, update); err != nil {
+			return err
+		}
+	}
+
+	if result.MatchedCount == 0 {
+		return ErrQuota
+	}
+
+	return nil
+}
+
+func (r *attachmentRepository) Release(userId primitive.ObjectID, size int64, ctx context.Context) error {
+	_, err := r.client.Collection("attachment_usage").UpdateOne(ctx, bson.M{"_id": userId}, bson.M{"$inc": bson.M{"used": -size}})
+	return err
+}
@@ -0,0 +1,218 @@
+package attachments
+
+import (
+	"context"
+	"errors"
+	"io"
+	"math"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/pkg/security"
+	"memo/pkg/storage"
+	"memo/pkg/upload"
+)
+
+var (
+	ErrTooLarge    = errors.New("attachment is too large")
+	ErrType        = errors.New("attachment type is not allowed")
+	ErrQuota       = errors.New("storage quota exceeded")
+	ErrMissingFile = errors.New("no file was uploaded")
+)
+
+// Service stores the attachment files in the blob store and their details in mongo.
+// It's also a notes repository hook, attachments are removed with their note.
+type Service struct {
+	repo   AttachmentRepository
+	blobs  storage.BlobStore
+	config Config
+	signer *security.Signer
+}
+
+func NewService(repo AttachmentRepository, blobs storage.BlobStore, config Config) *Service {
+	return &Service{repo, blobs, config, security.NewSigner(config.SigningKey)}
+}
+
+func (s *Service) Config() Config {
+	return s.config
+}
+
+// Upload checks the content type and size of r and stores it as an attachment of note.
+// The type is sniffed from the content, whatever the client sent.
+func (s *Service) Upload(note *models.EmbeddedNote, userId, name string, r io.Reader, ctx context.Context) (*Attachment, error) {
+	uploader, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	mimeType, content, err := upload.Sniff(r)
+	if err == io.EOF {
+		return nil, ErrMissingFile
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if !s.allowed(mimeType) {
+		return nil, ErrType
+	}
+
+	// spool to disk, the size has to be known before the quota check and the upload.
+	tmp, err := os.CreateTemp("", "attachment-*")
+	if err != nil {
+		return nil, err
+	}
+
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	size, err := io.Copy(tmp, io.LimitReader(content, s.config.MaxSize+1))
+	if err != nil {
+		return nil, err
+	}
+
+	if size > s.config.MaxSize {
+		return nil, ErrTooLarge
+	}
+
+	// the usage is counted even without a quota, it stays right if one is set later.
+	quota := s.config.Quota
+	if quota == 0 {
+		quota = math.MaxInt64
+	}
+
+	if err := s.repo.Reserve(uploader, size, quota, ctx); err != nil {
+		return nil, err
+	}
+
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		s.repo.Release(uploader, size, ctx)
+		return nil, err
+	}
+
+	attachment := &Attachment{
+		ID:        primitive.NewObjectID(),
+		NoteID:    note.ID,
+		UserID:    uploader,
+		Name:      cleanName(name),
+		MimeType:  mimeType,
+		Size:      size,
+		CreatedAt: time.Now(),
+	}
+	attachment.Key = "attachments/" + uploader.Hex() + "/" + attachment.ID.Hex()
+
+	if err := s.blobs.Put(attachment.Key, tmp, size, mimeType, ctx); err != nil {
+		s.repo.Release(uploader, size, ctx)
+		return nil, err
+	}
+
+	if err := s.repo.Insert(attachment, ctx); err != nil {
+		s.blobs.Delete(attachment.Key, ctx)
+		s.repo.Release(uploader, size, ctx)
+		return nil, err
+	}
+
+	return attachment, nil
+}
+
+func (s *Service) Open(attachment *Attachment, ctx context.Context) (io.ReadCloser, error) {
+	return s.blobs.Get(attachment.Key, ctx)
+}
+
+// SignedURL returns a url to download attachment without a session, valid for the configured expiry.
+func (s *Service) SignedURL(attachment *Attachment) (string, time.Time) {
+	path := signedPath(attachment.ID.Hex())
+	expires := time.Now().Add(s.config.URLExpiry)
+
+	return s.config.BaseURL + path + "?" + s.signer.Sign(path, expires).Encode(), expires
+}
+
+// VerifyURL checks the signature of a download url for the attachment id.
+func (s *Service) VerifyURL(id string, query url.Values) (time.Time, error) {
+	return s.signer.Verify(signedPath(id), query)
+}
+
+func signedPath(id string) string {
+	return "/files/attachments/" + id
+}
+
+func (s *Service) Remove(attachment *Attachment, ctx context.Context) error {
+	if err := s.blobs.Delete(attachment.Key, ctx); err != nil {
+		return err
+	}
+
+	if err := s.repo.Delete(attachment.ID, ctx); err != nil {
+		return err
+	}
+
+	return s.repo.Release(attachment.UserID, attachment.Size, ctx)
+}
+
+func (s *Service) NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error {
+	return nil
+}
+
+func (s *Service) NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error {
+	attachments, err := s.repo.ListByNote(note.ID, ctx)
+	if err != nil {
+		return err
+	}
+
+	released := map[primitive.ObjectID]int64{}
+	for _, attachment := range attachments {
+		if err := s.blobs.Delete(attachment.Key, ctx); err != nil {
+			return err
+		}
+		released[attachment.UserID] += attachment.Size
+	}
+
+	if err := s.repo.DeleteByNote(note.ID, ctx); err != nil {
+		return err
+	}
+
+	for userId, size := range released {
+		if err := s.repo.Release(userId, size, ctx); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *Service) allowed(mimeType string) bool {
+	for _, t := range s.config.AllowedTypes {
+		if t == mimeType {
+			return true
+		}
+	}
+	return false
+}
+
+// cleanName keeps the base name of the client file name, without control characters.
+func cleanName(name string) string {
+	name = filepath.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) {
+			return -1
+		}
+		return r
+	}, name)
+
+	if name == "." || name == "/" || strings.TrimSpace(name) == "" {
+		return "attachment"
+	}
+
+	if runes := []rune(name); len(runes) > 200 {
+		name = string(runes[len(runes)-200:])
+	}
+
+	return name
+}
@@ -0,0 +1,195 @@
+package attachments
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/pkg/storage"
+)
+
+// memRepo keeps the attachments in memory, Reserve checks and adds under a lock like the
+// conditional update of mongo.
+type memRepo struct {
+	mu          sync.Mutex
+	attachments map[primitive.ObjectID]*Attachment
+	used        map[primitive.ObjectID]int64
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{attachments: map[primitive.ObjectID]*Attachment{}, used: map[primitive.ObjectID]int64{}}
+}
+
+func (r *memRepo) Insert(attachment *Attachment, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.attachments[attachment.ID] = attachment
+	return nil
+}
+
+func (r *memRepo) Get(id string, ctx context.Context) (*Attachment, error) {
+	oId, _ := primitive.ObjectIDFromHex(id)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if attachment, ok := r.attachments[oId]; ok {
+		return attachment, nil
+	}
+	return nil, fmt.Errorf("no documents matched the filter")
+}
+
+func (r *memRepo) ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Attachment, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	attachments := []*Attachment{}
+	for _, attachment := range r.attachments {
+		if attachment.NoteID == noteId {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+func (r *memRepo) Delete(id primitive.ObjectID, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delete(r.attachments, id)
+	return nil
+}
+
+func (r *memRepo) DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for id, attachment := range r.attachments {
+		if attachment.NoteID == noteId {
+			delete(r.attachments, id)
+		}
+	}
+	return nil
+}
+
+func (r *memRepo) Usage(userId primitive.ObjectID, ctx context.Context) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return r.used[userId], nil
+}
+
+func (r *memRepo) Reserve(userId primitive.ObjectID, size, quota int64, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.used[userId] > quota-size {
+		return ErrQuota
+	}
+	r.used[userId] += size
+	return nil
+}
+
+func (r *memRepo) Release(userId primitive.ObjectID, size int64, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.used[userId] -= size
+	return nil
+}
+
+func newTestService(t *testing.T, config Config) (*Service, *memRepo) {
+	blobs, err := storage.NewLocal(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	repo := newMemRepo()
+	return NewService(repo, blobs, config), repo
+}
+
+var pngHeader = []byte("\x89PNG\r\n\x1a\n\x00\x00\x00\rIHDR")
+
+func TestUploadSniffsTheType(t *testing.T) {
+	svc, _ := newTestService(t, DefaultConfig)
+	note := &models.EmbeddedNote{BaseNote: models.BaseNote{ID: primitive.NewObjectID()}}
+	userId := primitive.NewObjectID().Hex()
+
+	tests := []struct {
+		name     string
+		content  []byte
+		mimeType string
+		err      error
+	}{
+		// the names don't matter, the content does.
+		{"image.png", []byte("MZ\x90\x00\x03\x00\x00\x00\x04\x00\x00\x00\xff\xff"), "", ErrType},
+		{"page.txt", []byte("<!DOCTYPE html><html><script>alert(1)</script></html>"), "", ErrType},
+		{"notes.pdf", pngHeader, "image/png", nil},
+		{"notes.txt", []byte("plain text"), "text/plain", nil},
+		{"empty.txt", nil, "", ErrMissingFile},
+	}
+
+	for _, test := range tests {
+		attachment, err := svc.Upload(note, userId, test.name, bytes.NewReader(test.content), context.Background())
+		if !errors.Is(err, test.err) {
+			t.Errorf("Upload(%s) = %v, want %v", test.name, err, test.err)
+			continue
+		}
+		if err == nil && attachment.MimeType != test.mimeType {
+			t.Errorf("Upload(%s) detected %s, want %s", test.name, attachment.MimeType, test.mimeType)
+		}
+	}
+}
+
+func TestUploadLimits(t *testing.T) {
+	config := DefaultConfig
+	config.MaxSize = 100
+	config.Quota = 250
+
+	svc, repo := newTestService(t, config)
+	note := &models.EmbeddedNote{BaseNote: models.BaseNote{ID: primitive.NewObjectID()}}
+	user := primitive.NewObjectID()
+	ctx := context.Background()
+
+	if _, err := svc.Upload(note, user.Hex(), "big.txt", strings.NewReader(strings.Repeat("a", 101)), ctx); !errors.Is(err, ErrTooLarge) {
+		t.Errorf("Upload of 101 bytes = %v, want %v", err, ErrTooLarge)
+	}
+
+	// concurrent uploads can't exceed the quota together.
+	var wg sync.WaitGroup
+	var mu sync.Mutex
+	uploaded := []*Attachment{}
+	for i := 0; i < 10; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			attachment, err := svc.Upload(note, user.Hex(), "part.txt", strings.NewReader(strings.Repeat("b", 100)), ctx)
+			if err == nil {
+				mu.Lock()
+				uploaded = append(uploaded, attachment)
+				mu.Unlock()
+			} else if !errors.Is(err, ErrQuota) {
+				t.Error(err)
+			}
+		}()
+	}
+	wg.Wait()
+
+	if len(uploaded) != 2 || repo.used[user] != 200 {
+		t.Fatalf("%d uploads using %d bytes, want 2 using 200", len(uploaded), repo.used[user])
+	}
+
+	// removing an attachment gives its size back.
+	if err := svc.Remove(uploaded[0], ctx); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := svc.Upload(note, user.Hex(), "more.txt", strings.NewReader(strings.Repeat("c", 100)), ctx); err != nil {
+		t.Errorf("Upload after Remove = %v", err)
+	}
+
+	if err := svc.NoteDeleted(note, ctx); err != nil {
+		t.Fatal(err)
+	}
+	if repo.used[user] != 0 {
+		t.Errorf("%d bytes used after the note was deleted, want 0", repo.used[user])
+	}
+}
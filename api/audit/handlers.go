@@ -0,0 +1,140 @@
+package audit
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 500
+)
+
+// Admins tells the administrators apart, they read the audit log of every user.
+type Admins interface {
+	IsAdmin(userId string, ctx context.Context) bool
+}
+
+// HandleMine returns the entries concerning the user: their own actions and the actions of the
+// others on them, like sharing a note with them. The address and the browser of the others
+// are left out. See parseFilter for the filters.
+func HandleMine(logger logger.Logger, repo AuditRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		filter, problems := parseFilter(r.URL.Query())
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+		filter.UserID = userId
+
+		entries, err := repo.Find(filter, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("audit issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		for _, entry := range entries {
+			if entry.ActorID != userId {
+				entry.IP, entry.ForwardedFor, entry.UserAgent = "", "", ""
+			}
+		}
+
+		response.Respond(w, entries, http.StatusOK)
+	})
+}
+
+// HandleAll returns the entries of every user for the admins, ?user_id= keeps the ones concerning
+// a user. Reading the log is recorded in it.
+func HandleAll(logger logger.Logger, repo AuditRepository, admins Admins, recorder Recorder) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		if !admins.IsAdmin(userId, r.Context()) {
+			response.RespondErr(w, response.Forbidden())
+			return
+		}
+
+		filter, problems := parseFilter(r.URL.Query())
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+		filter.UserID = r.URL.Query().Get("user_id")
+
+		entries, err := repo.Find(filter, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("audit issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		recorder.Record(Entry{
+			Action:     AdminAuditRead,
+			Users:      []string{filter.UserID},
+			TargetType: "audit_log",
+			TargetID:   filter.UserID,
+			Details:    map[string]string{"query": r.URL.RawQuery},
+		}, r.Context())
+
+		response.Respond(w, entries, http.StatusOK)
+	})
+}
+
+// parseFilter reads the filters of the query: action (comma separated), actor_id, target_type,
+// target_id, since and until (RFC 3339), before (an entry id, for the next page) and limit.
+func parseFilter(query url.Values) (Filter, map[string]string) {
+	filter := Filter{
+		ActorID:    query.Get("actor_id"),
+		TargetType: query.Get("target_type"),
+		TargetID:   query.Get("target_id"),
+		Limit:      defaultLimit,
+	}
+	problems := map[string]string{}
+
+	if actions := query.Get("action"); actions != "" {
+		for _, action := range strings.Split(actions, ",") {
+			filter.Actions = append(filter.Actions, Action(strings.TrimSpace(action)))
+		}
+	}
+
+	for name, at := range map[string]*time.Time{"since": &filter.Since, "until": &filter.Until} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				problems[name] = "date"
+				continue
+			}
+			*at = parsed
+		}
+	}
+
+	if value := query.Get("before"); value != "" {
+		before, err := primitive.ObjectIDFromHex(value)
+		if err != nil {
+			problems["before"] = "id"
+		}
+		filter.Before = before
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxLimit {
+			problems["limit"] = "between:1," + strconv.Itoa(maxLimit)
+		}
+		filter.Limit = int64(limit)
+	}
+
+	return filter, problems
+}
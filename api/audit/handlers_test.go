@@ -0,0 +1,66 @@
+package audit
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http/httptest"
+	"testing"
+
+	"memo/pkg/logger"
+)
+
+// memRepo returns its entries to any filter.
+type memRepo struct {
+	entries []*Entry
+}
+
+func (r *memRepo) Insert(entry *Entry, ctx context.Context) error {
+	r.entries = append(r.entries, entry)
+	return nil
+}
+
+func (r *memRepo) Find(filter Filter, ctx context.Context) ([]*Entry, error) {
+	entries := []*Entry{}
+	for _, entry := range r.entries {
+		copied := *entry
+		entries = append(entries, &copied)
+	}
+	return entries, nil
+}
+
+func TestHandleMineHidesTheClientOfOthers(t *testing.T) {
+	repo := &memRepo{}
+	for _, actor := range []string{"me", "other", ""} {
+		repo.Insert(&Entry{
+			Action:       NoteShared,
+			ActorID:      actor,
+			Users:        []string{"me"},
+			IP:           "192.0.2.1",
+			ForwardedFor: "198.51.100.7",
+			UserAgent:    "browser",
+		}, context.Background())
+	}
+
+	r := httptest.NewRequest("GET", "/api/v1/audit", nil)
+	r = r.WithContext(context.WithValue(r.Context(), "user", "me"))
+	w := httptest.NewRecorder()
+
+	HandleMine(logger.New(io.Discard, logger.Config{}), repo).ServeHTTP(w, r)
+
+	var entries []Entry
+	if err := json.NewDecoder(w.Body).Decode(&entries); err != nil {
+		t.Fatalf("status %d: %s", w.Code, err)
+	}
+
+	if len(entries) != 3 {
+		t.Fatalf("%d entries, want 3", len(entries))
+	}
+
+	for _, entry := range entries {
+		mine := entry.ActorID == "me"
+		if got := entry.IP != "" && entry.ForwardedFor != "" && entry.UserAgent != ""; got != mine {
+			t.Errorf("entry of %q: ip %q, forwarded for %q, user agent %q", entry.ActorID, entry.IP, entry.ForwardedFor, entry.UserAgent)
+		}
+	}
+}
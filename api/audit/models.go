@@ -0,0 +1,62 @@
+package audit
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+type Action string
+
+const (
+	Login         Action = "auth.login"
+	LoginFailed   Action = "auth.login_failed"
+	Registered    Action = "auth.registered"
+	TokenCreated  Action = "token.created"
+	TokenRevoked  Action = "token.revoked"
+	ProfileUpdate Action = "profile.updated"
+
+	NoteShared            Action = "note.shared"
+	NotePermissionChanged Action = "note.permission_changed"
+	NoteUnshared          Action = "note.unshared"
+	NoteInvited           Action = "note.invited"
+	NoteTransferred       Action = "note.transferred"
+	NoteDeleted           Action = "note.deleted"
+
+	// AdminAuditRead is an admin reading the audit log of other users.
+	AdminAuditRead Action = "admin.audit_read"
+)
+
+// Entry records an action, it's never changed once stored.
+type Entry struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Action Action             `bson:"action" json:"action"`
+	// ActorID is the user who did the action, empty for a failed login.
+	ActorID string `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	// Users are the users concerned by the action, the actor and the users it targets. The entry is
+	// in their audit log.
+	Users      []string          `bson:"users" json:"-"`
+	TargetType string            `bson:"target_type,omitempty" json:"target_type,omitempty"`
+	TargetID   string            `bson:"target_id,omitempty" json:"target_id,omitempty"`
+	Details    map[string]string `bson:"details,omitempty" json:"details,omitempty"`
+	IP         string            `bson:"ip" json:"ip,omitempty"`
+	// ForwardedFor is the X-Forwarded-For header, the client when the api is behind a proxy.
+	ForwardedFor string    `bson:"forwarded_for,omitempty" json:"forwarded_for,omitempty"`
+	UserAgent    string    `bson:"user_agent" json:"user_agent,omitempty"`
+	CreatedAt    time.Time `bson:"created_at" json:"created_at"`
+}
+
+// Filter selects entries of the audit log, newest first. Zero fields don't filter.
+type Filter struct {
+	// UserID keeps the entries concerning a user.
+	UserID     string
+	ActorID    string
+	Actions    []Action
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+	// Before pages through the log, only the entries older than this one are returned.
+	Before primitive.ObjectID
+	Limit  int64
+}
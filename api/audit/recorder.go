@@ -0,0 +1,73 @@
+package audit
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"time"
+
+	"memo/pkg/logger"
+)
+
+// Recorder appends entries to the audit log, the subsystems record their actions through it.
+// The actor, the IP and the user agent are taken from ctx when the entry leaves them out.
+type Recorder interface {
+	Record(entry Entry, ctx context.Context)
+}
+
+type requestKey struct{}
+
+type request struct {
+	ip           string
+	forwardedFor string
+	userAgent    string
+}
+
+// Middleware keeps the client of the request in its context for the entries recorded meanwhile.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ip, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			ip = r.RemoteAddr
+		}
+
+		client := request{ip: ip, forwardedFor: r.Header.Get("X-Forwarded-For"), userAgent: r.UserAgent()}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestKey{}, client)))
+	})
+}
+
+// Log stores the entries. Recording never fails the action, the errors are logged.
+type Log struct {
+	logger logger.Logger
+	repo   AuditRepository
+}
+
+func NewLog(logger logger.Logger, repo AuditRepository) *Log {
+	return &Log{logger, repo}
+}
+
+func (l *Log) Record(entry Entry, ctx context.Context) {
+	if entry.ActorID == "" {
+		entry.ActorID, _ = ctx.Value("user").(string)
+	}
+
+	if client, ok := ctx.Value(requestKey{}).(request); ok {
+		entry.IP, entry.ForwardedFor, entry.UserAgent = client.ip, client.forwardedFor, client.userAgent
+	}
+
+	users := []string{}
+	seen := map[string]bool{}
+	for _, userId := range append([]string{entry.ActorID}, entry.Users...) {
+		if userId != "" && !seen[userId] {
+			seen[userId] = true
+			users = append(users, userId)
+		}
+	}
+	entry.Users = users
+
+	entry.CreatedAt = time.Now()
+
+	if err := l.repo.Insert(&entry, ctx); err != nil {
+		l.logger.For(ctx).Error("audit issue", "error", err)
+	}
+}
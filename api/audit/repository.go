@@ -0,0 +1,78 @@
+package audit
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// AuditRepository only appends entries, they can't be changed or deleted through it.
+type AuditRepository interface {
+	Insert(entry *Entry, ctx context.Context) error
+	Find(filter Filter, ctx context.Context) ([]*Entry, error)
+}
+
+type auditRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) AuditRepository {
+	return &auditRepository{client}
+}
+
+func (r *auditRepository) Insert(entry *Entry, ctx context.Context) error {
+	_, err := r.client.Collection("audit_log").InsertOne(ctx, entry)
+	return err
+}
+
+func (r *auditRepository) Find(filter Filter, ctx context.Context) ([]*Entry, error) {
+	query := bson.M{}
+	if filter.UserID != "" {
+		query["users"] = filter.UserID
+	}
+	if filter.ActorID != "" {
+		query["actor_id"] = filter.ActorID
+	}
+	if len(filter.Actions) > 0 {
+		query["action"] = bson.M{"$in": filter.Actions}
+	}
+	if filter.TargetType != "" {
+		query["target_type"] = filter.TargetType
+	}
+	if filter.TargetID != "" {
+		query["target_id"] = filter.TargetID
+	}
+
+	created := bson.M{}
+	if !filter.Since.IsZero() {
+		created["$gte"] = filter.Since
+	}
+	if !filter.Until.IsZero() {
+		created["$lt"] = filter.Until
+	}
+	if len(created) > 0 {
+		query["created_at"] = created
+	}
+
+	if !filter.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": filter.Before}
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(filter.Limit)
+
+	cursor, err := r.client.Collection("audit_log").Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	entries := []*Entry{}
+	if err = cursor.All(ctx, &entries); err != nil {
+		return nil, err
+	}
+
+	return entries, nil
+}
@@ -1,17 +1,23 @@
 package auth
 
 import (
-	"fmt"
+	"context"
+	"errors"
+	"io/fs"
 	"net/http"
 	"os"
+	"strconv"
 	"strings"
 
+	"memo/api/audit"
+	"memo/pkg/avatar"
+	"memo/pkg/logger"
 	"memo/pkg/response"
 	"memo/pkg/upload"
 	"memo/pkg/validation"
 )
 
-func HandleLogin(store AuthStore) http.HandlerFunc {
+func HandleLogin(store AuthStore, recorder audit.Recorder) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data, problems := validation.DecodeValid[*loginRequest](r)
 		if len(problems) > 0 {
@@ -20,8 +26,17 @@ func HandleLogin(store AuthStore) http.HandlerFunc {
 		}
 
 		if token, err := store.Authenticate(data, r.Context()); err != nil {
+			// the failed logins are in the audit log of the account, when there's one.
+			failure := audit.Entry{Action: audit.LoginFailed, Details: map[string]string{"email": data.Email}}
+			if u, err := store.GetUserByEmail(data.Email, r.Context()); err == nil {
+				failure.Users = []string{u.ID.Hex()}
+				failure.TargetType, failure.TargetID = "user", u.ID.Hex()
+			}
+			recorder.Record(failure, r.Context())
+
 			response.ErrMessage(w, "Can't login", http.StatusUnauthorized)
 		} else {
+			recordToken(recorder, audit.Login, token, r.Context())
 			response.Respond(w, token, http.StatusOK)
 		}
 	})
@@ -39,8 +54,20 @@ func HandleProfile(store AuthStore) http.HandlerFunc {
 	})
 }
 
-func HandleProfileUpdate(store AuthStore) http.HandlerFunc {
+func HandleProfileUpdate(logger logger.Logger, store AuthStore, avatars avatar.Config, recorder audit.Recorder) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fu := upload.NewUpload(w, r, "image")
+
+		fu.SetMaxSize(1 * 1000 * 1000) // 1Mb
+		fu.SetAllowedTypes("png", "jpg")
+		fu.SetMaxDimensions(2048, 2048)
+
+		// the form is parsed with the upload size limit, before reading any field.
+		if err := fu.Parse(); err != nil && err != http.ErrNotMultipart {
+			response.ErrMessage(w, "Can't upload image", http.StatusRequestEntityTooLarge)
+			return
+		}
+
 		name := r.FormValue("name")
 		if strings.TrimSpace(name) == "" {
 			response.ValidationErr(w, map[string]string{"name": "required"})
@@ -56,39 +83,73 @@ func HandleProfileUpdate(store AuthStore) http.HandlerFunc {
 
 		u.Name = name
 
-		fu := upload.NewUpload(r, "image")
-
-		fu.SetMaxSize(1 * 1000 * 1000) // 1Mb
-		fu.SetAllowedTypes("png", "jpg")
+		// the upload is only the source of the avatar variants, it's removed once they're generated.
+		file, err := fu.ValidateAndUpload(os.TempDir())
+		if errors.Is(err, upload.ErrTooLarge) || errors.Is(err, upload.ErrType) || errors.Is(err, upload.ErrDimensions) {
+			response.ValidationErr(w, map[string]string{"image": err.Error()})
+			return
+		}
 
-		file, err := fu.ValidateAndUpload("public/images")
-		if err != nil && err != http.ErrMissingFile {
+		if err != nil && err != http.ErrMissingFile && err != http.ErrNotMultipart {
+			logger.For(r.Context()).Error("profile image upload issue", "error", err)
 			response.ErrMessage(w, "Can't upload image", http.StatusNotFound)
 			return
 		}
 
+		oldImage, oldAvatar := u.Image, u.Avatar
+
 		if file != nil {
-			// delete old image
-			if u.Image != "" {
-				if err := os.Remove(u.Image); err != nil {
-					fmt.Println("Image was not deleted.")
-				}
+			variants, err := avatar.Generate(file.Name, u.ID.Hex(), avatars)
+			if err := os.Remove(file.Name); err != nil {
+				logger.For(r.Context()).Error("profile image upload was not deleted", "error", err)
+			}
+
+			if err != nil {
+				logger.For(r.Context()).Error("avatar issue", "error", err)
+				response.ErrMessage(w, "Can't upload image", http.StatusBadRequest)
+				return
 			}
 
-			u.Image = file.Name
+			u.Avatar = variants
+			u.Image = avatar.Largest(variants)
 		}
 
 		err = store.UpdateUserInfo(u, r.Context())
 		if err != nil {
+			if file != nil {
+				avatar.Remove(u.Avatar, oldAvatar...)
+			}
+
 			response.ErrMessage(w, "User not updated", http.StatusBadRequest)
 			return
 		}
 
-		response.Respond(w, map[string]string{"name": u.Name, "image": u.Image}, http.StatusOK)
+		// delete the old images once the user points to the new ones.
+		if file != nil {
+			if err := avatar.Remove(oldAvatar, u.Avatar...); err != nil {
+				logger.For(r.Context()).Error("old avatar was not deleted", "error", err)
+			}
+
+			// images uploaded before the avatar variants were stored as a single file.
+			if len(oldAvatar) == 0 && strings.HasPrefix(oldImage, "public/images/") {
+				if err := os.Remove(oldImage); err != nil && !errors.Is(err, fs.ErrNotExist) {
+					logger.For(r.Context()).Error("old image was not deleted", "error", err)
+				}
+			}
+		}
+
+		recorder.Record(audit.Entry{
+			Action:     audit.ProfileUpdate,
+			TargetType: "user",
+			TargetID:   userId,
+			Details:    map[string]string{"name": u.Name, "image": strconv.FormatBool(file != nil)},
+		}, r.Context())
+
+		response.Respond(w, map[string]any{"name": u.Name, "image": u.Image, "avatar": u.Avatar}, http.StatusOK)
 	})
 }
 
-func HandleRegister(store AuthStore) http.HandlerFunc {
+func HandleRegister(store AuthStore, recorder audit.Recorder) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		data, problems := validation.DecodeValid[*registerRequest](r)
 		if len(problems) > 0 {
@@ -104,19 +165,27 @@ func HandleRegister(store AuthStore) http.HandlerFunc {
 		if token, err := store.Authenticate(data.AsLogin(), r.Context()); err != nil {
 			response.ErrMessage(w, "Couldn't create token", http.StatusUnauthorized)
 		} else {
+			recordToken(recorder, audit.Registered, token, r.Context())
 			response.Respond(w, token, http.StatusOK)
 		}
 	})
 }
 
-func HandleLogout(store AuthStore) http.HandlerFunc {
+func HandleLogout(store AuthStore, recorder audit.Recorder) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userId := r.Context().Value("user").(string)
 
 		if err := store.DeleteToken(userId, r.Context()); err != nil {
 			response.ErrMessage(w, "Can't logout", http.StatusNotModified)
 		} else {
+			recorder.Record(audit.Entry{Action: audit.TokenRevoked, TargetType: "user", TargetID: userId}, r.Context())
 			response.Respond(w, map[string]any{"message": "Logged out"}, http.StatusOK)
 		}
 	})
 }
+
+// recordToken records a login or a registration, and the token it created.
+func recordToken(recorder audit.Recorder, action audit.Action, token *registerResponse, ctx context.Context) {
+	recorder.Record(audit.Entry{Action: action, ActorID: token.UserID, TargetType: "user", TargetID: token.UserID}, ctx)
+	recorder.Record(audit.Entry{Action: audit.TokenCreated, ActorID: token.UserID, TargetType: "token", TargetID: token.TokenID}, ctx)
+}
@@ -2,6 +2,7 @@ package auth
 
 import (
 	"context"
+	"memo/pkg/logger"
 	"memo/pkg/response"
 	"net/http"
 	"strings"
@@ -19,6 +20,11 @@ func (m *AuthMiddleware) Handle(pattern string, handler http.HandlerFunc) {
 func (m *AuthMiddleware) use(handler http.HandlerFunc) http.HandlerFunc {
 	return func(w http.ResponseWriter, r *http.Request) {
 		auth := r.Header.Get("Authorization")
+		// EventSource and WebSocket can't send headers, event streams and websockets can pass the token in the url.
+		if token := r.URL.Query().Get("access_token"); auth == "" && token != "" && streaming(r) {
+			auth = "Bearer " + token
+		}
+
 		parts := strings.Split(auth, " ")
 		if len(parts) < 2 {
 			response.RespondErr(w, response.Unauthorized())
@@ -30,8 +36,13 @@ func (m *AuthMiddleware) use(handler http.HandlerFunc) http.HandlerFunc {
 			response.RespondErr(w, response.Unauthorized())
 		} else {
 			r = r.WithContext(context.WithValue(r.Context(), "user", userId))
+			logger.SetUser(r.Context(), userId)
 
 			handler(w, r)
 		}
 	}
 }
+
+func streaming(r *http.Request) bool {
+	return r.Header.Get("Accept") == "text/event-stream" || strings.EqualFold(r.Header.Get("Upgrade"), "websocket")
+}
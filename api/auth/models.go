@@ -2,6 +2,8 @@ package auth
 
 import (
 	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/pkg/avatar"
 )
 
 type (
@@ -17,6 +19,9 @@ type (
 		Name     string             `json:"name" bson:"name"`
 		Email    string             `json:"email" bson:"email"`
 		Image    string             `json:"image" bson:"image"`
+		Avatar   []avatar.Variant   `json:"avatar" bson:"avatar,omitempty"`
 		Password string             `json:"-" bson:"password"`
+		// Admin users read the audit log of everyone, the flag is set in the database.
+		Admin bool `json:"admin" bson:"admin,omitempty"`
 	}
 )
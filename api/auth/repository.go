@@ -50,6 +50,7 @@ func (r *authRepository) UpdateUserInfo(user *AuthUser, ctx context.Context) err
 
 	update["$set"].(bson.M)["name"] = user.Name
 	update["$set"].(bson.M)["image"] = user.Image
+	update["$set"].(bson.M)["avatar"] = user.Avatar
 
 	_, err := r.client.Collection("users").UpdateOne(ctx, filter, update)
 	return err
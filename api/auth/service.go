@@ -25,6 +25,10 @@ type (
 	}
 
 	registerResponse struct {
+		UserID string `json:"-"`
+		// TokenID is the id part of the token.
+		TokenID string `json:"-"`
+
 		Name  string `json:"name"`
 		Email string `json:"email"`
 		Token string `json:"token"`
@@ -45,8 +49,10 @@ type AuthStore interface {
 	CreateUser(*registerRequest, context.Context) error
 	DeleteToken(string, context.Context) error
 	GetUserById(id string, ctx context.Context) (*AuthUser, error)
+	GetUserByEmail(email string, ctx context.Context) (*AuthUser, error)
 	Authenticate(request *loginRequest, ctx context.Context) (*registerResponse, error)
 	UpdateUserInfo(u *AuthUser, ctx context.Context) error
+	IsAdmin(userId string, ctx context.Context) bool
 }
 
 func NewStore(repository AuthRepository) AuthStore {
@@ -57,6 +63,10 @@ func (s *authStore) GetUserById(id string, ctx context.Context) (*AuthUser, erro
 	return s.repository.FindUserById(id, ctx)
 }
 
+func (s *authStore) GetUserByEmail(email string, ctx context.Context) (*AuthUser, error) {
+	return s.repository.FindUserByEmail(email, ctx)
+}
+
 func (s *authStore) CreateUser(req *registerRequest, ctx context.Context) error {
 	hash, err := security.HashPassword(req.Password)
 	if err != nil {
@@ -113,10 +123,12 @@ func (s *authStore) Authenticate(request *loginRequest, ctx context.Context) (*r
 
 	// expires_at: time.Now(),
 	return &registerResponse{
-		Name:  u.Name,
-		Email: u.Email,
-		Image: u.Image,
-		Token: fmt.Sprintf("%s|%s", lastId, tok.Plain),
+		UserID:  u.ID.Hex(),
+		TokenID: lastId,
+		Name:    u.Name,
+		Email:   u.Email,
+		Image:   u.Image,
+		Token:   fmt.Sprintf("%s|%s", lastId, tok.Plain),
 	}, nil
 }
 
@@ -127,3 +139,8 @@ func (s *authStore) DeleteToken(token string, ctx context.Context) error {
 func (s *authStore) UpdateUserInfo(u *AuthUser, ctx context.Context) error {
 	return s.repository.UpdateUserInfo(u, ctx)
 }
+
+func (s *authStore) IsAdmin(userId string, ctx context.Context) bool {
+	u, err := s.repository.FindUserById(userId, ctx)
+	return err == nil && u.Admin
+}
@@ -0,0 +1,26 @@
+package authz
+
+import (
+	"net/http"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/response"
+)
+
+// Authorize returns the note of the {id} path value, or answers the request when it's not found
+// or when the user isn't allowed to do action with it.
+func Authorize(w http.ResponseWriter, r *http.Request, notes repository.NotesRepository, userId string, action Action) (*models.EmbeddedNote, bool) {
+	note, err := notes.GetById(r.PathValue("id"), r.Context())
+	if err != nil {
+		response.RespondErr(w, response.NotFound())
+		return nil, false
+	}
+
+	if !Can(note, userId, action) {
+		response.ErrMessage(w, Message(action), http.StatusForbidden)
+		return nil, false
+	}
+
+	return note, true
+}
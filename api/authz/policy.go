@@ -0,0 +1,137 @@
+// Package authz decides what a user can do with a note, from its ownership, its shares and the
+// role of the user in its workspace.
+package authz
+
+import (
+	"memo/api/notes/models"
+)
+
+// Level is the access of a user to a note, each level allows what the lower ones do.
+type Level int
+
+const (
+	None Level = iota
+	Read
+	Comment
+	Write
+	Manage
+	Owner
+)
+
+// Action is something done with a note.
+type Action string
+
+const (
+	View      Action = "view"
+	CommentOn Action = "comment"
+	// Edit changes the note, ticking, adding and removing the tasks of a todo note included.
+	Edit Action = "edit"
+	// Share shares the note with other users, reshares for the collaborators who manage it.
+	Share    Action = "share"
+	Delete   Action = "delete"
+	Transfer Action = "transfer"
+)
+
+// policy is the level each action needs.
+var policy = map[Action]Level{
+	View:      Read,
+	CommentOn: Comment,
+	Edit:      Write,
+	Share:     Manage,
+	Delete:    Owner,
+	Transfer:  Owner,
+}
+
+// permissions is the level given by each share permission.
+var permissions = map[models.Permission]Level{
+	models.PermissionRead:    Read,
+	models.PermissionComment: Comment,
+	models.PermissionWrite:   Write,
+	models.PermissionManage:  Manage,
+}
+
+// roles is the level given by each workspace role.
+var roles = map[models.Role]Level{
+	models.RoleViewer: Read,
+	models.RoleEditor: Write,
+	models.RoleAdmin:  Manage,
+	models.RoleOwner:  Manage,
+}
+
+// LevelOf returns the access of the user to the note, the highest of its ownership, its share
+// and its workspace role.
+func LevelOf(note *models.EmbeddedNote, userId string) Level {
+	if note == nil || userId == "" {
+		return None
+	}
+
+	if note.OwnedBy(userId) {
+		return Owner
+	}
+
+	level := None
+	for _, shared := range note.SharedWith {
+		if shared.UserID.Hex() == userId {
+			level = max(level, permissions[shared.Permission])
+		}
+	}
+
+	if role, ok := note.Role(userId); ok {
+		level = max(level, roles[role])
+	}
+
+	return level
+}
+
+// Can reports whether the user is allowed to do action with the note.
+func Can(note *models.EmbeddedNote, userId string, action Action) bool {
+	required, ok := policy[action]
+	if !ok {
+		return false
+	}
+
+	return LevelOf(note, userId) >= required
+}
+
+// Grantable reports whether permission is one of the share permissions.
+func Grantable(permission models.Permission) bool {
+	_, ok := permissions[permission]
+	return ok
+}
+
+// CanGrant reports whether the user shares the note with the permission: the owner grants any
+// permission, the collaborators who manage it grant the lower ones.
+func CanGrant(note *models.EmbeddedNote, userId string, permission models.Permission) bool {
+	granted, ok := permissions[permission]
+	if !ok || !Can(note, userId, Share) {
+		return false
+	}
+
+	return LevelOf(note, userId) > granted
+}
+
+// CanManage reports whether the user changes the access of the collaborator: the owner manages
+// everyone, the managers manage the collaborators below them.
+func CanManage(note *models.EmbeddedNote, userId, collaborator string) bool {
+	return Can(note, userId, Share) && LevelOf(note, userId) > LevelOf(note, collaborator)
+}
+
+// CanRevoke reports whether the user removes the collaborator of the note, everyone can leave a note.
+func CanRevoke(note *models.EmbeddedNote, userId, collaborator string) bool {
+	return userId == collaborator || CanManage(note, userId, collaborator)
+}
+
+// verbs words the actions in the messages of the denied requests.
+var verbs = map[Action]string{
+	View:      "access",
+	CommentOn: "comment on",
+	Edit:      "edit",
+	Share:     "share",
+	Delete:    "delete",
+	Transfer:  "transfer",
+}
+
+// Message returns the error shown when the user isn't allowed to do action.
+func Message(action Action) string {
+	return "You don't have permission to " + verbs[action] + " this note"
+}
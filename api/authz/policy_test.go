@@ -0,0 +1,172 @@
+package authz
+
+import (
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+)
+
+var actions = []Action{View, CommentOn, Edit, Share, Delete, Transfer}
+
+// testNote returns a note with a user per share permission and per workspace role, and a user
+// given both a share and a role.
+func testNote() (*models.EmbeddedNote, map[string]string) {
+	users := map[string]string{}
+	id := func(name string) primitive.ObjectID {
+		oId := primitive.NewObjectID()
+		users[name] = oId.Hex()
+		return oId
+	}
+
+	note := &models.EmbeddedNote{BaseNote: models.BaseNote{UserId: id("owner")}}
+
+	for _, permission := range []models.Permission{models.PermissionRead, models.PermissionComment, models.PermissionWrite, models.PermissionManage} {
+		note.SharedWith = append(note.SharedWith, models.SharedUser{UserID: id("share " + string(permission)), Permission: permission})
+	}
+
+	for _, role := range []models.Role{models.RoleViewer, models.RoleEditor, models.RoleAdmin, models.RoleOwner} {
+		note.Members = append(note.Members, models.Member{UserID: id("role " + string(role)), Role: role})
+	}
+
+	// the highest of both counts.
+	both := id("comment share and editor role")
+	note.SharedWith = append(note.SharedWith, models.SharedUser{UserID: both, Permission: models.PermissionComment})
+	note.Members = append(note.Members, models.Member{UserID: both, Role: models.RoleEditor})
+
+	id("stranger")
+
+	return note, users
+}
+
+func TestCan(t *testing.T) {
+	note, users := testNote()
+
+	tests := []struct {
+		user    string
+		level   Level
+		allowed []Action
+	}{
+		{"owner", Owner, []Action{View, CommentOn, Edit, Share, Delete, Transfer}},
+		{"share read", Read, []Action{View}},
+		{"share comment", Comment, []Action{View, CommentOn}},
+		{"share write", Write, []Action{View, CommentOn, Edit}},
+		{"share manage", Manage, []Action{View, CommentOn, Edit, Share}},
+		{"role viewer", Read, []Action{View}},
+		{"role editor", Write, []Action{View, CommentOn, Edit}},
+		{"role admin", Manage, []Action{View, CommentOn, Edit, Share}},
+		{"role owner", Manage, []Action{View, CommentOn, Edit, Share}},
+		{"comment share and editor role", Write, []Action{View, CommentOn, Edit}},
+		{"stranger", None, nil},
+	}
+
+	for _, test := range tests {
+		t.Run(test.user, func(t *testing.T) {
+			userId := users[test.user]
+
+			if level := LevelOf(note, userId); level != test.level {
+				t.Errorf("LevelOf = %d, want %d", level, test.level)
+			}
+
+			allowed := map[Action]bool{}
+			for _, action := range test.allowed {
+				allowed[action] = true
+			}
+
+			for _, action := range actions {
+				if got := Can(note, userId, action); got != allowed[action] {
+					t.Errorf("Can(%s) = %t, want %t", action, got, allowed[action])
+				}
+			}
+		})
+	}
+}
+
+func TestCanWithoutNoteOrUser(t *testing.T) {
+	note, users := testNote()
+
+	for _, action := range actions {
+		if Can(nil, users["owner"], action) {
+			t.Errorf("Can(%s) on no note", action)
+		}
+		if Can(note, "", action) {
+			t.Errorf("Can(%s) without a user", action)
+		}
+	}
+
+	if Can(note, users["owner"], Action("archive")) {
+		t.Error("Can allows an unknown action")
+	}
+}
+
+func TestCanGrant(t *testing.T) {
+	note, users := testNote()
+
+	tests := []struct {
+		user    string
+		granted []models.Permission
+	}{
+		{"owner", []models.Permission{models.PermissionRead, models.PermissionComment, models.PermissionWrite, models.PermissionManage}},
+		{"share manage", []models.Permission{models.PermissionRead, models.PermissionComment, models.PermissionWrite}},
+		{"role admin", []models.Permission{models.PermissionRead, models.PermissionComment, models.PermissionWrite}},
+		{"share write", nil},
+		{"role editor", nil},
+		{"share read", nil},
+		{"stranger", nil},
+	}
+
+	for _, test := range tests {
+		granted := map[models.Permission]bool{}
+		for _, permission := range test.granted {
+			granted[permission] = true
+		}
+
+		for permission := range permissions {
+			if got := CanGrant(note, users[test.user], permission); got != granted[permission] {
+				t.Errorf("%s: CanGrant(%s) = %t, want %t", test.user, permission, got, granted[permission])
+			}
+		}
+
+		if CanGrant(note, users[test.user], models.Permission("owner")) {
+			t.Errorf("%s: CanGrant grants a permission that doesn't exist", test.user)
+		}
+	}
+}
+
+func TestCanManageAndRevoke(t *testing.T) {
+	note, users := testNote()
+
+	tests := []struct {
+		user, collaborator string
+		manage             bool
+	}{
+		{"owner", "share manage", true},
+		{"owner", "role admin", true},
+		{"share manage", "share write", true},
+		{"share manage", "role editor", true},
+		{"share manage", "role admin", false},
+		{"role admin", "share manage", false},
+		{"share manage", "owner", false},
+		{"share write", "share read", false},
+		{"stranger", "share read", false},
+	}
+
+	for _, test := range tests {
+		user, collaborator := users[test.user], users[test.collaborator]
+
+		if got := CanManage(note, user, collaborator); got != test.manage {
+			t.Errorf("CanManage(%s, %s) = %t, want %t", test.user, test.collaborator, got, test.manage)
+		}
+		if got := CanRevoke(note, user, collaborator); got != test.manage {
+			t.Errorf("CanRevoke(%s, %s) = %t, want %t", test.user, test.collaborator, got, test.manage)
+		}
+	}
+
+	// everyone can leave a note.
+	for name, userId := range users {
+		if !CanRevoke(note, userId, userId) {
+			t.Errorf("%s can't leave the note", name)
+		}
+	}
+}
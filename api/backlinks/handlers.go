@@ -0,0 +1,91 @@
+package backlinks
+
+import (
+	"net/http"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/authz"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+func HandleBacklinks(logger logger.Logger, notes repository.NotesRepository, repo LinkRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		links, err := repo.ListByTarget(note.ID, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("backlinks issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		ids := []primitive.ObjectID{}
+		kinds := make(map[primitive.ObjectID]string)
+		for _, link := range links {
+			ids = append(ids, link.SourceID)
+			kinds[link.SourceID] = link.Kind
+		}
+
+		backlinks := []Backlink{}
+		if len(ids) == 0 {
+			response.Respond(w, backlinks, http.StatusOK)
+			return
+		}
+
+		sources, err := repo.FindNotes(ids, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("backlinks issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		// the linking notes are only listed when the caller can read them.
+		for _, source := range sources {
+			if !authz.Can(source, userId, authz.View) {
+				continue
+			}
+
+			backlinks = append(backlinks, Backlink{
+				NoteID: source.ID,
+				Title:  source.Title,
+				Type:   source.Type,
+				Kind:   kinds[source.ID],
+			})
+		}
+
+		response.Respond(w, backlinks, http.StatusOK)
+	})
+}
+
+func HandleDanglingLinks(logger logger.Logger, repo LinkRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId, err := primitive.ObjectIDFromHex(r.Context().Value("user").(string))
+		if err != nil {
+			response.RespondErr(w, response.Unauthorized())
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		if status != "" && status != StatusDangling && status != StatusUnresolved {
+			response.ValidationErr(w, map[string]string{"status": "in:" + StatusDangling + "," + StatusUnresolved})
+			return
+		}
+
+		links, err := repo.ListPending(userId, status, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("dangling links issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, links, http.StatusOK)
+	})
+}
@@ -0,0 +1,34 @@
+package backlinks
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	StatusResolved   = "resolved"
+	StatusUnresolved = "unresolved" // no readable note matches the link
+	StatusDangling   = "dangling"   // the linked note was deleted
+)
+
+type Link struct {
+	ID           primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	SourceID     primitive.ObjectID  `bson:"source_id" json:"source_id"`
+	SourceUserID primitive.ObjectID  `bson:"source_user_id" json:"-"`
+	Kind         string              `bson:"kind" json:"kind"`
+	Status       string              `bson:"status" json:"status"`
+	TargetID     *primitive.ObjectID `bson:"target_id" json:"target_id"`
+	TargetTitle  string              `bson:"target_title" json:"target_title"`
+	TargetKey    string              `bson:"target_key" json:"-"`
+	// DeletedTargetID is kept on dangling links so they can be listed with the note they pointed to.
+	DeletedTargetID *primitive.ObjectID `bson:"deleted_target_id,omitempty" json:"deleted_target_id,omitempty"`
+	CreatedAt       time.Time           `bson:"created_at" json:"created_at"`
+}
+
+type Backlink struct {
+	NoteID primitive.ObjectID `json:"note_id"`
+	Title  string             `json:"title"`
+	Type   string             `json:"type"`
+	Kind   string             `json:"kind"`
+}
@@ -0,0 +1,74 @@
+package backlinks
+
+import (
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	KindWiki = "wiki" // [[Note title]] or [[Note title|label]]
+	KindID   = "id"   // [[<note id>]] or note://<note id>
+)
+
+var (
+	wikiLink = regexp.MustCompile(`\[\[([^\[\]|\n]+)(\|[^\[\]\n]*)?\]\]`)
+	noteURL  = regexp.MustCompile(`note://([0-9a-fA-F]{24})\b`)
+)
+
+type Ref struct {
+	Kind  string
+	Title string
+	ID    primitive.ObjectID
+}
+
+// Parse returns the links found in content, each target only once.
+func Parse(content string) []Ref {
+	refs := []Ref{}
+	seen := make(map[string]bool)
+
+	add := func(ref Ref) {
+		key := ref.Kind + ":" + titleKey(ref.Title)
+		if ref.Kind == KindID {
+			key = ref.Kind + ":" + ref.ID.Hex()
+		}
+
+		if !seen[key] {
+			seen[key] = true
+			refs = append(refs, ref)
+		}
+	}
+
+	for _, m := range wikiLink.FindAllStringSubmatch(content, -1) {
+		title := strings.TrimSpace(m[1])
+		if title == "" {
+			continue
+		}
+
+		if id, err := primitive.ObjectIDFromHex(title); err == nil {
+			add(Ref{Kind: KindID, ID: id, Title: title})
+		} else {
+			add(Ref{Kind: KindWiki, Title: title})
+		}
+	}
+
+	for _, m := range noteURL.FindAllStringSubmatch(content, -1) {
+		if id, err := primitive.ObjectIDFromHex(strings.ToLower(m[1])); err == nil {
+			add(Ref{Kind: KindID, ID: id, Title: id.Hex()})
+		}
+	}
+
+	return refs
+}
+
+// RenameWikiLinks replaces the [[oldTitle]] links in content with newTitle, labels are kept.
+func RenameWikiLinks(content, oldTitle, newTitle string) string {
+	pattern := regexp.MustCompile(`(?i)\[\[\s*` + regexp.QuoteMeta(strings.TrimSpace(oldTitle)) + `\s*(\||\]\])`)
+	return pattern.ReplaceAllString(content, "[["+strings.ReplaceAll(newTitle, "$", "$$")+"$1")
+}
+
+// titleKey is used to match wiki links with note titles.
+func titleKey(title string) string {
+	return strings.ToLower(strings.Join(strings.Fields(title), " "))
+}
@@ -0,0 +1,163 @@
+package backlinks
+
+import (
+	"context"
+	"regexp"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+)
+
+type LinkRepository interface {
+	Replace(sourceId primitive.ObjectID, links []Link, ctx context.Context) error
+	DeleteBySource(sourceId primitive.ObjectID, ctx context.Context) error
+	ListByTarget(targetId primitive.ObjectID, ctx context.Context) ([]*Link, error)
+	ListPending(userId primitive.ObjectID, status string, ctx context.Context) ([]*Link, error)
+	MarkDangling(targetId primitive.ObjectID, ctx context.Context) error
+	Resolve(target *models.EmbeddedNote, readers []primitive.ObjectID, ctx context.Context) error
+	Retitle(targetId primitive.ObjectID, title string, ctx context.Context) error
+
+	FindReadableByTitle(userId primitive.ObjectID, title string, ctx context.Context) (*models.BaseNote, error)
+	FindNotes(ids []primitive.ObjectID, ctx context.Context) ([]*models.EmbeddedNote, error)
+}
+
+type linkRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) LinkRepository {
+	return &linkRepository{client}
+}
+
+func (r *linkRepository) Replace(sourceId primitive.ObjectID, links []Link, ctx context.Context) error {
+	if err := r.DeleteBySource(sourceId, ctx); err != nil {
+		return err
+	}
+
+	if len(links) == 0 {
+		return nil
+	}
+
+	docs := make([]any, len(links))
+	for i := range links {
+		docs[i] = links[i]
+	}
+
+	_, err := r.client.Collection("note_links").InsertMany(ctx, docs)
+	return err
+}
+
+func (r *linkRepository) DeleteBySource(sourceId primitive.ObjectID, ctx context.Context) error {
+	_, err := r.client.Collection("note_links").DeleteMany(ctx, bson.M{"source_id": sourceId})
+	return err
+}
+
+func (r *linkRepository) ListByTarget(targetId primitive.ObjectID, ctx context.Context) ([]*Link, error) {
+	return r.find(bson.M{"target_id": targetId, "status": StatusResolved}, ctx)
+}
+
+func (r *linkRepository) ListPending(userId primitive.ObjectID, status string, ctx context.Context) ([]*Link, error) {
+	filter := bson.M{
+		"source_user_id": userId,
+		"status":         bson.M{"$in": []string{StatusDangling, StatusUnresolved}},
+	}
+
+	if status != "" {
+		filter["status"] = status
+	}
+
+	return r.find(filter, ctx)
+}
+
+func (r *linkRepository) MarkDangling(targetId primitive.ObjectID, ctx context.Context) error {
+	filter := bson.M{"target_id": targetId}
+	update := bson.M{"$set": bson.M{
+		"status":            StatusDangling,
+		"target_id":         nil,
+		"deleted_target_id": targetId,
+	}}
+
+	_, err := r.client.Collection("note_links").UpdateMany(ctx, filter, update)
+	return err
+}
+
+// Resolve points the pending wiki links matching the title of target to it,
+// only links written by readers of the target are resolved.
+func (r *linkRepository) Resolve(target *models.EmbeddedNote, readers []primitive.ObjectID, ctx context.Context) error {
+	filter := bson.M{
+		"kind":           KindWiki,
+		"status":         bson.M{"$in": []string{StatusDangling, StatusUnresolved}},
+		"target_key":     titleKey(target.Title),
+		"source_user_id": bson.M{"$in": readers},
+		"source_id":      bson.M{"$ne": target.ID},
+	}
+
+	update := bson.M{
+		"$set":   bson.M{"status": StatusResolved, "target_id": target.ID, "target_title": target.Title},
+		"$unset": bson.M{"deleted_target_id": ""},
+	}
+
+	_, err := r.client.Collection("note_links").UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *linkRepository) Retitle(targetId primitive.ObjectID, title string, ctx context.Context) error {
+	filter := bson.M{"target_id": targetId, "kind": KindWiki}
+	update := bson.M{"$set": bson.M{"target_title": title, "target_key": titleKey(title)}}
+
+	_, err := r.client.Collection("note_links").UpdateMany(ctx, filter, update)
+	return err
+}
+
+func (r *linkRepository) FindReadableByTitle(userId primitive.ObjectID, title string, ctx context.Context) (*models.BaseNote, error) {
+	pattern := `^\s*` + strings.ReplaceAll(regexp.QuoteMeta(titleKey(title)), " ", `\s+`) + `\s*$`
+
+	filter := bson.M{
+		"title": primitive.Regex{Pattern: pattern, Options: "i"},
+		"$or":   repository.Readers(userId),
+	}
+
+	var note *models.BaseNote
+	if err := r.client.Collection("notes").FindOne(ctx, filter).Decode(&note); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+func (r *linkRepository) FindNotes(ids []primitive.ObjectID, ctx context.Context) ([]*models.EmbeddedNote, error) {
+	cursor, err := r.client.Collection("notes").Find(ctx, bson.M{"_id": bson.M{"$in": ids}})
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	notes := []*models.EmbeddedNote{}
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
+	}
+
+	return notes, nil
+}
+
+func (r *linkRepository) find(filter bson.M, ctx context.Context) ([]*Link, error) {
+	cursor, err := r.client.Collection("note_links").Find(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	links := []*Link{}
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
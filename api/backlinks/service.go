@@ -0,0 +1,165 @@
+package backlinks
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/authz"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+)
+
+const maxAttempts = 3
+
+// Indexer keeps the link graph in sync with the notes, it's registered as a notes repository hook.
+type Indexer struct {
+	repo  LinkRepository
+	notes repository.NotesRepository
+	types *models.Registry
+}
+
+func NewIndexer(repo LinkRepository, types *models.Registry) *Indexer {
+	return &Indexer{repo: repo, types: types}
+}
+
+// Use sets the notes repository the renamed links are written through. It's the repository the
+// indexer is a hook of, so the rewritten notes are versioned, run the hooks and are published.
+func (i *Indexer) Use(notes repository.NotesRepository) {
+	i.notes = notes
+}
+
+func (i *Indexer) NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error {
+	if !created {
+		if err := i.rename(note, ctx); err != nil {
+			return err
+		}
+	}
+
+	if text, ok := note.Data.(*models.TextNoteData); ok {
+		if err := i.index(note, text.Content, ctx); err != nil {
+			return err
+		}
+	}
+
+	return i.repo.Resolve(note, readers(note), ctx)
+}
+
+func (i *Indexer) NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error {
+	if err := i.repo.DeleteBySource(note.ID, ctx); err != nil {
+		return err
+	}
+
+	return i.repo.MarkDangling(note.ID, ctx)
+}
+
+// rename updates the wiki links pointing to note when its title changed.
+func (i *Indexer) rename(note *models.EmbeddedNote, ctx context.Context) error {
+	links, err := i.repo.ListByTarget(note.ID, ctx)
+	if err != nil {
+		return err
+	}
+
+	renamed := false
+	for _, link := range links {
+		if link.Kind != KindWiki || link.TargetKey == titleKey(note.Title) {
+			continue
+		}
+
+		renamed = true
+		if err := i.renameInSource(link.SourceID, link.TargetTitle, note.Title, ctx); err != nil {
+			return err
+		}
+	}
+
+	if !renamed {
+		return nil
+	}
+
+	return i.repo.Retitle(note.ID, note.Title, ctx)
+}
+
+// renameInSource rewrites the [[oldTitle]] links of a text note after the linked note was renamed.
+// The note is read again when it changed meanwhile, so a concurrent edit isn't overwritten.
+func (i *Indexer) renameInSource(sourceId primitive.ObjectID, oldTitle, newTitle string, ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		note, err := i.notes.GetById(sourceId.Hex(), ctx)
+		if err != nil {
+			return err
+		}
+
+		text, ok := note.Data.(*models.TextNoteData)
+		if !ok {
+			return nil
+		}
+
+		content := RenameWikiLinks(text.Content, oldTitle, newTitle)
+		if content == text.Content {
+			return nil
+		}
+
+		note.Data = &models.TextNoteData{Content: content}
+		note.SearchText = i.types.SearchText(note)
+
+		err = i.notes.Update(note, map[string]any{"text_note.content": content}, ctx)
+		if !errors.Is(err, repository.ErrVersionConflict) || attempt == maxAttempts {
+			return err
+		}
+	}
+}
+
+func (i *Indexer) index(note *models.EmbeddedNote, content string, ctx context.Context) error {
+	links := []Link{}
+
+	for _, ref := range Parse(content) {
+		link := Link{
+			SourceID:     note.ID,
+			SourceUserID: note.UserId,
+			Kind:         ref.Kind,
+			Status:       StatusUnresolved,
+			TargetTitle:  ref.Title,
+			TargetKey:    titleKey(ref.Title),
+			CreatedAt:    time.Now(),
+		}
+
+		if target := i.lookup(note.UserId, ref, ctx); target != nil {
+			link.Status = StatusResolved
+			link.TargetID = &target.ID
+			link.TargetTitle = target.Title
+			link.TargetKey = titleKey(target.Title)
+		}
+
+		links = append(links, link)
+	}
+
+	return i.repo.Replace(note.ID, links, ctx)
+}
+
+// lookup returns the note ref points to, if the author of the link can read it.
+func (i *Indexer) lookup(userId primitive.ObjectID, ref Ref, ctx context.Context) *models.BaseNote {
+	if ref.Kind == KindWiki {
+		target, err := i.repo.FindReadableByTitle(userId, ref.Title, ctx)
+		if err != nil {
+			return nil
+		}
+		return target
+	}
+
+	notes, err := i.repo.FindNotes([]primitive.ObjectID{ref.ID}, ctx)
+	if err != nil || len(notes) == 0 {
+		return nil
+	}
+
+	if !authz.Can(notes[0], userId.Hex(), authz.View) {
+		return nil
+	}
+
+	return &notes[0].BaseNote
+}
+
+// readers returns the users allowed to link to note.
+func readers(note *models.EmbeddedNote) []primitive.ObjectID {
+	return note.Readers()
+}
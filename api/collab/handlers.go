@@ -0,0 +1,117 @@
+package collab
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/gorilla/websocket"
+
+	"memo/api/authz"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+const (
+	writeWait  = 10 * time.Second
+	pongWait   = 60 * time.Second
+	pingPeriod = pongWait * 9 / 10
+	// a message holds at most this many bytes, large pastes are sent in several messages.
+	maxMessageSize = 1 << 20
+)
+
+var upgrader = websocket.Upgrader{
+	// the access token is sent by the client itself, browsers don't add it to cross-site requests.
+	CheckOrigin: func(r *http.Request) bool { return true },
+}
+
+// HandleCollab opens a websocket to edit a text note with the other users in it. The client gets
+// the document state and the peers on "init", then exchanges "ops" and "cursor" messages.
+// Users with read access follow the edits, only writers can send ops.
+func HandleCollab(logger logger.Logger, repo repository.NotesRepository, manager *Manager) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, repo, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		if note.Type != "text" {
+			response.ErrMessage(w, "Only text notes can be edited together", http.StatusBadRequest)
+			return
+		}
+
+		conn, err := upgrader.Upgrade(w, r, nil)
+		if err != nil {
+			// the upgrader answered the request.
+			return
+		}
+
+		c := manager.join(note, userId, authz.Can(note, userId, authz.Edit))
+		defer manager.leave(c)
+
+		go c.write(conn)
+		c.read(conn, logger)
+	})
+}
+
+// read applies the messages of the client until the connection closes.
+func (c *client) read(conn *websocket.Conn, logger logger.Logger) {
+	conn.SetReadLimit(maxMessageSize)
+	conn.SetReadDeadline(time.Now().Add(pongWait))
+	conn.SetPongHandler(func(string) error {
+		return conn.SetReadDeadline(time.Now().Add(pongWait))
+	})
+
+	for {
+		var msg message
+		if err := conn.ReadJSON(&msg); err != nil {
+			if websocket.IsUnexpectedCloseError(err, websocket.CloseGoingAway, websocket.CloseNormalClosure) {
+				logger.Error("collab read issue", "error", err)
+			}
+			return
+		}
+
+		switch msg.Type {
+		case msgOps:
+			// a rejected operation leaves the client out of sync, it reloads the document.
+			if err := c.room.apply(c, msg.Ops); err != nil {
+				c.room.reply(c, message{Type: msgError, Message: err.Error()})
+			}
+		case msgCursor:
+			c.room.move(c, msg.Cursor)
+		default:
+			c.room.reply(c, message{Type: msgError, Message: "Unknown message type"})
+		}
+	}
+}
+
+// write sends the queued messages and pings, it closes the connection when the client leaves.
+func (c *client) write(conn *websocket.Conn) {
+	ticker := time.NewTicker(pingPeriod)
+	defer func() {
+		ticker.Stop()
+		conn.Close()
+	}()
+
+	for {
+		select {
+		case msg, ok := <-c.send:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if !ok {
+				conn.WriteMessage(websocket.CloseMessage, []byte{})
+				return
+			}
+
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ticker.C:
+			conn.SetWriteDeadline(time.Now().Add(writeWait))
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		}
+	}
+}
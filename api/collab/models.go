@@ -0,0 +1,65 @@
+package collab
+
+import (
+	"time"
+
+	"memo/pkg/crdt"
+)
+
+type Config struct {
+	// SnapshotInterval is how often the edited text is saved into the note.
+	SnapshotInterval time.Duration
+}
+
+var DefaultConfig = Config{
+	SnapshotInterval: 10 * time.Second,
+}
+
+// LoadConfig reads COLLAB_SNAPSHOT_INTERVAL, a duration such as "30s".
+func LoadConfig(getEnv func(string) string) Config {
+	config := DefaultConfig
+
+	if interval, err := time.ParseDuration(getEnv("COLLAB_SNAPSHOT_INTERVAL")); err == nil && interval > 0 {
+		config.SnapshotInterval = interval
+	}
+
+	return config
+}
+
+// Cursor is a selection, from the anchor to the head. Both are characters of the document, so
+// the selection follows the text edited by the others.
+type Cursor struct {
+	Anchor crdt.ID `json:"anchor"`
+	Head   crdt.ID `json:"head"`
+}
+
+// Peer is a user in the room.
+type Peer struct {
+	Site     string  `json:"site"`
+	UserID   string  `json:"user_id"`
+	CanWrite bool    `json:"can_write"`
+	Cursor   *Cursor `json:"cursor,omitempty"`
+}
+
+const (
+	// sent by the server.
+	msgInit     = "init"
+	msgPresence = "presence"
+	msgError    = "error"
+	// sent by both.
+	msgOps    = "ops"
+	msgCursor = "cursor"
+)
+
+// message is exchanged over the websocket.
+type message struct {
+	Type string `json:"type"`
+	// Site is the replica of the receiving client in init, the author in ops and cursor.
+	Site string `json:"site,omitempty"`
+	// Elements is the document state sent in init.
+	Elements []crdt.Element `json:"elements,omitempty"`
+	Ops      []crdt.Op      `json:"ops,omitempty"`
+	Cursor   *Cursor        `json:"cursor,omitempty"`
+	Peers    []Peer         `json:"peers,omitempty"`
+	Message  string         `json:"message,omitempty"`
+}
@@ -0,0 +1,300 @@
+package collab
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/crdt"
+	"memo/pkg/logger"
+)
+
+// a client that falls this many messages behind is disconnected, it reloads the document.
+const sendBuffer = 256
+
+// the snapshot is written again this many times when the note changes while it's written.
+const maxAttempts = 3
+
+var errReadOnly = errors.New("You don't have permission to edit this note")
+
+// client is a connection to a room, its messages are queued on send.
+type client struct {
+	peer Peer
+	send chan message
+	room *room
+}
+
+// room is the shared document of a note, while at least one client edits it.
+type room struct {
+	noteId  string
+	mu      sync.Mutex
+	doc     *crdt.Doc
+	clients map[*client]bool
+	// dirty is set when the document changed since the last snapshot.
+	dirty bool
+}
+
+// Manager keeps a room per edited note and saves their text into the notes.
+type Manager struct {
+	logger logger.Logger
+	notes  repository.NotesRepository
+	types  *models.Registry
+	config Config
+
+	mu    sync.Mutex
+	rooms map[string]*room
+}
+
+func NewManager(logger logger.Logger, notes repository.NotesRepository, types *models.Registry, config Config) *Manager {
+	return &Manager{
+		logger: logger,
+		notes:  notes,
+		types:  types,
+		config: config,
+		rooms:  make(map[string]*room),
+	}
+}
+
+// Run saves the changed rooms every SnapshotInterval, and all of them when ctx is done.
+func (m *Manager) Run(ctx context.Context) {
+	ticker := time.NewTicker(m.config.SnapshotInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			m.snapshotAll(ctx)
+		case <-ctx.Done():
+			m.snapshotAll(context.Background())
+			return
+		}
+	}
+}
+
+func (m *Manager) snapshotAll(ctx context.Context) {
+	m.mu.Lock()
+	rooms := make([]*room, 0, len(m.rooms))
+	for _, room := range m.rooms {
+		rooms = append(rooms, room)
+	}
+	m.mu.Unlock()
+
+	for _, room := range rooms {
+		if err := m.snapshot(room, ctx); err != nil {
+			m.logger.For(ctx).Error("collab snapshot issue", "error", err)
+		}
+
+		m.close(room)
+	}
+}
+
+// join adds a client to the room of the note, the room starts from the stored text.
+func (m *Manager) join(note *models.EmbeddedNote, userId string, canWrite bool) *client {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	id := note.ID.Hex()
+	r, ok := m.rooms[id]
+	if !ok {
+		content := ""
+		if text, ok := note.Data.(*models.TextNoteData); ok {
+			content = text.Content
+		}
+
+		r = &room{noteId: id, doc: crdt.FromText("server", content), clients: make(map[*client]bool)}
+		m.rooms[id] = r
+	}
+
+	c := &client{
+		peer: Peer{Site: primitive.NewObjectID().Hex(), UserID: userId, CanWrite: canWrite},
+		send: make(chan message, sendBuffer),
+		room: r,
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	r.clients[c] = true
+	c.send <- message{Type: msgInit, Site: c.peer.Site, Elements: r.doc.Elements(), Peers: r.peers()}
+	r.broadcast(message{Type: msgPresence, Peers: r.peers()}, c)
+
+	return c
+}
+
+// leave removes the client. The last one out saves the text and closes the room, the room is
+// kept while it's saved so a client joining meanwhile doesn't load the old text.
+func (m *Manager) leave(c *client) {
+	r := c.room
+
+	r.mu.Lock()
+	r.remove(c)
+	empty := len(r.clients) == 0
+	if !empty {
+		r.broadcast(message{Type: msgPresence, Peers: r.peers()}, nil)
+	}
+	r.mu.Unlock()
+
+	if !empty {
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	if err := m.snapshot(r, ctx); err != nil {
+		m.logger.Error("collab snapshot issue", "error", err)
+	}
+
+	m.close(r)
+}
+
+// close drops the room when nobody is in it and its text is saved, a room that failed to save
+// is saved again by Run.
+func (m *Manager) close(r *room) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if len(r.clients) == 0 && !r.dirty {
+		delete(m.rooms, r.noteId)
+	}
+}
+
+// snapshot writes the text of the room into the note.
+func (m *Manager) snapshot(r *room, ctx context.Context) error {
+	r.mu.Lock()
+	if !r.dirty {
+		r.mu.Unlock()
+		return nil
+	}
+	text := r.doc.Text()
+	r.dirty = false
+	r.mu.Unlock()
+
+	err := m.save(r.noteId, text, ctx)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// the note was deleted.
+		return nil
+	}
+
+	if err != nil {
+		r.mu.Lock()
+		r.dirty = true
+		r.mu.Unlock()
+	}
+
+	return err
+}
+
+func (m *Manager) save(noteId, text string, ctx context.Context) error {
+	for attempt := 1; ; attempt++ {
+		note, err := m.notes.GetById(noteId, ctx)
+		if err != nil {
+			return err
+		}
+
+		if current, ok := note.Data.(*models.TextNoteData); ok && current.Content == text {
+			return nil
+		}
+
+		note.Data = &models.TextNoteData{Content: text}
+		note.SearchText = m.types.SearchText(note)
+
+		err = m.notes.Update(note, map[string]any{"text_note.content": text}, ctx)
+		if !errors.Is(err, repository.ErrVersionConflict) || attempt == maxAttempts {
+			return err
+		}
+	}
+}
+
+// apply integrates the operations of the client and sends them to the others.
+func (r *room) apply(c *client, ops []crdt.Op) error {
+	if !c.peer.CanWrite {
+		return errReadOnly
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	applied := 0
+	var err error
+	for _, op := range ops {
+		// a client only inserts characters with its own site, ids can't collide.
+		if op.Type == crdt.OpInsert && op.ID.Site != c.peer.Site {
+			err = crdt.ErrInvalidOp
+			break
+		}
+
+		if err = r.doc.Apply(op); err != nil {
+			break
+		}
+		applied++
+	}
+
+	if applied > 0 {
+		r.dirty = true
+		r.broadcast(message{Type: msgOps, Site: c.peer.Site, Ops: ops[:applied]}, c)
+	}
+
+	return err
+}
+
+// move sets the cursor of the client and shows it to the others.
+func (r *room) move(c *client, cursor *Cursor) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	c.peer.Cursor = cursor
+	r.broadcast(message{Type: msgCursor, Site: c.peer.Site, Cursor: cursor}, c)
+}
+
+// reply sends a message to the client only.
+func (r *room) reply(c *client, msg message) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if r.clients[c] {
+		r.queue(c, msg)
+	}
+}
+
+// broadcast sends msg to every client but except, the room is locked.
+func (r *room) broadcast(msg message, except *client) {
+	for c := range r.clients {
+		if c != except {
+			r.queue(c, msg)
+		}
+	}
+}
+
+// queue sends without blocking the room, slow clients are disconnected.
+func (r *room) queue(c *client, msg message) {
+	select {
+	case c.send <- msg:
+	default:
+		r.remove(c)
+	}
+}
+
+func (r *room) remove(c *client) {
+	if r.clients[c] {
+		delete(r.clients, c)
+		close(c.send)
+	}
+}
+
+func (r *room) peers() []Peer {
+	peers := make([]Peer, 0, len(r.clients))
+	for c := range r.clients {
+		peers = append(peers, c.peer)
+	}
+	return peers
+}
@@ -0,0 +1,340 @@
+package comments
+
+import (
+	"context"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/authz"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/api/notifications"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/validation"
+)
+
+// a comment holds at most this many characters.
+const maxBodyLength = 10000
+
+// the changes told to CommentEvents.
+const (
+	Created    = "created"
+	Updated    = "updated"
+	Deleted    = "deleted"
+	Resolved   = "resolved"
+	Unresolved = "unresolved"
+)
+
+// CommentEvents is told about comment changes, to notify the readers of the note.
+type CommentEvents interface {
+	CommentChanged(noteId, commentId, change string, ctx context.Context)
+}
+
+type commentRequest struct {
+	Body string `json:"body" validate:"required"`
+}
+
+// HandleList returns the threads of a note, oldest first. ?resolved=false leaves the resolved
+// threads out, ?resolved=true keeps only them.
+func HandleList(logger logger.Logger, notes repository.NotesRepository, repo CommentRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		comments, err := repo.ListByNote(note.ID, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("comments issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		threads := threadsOf(comments)
+
+		if resolved, err := strconv.ParseBool(r.URL.Query().Get("resolved")); err == nil {
+			filtered := []*Thread{}
+			for _, thread := range threads {
+				if thread.Resolved == resolved {
+					filtered = append(filtered, thread)
+				}
+			}
+			threads = filtered
+		}
+
+		response.Respond(w, threads, http.StatusOK)
+	})
+}
+
+// HandleCreate comments on a note, or replies to a thread with parent_id. The users mentioned
+// in the body are notified.
+func HandleCreate(logger logger.Logger, notes repository.NotesRepository, repo CommentRepository, events CommentEvents, notifier notifications.Notifier) http.HandlerFunc {
+	type createRequest struct {
+		Body     string `json:"body" validate:"required"`
+		ParentID string `json:"parent_id"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*createRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.CommentOn)
+		if !ok {
+			return
+		}
+
+		body := strings.TrimSpace(data.Body)
+		if problems := validBody(body); len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		authorId, _ := primitive.ObjectIDFromHex(userId)
+		comment := &Comment{
+			NoteID:    note.ID,
+			AuthorID:  authorId,
+			Body:      body,
+			Mentions:  mentions(note, body),
+			CreatedAt: time.Now(),
+		}
+
+		if data.ParentID != "" {
+			parent, err := repo.Get(data.ParentID, r.Context())
+			if err != nil || parent.NoteID != note.ID {
+				response.ValidationErr(w, map[string]string{"parent_id": "exists"})
+				return
+			}
+
+			// replies are kept on the first comment of the thread.
+			comment.ParentID = &parent.ID
+			if parent.ParentID != nil {
+				comment.ParentID = parent.ParentID
+			}
+		}
+
+		if err := repo.Insert(comment, r.Context()); err != nil {
+			logger.For(r.Context()).Error("comments issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		events.CommentChanged(note.ID.Hex(), comment.ID.Hex(), Created, r.Context())
+		notify(notifier, note, comment, comment.Mentions, r.Context())
+
+		response.Respond(w, comment, http.StatusCreated)
+	})
+}
+
+// HandleEdit changes the body of a comment, only its author can. The users newly mentioned are notified.
+func HandleEdit(logger logger.Logger, notes repository.NotesRepository, repo CommentRepository, events CommentEvents, notifier notifications.Notifier) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*commentRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		note, comment, ok := load(w, r, notes, repo, userId, authz.CommentOn)
+		if !ok {
+			return
+		}
+
+		if comment.Deleted {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if comment.AuthorID.Hex() != userId {
+			response.ErrMessage(w, "Only the author can edit this comment", http.StatusForbidden)
+			return
+		}
+
+		body := strings.TrimSpace(data.Body)
+		if problems := validBody(body); len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		previous := map[primitive.ObjectID]bool{}
+		for _, id := range comment.Mentions {
+			previous[id] = true
+		}
+
+		now := time.Now()
+		comment.Body, comment.Mentions, comment.EditedAt = body, mentions(note, body), &now
+
+		if err := repo.Edit(comment.ID, comment.Body, comment.Mentions, r.Context()); err != nil {
+			logger.For(r.Context()).Error("comments issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		added := []primitive.ObjectID{}
+		for _, id := range comment.Mentions {
+			if !previous[id] {
+				added = append(added, id)
+			}
+		}
+
+		events.CommentChanged(note.ID.Hex(), comment.ID.Hex(), Updated, r.Context())
+		notify(notifier, note, comment, added, r.Context())
+
+		response.Respond(w, comment, http.StatusOK)
+	})
+}
+
+// HandleDelete deletes a comment, only its author can. The replies of others stay, the first
+// comment of their thread is blanked, see CommentRepository.Delete.
+func HandleDelete(logger logger.Logger, notes repository.NotesRepository, repo CommentRepository, events CommentEvents) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, comment, ok := load(w, r, notes, repo, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		if comment.Deleted {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if comment.AuthorID.Hex() != userId {
+			response.ErrMessage(w, "Only the author can delete this comment", http.StatusForbidden)
+			return
+		}
+
+		if err := repo.Delete(comment.ID, r.Context()); err != nil {
+			logger.For(r.Context()).Error("comments issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		events.CommentChanged(note.ID.Hex(), comment.ID.Hex(), Deleted, r.Context())
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleResolve resolves or reopens the thread of a comment.
+func HandleResolve(logger logger.Logger, notes repository.NotesRepository, repo CommentRepository, events CommentEvents, resolved bool) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, comment, ok := load(w, r, notes, repo, userId, authz.CommentOn)
+		if !ok {
+			return
+		}
+
+		threadId := comment.ID
+		if comment.ParentID != nil {
+			threadId = *comment.ParentID
+		}
+
+		oUserId, _ := primitive.ObjectIDFromHex(userId)
+		if err := repo.Resolve(threadId, resolved, oUserId, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		change := Unresolved
+		if resolved {
+			change = Resolved
+		}
+		events.CommentChanged(note.ID.Hex(), threadId.Hex(), change, r.Context())
+
+		response.RespondSuccess(w)
+	})
+}
+
+// threadsOf groups the comments of a note by thread.
+func threadsOf(comments []*Comment) []*Thread {
+	threads := []*Thread{}
+	byId := map[primitive.ObjectID]*Thread{}
+
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			thread := &Thread{Comment: comment, Replies: []*Comment{}}
+			byId[comment.ID] = thread
+			threads = append(threads, thread)
+		}
+	}
+
+	for _, comment := range comments {
+		if comment.ParentID == nil {
+			continue
+		}
+
+		if thread, ok := byId[*comment.ParentID]; ok {
+			thread.Replies = append(thread.Replies, comment)
+		}
+	}
+
+	return threads
+}
+
+// mentions returns the users mentioned in body who can read the note.
+func mentions(note *models.EmbeddedNote, body string) []primitive.ObjectID {
+	users := []primitive.ObjectID{}
+	for _, id := range mentioned(body) {
+		if authz.Can(note, id.Hex(), authz.View) {
+			users = append(users, id)
+		}
+	}
+
+	return users
+}
+
+// notify tells the mentioned users about the comment.
+func notify(notifier notifications.Notifier, note *models.EmbeddedNote, comment *Comment, users []primitive.ObjectID, ctx context.Context) {
+	for _, id := range users {
+		notifier.Notify(notifications.Notice{
+			UserID: id.Hex(),
+			Kind:   notifications.KindMentioned,
+			NoteID: note.ID.Hex(),
+			Data:   map[string]string{"title": note.Title, "comment_id": comment.ID.Hex()},
+		}, ctx)
+	}
+}
+
+func validBody(body string) map[string]string {
+	if body == "" {
+		return map[string]string{"body": "required"}
+	}
+
+	if len([]rune(body)) > maxBodyLength {
+		return map[string]string{"body": "max:" + strconv.Itoa(maxBodyLength)}
+	}
+
+	return nil
+}
+
+// load returns the note and the comment of the {commentId} path value, see authz.Authorize.
+func load(w http.ResponseWriter, r *http.Request, notes repository.NotesRepository, repo CommentRepository, userId string, action authz.Action) (*models.EmbeddedNote, *Comment, bool) {
+	note, ok := authz.Authorize(w, r, notes, userId, action)
+	if !ok {
+		return nil, nil, false
+	}
+
+	comment, err := repo.Get(r.PathValue("commentId"), r.Context())
+	if err != nil || comment.NoteID != note.ID {
+		response.RespondErr(w, response.NotFound())
+		return nil, nil, false
+	}
+
+	return note, comment, true
+}
@@ -0,0 +1,56 @@
+package comments
+
+import (
+	"regexp"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Comment is a message left on a note. Replies point to the first comment of their thread,
+// threads are resolved as a whole.
+type Comment struct {
+	ID       primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	NoteID   primitive.ObjectID  `bson:"note_id" json:"note_id"`
+	ParentID *primitive.ObjectID `bson:"parent_id,omitempty" json:"parent_id,omitempty"`
+	AuthorID primitive.ObjectID  `bson:"author_id" json:"author_id"`
+	Body     string              `bson:"body" json:"body"`
+	// Mentions are the users mentioned in the body who can read the note.
+	Mentions   []primitive.ObjectID `bson:"mentions" json:"mentions"`
+	Resolved   bool                 `bson:"resolved" json:"resolved"`
+	ResolvedBy *primitive.ObjectID  `bson:"resolved_by,omitempty" json:"resolved_by,omitempty"`
+	ResolvedAt *time.Time           `bson:"resolved_at,omitempty" json:"resolved_at,omitempty"`
+	CreatedAt  time.Time            `bson:"created_at" json:"created_at"`
+	EditedAt   *time.Time           `bson:"edited_at,omitempty" json:"edited_at,omitempty"`
+	// Deleted is set on the first comment of a thread deleted while it has replies, its body is
+	// blanked and the replies are kept.
+	Deleted   bool       `bson:"deleted,omitempty" json:"deleted,omitempty"`
+	DeletedAt *time.Time `bson:"deleted_at,omitempty" json:"deleted_at,omitempty"`
+}
+
+// Thread is a comment and its replies, oldest first.
+type Thread struct {
+	*Comment
+	Replies []*Comment `json:"replies"`
+}
+
+// a mention is written @[name](user id), the name is only shown.
+var mentionPattern = regexp.MustCompile(`@\[[^\]]*\]\(([0-9a-f]{24})\)`)
+
+// mentioned returns the ids of the users mentioned in body, once each.
+func mentioned(body string) []primitive.ObjectID {
+	ids := []primitive.ObjectID{}
+	seen := map[primitive.ObjectID]bool{}
+
+	for _, match := range mentionPattern.FindAllStringSubmatch(body, -1) {
+		id, err := primitive.ObjectIDFromHex(match[1])
+		if err != nil || seen[id] {
+			continue
+		}
+
+		seen[id] = true
+		ids = append(ids, id)
+	}
+
+	return ids
+}
@@ -0,0 +1,149 @@
+package comments
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type CommentRepository interface {
+	Insert(comment *Comment, ctx context.Context) error
+	Get(id string, ctx context.Context) (*Comment, error)
+	// ListByNote returns the comments of a note, oldest first.
+	ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Comment, error)
+	Edit(id primitive.ObjectID, body string, mentions []primitive.ObjectID, ctx context.Context) error
+	// Resolve resolves or reopens a thread.
+	Resolve(id primitive.ObjectID, resolved bool, userId primitive.ObjectID, ctx context.Context) error
+	// Delete deletes a comment. The first comment of a thread with replies is blanked instead, it's
+	// deleted with its last reply.
+	Delete(id primitive.ObjectID, ctx context.Context) error
+	DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error
+}
+
+type commentRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) CommentRepository {
+	return &commentRepository{client}
+}
+
+func (r *commentRepository) Insert(comment *Comment, ctx context.Context) error {
+	result, err := r.client.Collection("comments").InsertOne(ctx, comment)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		comment.ID = id
+	}
+
+	return nil
+}
+
+func (r *commentRepository) Get(id string, ctx context.Context) (*Comment, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var comment *Comment
+	if err := r.client.Collection("comments").FindOne(ctx, bson.M{"_id": oId}).Decode(&comment); err != nil {
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+func (r *commentRepository) ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Comment, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.client.Collection("comments").Find(ctx, bson.M{"note_id": noteId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	comments := []*Comment{}
+	if err = cursor.All(ctx, &comments); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
+
+func (r *commentRepository) Edit(id primitive.ObjectID, body string, mentions []primitive.ObjectID, ctx context.Context) error {
+	update := bson.M{"$set": bson.M{"body": body, "mentions": mentions, "edited_at": time.Now()}}
+	return r.update(id, update, ctx)
+}
+
+func (r *commentRepository) Resolve(id primitive.ObjectID, resolved bool, userId primitive.ObjectID, ctx context.Context) error {
+	update := bson.M{"$set": bson.M{"resolved": true, "resolved_by": userId, "resolved_at": time.Now()}}
+	if !resolved {
+		update = bson.M{
+			"$set":   bson.M{"resolved": false},
+			"$unset": bson.M{"resolved_by": "", "resolved_at": ""},
+		}
+	}
+
+	return r.update(id, update, ctx)
+}
+
+func (r *commentRepository) update(id primitive.ObjectID, update bson.M, ctx context.Context) error {
+	result, err := r.client.Collection("comments").UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *commentRepository) Delete(id primitive.ObjectID, ctx context.Context) error {
+	comments := r.client.Collection("comments")
+
+	replies, err := comments.CountDocuments(ctx, bson.M{"parent_id": id})
+	if err != nil {
+		return err
+	}
+
+	if replies > 0 {
+		update := bson.M{"$set": bson.M{"body": "", "mentions": []primitive.ObjectID{}, "deleted": true, "deleted_at": time.Now()}}
+		return r.update(id, update, ctx)
+	}
+
+	var deleted *Comment
+	if err := comments.FindOneAndDelete(ctx, bson.M{"_id": id}).Decode(&deleted); err != nil {
+		if err == mongo.ErrNoDocuments {
+			return fmt.Errorf("no documents matched the filter")
+		}
+		return err
+	}
+
+	if deleted.ParentID == nil {
+		return nil
+	}
+
+	// the blanked first comment goes with its last reply.
+	replies, err = comments.CountDocuments(ctx, bson.M{"parent_id": *deleted.ParentID})
+	if err != nil || replies > 0 {
+		return err
+	}
+
+	_, err = comments.DeleteOne(ctx, bson.M{"_id": *deleted.ParentID, "deleted": true})
+	return err
+}
+
+func (r *commentRepository) DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error {
+	_, err := r.client.Collection("comments").DeleteMany(ctx, bson.M{"note_id": noteId})
+	return err
+}
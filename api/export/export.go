@@ -0,0 +1,263 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo/api/attachments"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+)
+
+const manifestVersion = 1
+
+type Manifest struct {
+	Version    int            `json:"version"`
+	ExportedAt time.Time      `json:"exported_at"`
+	UserID     string         `json:"user_id"`
+	Notes      []ManifestNote `json:"notes"`
+}
+
+type ManifestNote struct {
+	ID          string   `json:"id"`
+	Type        string   `json:"type"`
+	Title       string   `json:"title"`
+	Path        string   `json:"path"`
+	Attachments []string `json:"attachments,omitempty"`
+	// MissingAttachments are the names of the attachments whose file couldn't be read, they're
+	// left out of the archive.
+	MissingAttachments []string `json:"missing_attachments,omitempty"`
+}
+
+type movieRow struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Year     int      `json:"year"`
+	Director string   `json:"director"`
+	Genres   []string `json:"genres"`
+	Runtime  int      `json:"runtime"`
+	Watched  bool     `json:"watched"`
+	SourceID string   `json:"source_id,omitempty"`
+	Tags     []string `json:"tags"`
+}
+
+// Exporter writes all the notes of a user, it reads them one by one so the archive is streamed.
+type Exporter struct {
+	notes       repository.NotesRepository
+	attachments attachments.AttachmentRepository
+	files       *attachments.Service
+}
+
+func NewExporter(notes repository.NotesRepository, attachmentRepo attachments.AttachmentRepository, files *attachments.Service) *Exporter {
+	return &Exporter{notes, attachmentRepo, files}
+}
+
+// Zip writes a zip archive: markdown files with front matter for text, todo and link notes,
+// movies.csv and movies.json for the movies, the attachments and a manifest.json.
+func (e *Exporter) Zip(w io.Writer, userId string, ctx context.Context) error {
+	archive := zip.NewWriter(w)
+	names := make(map[string]bool)
+	manifest := Manifest{Version: manifestVersion, ExportedAt: time.Now().UTC(), UserID: userId, Notes: []ManifestNote{}}
+	movies := []movieRow{}
+
+	err := e.notes.Each(userId, func(note *models.EmbeddedNote) error {
+		entry := ManifestNote{ID: note.ID.Hex(), Type: note.Type, Title: note.Title}
+
+		var content []byte
+		switch data := note.Data.(type) {
+		case *models.TextNoteData:
+			entry.Path = unique(names, "notes/"+slug(note.Title), ".md")
+			content = textMarkdown(note, data)
+		case *models.TodoNoteData:
+			entry.Path = unique(names, "todos/"+slug(note.Title), ".md")
+			content = todoMarkdown(note, data)
+		case *models.LinkNoteData:
+			entry.Path = unique(names, "links/"+slug(note.Title), ".md")
+			content = linkMarkdown(note, data)
+		case *models.MovieNoteData:
+			entry.Path = "movies.csv"
+			movies = append(movies, movieRow{
+				ID:       note.ID.Hex(),
+				Title:    note.Title,
+				Year:     data.Year,
+				Director: data.Director,
+				Genres:   list(data.Genres),
+				Runtime:  data.Runtime,
+				Watched:  data.Watched,
+				SourceID: data.SourceID,
+				Tags:     list(note.Tags),
+			})
+		default:
+			entry.Path = unique(names, "notes/"+slug(note.Title), ".json")
+			content, _ = json.MarshalIndent(note, "", "  ")
+		}
+
+		if content != nil {
+			if err := writeFile(archive, entry.Path, note.UpdatedAt, content); err != nil {
+				return err
+			}
+		}
+
+		files, missing, err := e.writeAttachments(archive, note, ctx)
+		if err != nil {
+			return err
+		}
+
+		entry.Attachments, entry.MissingAttachments = files, missing
+		manifest.Notes = append(manifest.Notes, entry)
+
+		return nil
+	}, ctx)
+
+	if err != nil {
+		return err
+	}
+
+	if len(movies) > 0 {
+		if err := writeMovies(archive, movies, manifest.ExportedAt); err != nil {
+			return err
+		}
+	}
+
+	content, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	if err := writeFile(archive, "manifest.json", manifest.ExportedAt, content); err != nil {
+		return err
+	}
+
+	return archive.Close()
+}
+
+// JSONLines writes one json encoded note per line.
+func (e *Exporter) JSONLines(w io.Writer, userId string, ctx context.Context) error {
+	encoder := json.NewEncoder(w)
+
+	return e.notes.Each(userId, func(note *models.EmbeddedNote) error {
+		return encoder.Encode(note)
+	}, ctx)
+}
+
+// writeAttachments copies the attachments of note into the archive and returns their paths, and
+// the names of the ones whose file is missing or can't be opened.
+func (e *Exporter) writeAttachments(archive *zip.Writer, note *models.EmbeddedNote, ctx context.Context) ([]string, []string, error) {
+	list, err := e.attachments.ListByNote(note.ID, ctx)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	names := make(map[string]bool)
+	paths := []string{}
+	missing := []string{}
+
+	for _, attachment := range list {
+		file, err := e.files.Open(attachment, ctx)
+		if err != nil {
+			missing = append(missing, attachment.Name)
+			continue
+		}
+
+		ext := path.Ext(attachment.Name)
+		name := unique(names, "attachments/"+note.ID.Hex()+"/"+strings.TrimSuffix(attachment.Name, ext), ext)
+
+		err = copyAttachment(archive, name, attachment, file)
+		file.Close()
+
+		if err != nil {
+			return nil, nil, err
+		}
+
+		paths = append(paths, name)
+	}
+
+	return paths, missing, nil
+}
+
+func copyAttachment(archive *zip.Writer, name string, attachment *attachments.Attachment, file io.Reader) error {
+	header := &zip.FileHeader{Name: name, Modified: attachment.CreatedAt, Method: zip.Deflate}
+	// images, media and archives are compressed already.
+	if !strings.HasPrefix(attachment.MimeType, "text/") && attachment.MimeType != "application/pdf" {
+		header.Method = zip.Store
+	}
+
+	dst, err := archive.CreateHeader(header)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.Copy(dst, file)
+	return err
+}
+
+func writeMovies(archive *zip.Writer, movies []movieRow, modified time.Time) error {
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: "movies.csv", Modified: modified, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+
+	w := csv.NewWriter(dst)
+	w.Write([]string{"id", "title", "year", "director", "genres", "runtime", "watched", "source_id", "tags"})
+
+	for _, movie := range movies {
+		w.Write([]string{
+			movie.ID,
+			movie.Title,
+			strconv.Itoa(movie.Year),
+			movie.Director,
+			strings.Join(movie.Genres, ","),
+			strconv.Itoa(movie.Runtime),
+			strconv.FormatBool(movie.Watched),
+			movie.SourceID,
+			strings.Join(movie.Tags, ","),
+		})
+	}
+
+	w.Flush()
+	if err := w.Error(); err != nil {
+		return err
+	}
+
+	content, err := json.MarshalIndent(movies, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return writeFile(archive, "movies.json", modified, content)
+}
+
+func writeFile(archive *zip.Writer, name string, modified time.Time, content []byte) error {
+	dst, err := archive.CreateHeader(&zip.FileHeader{Name: name, Modified: modified, Method: zip.Deflate})
+	if err != nil {
+		return err
+	}
+
+	_, err = dst.Write(content)
+	return err
+}
+
+func list(values []string) []string {
+	if values == nil {
+		return []string{}
+	}
+	return values
+}
+
+// unique returns base+ext, with a counter added when the name is already used.
+func unique(names map[string]bool, base, ext string) string {
+	name := base + ext
+	for n := 2; names[name]; n++ {
+		name = base + "-" + strconv.Itoa(n) + ext
+	}
+
+	names[name] = true
+	return name
+}
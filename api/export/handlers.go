@@ -0,0 +1,45 @@
+package export
+
+import (
+	"mime"
+	"net/http"
+	"time"
+
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+// HandleExport streams the notes of the user, as a zip archive or as json lines with ?format=jsonl.
+func HandleExport(logger logger.Logger, exporter *Exporter) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		format := r.URL.Query().Get("format")
+		if format == "" {
+			format = "zip"
+		}
+
+		if format != "zip" && format != "jsonl" {
+			response.ValidationErr(w, map[string]string{"format": "in:zip,jsonl"})
+			return
+		}
+
+		name := "memo-export-" + time.Now().UTC().Format("20060102") + "." + format
+		w.Header().Set("Content-Disposition", mime.FormatMediaType("attachment", map[string]string{"filename": name}))
+		w.Header().Set("Cache-Control", "no-store")
+
+		var err error
+		if format == "zip" {
+			w.Header().Set("Content-Type", "application/zip")
+			err = exporter.Zip(w, userId, r.Context())
+		} else {
+			w.Header().Set("Content-Type", "application/x-ndjson")
+			err = exporter.JSONLines(w, userId, r.Context())
+		}
+
+		// the response is already started, the archive is cut short.
+		if err != nil {
+			logger.For(r.Context()).Error("export issue", "error", err)
+		}
+	})
+}
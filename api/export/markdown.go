@@ -0,0 +1,106 @@
+package export
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+	"unicode"
+
+	"memo/api/notes/models"
+)
+
+// frontMatter writes the yaml header of a markdown file, values are json encoded which is valid yaml.
+func frontMatter(b *strings.Builder, note *models.EmbeddedNote, extra ...[2]any) {
+	fields := [][2]any{
+		{"id", note.ID.Hex()},
+		{"title", note.Title},
+		{"type", note.Type},
+		{"tags", list(note.Tags)},
+		{"created_at", note.CreatedAt.UTC().Format(time.RFC3339)},
+	}
+
+	if !note.UpdatedAt.IsZero() {
+		fields = append(fields, [2]any{"updated_at", note.UpdatedAt.UTC().Format(time.RFC3339)})
+	}
+
+	b.WriteString("---\n")
+	for _, field := range append(fields, extra...) {
+		value, _ := json.Marshal(field[1])
+		b.WriteString(field[0].(string) + ": " + string(value) + "\n")
+	}
+	b.WriteString("---\n\n")
+}
+
+func textMarkdown(note *models.EmbeddedNote, text *models.TextNoteData) []byte {
+	var b strings.Builder
+	frontMatter(&b, note)
+
+	b.WriteString(text.Content)
+	if !strings.HasSuffix(text.Content, "\n") {
+		b.WriteString("\n")
+	}
+
+	return []byte(b.String())
+}
+
+// todoMarkdown writes the tasks as a markdown checklist.
+func todoMarkdown(note *models.EmbeddedNote, todo *models.TodoNoteData) []byte {
+	var b strings.Builder
+	frontMatter(&b, note)
+
+	b.WriteString("# " + note.Title + "\n\n")
+	for _, task := range todo.Tasks {
+		check := " "
+		if task.IsCompleted {
+			check = "x"
+		}
+
+		b.WriteString("- [" + check + "] " + strings.ReplaceAll(task.Content, "\n", " ") + "\n")
+	}
+
+	return []byte(b.String())
+}
+
+func linkMarkdown(note *models.EmbeddedNote, link *models.LinkNoteData) []byte {
+	var b strings.Builder
+	frontMatter(&b, note, [2]any{"url", link.URL})
+
+	b.WriteString("# [" + note.Title + "](" + link.URL + ")\n")
+	if link.Description != "" {
+		b.WriteString("\n" + link.Description + "\n")
+	}
+
+	if link.Snapshot != "" {
+		b.WriteString("\n---\n\n" + link.Snapshot + "\n")
+	}
+
+	return []byte(b.String())
+}
+
+// slug turns a title into a file name: lowercase letters and digits separated by dashes.
+func slug(title string) string {
+	var b strings.Builder
+	dash := false
+
+	for _, r := range strings.ToLower(title) {
+		if unicode.IsLetter(r) || unicode.IsDigit(r) {
+			if dash && b.Len() > 0 {
+				b.WriteRune('-')
+			}
+			dash = false
+			b.WriteRune(r)
+		} else {
+			dash = true
+		}
+
+		if b.Len() >= 80 {
+			break
+		}
+	}
+
+	if b.Len() == 0 {
+		return "untitled"
+	}
+
+	return b.String()
+}
@@ -0,0 +1,227 @@
+package imports
+
+import (
+	"encoding/xml"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/atom"
+
+	"memo/api/notes/models"
+)
+
+// enexNote is a note of an Evernote export, resources (files) are not imported.
+type enexNote struct {
+	Title     string   `xml:"title"`
+	Content   string   `xml:"content"`
+	Created   string   `xml:"created"`
+	Updated   string   `xml:"updated"`
+	Tags      []string `xml:"tag"`
+	SourceURL string   `xml:"note-attributes>source-url"`
+}
+
+// enex reads an .enex file note by note. The ENML content is converted to markdown,
+// notes that are only a checklist become todo notes.
+func (r *reader) enex(file string) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	decoder := xml.NewDecoder(f)
+	decoder.Strict = false
+
+	for n := 1; ; {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			return nil
+		}
+
+		if err != nil {
+			return err
+		}
+
+		start, ok := token.(xml.StartElement)
+		if !ok || start.Name.Local != "note" {
+			continue
+		}
+
+		source := "note " + strconv.Itoa(n)
+		n++
+
+		var enex enexNote
+		if err := decoder.DecodeElement(&enex, &start); err != nil {
+			if err := r.emit(entry{source: source, err: err}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		if enex.Title != "" {
+			source += " (" + enex.Title + ")"
+		}
+
+		note, err := enex.note()
+		if err := r.emit(entry{source: source, note: note, err: err}); err != nil {
+			return err
+		}
+	}
+}
+
+func (e enexNote) note() (*models.EmbeddedNote, error) {
+	content, err := enmlToMarkdown(e.Content)
+	if err != nil {
+		return nil, err
+	}
+
+	if e.SourceURL != "" {
+		content = strings.TrimRight(content, "\n") + "\n\nSource: " + e.SourceURL + "\n"
+	}
+
+	title := e.Title
+	if title == "" {
+		title = titleFrom(content, "Untitled")
+	}
+
+	var note *models.EmbeddedNote
+	if tasks, only := checklist(content); only {
+		note = todoNote(title, tasks)
+	} else {
+		note = textNote(title, content)
+	}
+
+	note.Tags = e.Tags
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+
+	note.CreatedAt = parseDate(e.Created)
+	note.UpdatedAt = parseDate(e.Updated)
+
+	return note, nil
+}
+
+// enmlToMarkdown converts the xhtml of a note to markdown: blocks, headings, lists, links,
+// emphasis and checkboxes (en-todo). Media and other tags keep only their text.
+func enmlToMarkdown(enml string) (string, error) {
+	doc, err := html.Parse(strings.NewReader(enml))
+	if err != nil {
+		return "", err
+	}
+
+	var b strings.Builder
+	newline := func() {
+		if s := b.String(); s != "" && !strings.HasSuffix(s, "\n") {
+			b.WriteString("\n")
+		}
+	}
+
+	var walk func(n *html.Node, inList bool)
+	walk = func(n *html.Node, inList bool) {
+		switch n.Type {
+		case html.TextNode:
+			// whitespace collapses to one space, as in html.
+			text := strings.Join(strings.Fields(n.Data), " ")
+			if n.Data != strings.TrimLeftFunc(n.Data, unicode.IsSpace) && !strings.HasSuffix(b.String(), " ") && !strings.HasSuffix(b.String(), "\n") {
+				b.WriteString(" ")
+			}
+
+			b.WriteString(text)
+			if text != "" && n.Data != strings.TrimRightFunc(n.Data, unicode.IsSpace) {
+				b.WriteString(" ")
+			}
+			return
+		case html.ElementNode:
+		default:
+			for c := n.FirstChild; c != nil; c = c.NextSibling {
+				walk(c, inList)
+			}
+			return
+		}
+
+		suffix := ""
+		switch n.DataAtom {
+		case atom.Div, atom.P, atom.Blockquote, atom.Pre, atom.Tr, atom.Table:
+			newline()
+		case atom.Br:
+			b.WriteString("\n")
+			return
+		case atom.Hr:
+			newline()
+			b.WriteString("---\n")
+			return
+		case atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			newline()
+			b.WriteString(strings.Repeat("#", int(n.Data[1]-'0')) + " ")
+		case atom.Ul, atom.Ol:
+			newline()
+			inList = true
+		case atom.Li:
+			newline()
+			b.WriteString("- ")
+		case atom.B, atom.Strong:
+			b.WriteString("**")
+			suffix = "**"
+		case atom.I, atom.Em:
+			b.WriteString("_")
+			suffix = "_"
+		case atom.A:
+			b.WriteString("[")
+			suffix = "](" + attr(n, "href") + ")"
+		}
+
+		if n.Data == "en-todo" {
+			if !inList {
+				newline()
+				b.WriteString("- ")
+			}
+
+			if attr(n, "checked") == "true" {
+				b.WriteString("[x] ")
+			} else {
+				b.WriteString("[ ] ")
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c, inList && n.DataAtom != atom.Div)
+		}
+
+		b.WriteString(suffix)
+
+		switch n.DataAtom {
+		case atom.Div, atom.P, atom.Blockquote, atom.Pre, atom.Tr, atom.Table, atom.Li, atom.Ul, atom.Ol,
+			atom.H1, atom.H2, atom.H3, atom.H4, atom.H5, atom.H6:
+			newline()
+		}
+	}
+
+	walk(doc, false)
+
+	// collapse the blank lines left by nested blocks.
+	lines := []string{}
+	for _, line := range strings.Split(b.String(), "\n") {
+		line = strings.TrimRight(line, " ")
+		if line == "" && len(lines) > 0 && lines[len(lines)-1] == "" {
+			continue
+		}
+		lines = append(lines, line)
+	}
+
+	return strings.TrimSpace(strings.Join(lines, "\n")) + "\n", nil
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if a.Key == key {
+			return a.Val
+		}
+	}
+	return ""
+}
@@ -0,0 +1,114 @@
+package imports
+
+import (
+	"errors"
+	"net/http"
+	"strconv"
+
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+// HandleImport starts an import from the multipart "file" field. The optional "format" field is
+// markdown, keep or enex (detected when missing) and "dry_run" only previews the import.
+func HandleImport(logger logger.Logger, importer *Importer) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		r.Body = http.MaxBytesReader(w, r.Body, importer.Config().MaxSize+1<<20)
+
+		// parts above 1Mb are kept in temp files.
+		if err := r.ParseMultipartForm(1 << 20); err != nil {
+			var maxBytes *http.MaxBytesError
+			if errors.As(err, &maxBytes) {
+				response.ErrMessage(w, "File is too big", http.StatusRequestEntityTooLarge)
+				return
+			}
+
+			response.ValidationErr(w, map[string]string{"file": "required"})
+			return
+		}
+
+		defer r.MultipartForm.RemoveAll()
+
+		file, header, err := r.FormFile("file")
+		if err != nil {
+			response.ValidationErr(w, map[string]string{"file": "required"})
+			return
+		}
+
+		defer file.Close()
+
+		format := r.FormValue("format")
+		if format != "" && format != FormatMarkdown && format != FormatKeep && format != FormatENEX {
+			response.ValidationErr(w, map[string]string{"format": "in:markdown,keep,enex"})
+			return
+		}
+
+		dryRun, _ := strconv.ParseBool(r.FormValue("dry_run"))
+
+		job, err := importer.Start(userId, header.Filename, format, dryRun, file, r.Context())
+		if errors.Is(err, ErrFormat) {
+			response.ValidationErr(w, map[string]string{"format": "in:markdown,keep,enex"})
+			return
+		}
+
+		if errors.Is(err, ErrBusy) {
+			response.ErrMessage(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err != nil {
+			logger.For(r.Context()).Error("import issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, job, http.StatusAccepted)
+	})
+}
+
+// HandleJob returns the status and progress of an import.
+func HandleJob(logger logger.Logger, repo JobRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		job, err := repo.Get(r.PathValue("id"), userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		response.Respond(w, job, http.StatusOK)
+	})
+}
+
+// HandleItems returns the report of an import, ?status=failed lists the errors only.
+func HandleItems(logger logger.Logger, repo JobRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		job, err := repo.Get(r.PathValue("id"), userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		status := r.URL.Query().Get("status")
+		switch status {
+		case "", ItemImported, ItemDuplicate, ItemFailed, ItemNew:
+		default:
+			response.ValidationErr(w, map[string]string{"status": "in:imported,duplicate,failed,new"})
+			return
+		}
+
+		items, err := repo.Items(job.ID, status, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("import items issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, items, http.StatusOK)
+	})
+}
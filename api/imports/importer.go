@@ -0,0 +1,309 @@
+package imports
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+)
+
+// progress is saved every batch items.
+const batch = 50
+
+var ErrBusy = errors.New("An import is already in progress")
+
+// Importer runs the imports in the background. A user has one import at a time and at most
+// config.Workers imports run at once, the other jobs stay pending until a worker is free.
+type Importer struct {
+	logger  logger.Logger
+	jobs    JobRepository
+	notes   repository.NotesRepository
+	types   *models.Registry
+	config  Config
+	workers chan struct{}
+
+	mu     sync.Mutex
+	active map[primitive.ObjectID]bool
+}
+
+func NewImporter(logger logger.Logger, jobs JobRepository, notes repository.NotesRepository, types *models.Registry, config Config) *Importer {
+	if config.Workers <= 0 {
+		config.Workers = DefaultConfig.Workers
+	}
+
+	if config.MaxUncompressed <= 0 {
+		config.MaxUncompressed = DefaultConfig.MaxUncompressed
+	}
+
+	if config.MaxEntries <= 0 {
+		config.MaxEntries = DefaultConfig.MaxEntries
+	}
+
+	return &Importer{
+		logger:  logger,
+		jobs:    jobs,
+		notes:   notes,
+		types:   types,
+		config:  config,
+		workers: make(chan struct{}, config.Workers),
+		active:  map[primitive.ObjectID]bool{},
+	}
+}
+
+func (i *Importer) Config() Config {
+	return i.config
+}
+
+// Start spools r to a temp file, creates the job and imports it in the background.
+// The format is detected when empty. It fails with ErrBusy while the user has an import
+// pending or running.
+func (i *Importer) Start(userId, name, format string, dryRun bool, r io.Reader, ctx context.Context) (*Job, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	if !i.acquire(oUserId) {
+		return nil, ErrBusy
+	}
+
+	started := false
+	defer func() {
+		if !started {
+			i.release(oUserId)
+		}
+	}()
+
+	tmp, err := os.CreateTemp("", "import-*")
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = io.Copy(tmp, r)
+	tmp.Close()
+
+	if err == nil && format == "" {
+		format, err = detect(name, tmp.Name())
+	}
+
+	if err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	job := &Job{
+		UserID:    oUserId,
+		Format:    format,
+		FileName:  name,
+		DryRun:    dryRun,
+		Status:    JobPending,
+		CreatedAt: time.Now(),
+	}
+
+	if err := i.jobs.Create(job, ctx); err != nil {
+		os.Remove(tmp.Name())
+		return nil, err
+	}
+
+	started = true
+	go func() {
+		defer i.release(oUserId)
+
+		i.workers <- struct{}{}
+		defer func() { <-i.workers }()
+
+		i.run(job, tmp.Name())
+	}()
+
+	return job, nil
+}
+
+// acquire marks the user as having an import, it returns false if they already have one.
+func (i *Importer) acquire(userId primitive.ObjectID) bool {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	if i.active[userId] {
+		return false
+	}
+
+	i.active[userId] = true
+	return true
+}
+
+func (i *Importer) release(userId primitive.ObjectID) {
+	i.mu.Lock()
+	defer i.mu.Unlock()
+
+	delete(i.active, userId)
+}
+
+func (i *Importer) run(job *Job, file string) {
+	// the job outlives the request.
+	ctx := context.Background()
+	defer os.Remove(file)
+
+	fail := func(err error) {
+		i.logger.Error("import issue", "error", err, "import_id", job.ID.Hex())
+		now := time.Now()
+		job.Status, job.Error, job.FinishedAt = JobFailed, err.Error(), &now
+		i.jobs.Progress(job, ctx)
+	}
+
+	fingerprints, err := i.fingerprints(job.UserID.Hex(), ctx)
+	if err != nil {
+		fail(err)
+		return
+	}
+
+	job.Status = JobRunning
+	if err := i.jobs.Progress(job, ctx); err != nil {
+		fail(err)
+		return
+	}
+
+	// the entries are imported as they are read, the file is never held in memory.
+	items := []*Item{}
+	err = parse(job.Format, file, i.config, func(entry entry) error {
+		item := i.importEntry(job, entry, fingerprints, ctx)
+
+		switch item.Status {
+		case ItemImported:
+			job.Imported++
+		case ItemDuplicate:
+			job.Duplicates++
+		case ItemFailed:
+			job.Failed++
+		}
+
+		job.Total++
+		job.Processed++
+		items = append(items, item)
+
+		if len(items) < batch {
+			return nil
+		}
+
+		err := i.save(job, items, ctx)
+		items = items[:0]
+		return err
+	})
+
+	if err != nil {
+		// the report keeps the notes imported before the error.
+		i.jobs.AddItems(items, ctx)
+		fail(err)
+		return
+	}
+
+	now := time.Now()
+	job.Status, job.FinishedAt = JobDone, &now
+
+	if err := i.save(job, items, ctx); err != nil {
+		fail(err)
+	}
+}
+
+func (i *Importer) importEntry(job *Job, entry entry, fingerprints map[string]bool, ctx context.Context) *Item {
+	item := &Item{JobID: job.ID, Source: entry.source}
+
+	if entry.err != nil {
+		item.Status, item.Error = ItemFailed, entry.err.Error()
+		return item
+	}
+
+	note := entry.note
+	item.Title, item.Type = note.Title, note.Type
+
+	if _, ok := i.types.Get(note.Type); !ok {
+		item.Status, item.Error = ItemFailed, "Unknown note type "+note.Type
+		return item
+	}
+
+	if strings.TrimSpace(note.Title) == "" {
+		item.Status, item.Error = ItemFailed, "The title is empty"
+		return item
+	}
+
+	// duplicates of existing notes, or of an earlier item of the same import.
+	fingerprint := i.fingerprint(note)
+	if fingerprints[fingerprint] {
+		item.Status = ItemDuplicate
+		return item
+	}
+	fingerprints[fingerprint] = true
+
+	if job.DryRun {
+		item.Status = ItemNew
+		return item
+	}
+
+	if note.CreatedAt.IsZero() {
+		note.CreatedAt = time.Now()
+	}
+
+	if note.UpdatedAt.IsZero() {
+		note.UpdatedAt = note.CreatedAt
+	}
+
+	if note.Tags == nil {
+		note.Tags = []string{}
+	}
+
+	note.SearchText = i.types.SearchText(note)
+
+	id, err := i.notes.Add(*note, job.UserID.Hex(), ctx)
+	if err != nil {
+		item.Status, item.Error = ItemFailed, err.Error()
+		return item
+	}
+
+	item.Status = ItemImported
+	if noteId, err := primitive.ObjectIDFromHex(id); err == nil {
+		item.NoteID = &noteId
+	}
+
+	return item
+}
+
+func (i *Importer) save(job *Job, items []*Item, ctx context.Context) error {
+	if err := i.jobs.AddItems(items, ctx); err != nil {
+		return err
+	}
+
+	return i.jobs.Progress(job, ctx)
+}
+
+// fingerprints returns the fingerprints of the notes the user already has.
+func (i *Importer) fingerprints(userId string, ctx context.Context) (map[string]bool, error) {
+	fingerprints := make(map[string]bool)
+
+	err := i.notes.Each(userId, func(note *models.EmbeddedNote) error {
+		fingerprints[i.fingerprint(note)] = true
+		return nil
+	}, ctx)
+
+	return fingerprints, err
+}
+
+// fingerprint identifies a note by its type, title and content, tags and dates are left out.
+func (i *Importer) fingerprint(note *models.EmbeddedNote) string {
+	content := ""
+	if t, ok := i.types.Get(note.Type); ok && note.Data != nil {
+		content = t.SearchText(note.Data)
+	}
+
+	sum := sha256.Sum256([]byte(note.Type + "\n" + strings.ToLower(strings.TrimSpace(note.Title)) + "\n" + strings.TrimSpace(content)))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,118 @@
+package imports
+
+import (
+	"archive/zip"
+	"encoding/json"
+	"errors"
+	"path"
+	"strings"
+	"time"
+
+	"memo/api/notes/models"
+)
+
+// keepNote is a note of a Google Keep Takeout archive (Takeout/Keep/*.json).
+type keepNote struct {
+	Title       string `json:"title"`
+	TextContent string `json:"textContent"`
+	ListContent []struct {
+		Text      string `json:"text"`
+		IsChecked bool   `json:"isChecked"`
+	} `json:"listContent"`
+	Labels []struct {
+		Name string `json:"name"`
+	} `json:"labels"`
+	IsTrashed   bool  `json:"isTrashed"`
+	IsArchived  bool  `json:"isArchived"`
+	CreatedUsec int64 `json:"createdTimestampUsec"`
+	EditedUsec  int64 `json:"userEditedTimestampUsec"`
+}
+
+func isKeepNote(name string) bool {
+	return strings.HasSuffix(strings.ToLower(name), ".json") && strings.Contains("/"+path.Dir(name)+"/", "/Keep/")
+}
+
+// keep reads the notes of a Takeout archive, lists become todo notes and labels tags.
+// Trashed notes are left out.
+func (r *reader) keep(file string) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if skipZipFile(f) || !isKeepNote(f.Name) {
+			continue
+		}
+
+		content, err := r.readZipFile(f)
+		if errors.Is(err, ErrTooLarge) {
+			return err
+		}
+
+		var keep keepNote
+		if err == nil {
+			err = json.Unmarshal(content, &keep)
+		}
+
+		if err != nil {
+			err = r.emit(entry{source: f.Name, err: err})
+		} else if !keep.IsTrashed {
+			err = r.emit(entry{source: f.Name, note: keep.note(baseName(f.Name))})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (k keepNote) note(fallback string) *models.EmbeddedNote {
+	var note *models.EmbeddedNote
+
+	if len(k.ListContent) > 0 {
+		tasks := []models.Task{}
+		for _, item := range k.ListContent {
+			if strings.TrimSpace(item.Text) != "" {
+				tasks = append(tasks, task(item.Text, item.IsChecked))
+			}
+		}
+
+		title := k.Title
+		if title == "" && len(tasks) > 0 {
+			title = titleFrom(tasks[0].Content, fallback)
+		}
+
+		note = todoNote(title, tasks)
+	} else {
+		title := k.Title
+		if title == "" {
+			title = titleFrom(k.TextContent, fallback)
+		}
+
+		note = textNote(title, k.TextContent)
+	}
+
+	note.Tags = []string{}
+	for _, label := range k.Labels {
+		note.Tags = append(note.Tags, label.Name)
+	}
+
+	if k.IsArchived {
+		note.Tags = append(note.Tags, "archived")
+	}
+
+	if k.CreatedUsec > 0 {
+		note.CreatedAt = time.UnixMicro(k.CreatedUsec)
+	}
+
+	if k.EditedUsec > 0 {
+		note.UpdatedAt = time.UnixMicro(k.EditedUsec)
+	}
+
+	return note
+}
@@ -0,0 +1,288 @@
+package imports
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"path"
+	"strconv"
+	"strings"
+
+	"memo/api/notes/bookmark"
+	"memo/api/notes/models"
+)
+
+// markdownZip reads the .md and .txt files of a zip, and the movies.csv written by the export.
+func (r *reader) markdownZip(file string) error {
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return err
+	}
+
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if skipZipFile(f) {
+			continue
+		}
+
+		ext := strings.ToLower(path.Ext(f.Name))
+		if ext != ".md" && ext != ".markdown" && ext != ".txt" && path.Base(f.Name) != "movies.csv" {
+			continue
+		}
+
+		content, err := r.readZipFile(f)
+		switch {
+		case errors.Is(err, ErrTooLarge):
+			return err
+		case err != nil:
+			err = r.emit(entry{source: f.Name, err: err})
+		case path.Base(f.Name) == "movies.csv":
+			err = r.movies(f.Name, content)
+		default:
+			note, parseErr := parseMarkdown(f.Name, string(content))
+			err = r.emit(entry{source: f.Name, note: note, err: parseErr})
+		}
+
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// parseMarkdown maps a markdown file with an optional front matter onto a note.
+// A file that is only a checklist, or has "type: todo", becomes a todo note.
+func parseMarkdown(name, content string) (*models.EmbeddedNote, error) {
+	content = strings.ReplaceAll(content, "\r\n", "\n")
+	meta, body := splitFrontMatter(content)
+
+	title := meta.str("title")
+	noteType := meta.str("type")
+
+	// a leading "# heading" is the title when there is none in the front matter.
+	heading, rest := "", body
+	if trimmed := strings.TrimLeft(body, "\n"); strings.HasPrefix(trimmed, "# ") {
+		heading, rest, _ = strings.Cut(strings.TrimPrefix(trimmed, "# "), "\n")
+		heading = strings.TrimSpace(heading)
+	}
+
+	if title == "" {
+		title = heading
+	}
+
+	if title == "" {
+		title = baseName(name)
+	}
+
+	var note *models.EmbeddedNote
+
+	tasks, only := checklist(rest)
+	switch {
+	case noteType == "todo" || (noteType == "" && only):
+		note = todoNote(title, tasks)
+	case noteType == "link" && meta.str("url") != "":
+		normalized, err := bookmark.NormalizeURL(meta.str("url"))
+		if err != nil {
+			return nil, fmt.Errorf("Invalid url: %s", meta.str("url"))
+		}
+
+		note = &models.EmbeddedNote{
+			BaseNote: models.BaseNote{Type: "link", Title: title},
+			Data:     &models.LinkNoteData{URL: meta.str("url"), NormalizedURL: normalized, Title: title},
+		}
+	default:
+		note = textNote(title, strings.TrimLeft(body, "\n"))
+	}
+
+	note.Tags = meta.list("tags")
+	note.CreatedAt = parseDate(meta.first("created_at", "created", "date"))
+	note.UpdatedAt = parseDate(meta.first("updated_at", "updated", "modified"))
+
+	return note, nil
+}
+
+// movies reads a watchlist with at least a title column, a row at a time.
+func (r *reader) movies(name string, content []byte) error {
+	reader := csv.NewReader(bytes.NewReader(content))
+	reader.FieldsPerRecord = -1
+
+	header, err := reader.Read()
+	if err != nil {
+		return r.emit(entry{source: name, err: fmt.Errorf("Invalid csv file")})
+	}
+
+	columns := make(map[string]int)
+	for i, column := range header {
+		columns[strings.ToLower(strings.TrimSpace(column))] = i
+	}
+
+	if _, ok := columns["title"]; !ok {
+		return r.emit(entry{source: name, err: fmt.Errorf("The title column is missing")})
+	}
+
+	for line := 2; ; line++ {
+		row, err := reader.Read()
+		if err == io.EOF {
+			return nil
+		}
+
+		source := name + ":" + strconv.Itoa(line)
+		if err != nil {
+			return r.emit(entry{source: source, err: fmt.Errorf("Invalid csv file")})
+		}
+
+		get := func(column string) string {
+			if i, ok := columns[column]; ok && i < len(row) {
+				return strings.TrimSpace(row[i])
+			}
+			return ""
+		}
+
+		if get("title") == "" {
+			if err := r.emit(entry{source: source, err: fmt.Errorf("The title is empty")}); err != nil {
+				return err
+			}
+			continue
+		}
+
+		movie := &models.MovieNoteData{Director: get("director"), SourceID: get("source_id")}
+		movie.Year, _ = strconv.Atoi(get("year"))
+		movie.Runtime, _ = strconv.Atoi(get("runtime"))
+		movie.Watched, _ = strconv.ParseBool(get("watched"))
+		movie.Genres = splitComma(get("genres"))
+
+		err = r.emit(entry{source: source, note: &models.EmbeddedNote{
+			BaseNote: models.BaseNote{Type: "movie", Title: get("title"), Tags: splitComma(get("tags"))},
+			Data:     movie,
+		}})
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func splitComma(value string) []string {
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+	return list
+}
+
+// frontMatter holds the values of a yaml header, strings or lists of strings.
+type frontMatter map[string]any
+
+func (m frontMatter) str(key string) string {
+	value, _ := m[key].(string)
+	return value
+}
+
+func (m frontMatter) first(keys ...string) string {
+	for _, key := range keys {
+		if value := m.str(key); value != "" {
+			return value
+		}
+	}
+	return ""
+}
+
+func (m frontMatter) list(key string) []string {
+	switch value := m[key].(type) {
+	case []string:
+		return value
+	case string:
+		return splitComma(value)
+	}
+	return []string{}
+}
+
+// splitFrontMatter separates the "---" yaml header from the body. Only the subset of yaml
+// used by front matter is read: scalars, flow lists ([a, b]) and block lists ("- a").
+func splitFrontMatter(content string) (frontMatter, string) {
+	meta := frontMatter{}
+
+	if !strings.HasPrefix(content, "---\n") {
+		return meta, content
+	}
+
+	header, body, ok := strings.Cut(content[4:], "\n---\n")
+	if !ok {
+		if header, ok = strings.CutSuffix(content[4:], "\n---"); !ok {
+			return meta, content
+		}
+	}
+
+	key := ""
+	for _, line := range strings.Split(header, "\n") {
+		trimmed := strings.TrimSpace(line)
+		if trimmed == "" || strings.HasPrefix(trimmed, "#") {
+			continue
+		}
+
+		// item of a block list.
+		if strings.HasPrefix(trimmed, "- ") && key != "" {
+			list, _ := meta[key].([]string)
+			meta[key] = append(list, unquote(strings.TrimPrefix(trimmed, "- ")))
+			continue
+		}
+
+		name, value, ok := strings.Cut(line, ":")
+		if !ok {
+			continue
+		}
+
+		key = strings.ToLower(strings.TrimSpace(name))
+		value = strings.TrimSpace(value)
+
+		switch {
+		case value == "":
+			meta[key] = []string{}
+		case strings.HasPrefix(value, "[") && strings.HasSuffix(value, "]"):
+			meta[key] = flowList(value)
+		default:
+			meta[key] = unquote(value)
+		}
+	}
+
+	return meta, body
+}
+
+func flowList(value string) []string {
+	var list []string
+	if json.Unmarshal([]byte(value), &list) == nil {
+		return list
+	}
+
+	list = []string{}
+	for _, item := range strings.Split(strings.Trim(value, "[]"), ",") {
+		if item = unquote(strings.TrimSpace(item)); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		var s string
+		if json.Unmarshal([]byte(value), &s) == nil {
+			return s
+		}
+		return value[1 : len(value)-1]
+	}
+
+	if len(value) >= 2 && value[0] == '\'' && value[len(value)-1] == '\'' {
+		return strings.ReplaceAll(value[1:len(value)-1], "''", "'")
+	}
+
+	return value
+}
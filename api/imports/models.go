@@ -0,0 +1,102 @@
+package imports
+
+import (
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+const (
+	FormatMarkdown = "markdown"
+	FormatKeep     = "keep"
+	FormatENEX     = "enex"
+)
+
+const (
+	JobPending = "pending"
+	JobRunning = "running"
+	JobDone    = "done"
+	JobFailed  = "failed"
+)
+
+const (
+	ItemImported  = "imported"
+	ItemDuplicate = "duplicate"
+	ItemFailed    = "failed"
+	// ItemNew is used in dry runs, for items that would be imported.
+	ItemNew = "new"
+)
+
+// Job is an import running in the background, its items are stored apart in import_items.
+type Job struct {
+	ID       primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID   primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Format   string             `bson:"format" json:"format"`
+	FileName string             `bson:"file_name" json:"file_name"`
+	DryRun   bool               `bson:"dry_run" json:"dry_run"`
+	Status   string             `bson:"status" json:"status"`
+	Error    string             `bson:"error,omitempty" json:"error,omitempty"`
+	// Total counts the notes read from the file so far, the file is read as they are imported.
+	Total      int        `bson:"total" json:"total"`
+	Processed  int        `bson:"processed" json:"processed"`
+	Imported   int        `bson:"imported" json:"imported"`
+	Duplicates int        `bson:"duplicates" json:"duplicates"`
+	Failed     int        `bson:"failed" json:"failed"`
+	CreatedAt  time.Time  `bson:"created_at" json:"created_at"`
+	FinishedAt *time.Time `bson:"finished_at" json:"finished_at"`
+}
+
+// Item is the result of one note of an import.
+type Item struct {
+	ID     primitive.ObjectID  `bson:"_id,omitempty" json:"id"`
+	JobID  primitive.ObjectID  `bson:"job_id" json:"job_id"`
+	Source string              `bson:"source" json:"source"`
+	Title  string              `bson:"title" json:"title"`
+	Type   string              `bson:"type" json:"type"`
+	Status string              `bson:"status" json:"status"`
+	Error  string              `bson:"error,omitempty" json:"error,omitempty"`
+	NoteID *primitive.ObjectID `bson:"note_id,omitempty" json:"note_id,omitempty"`
+}
+
+type Config struct {
+	// MaxSize is the size limit of an uploaded archive, in bytes.
+	MaxSize int64
+	// MaxUncompressed is the number of bytes read from the files of an archive, in total.
+	MaxUncompressed int64
+	// MaxEntries is the number of notes of an import.
+	MaxEntries int
+	// Workers is the number of imports running at once, the others wait for their turn.
+	Workers int
+}
+
+var DefaultConfig = Config{
+	MaxSize:         100 * 1000 * 1000, // 100Mb
+	MaxUncompressed: 500 * 1000 * 1000, // 500Mb
+	MaxEntries:      10000,
+	Workers:         2,
+}
+
+// LoadConfig reads IMPORT_MAX_SIZE and IMPORT_MAX_UNCOMPRESSED (in bytes), IMPORT_MAX_ENTRIES and
+// IMPORT_WORKERS, missing values keep the defaults.
+func LoadConfig(getEnv func(string) string) Config {
+	config := DefaultConfig
+
+	if size, err := strconv.ParseInt(getEnv("IMPORT_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		config.MaxSize = size
+	}
+
+	if size, err := strconv.ParseInt(getEnv("IMPORT_MAX_UNCOMPRESSED"), 10, 64); err == nil && size > 0 {
+		config.MaxUncompressed = size
+	}
+
+	if entries, err := strconv.Atoi(getEnv("IMPORT_MAX_ENTRIES")); err == nil && entries > 0 {
+		config.MaxEntries = entries
+	}
+
+	if workers, err := strconv.Atoi(getEnv("IMPORT_WORKERS")); err == nil && workers > 0 {
+		config.Workers = workers
+	}
+
+	return config
+}
@@ -0,0 +1,237 @@
+package imports
+
+import (
+	"archive/zip"
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+)
+
+var ErrFormat = errors.New("unknown import format")
+
+// entry is a note read from an import file, err is set when it can't be imported.
+type entry struct {
+	source string
+	note   *models.EmbeddedNote
+	err    error
+}
+
+// detect guesses the format of the file at path: enex is xml, a takeout archive has a Keep folder,
+// any other zip is read as markdown.
+func detect(name, file string) (string, error) {
+	if strings.HasSuffix(strings.ToLower(name), ".enex") {
+		return FormatENEX, nil
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return "", err
+	}
+
+	defer f.Close()
+
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(f, head)
+	head = head[:n]
+
+	if strings.HasPrefix(strings.TrimSpace(string(head)), "<?xml") && strings.Contains(string(head), "en-export") {
+		return FormatENEX, nil
+	}
+
+	if !strings.HasPrefix(string(head), "PK") {
+		return "", ErrFormat
+	}
+
+	archive, err := zip.OpenReader(file)
+	if err != nil {
+		return "", ErrFormat
+	}
+
+	defer archive.Close()
+
+	for _, f := range archive.File {
+		if isKeepNote(f.Name) {
+			return FormatKeep, nil
+		}
+	}
+
+	return FormatMarkdown, nil
+}
+
+// ErrTooLarge stops an import whose archive holds more entries or data than Config allows.
+var ErrTooLarge = errors.New("The archive holds too many notes or too much data")
+
+// maxFileSize is the size limit of a file of an archive.
+const maxFileSize = 10 << 20
+
+// reader passes the entries of an import file to yield one at a time, within the limits of
+// the job: the number of entries and the bytes read from the archive.
+type reader struct {
+	config  Config
+	yield   func(entry) error
+	entries int
+	read    int64
+}
+
+// parse reads file and calls yield with each entry, it stops at the first error of yield.
+func parse(format, file string, config Config, yield func(entry) error) error {
+	r := &reader{config: config, yield: yield}
+
+	switch format {
+	case FormatMarkdown:
+		return r.markdownZip(file)
+	case FormatKeep:
+		return r.keep(file)
+	case FormatENEX:
+		return r.enex(file)
+	}
+
+	return ErrFormat
+}
+
+func (r *reader) emit(e entry) error {
+	r.entries++
+	if r.entries > r.config.MaxEntries {
+		return ErrTooLarge
+	}
+
+	return r.yield(e)
+}
+
+// readZipFile reads a file of an archive, up to 10Mb. The bytes count toward the limit of
+// the job whatever the archive claims, it fails with ErrTooLarge past it.
+func (r *reader) readZipFile(f *zip.File) ([]byte, error) {
+	if f.UncompressedSize64 > maxFileSize {
+		return nil, fmt.Errorf("File is too big")
+	}
+
+	rc, err := f.Open()
+	if err != nil {
+		return nil, err
+	}
+
+	defer rc.Close()
+
+	limit := min(maxFileSize, r.config.MaxUncompressed-r.read) + 1
+	content, err := io.ReadAll(io.LimitReader(rc, limit))
+	r.read += int64(len(content))
+
+	if r.read > r.config.MaxUncompressed {
+		return nil, ErrTooLarge
+	}
+
+	if len(content) > maxFileSize {
+		return nil, fmt.Errorf("File is too big")
+	}
+
+	return content, err
+}
+
+// skipZipFile reports if f is a folder or a file added by the os (__MACOSX, .DS_Store).
+func skipZipFile(f *zip.File) bool {
+	if f.FileInfo().IsDir() {
+		return true
+	}
+
+	for _, part := range strings.Split(f.Name, "/") {
+		if strings.HasPrefix(part, ".") || part == "__MACOSX" {
+			return true
+		}
+	}
+
+	return false
+}
+
+var taskLine = regexp.MustCompile(`^\s*[-*+]\s+\[([ xX])\]\s+(.*)$`)
+
+// checklist returns the tasks of a markdown checklist, only is set when body has nothing else.
+func checklist(body string) (tasks []models.Task, only bool) {
+	only = true
+
+	scanner := bufio.NewScanner(strings.NewReader(body))
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	for scanner.Scan() {
+		line := scanner.Text()
+
+		match := taskLine.FindStringSubmatch(line)
+		if match == nil {
+			if strings.TrimSpace(line) != "" {
+				only = false
+			}
+			continue
+		}
+
+		tasks = append(tasks, task(match[2], match[1] != " "))
+	}
+
+	return tasks, only && len(tasks) > 0
+}
+
+func task(content string, done bool) models.Task {
+	t := models.Task{ID: primitive.NewObjectID(), Content: strings.TrimSpace(content), IsCompleted: done}
+	if done {
+		now := time.Now()
+		t.CompletedAt = &now
+	}
+
+	return t
+}
+
+func textNote(title, content string) *models.EmbeddedNote {
+	return &models.EmbeddedNote{
+		BaseNote: models.BaseNote{Type: "text", Title: title},
+		Data:     &models.TextNoteData{Content: content},
+	}
+}
+
+func todoNote(title string, tasks []models.Task) *models.EmbeddedNote {
+	return &models.EmbeddedNote{
+		BaseNote: models.BaseNote{Type: "todo", Title: title},
+		Data:     &models.TodoNoteData{Tasks: tasks},
+	}
+}
+
+// titleFrom returns the first line of content, shortened, for notes without a title.
+func titleFrom(content, fallback string) string {
+	for _, line := range strings.Split(content, "\n") {
+		line = strings.TrimSpace(strings.TrimLeft(line, "#-*>[] "))
+		if line == "" {
+			continue
+		}
+
+		if runes := []rune(line); len(runes) > 80 {
+			line = string(runes[:80])
+		}
+
+		return line
+	}
+
+	return fallback
+}
+
+func baseName(name string) string {
+	return strings.TrimSuffix(path.Base(name), path.Ext(name))
+}
+
+var dateLayouts = []string{time.RFC3339, "2006-01-02 15:04:05", "2006-01-02T15:04:05", "2006-01-02", "20060102T150405Z"}
+
+func parseDate(value string) time.Time {
+	for _, layout := range dateLayouts {
+		if t, err := time.Parse(layout, strings.TrimSpace(value)); err == nil {
+			return t
+		}
+	}
+
+	return time.Time{}
+}
@@ -0,0 +1,73 @@
+package imports
+
+import (
+	"archive/zip"
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+// markdownArchive writes a zip of n markdown files of size bytes each.
+func markdownArchive(t *testing.T, n, size int) string {
+	file := filepath.Join(t.TempDir(), "notes.zip")
+
+	f, err := os.Create(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	defer f.Close()
+
+	archive := zip.NewWriter(f)
+	for i := 0; i < n; i++ {
+		w, err := archive.Create("note " + strconv.Itoa(i) + ".md")
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(strings.Repeat("a", size)))
+	}
+
+	if err := archive.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	return file
+}
+
+func TestParseLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		config Config
+		read   int
+		err    error
+	}{
+		{"within the limits", Config{MaxEntries: 5, MaxUncompressed: 5000}, 5, nil},
+		{"too many entries", Config{MaxEntries: 3, MaxUncompressed: 5000}, 3, ErrTooLarge},
+		{"too much data", Config{MaxEntries: 5, MaxUncompressed: 2500}, 2, ErrTooLarge},
+	}
+
+	file := markdownArchive(t, 5, 1000)
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			read := 0
+			err := parse(FormatMarkdown, file, test.config, func(entry entry) error {
+				if entry.err != nil {
+					t.Errorf("%s: %s", entry.source, entry.err)
+				}
+				read++
+				return nil
+			})
+
+			if !errors.Is(err, test.err) {
+				t.Errorf("parse = %v, want %v", err, test.err)
+			}
+			if read != test.read {
+				t.Errorf("%d entries read, want %d", read, test.read)
+			}
+		})
+	}
+}
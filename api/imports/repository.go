@@ -0,0 +1,136 @@
+package imports
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type JobRepository interface {
+	Create(job *Job, ctx context.Context) error
+	Get(id string, userId string, ctx context.Context) (*Job, error)
+	// Progress saves the status and counters of job.
+	Progress(job *Job, ctx context.Context) error
+	AddItems(items []*Item, ctx context.Context) error
+	// Items lists the items of a job, status filters them when set.
+	Items(jobId primitive.ObjectID, status string, ctx context.Context) ([]*Item, error)
+	// FailRunning marks the jobs left running by a previous process as failed.
+	FailRunning(ctx context.Context) error
+}
+
+type jobRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) JobRepository {
+	return &jobRepository{client}
+}
+
+func (r *jobRepository) Create(job *Job, ctx context.Context) error {
+	result, err := r.client.Collection("import_jobs").InsertOne(ctx, job)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		job.ID = id
+	}
+
+	return nil
+}
+
+func (r *jobRepository) Get(id string, userId string, ctx context.Context) (*Job, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var job *Job
+	filter := bson.M{"_id": oId, "user_id": oUserId}
+	if err := r.client.Collection("import_jobs").FindOne(ctx, filter).Decode(&job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func (r *jobRepository) Progress(job *Job, ctx context.Context) error {
+	update := bson.M{"$set": bson.M{
+		"status":      job.Status,
+		"error":       job.Error,
+		"total":       job.Total,
+		"processed":   job.Processed,
+		"imported":    job.Imported,
+		"duplicates":  job.Duplicates,
+		"failed":      job.Failed,
+		"finished_at": job.FinishedAt,
+	}}
+
+	result, err := r.client.Collection("import_jobs").UpdateByID(ctx, job.ID, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *jobRepository) AddItems(items []*Item, ctx context.Context) error {
+	if len(items) == 0 {
+		return nil
+	}
+
+	docs := make([]any, 0, len(items))
+	for _, item := range items {
+		docs = append(docs, item)
+	}
+
+	_, err := r.client.Collection("import_items").InsertMany(ctx, docs)
+	return err
+}
+
+func (r *jobRepository) Items(jobId primitive.ObjectID, status string, ctx context.Context) ([]*Item, error) {
+	filter := bson.M{"job_id": jobId}
+	if status != "" {
+		filter["status"] = status
+	}
+
+	cursor, err := r.client.Collection("import_items").Find(ctx, filter, options.Find().SetSort(bson.M{"_id": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	items := []*Item{}
+	if err := cursor.All(ctx, &items); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+func (r *jobRepository) FailRunning(ctx context.Context) error {
+	filter := bson.M{"status": bson.M{"$in": []string{JobPending, JobRunning}}}
+	update := bson.M{"$set": bson.M{
+		"status":      JobFailed,
+		"error":       "Interrupted by a restart",
+		"finished_at": time.Now(),
+	}}
+
+	_, err := r.client.Collection("import_jobs").UpdateMany(ctx, filter, update)
+	return err
+}
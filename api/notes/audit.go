@@ -0,0 +1,40 @@
+package notes
+
+import (
+	"context"
+
+	"memo/api/audit"
+	"memo/api/notes/models"
+)
+
+// Auditor records the deleted notes in the audit log, whether they're deleted one by one, in bulk
+// or by a sync. It's registered as a notes repository hook.
+type Auditor struct {
+	recorder audit.Recorder
+}
+
+func NewAuditor(recorder audit.Recorder) *Auditor {
+	return &Auditor{recorder}
+}
+
+func (a *Auditor) NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error {
+	return nil
+}
+
+func (a *Auditor) NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error {
+	// the users who could read the note see its deletion in their log.
+	users := []string{}
+	for _, userId := range note.Readers() {
+		users = append(users, userId.Hex())
+	}
+
+	a.recorder.Record(audit.Entry{
+		Action:     audit.NoteDeleted,
+		Users:      users,
+		TargetType: "note",
+		TargetID:   note.ID.Hex(),
+		Details:    map[string]string{"title": note.Title, "owner_id": note.UserId.Hex()},
+	}, ctx)
+
+	return nil
+}
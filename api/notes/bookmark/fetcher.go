@@ -0,0 +1,239 @@
+package bookmark
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"golang.org/x/net/html"
+	"golang.org/x/net/html/charset"
+
+	"memo/pkg/security"
+)
+
+const (
+	maxPageSize     = 2 * 1000 * 1000 // 2Mb
+	maxSnapshotSize = 100 * 1000
+)
+
+type Page struct {
+	URL         string
+	Title       string
+	Description string
+	Favicon     string
+	// Text is the readable text of the page, used as the archived snapshot.
+	Text string
+}
+
+// Fetcher retrieves a page so link notes can show its title and description.
+type Fetcher interface {
+	Fetch(url string, ctx context.Context) (*Page, error)
+}
+
+type httpFetcher struct {
+	client *http.Client
+}
+
+// NewHTTPFetcher returns a Fetcher using client. When nil, a client with a 10s timeout that only
+// connects to public addresses is used, the urls come from the users.
+func NewHTTPFetcher(client *http.Client) Fetcher {
+	if client == nil {
+		client = security.PublicClient(10 * time.Second)
+	}
+
+	return &httpFetcher{client}
+}
+
+func (f *httpFetcher) Fetch(pageUrl string, ctx context.Context) (*Page, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, pageUrl, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("User-Agent", "memo-link-preview/1.0")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	if resp.StatusCode >= 400 {
+		return nil, fmt.Errorf("Fetching %s: %s", pageUrl, resp.Status)
+	}
+
+	contentType := resp.Header.Get("Content-Type")
+	if mediaType, _, err := mime.ParseMediaType(contentType); err != nil || (mediaType != "text/html" && mediaType != "application/xhtml+xml") {
+		return nil, fmt.Errorf("Fetching %s: not an html page (%s)", pageUrl, contentType)
+	}
+
+	body, err := charset.NewReader(io.LimitReader(resp.Body, maxPageSize), contentType)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := html.Parse(body)
+	if err != nil {
+		return nil, err
+	}
+
+	// the final url, after redirects, is used to resolve relative links.
+	return parsePage(doc, resp.Request.URL), nil
+}
+
+func parsePage(doc *html.Node, base *url.URL) *Page {
+	page := &Page{URL: base.String()}
+
+	var ogTitle, ogDescription, title, icon string
+	var article, body *html.Node
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if n.Type == html.ElementNode {
+			switch n.Data {
+			case "title":
+				if title == "" && n.FirstChild != nil {
+					title = n.FirstChild.Data
+				}
+			case "meta":
+				name := strings.ToLower(attr(n, "name") + attr(n, "property"))
+				switch name {
+				case "description":
+					page.Description = attr(n, "content")
+				case "og:title":
+					ogTitle = attr(n, "content")
+				case "og:description":
+					ogDescription = attr(n, "content")
+				}
+			case "link":
+				rel := strings.Fields(strings.ToLower(attr(n, "rel")))
+				for _, r := range rel {
+					if r == "icon" && icon == "" {
+						icon = attr(n, "href")
+					}
+				}
+			case "article", "main":
+				if article == nil {
+					article = n
+				}
+			case "body":
+				body = n
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+	}
+	walk(doc)
+
+	page.Title = clean(firstOf(ogTitle, title))
+	page.Description = clean(firstOf(page.Description, ogDescription))
+	page.Favicon = resolve(base, firstOf(icon, "/favicon.ico"))
+
+	if root := firstNode(article, body); root != nil {
+		page.Text = readableText(root)
+	}
+
+	return page
+}
+
+// elements that never hold the content of the page.
+var skipped = map[string]bool{
+	"script": true, "style": true, "noscript": true, "nav": true, "header": true,
+	"footer": true, "aside": true, "form": true, "svg": true, "iframe": true, "template": true,
+}
+
+// elements that start a new line in the snapshot.
+var blocks = map[string]bool{
+	"p": true, "div": true, "li": true, "pre": true, "blockquote": true, "tr": true, "br": true,
+	"h1": true, "h2": true, "h3": true, "h4": true, "h5": true, "h6": true, "section": true,
+}
+
+func readableText(root *html.Node) string {
+	var b strings.Builder
+
+	var walk func(n *html.Node)
+	walk = func(n *html.Node) {
+		if b.Len() > maxSnapshotSize {
+			return
+		}
+
+		switch n.Type {
+		case html.TextNode:
+			if text := strings.Join(strings.Fields(n.Data), " "); text != "" {
+				if b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+					b.WriteString(" ")
+				}
+				b.WriteString(text)
+			}
+			return
+		case html.ElementNode:
+			if skipped[n.Data] {
+				return
+			}
+		}
+
+		for c := n.FirstChild; c != nil; c = c.NextSibling {
+			walk(c)
+		}
+
+		if n.Type == html.ElementNode && blocks[n.Data] && b.Len() > 0 && !strings.HasSuffix(b.String(), "\n") {
+			b.WriteString("\n")
+		}
+	}
+	walk(root)
+
+	text := strings.TrimSpace(b.String())
+	if len(text) > maxSnapshotSize {
+		text = strings.ToValidUTF8(text[:maxSnapshotSize], "")
+	}
+
+	return text
+}
+
+func attr(n *html.Node, key string) string {
+	for _, a := range n.Attr {
+		if strings.EqualFold(a.Key, key) {
+			return a.Val
+		}
+	}
+	return ""
+}
+
+func resolve(base *url.URL, ref string) string {
+	u, err := base.Parse(ref)
+	if err != nil {
+		return ""
+	}
+	return u.String()
+}
+
+func clean(s string) string {
+	return strings.Join(strings.Fields(s), " ")
+}
+
+func firstOf(values ...string) string {
+	for _, v := range values {
+		if strings.TrimSpace(v) != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+func firstNode(nodes ...*html.Node) *html.Node {
+	for _, n := range nodes {
+		if n != nil {
+			return n
+		}
+	}
+	return nil
+}
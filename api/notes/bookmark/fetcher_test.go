@@ -0,0 +1,89 @@
+package bookmark
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const page = `<!doctype html>
+<html>
+<head>
+	<title>Fallback title</title>
+	<meta property="og:title" content="  The   Title ">
+	<meta name="description" content="A description">
+	<link rel="shortcut icon" href="/static/icon.png">
+</head>
+<body>
+	<nav>Home About</nav>
+	<article><h1>Heading</h1><p>First paragraph.</p><script>alert(1)</script><p>Second one.</p></article>
+	<footer>Copyright</footer>
+</body>
+</html>`
+
+func testServer(t *testing.T) *httptest.Server {
+	mux := http.NewServeMux()
+	mux.HandleFunc("/page", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		w.Write([]byte(page))
+	})
+	mux.HandleFunc("/moved", func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, "/page", http.StatusMovedPermanently)
+	})
+	mux.HandleFunc("/file.pdf", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Write([]byte("%PDF-1.4"))
+	})
+
+	server := httptest.NewServer(mux)
+	t.Cleanup(server.Close)
+
+	return server
+}
+
+func TestFetch(t *testing.T) {
+	server := testServer(t)
+	fetcher := NewHTTPFetcher(server.Client())
+
+	got, err := fetcher.Fetch(server.URL+"/moved", context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := &Page{
+		// the final url, after the redirect.
+		URL:         server.URL + "/page",
+		Title:       "The Title",
+		Description: "A description",
+		Favicon:     server.URL + "/static/icon.png",
+		Text:        "Heading\nFirst paragraph.\nSecond one.",
+	}
+	if *got != *want {
+		t.Errorf("Fetch = %+v, want %+v", *got, *want)
+	}
+}
+
+func TestFetchErrors(t *testing.T) {
+	server := testServer(t)
+	fetcher := NewHTTPFetcher(server.Client())
+
+	for _, path := range []string{"/missing", "/file.pdf"} {
+		if _, err := fetcher.Fetch(server.URL+path, context.Background()); err == nil {
+			t.Errorf("Fetch(%s) succeeded", path)
+		}
+	}
+}
+
+func TestDefaultFetcherRefusesPrivateAddresses(t *testing.T) {
+	server := testServer(t)
+	fetcher := NewHTTPFetcher(nil)
+
+	for _, pageUrl := range []string{server.URL + "/page", "http://169.254.169.254/latest/meta-data/", "http://[::1]/"} {
+		_, err := fetcher.Fetch(pageUrl, context.Background())
+		if err == nil || !strings.Contains(err.Error(), "not public") {
+			t.Errorf("Fetch(%s) = %v, want an address error", pageUrl, err)
+		}
+	}
+}
@@ -0,0 +1,73 @@
+package bookmark
+
+import (
+	"fmt"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// query parameters that only track where the visitor came from.
+var trackingParams = []string{"utm_", "fbclid", "gclid", "mc_cid", "mc_eid", "ref_src"}
+
+// NormalizeURL returns a canonical form of raw, two urls pointing to the same page
+// should normalize to the same string so duplicates can be detected.
+func NormalizeURL(raw string) (string, error) {
+	raw = strings.TrimSpace(raw)
+	if !strings.Contains(raw, "://") {
+		raw = "https://" + raw
+	}
+
+	u, err := url.Parse(raw)
+	if err != nil {
+		return "", err
+	}
+
+	u.Scheme = strings.ToLower(u.Scheme)
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return "", fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	host := strings.ToLower(u.Hostname())
+	if host == "" {
+		return "", fmt.Errorf("url has no host")
+	}
+
+	host = strings.TrimPrefix(host, "www.")
+	if port := u.Port(); port != "" && !(u.Scheme == "http" && port == "80") && !(u.Scheme == "https" && port == "443") {
+		host = host + ":" + port
+	}
+
+	u.Host = host
+	u.User = nil
+	u.Fragment = ""
+	u.RawFragment = ""
+
+	u.Path = strings.TrimSuffix(u.Path, "/")
+	u.RawPath = ""
+
+	query := u.Query()
+	for key := range query {
+		if isTrackingParam(key) {
+			query.Del(key)
+		}
+	}
+
+	// url.Values.Encode sorts by key, values keep their order.
+	for _, values := range query {
+		sort.Strings(values)
+	}
+	u.RawQuery = query.Encode()
+
+	return u.String(), nil
+}
+
+func isTrackingParam(key string) bool {
+	key = strings.ToLower(key)
+	for _, p := range trackingParams {
+		if strings.HasPrefix(key, p) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,318 @@
+package notes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"memo/api/authz"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/api/share"
+	"memo/pkg/database"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+// a bulk request can touch this many notes at most.
+const maxBulkItems = 500
+
+var errBulkFailed = errors.New("bulk operation failed")
+
+type bulkOperation struct {
+	Op    string   `json:"op"`
+	IDs   []string `json:"ids"`
+	Tags  []string `json:"tags"`
+	Title *string  `json:"title"`
+	// Notebook is set by move, and by update when not nil.
+	Notebook   *string           `json:"notebook"`
+	UserID     string            `json:"user_id"`
+	Permission models.Permission `json:"permission"`
+}
+
+type bulkResult struct {
+	Op     int    `json:"op"`
+	ID     string `json:"id"`
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+type bulkResponse struct {
+	// Atomic is set when the operations ran in a transaction, then nothing is applied if one fails.
+	Atomic  bool         `json:"atomic"`
+	Applied bool         `json:"applied"`
+	Results []bulkResult `json:"results"`
+}
+
+// HandleBulk applies a list of operations (delete, add_tags, remove_tags, update, move and share)
+// to many notes. The operations run in a transaction when the deployment supports them.
+func HandleBulk(logger logger.Logger, repo repository.NotesRepository, sharer *share.Sharer, types *models.Registry, tx *database.Transactor) http.HandlerFunc {
+	type bulkRequest struct {
+		Operations []bulkOperation `json:"operations"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		var req bulkRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			response.ValidationErr(w, map[string]string{"operations": "required|array"})
+			return
+		}
+
+		if problems := validBulk(req.Operations); len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		res := bulkResponse{Atomic: tx.Supported()}
+		var runHooks func(ctx context.Context)
+
+		err := tx.Run(func(ctx context.Context) error {
+			// a retried transaction starts over.
+			ctx, runHooks = repository.DeferHooks(ctx)
+			bulk := &bulk{repo, sharer, types, userId, make(map[string]*models.EmbeddedNote)}
+			res.Results = bulk.apply(req.Operations, ctx)
+
+			for _, result := range res.Results {
+				if result.Status == "failed" && res.Atomic {
+					return errBulkFailed
+				}
+			}
+
+			return nil
+		}, r.Context())
+
+		if err != nil && !errors.Is(err, errBulkFailed) {
+			logger.For(r.Context()).Error("bulk issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		if errors.Is(err, errBulkFailed) {
+			for i := range res.Results {
+				if res.Results[i].Status == "ok" {
+					res.Results[i].Status = "rolled_back"
+				}
+			}
+		} else {
+			res.Applied = true
+			// the hooks and the share notifications, events and audit entries.
+			runHooks(r.Context())
+		}
+
+		response.Respond(w, res, http.StatusOK)
+	})
+}
+
+func validBulk(operations []bulkOperation) map[string]string {
+	problems := make(map[string]string)
+
+	if len(operations) == 0 {
+		problems["operations"] = "required|array"
+		return problems
+	}
+
+	items := 0
+	for i, op := range operations {
+		key := "operations." + strconv.Itoa(i) + "."
+		items += len(op.IDs)
+
+		if len(op.IDs) == 0 {
+			problems[key+"ids"] = "required|array"
+		}
+
+		switch op.Op {
+		case "delete":
+		case "add_tags", "remove_tags":
+			if len(op.Tags) == 0 {
+				problems[key+"tags"] = "required|array"
+			}
+		case "update":
+			if op.Title == nil && op.Notebook == nil && op.Tags == nil {
+				problems[key+"title"] = "required"
+			}
+
+			if op.Title != nil && strings.TrimSpace(*op.Title) == "" {
+				problems[key+"title"] = "required"
+			}
+		case "move":
+			if op.Notebook == nil {
+				problems[key+"notebook"] = "required"
+			}
+		case "share":
+			if op.UserID == "" {
+				problems[key+"user_id"] = "required"
+			}
+
+			if !authz.Grantable(op.Permission) {
+				problems[key+"permission"] = "required|in:read,comment,write,manage"
+			}
+		default:
+			problems[key+"op"] = "required|in:delete,add_tags,remove_tags,update,move,share"
+		}
+	}
+
+	if items > maxBulkItems {
+		problems["operations"] = "max:" + strconv.Itoa(maxBulkItems)
+	}
+
+	return problems
+}
+
+type bulk struct {
+	repo   repository.NotesRepository
+	sharer *share.Sharer
+	types  *models.Registry
+	userId string
+	// notes already loaded, nil once deleted, so later operations see the changes.
+	notes map[string]*models.EmbeddedNote
+}
+
+func (b *bulk) apply(operations []bulkOperation, ctx context.Context) []bulkResult {
+	results := []bulkResult{}
+
+	for i, op := range operations {
+		for _, id := range op.IDs {
+			result := bulkResult{Op: i, ID: id, Status: "ok"}
+
+			if err := b.applyOne(op, id, ctx); err != nil {
+				result.Status, result.Error = "failed", err.Error()
+			}
+
+			results = append(results, result)
+		}
+	}
+
+	return results
+}
+
+func (b *bulk) applyOne(op bulkOperation, id string, ctx context.Context) error {
+	note, err := b.note(id, ctx)
+	if err != nil {
+		return err
+	}
+
+	// deleting and sharing have their own rules, the other operations edit the note.
+	action := authz.Edit
+	switch op.Op {
+	case "delete":
+		action = authz.Delete
+	case "share":
+		action = authz.Share
+	}
+
+	if !authz.Can(note, b.userId, action) {
+		return errors.New(authz.Message(action))
+	}
+
+	fields := map[string]any{}
+
+	switch op.Op {
+	case "delete":
+		if err := b.repo.Delete(id, b.userId, ctx); err != nil {
+			return err
+		}
+
+		b.notes[id] = nil
+		return nil
+	case "share":
+		if op.UserID == b.userId {
+			return errors.New("Can't share the note with yourself.")
+		}
+
+		if !authz.CanGrant(note, b.userId, op.Permission) {
+			return errors.New("You can't share this note with the " + string(op.Permission) + " permission")
+		}
+
+		if err := b.sharer.Share(note, op.UserID, op.Permission, ctx); err != nil {
+			return err
+		}
+
+		// sharing changes the version, the note is read again by the next operation.
+		delete(b.notes, id)
+		return nil
+	case "add_tags":
+		note.Tags = addTags(note.Tags, op.Tags)
+		fields["tags"] = note.Tags
+	case "remove_tags":
+		note.Tags = removeTags(note.Tags, op.Tags)
+		fields["tags"] = note.Tags
+	case "update":
+		if op.Title != nil {
+			note.Title = strings.TrimSpace(*op.Title)
+			fields["title"] = note.Title
+		}
+
+		if op.Tags != nil {
+			note.Tags = addTags([]string{}, op.Tags)
+			fields["tags"] = note.Tags
+		}
+
+		if op.Notebook != nil {
+			note.Notebook = strings.TrimSpace(*op.Notebook)
+			fields["notebook"] = note.Notebook
+		}
+	case "move":
+		note.Notebook = strings.TrimSpace(*op.Notebook)
+		fields["notebook"] = note.Notebook
+	}
+
+	note.SearchText = b.types.SearchText(note)
+	return b.repo.Update(note, fields, ctx)
+}
+
+func (b *bulk) note(id string, ctx context.Context) (*models.EmbeddedNote, error) {
+	note, ok := b.notes[id]
+	if !ok {
+		var err error
+		if note, err = b.repo.GetById(id, ctx); err != nil {
+			note = nil
+		}
+		b.notes[id] = note
+	}
+
+	if note == nil {
+		return nil, errors.New("Note not found")
+	}
+
+	return note, nil
+}
+
+func addTags(tags []string, add []string) []string {
+	if tags == nil {
+		tags = []string{}
+	}
+
+	for _, tag := range add {
+		tag = strings.TrimSpace(tag)
+		if tag != "" && !contains(tags, tag) {
+			tags = append(tags, tag)
+		}
+	}
+
+	return tags
+}
+
+func removeTags(tags []string, remove []string) []string {
+	kept := []string{}
+	for _, tag := range tags {
+		if !contains(remove, tag) {
+			kept = append(kept, tag)
+		}
+	}
+
+	return kept
+}
+
+func contains(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
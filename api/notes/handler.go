@@ -1,13 +1,19 @@
 package notes
 
 import (
+	"context"
 	"encoding/json"
+	"errors"
 	"net/http"
+	"strings"
 	"time"
 
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/authz"
+	"memo/api/notes/bookmark"
 	"memo/api/notes/models"
 	"memo/api/notes/repository"
-	"memo/api/share"
 	"memo/pkg/logger"
 	"memo/pkg/response"
 	"memo/pkg/validation"
@@ -20,15 +26,31 @@ func HandleAll(logger logger.Logger, repo repository.NotesRepository) http.Handl
 		nType := r.URL.Query().Get("type")
 
 		filter := repository.FetchFilter{
-			Count:  10,
-			Sort:   sort,
-			Type:   nType,
-			UserId: userId,
+			Count:     10,
+			Sort:      sort,
+			Type:      nType,
+			UserId:    userId,
+			Notebook:  r.URL.Query().Get("notebook"),
+			Workspace: r.URL.Query().Get("workspace"),
+		}
+
+		if q := strings.TrimSpace(r.URL.Query().Get("q")); q != "" {
+			filter.Query = strings.ToLower(q)
+		}
+
+		if link := r.URL.Query().Get("url"); link != "" {
+			normalized, err := bookmark.NormalizeURL(link)
+			if err != nil {
+				response.ValidationErr(w, map[string]string{"url": "url"})
+				return
+			}
+
+			filter.URL = normalized
 		}
 
 		notes, err := repo.List(filter, r.Context())
 		if err != nil {
-			logger.Error(err.Error())
+			logger.For(r.Context()).Error("list issue", "error", err)
 			response.RespondErr(w, response.NotFound())
 			return
 		}
@@ -37,21 +59,35 @@ func HandleAll(logger logger.Logger, repo repository.NotesRepository) http.Handl
 	})
 }
 
-func HandleGet(logger logger.Logger, repo repository.NotesRepository) http.HandlerFunc {
+func HandleGet(logger logger.Logger, repo repository.NotesRepository, types *models.Registry) http.HandlerFunc {
+	type renderedNote struct {
+		Note     *models.EmbeddedNote `json:"note"`
+		Rendered any                  `json:"rendered"`
+	}
+
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		userId := r.Context().Value("user").(string)
-		note, err := repo.GetById(r.PathValue("id"), r.Context())
-		if err != nil {
-			response.RespondErr(w, response.NotFound())
+		note, ok := authz.Authorize(w, r, repo, userId, authz.View)
+		if !ok {
 			return
 		}
 
-		// check permission
-		if !share.CanRead(note, userId) && !note.OwnedBy(userId) {
-			response.RespondErr(w, response.ErrorResponse{
-				Status:  http.StatusForbidden,
-				Message: "You don't have permission to access this note",
-			})
+		if r.URL.Query().Get("format") == "html" {
+			t, _ := types.Get(note.Type)
+			renderer, ok := t.(models.Renderer)
+			if !ok {
+				response.ErrMessage(w, "This note can't be rendered as html", http.StatusBadRequest)
+				return
+			}
+
+			rendered, err := renderer.Render(note.Data)
+			if err != nil {
+				logger.For(r.Context()).Error("render issue", "error", err)
+				response.RespondErr(w, response.InternalServerError())
+				return
+			}
+
+			response.Respond(w, renderedNote{Note: note, Rendered: rendered}, http.StatusOK)
 			return
 		}
 
@@ -59,28 +95,22 @@ func HandleGet(logger logger.Logger, repo repository.NotesRepository) http.Handl
 	})
 }
 
-func HandleAdd(logger logger.Logger, repo repository.NotesRepository) http.HandlerFunc {
+// Workspaces returns the members of a workspace, notes created in it are shared with them.
+type Workspaces interface {
+	Members(workspaceId string, ctx context.Context) ([]models.Member, error)
+}
+
+func HandleAdd(logger logger.Logger, repo repository.NotesRepository, types *models.Registry, workspaces Workspaces) http.HandlerFunc {
 	type noteRequest struct {
-		Type  string   `json:"type" validate:"required|in:movie,todo,text"`
+		Type  string   `json:"type" validate:"required"`
 		Title string   `json:"title" validate:"required"`
 		Tags  []string `json:"tags" validate:"array"`
-	}
-
-	type textRequest struct {
-		Content string `json:"content" validate:"required"`
-	}
-
-	type movieRequest struct {
-		Year     int    `json:"year" validate:"required|numeric"`
-		Watched  bool   `json:"watched" validate:"required|boolean"`
-		Director string `json:"director"`
-	}
-
-	type todoRequest struct {
-		Tasks []string `json:"tasks" validate:"required|array"`
+		// Workspace creates the note in a workspace the user can write in.
+		Workspace string `json:"workspace_id"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
 		data := make(map[string]any)
 		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 			// NOTE: does this error needs to halt.
@@ -93,31 +123,21 @@ func HandleAdd(logger logger.Logger, repo repository.NotesRepository) http.Handl
 			return
 		}
 
-		var movieInfo *movieRequest
-		if note.Type == "movie" {
-			movieInfo, problems = validation.Valid[*movieRequest](data)
-			if len(problems) > 0 {
-				response.ValidationErr(w, problems)
-				return
-			}
+		noteType, ok := types.Get(note.Type)
+		if !ok {
+			response.ValidationErr(w, map[string]string{"type": "in:" + strings.Join(types.Names(), ",")})
+			return
 		}
 
-		var todoInfo *todoRequest
-		if note.Type == "todo" {
-			todoInfo, problems = validation.Valid[*todoRequest](data)
-			if len(problems) > 0 {
-				response.ValidationErr(w, problems)
-				return
-			}
+		doc, problems, err := noteType.Create(data, userId, r.Context())
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
 		}
 
-		var textInfo *textRequest
-		if note.Type == "text" {
-			textInfo, problems = validation.Valid[*textRequest](data)
-			if len(problems) > 0 {
-				response.ValidationErr(w, problems)
-				return
-			}
+		if err != nil {
+			response.RespondErr(w, err)
+			return
 		}
 
 		embeddedNote := models.EmbeddedNote{
@@ -128,35 +148,26 @@ func HandleAdd(logger logger.Logger, repo repository.NotesRepository) http.Handl
 				CreatedAt: time.Now(),
 				UpdatedAt: time.Now(),
 			},
+			Data: doc,
 		}
+		embeddedNote.SearchText = types.SearchText(&embeddedNote)
 
-		if note.Type == "text" && textInfo != nil {
-			embeddedNote.TextNote = &models.TextNoteData{Content: textInfo.Content}
-		}
-
-		if note.Type == "todo" && todoInfo != nil {
-			todo := models.TodoNoteData{}
-			for _, task := range todoInfo.Tasks {
-				todo.Tasks = append(todo.Tasks, models.Task{
-					Content:     task,
-					IsCompleted: false,
-					CompletedAt: nil,
-				})
+		if note.Workspace != "" {
+			members, err := workspaces.Members(note.Workspace, r.Context())
+			if err != nil {
+				response.ValidationErr(w, map[string]string{"workspace_id": "exists"})
+				return
 			}
 
-			embeddedNote.TodoNote = &todo
-		}
-
-		if note.Type == "movie" && movieInfo != nil {
-			embeddedNote.MovieNote = &models.MovieNoteData{
-				Year:     movieInfo.Year,
-				Watched:  movieInfo.Watched,
-				Director: movieInfo.Director,
+			embeddedNote.Members = members
+			if role, ok := embeddedNote.Role(userId); !ok || !role.CanWrite() {
+				response.ErrMessage(w, "You can't create notes in this workspace", http.StatusForbidden)
+				return
 			}
+			embeddedNote.Workspace, _ = primitive.ObjectIDFromHex(note.Workspace)
 		}
 
-		userId := r.Context().Value("user").(string)
-		_, err := repo.Add(embeddedNote, userId, r.Context())
+		_, err = repo.Add(embeddedNote, userId, r.Context())
 		if err != nil {
 			response.RespondErr(w, response.ErrorResponse{
 				Status:  http.StatusInternalServerError,
@@ -169,25 +180,12 @@ func HandleAdd(logger logger.Logger, repo repository.NotesRepository) http.Handl
 	})
 }
 
-func HandleUpdate(logger logger.Logger, repo repository.NotesRepository) http.HandlerFunc {
+func HandleUpdate(logger logger.Logger, repo repository.NotesRepository, types *models.Registry) http.HandlerFunc {
 	type noteRequest struct {
 		Title string   `json:"title" validate:"required"`
 		Tags  []string `json:"tags" validate:"array"`
 	}
 
-	type textRequest struct {
-		Content string `json:"content" validate:"required"`
-	}
-
-	type movieRequest struct {
-		Year     int    `json:"year" validate:"required|numeric"`
-		Director string `json:"director"`
-	}
-
-	type todoRequest struct {
-		// Tasks []string `json:"tasks" validate:"required|array"`
-	}
-
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
 		data := make(map[string]any)
@@ -210,57 +208,41 @@ func HandleUpdate(logger logger.Logger, repo repository.NotesRepository) http.Ha
 			return
 		}
 
-		var movieInfo *movieRequest
-		if oldNote.Type == "movie" {
-			movieInfo, problems = validation.Valid[*movieRequest](data)
-			if len(problems) > 0 {
-				response.ValidationErr(w, problems)
-				return
-			}
+		noteType, ok := types.Get(oldNote.Type)
+		if !ok {
+			response.RespondErr(w, response.BadRequest())
+			return
 		}
 
-		var todoInfo *todoRequest
-		if oldNote.Type == "todo" {
-			todoInfo, problems = validation.Valid[*todoRequest](data)
-			if len(problems) > 0 {
-				response.ValidationErr(w, problems)
-				return
-			}
+		if !authz.Can(oldNote, userId, authz.Edit) {
+			response.ErrMessage(w, authz.Message(authz.Edit), http.StatusForbidden)
+			return
 		}
 
-		var textInfo *textRequest
-		if oldNote.Type == "text" {
-			textInfo, problems = validation.Valid[*textRequest](data)
-			if len(problems) > 0 {
-				response.ValidationErr(w, problems)
-				return
-			}
+		fields, problems, err := noteType.Update(oldNote, data, r.Context())
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
 		}
 
-		oldNote.Title = note.Title
-
-		if oldNote.Type == "text" && textInfo != nil {
-			oldNote.TextNote.Content = textInfo.Content
+		if err != nil {
+			response.RespondErr(w, err)
+			return
 		}
 
-		if oldNote.Type == "todo" && todoInfo != nil {
-			// TODO: this is probably shouldn't be allowed
+		updates := make(map[string]any)
+		for key, value := range fields {
+			updates[noteType.Field()+"."+key] = value
 		}
 
-		if oldNote.Type == "movie" && movieInfo != nil {
-			oldNote.MovieNote.Year = movieInfo.Year
-			oldNote.MovieNote.Director = movieInfo.Director
+		if note.Title != oldNote.Title {
+			updates["title"] = note.Title
 		}
 
-		if !share.CanWrite(oldNote, userId) && !oldNote.OwnedBy(userId) {
-			response.RespondErr(w, response.ErrorResponse{
-				Status:  http.StatusForbidden,
-				Message: "You don't have permission to update this note",
-			})
-			return
-		}
+		oldNote.Title = note.Title
+		oldNote.SearchText = types.SearchText(oldNote)
 
-		err = repo.Update(oldNote, r.Context())
+		err = repo.Update(oldNote, updates, r.Context())
 		if err != nil {
 			response.RespondErr(w, response.ErrorResponse{
 				Status:  http.StatusInternalServerError,
@@ -275,10 +257,14 @@ func HandleUpdate(logger logger.Logger, repo repository.NotesRepository) http.Ha
 
 func HandleDelete(logger logger.Logger, repo repository.NotesRepository) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := r.PathValue("id")
 		userId := r.Context().Value("user").(string)
 
-		err := repo.Delete(id, userId, r.Context())
+		note, ok := authz.Authorize(w, r, repo, userId, authz.Delete)
+		if !ok {
+			return
+		}
+
+		err := repo.Delete(note.ID.Hex(), userId, r.Context())
 		if err != nil {
 			response.RespondErr(w, response.ErrorResponse{
 				Status:  http.StatusInternalServerError,
@@ -290,3 +276,59 @@ func HandleDelete(logger logger.Logger, repo repository.NotesRepository) http.Ha
 		response.RespondSuccess(w)
 	})
 }
+
+// HandleDuplicate copies a note the caller can read into a new note they own.
+// The title can be set in the body, it defaults to the title followed by "(copy)".
+func HandleDuplicate(logger logger.Logger, repo repository.NotesRepository, types *models.Registry) http.HandlerFunc {
+	type duplicateRequest struct {
+		Title string `json:"title"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		var req duplicateRequest
+		// the body is optional.
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		note, ok := authz.Authorize(w, r, repo, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		copied, err := types.Duplicate(note, userId, r.Context())
+		if err != nil {
+			var errResponse response.ErrorResponse
+			if errors.As(err, &errResponse) {
+				response.RespondErr(w, errResponse)
+				return
+			}
+
+			logger.For(r.Context()).Error("duplicate issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		copied.Title = strings.TrimSpace(req.Title)
+		if copied.Title == "" {
+			copied.Title = note.Title + " (copy)"
+		}
+		copied.SearchText = types.SearchText(copied)
+
+		id, err := repo.Add(*copied, userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("duplicate issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		created, err := repo.GetById(id, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("duplicate issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, created, http.StatusCreated)
+	})
+}
@@ -0,0 +1,61 @@
+package metadata
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"unicode"
+)
+
+var ErrNotFound = errors.New("movie not found")
+
+type Movie struct {
+	ID       string   `json:"id"`
+	Title    string   `json:"title"`
+	Year     int      `json:"year"`
+	Director string   `json:"director"`
+	Genres   []string `json:"genres"`
+	Runtime  int      `json:"runtime"`
+	Poster   string   `json:"poster"`
+}
+
+// MetadataProvider looks up movie (or show) details by title.
+type MetadataProvider interface {
+	// Lookup returns the best match for title, year is used to break ties and can be 0.
+	Lookup(title string, year int, ctx context.Context) (*Movie, error)
+	// Suggest returns titles starting with query, for autocomplete.
+	Suggest(query string, limit int, ctx context.Context) ([]Movie, error)
+}
+
+// NopProvider is used when no dataset is configured.
+type NopProvider struct{}
+
+func (NopProvider) Lookup(title string, year int, ctx context.Context) (*Movie, error) {
+	return nil, ErrNotFound
+}
+
+func (NopProvider) Suggest(query string, limit int, ctx context.Context) ([]Movie, error) {
+	return []Movie{}, nil
+}
+
+// normalize lowercases the title and strips punctuation so "Spider-Man: Homecoming"
+// and "spider man homecoming" end up with the same key.
+func normalize(title string) string {
+	var b strings.Builder
+	space := false
+
+	for _, r := range strings.ToLower(title) {
+		switch {
+		case unicode.IsLetter(r) || unicode.IsDigit(r):
+			if space && b.Len() > 0 {
+				b.WriteRune(' ')
+			}
+			space = false
+			b.WriteRune(r)
+		default:
+			space = true
+		}
+	}
+
+	return b.String()
+}
@@ -0,0 +1,343 @@
+package metadata
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// the imdb dumps use \N for empty values.
+const tsvNull = `\N`
+
+// title types kept when the dataset has a titleType column.
+var tsvTypes = map[string]bool{
+	"movie":        true,
+	"tvMovie":      true,
+	"tvSeries":     true,
+	"tvMiniSeries": true,
+	"short":        true,
+	"video":        true,
+}
+
+type tsvEntry struct {
+	Movie
+	votes     int
+	directors []string // name ids of title.crew, resolved by name.basics
+}
+
+type tsvProvider struct {
+	entries []tsvEntry
+	ids     map[string]int // tconst to entry
+	index   map[string][]int
+	keys    []string // sorted index keys, used for prefix search
+}
+
+// the IMDb datasets joined to title.basics when they're next to it, in this order.
+var tsvJoins = []string{"title.ratings", "title.crew", "name.basics"}
+
+// NewTSVProvider loads an IMDb-style tab separated dump (title.basics.tsv, optionally gzipped).
+// Columns are matched by header name: tconst, primaryTitle, originalTitle, titleType,
+// startYear, runtimeMinutes and genres. Only primaryTitle is required.
+//
+// The votes and the directors of the IMDb datasets are in other files, title.ratings.tsv,
+// title.crew.tsv and name.basics.tsv (for the director names) are joined on tconst when they're
+// in the same directory, gzipped or not. A single joined dump can carry directors (names),
+// numVotes and poster columns instead, IMDb has no posters.
+func NewTSVProvider(path string) (MetadataProvider, error) {
+	p := &tsvProvider{ids: make(map[string]int), index: make(map[string][]int)}
+	if err := readTSV(path, p.loadBasics); err != nil {
+		return nil, err
+	}
+
+	loads := map[string]func(io.Reader) error{
+		"title.ratings": p.loadRatings,
+		"title.crew":    p.loadCrew,
+		"name.basics":   p.loadNames,
+	}
+	for _, name := range tsvJoins {
+		if file, ok := sibling(path, name); ok {
+			if err := readTSV(file, loads[name]); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	p.sortKeys()
+
+	return p, nil
+}
+
+// sibling returns the name.tsv or name.tsv.gz file next to path.
+func sibling(path string, name string) (string, bool) {
+	for _, file := range []string{name + ".tsv", name + ".tsv.gz"} {
+		file = filepath.Join(filepath.Dir(path), file)
+		if _, err := os.Stat(file); err == nil {
+			return file, true
+		}
+	}
+	return "", false
+}
+
+func readTSV(path string, load func(io.Reader) error) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+
+	defer f.Close()
+
+	var reader io.Reader = f
+	if strings.HasSuffix(path, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return err
+		}
+
+		defer gz.Close()
+		reader = gz
+	}
+
+	if err := load(reader); err != nil {
+		return fmt.Errorf("Error loading %s: %s", path, err)
+	}
+
+	return nil
+}
+
+// scanTSV calls row for each line of r, get returns the value of a column of the line.
+// The required column must be in the header.
+func scanTSV(r io.Reader, required string, row func(get func(string) string)) error {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 1024*1024)
+
+	if !scanner.Scan() {
+		if err := scanner.Err(); err != nil {
+			return err
+		}
+		return fmt.Errorf("dataset is empty")
+	}
+
+	columns := make(map[string]int)
+	for i, name := range strings.Split(scanner.Text(), "\t") {
+		columns[name] = i
+	}
+
+	if _, ok := columns[required]; !ok {
+		return fmt.Errorf("%s column is missing", required)
+	}
+
+	for scanner.Scan() {
+		fields := strings.Split(scanner.Text(), "\t")
+
+		row(func(name string) string {
+			i, ok := columns[name]
+			if !ok || i >= len(fields) || fields[i] == tsvNull {
+				return ""
+			}
+			return fields[i]
+		})
+	}
+
+	return scanner.Err()
+}
+
+func (p *tsvProvider) loadBasics(r io.Reader) error {
+	return scanTSV(r, "primaryTitle", func(get func(string) string) {
+		if t := get("titleType"); t != "" && !tsvTypes[t] {
+			return
+		}
+
+		entry := tsvEntry{Movie: Movie{
+			ID:       get("tconst"),
+			Title:    get("primaryTitle"),
+			Director: strings.Join(splitList(get("directors")), ", "),
+			Genres:   splitList(get("genres")),
+			Poster:   get("poster"),
+		}}
+
+		if entry.Title == "" {
+			return
+		}
+
+		entry.Year, _ = strconv.Atoi(get("startYear"))
+		entry.Runtime, _ = strconv.Atoi(get("runtimeMinutes"))
+		entry.votes, _ = strconv.Atoi(get("numVotes"))
+
+		p.add(entry, get("originalTitle"))
+	})
+}
+
+// loadRatings reads the votes of title.ratings.
+func (p *tsvProvider) loadRatings(r io.Reader) error {
+	return scanTSV(r, "numVotes", func(get func(string) string) {
+		if i, ok := p.ids[get("tconst")]; ok {
+			p.entries[i].votes, _ = strconv.Atoi(get("numVotes"))
+		}
+	})
+}
+
+// loadCrew reads the director ids of title.crew, loadNames resolves them.
+func (p *tsvProvider) loadCrew(r io.Reader) error {
+	return scanTSV(r, "directors", func(get func(string) string) {
+		if i, ok := p.ids[get("tconst")]; ok {
+			p.entries[i].directors = splitList(get("directors"))
+		}
+	})
+}
+
+// loadNames sets the directors of the entries from the names of name.basics.
+func (p *tsvProvider) loadNames(r io.Reader) error {
+	wanted := make(map[string]string)
+	for _, entry := range p.entries {
+		for _, id := range entry.directors {
+			wanted[id] = ""
+		}
+	}
+
+	err := scanTSV(r, "primaryName", func(get func(string) string) {
+		if _, ok := wanted[get("nconst")]; ok {
+			wanted[get("nconst")] = get("primaryName")
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	for i, entry := range p.entries {
+		names := []string{}
+		for _, id := range entry.directors {
+			if name := wanted[id]; name != "" {
+				names = append(names, name)
+			}
+		}
+		if len(names) > 0 {
+			p.entries[i].Director = strings.Join(names, ", ")
+		}
+		p.entries[i].directors = nil
+	}
+
+	return nil
+}
+
+func (p *tsvProvider) sortKeys() {
+	p.keys = make([]string, 0, len(p.index))
+	for key := range p.index {
+		p.keys = append(p.keys, key)
+	}
+	sort.Strings(p.keys)
+}
+
+func (p *tsvProvider) add(entry tsvEntry, originalTitle string) {
+	i := len(p.entries)
+	p.entries = append(p.entries, entry)
+	if entry.ID != "" {
+		p.ids[entry.ID] = i
+	}
+
+	key := normalize(entry.Title)
+	p.index[key] = append(p.index[key], i)
+
+	if original := normalize(originalTitle); original != "" && original != key {
+		p.index[original] = append(p.index[original], i)
+	}
+}
+
+func (p *tsvProvider) Lookup(title string, year int, ctx context.Context) (*Movie, error) {
+	matches := p.index[normalize(title)]
+	if len(matches) == 0 {
+		return nil, ErrNotFound
+	}
+
+	best := -1
+	for _, i := range matches {
+		if best == -1 || p.better(i, best, year) {
+			best = i
+		}
+	}
+
+	movie := p.entries[best].Movie
+	return &movie, nil
+}
+
+// better reports if entry a is a closer match than entry b for the given year.
+func (p *tsvProvider) better(a, b int, year int) bool {
+	ea, eb := p.entries[a], p.entries[b]
+
+	if year > 0 {
+		da, db := abs(ea.Year-year), abs(eb.Year-year)
+		if da != db {
+			return da < db
+		}
+	}
+
+	return ea.votes > eb.votes
+}
+
+func (p *tsvProvider) Suggest(query string, limit int, ctx context.Context) ([]Movie, error) {
+	prefix := normalize(query)
+	movies := []Movie{}
+
+	if prefix == "" || limit <= 0 {
+		return movies, nil
+	}
+
+	// collect a few more candidates than needed, so the most popular ones win.
+	seen := make(map[int]bool)
+	candidates := []int{}
+	start := sort.SearchStrings(p.keys, prefix)
+
+	for k := start; k < len(p.keys) && strings.HasPrefix(p.keys[k], prefix); k++ {
+		for _, i := range p.index[p.keys[k]] {
+			if !seen[i] {
+				seen[i] = true
+				candidates = append(candidates, i)
+			}
+		}
+
+		if len(candidates) >= limit*10 {
+			break
+		}
+	}
+
+	sort.SliceStable(candidates, func(a, b int) bool {
+		return p.entries[candidates[a]].votes > p.entries[candidates[b]].votes
+	})
+
+	for _, i := range candidates {
+		if len(movies) == limit {
+			break
+		}
+		movies = append(movies, p.entries[i].Movie)
+	}
+
+	return movies, nil
+}
+
+func splitList(value string) []string {
+	if value == "" {
+		return nil
+	}
+
+	list := []string{}
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			list = append(list, item)
+		}
+	}
+
+	return list
+}
+
+func abs(n int) int {
+	if n < 0 {
+		return -n
+	}
+	return n
+}
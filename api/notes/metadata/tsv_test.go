@@ -0,0 +1,107 @@
+package metadata
+
+import (
+	"context"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestTSVProviderJoinsIMDbDatasets(t *testing.T) {
+	provider, err := NewTSVProvider("testdata/title.basics.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		title string
+		year  int
+		want  Movie
+	}{
+		{
+			// the most voted one wins without a year.
+			title: "the thing",
+			want: Movie{ID: "tt0084787", Title: "The Thing", Year: 1982, Director: "John Carpenter",
+				Genres: []string{"Horror", "Mystery", "Sci-Fi"}, Runtime: 109},
+		},
+		{
+			title: "The Thing",
+			year:  2011,
+			want: Movie{ID: "tt0905372", Title: "The Thing", Year: 2011, Director: "Matthijs van Heijningen Jr.",
+				Genres: []string{"Horror", "Mystery", "Sci-Fi"}, Runtime: 103},
+		},
+		{
+			title: "The Thing from Another World",
+			want: Movie{ID: "tt0044121", Title: "The Thing from Another World", Year: 1951,
+				Director: "Christian Nyby, Howard Hawks", Genres: []string{"Horror", "Sci-Fi"}, Runtime: 87},
+		},
+	}
+
+	for _, test := range tests {
+		movie, err := provider.Lookup(test.title, test.year, context.Background())
+		if err != nil {
+			t.Fatalf("Lookup(%q, %d): %s", test.title, test.year, err)
+		}
+		if !reflect.DeepEqual(*movie, test.want) {
+			t.Errorf("Lookup(%q, %d) = %+v, want %+v", test.title, test.year, *movie, test.want)
+		}
+	}
+
+	suggestions, err := provider.Suggest("the", 3, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ids := []string{}
+	for _, movie := range suggestions {
+		ids = append(ids, movie.ID)
+	}
+	if want := []string{"tt0084787", "tt0905372", "tt0044121"}; !reflect.DeepEqual(ids, want) {
+		t.Errorf("Suggest ranked %v, want %v", ids, want)
+	}
+}
+
+func TestTSVProviderSkipsOtherTitleTypes(t *testing.T) {
+	provider, err := NewTSVProvider("testdata/title.basics.tsv")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the tvEpisode "The Thing" of 2005 is left out.
+	movie, err := provider.Lookup("The Thing", 2005, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.ID == "tt0944947" {
+		t.Errorf("Lookup returned the tv episode")
+	}
+}
+
+func TestTSVProviderReadsJoinedColumns(t *testing.T) {
+	dataset := strings.Join([]string{
+		"tconst\tprimaryTitle\tstartYear\tdirectors\tnumVotes\tposter",
+		"tt1\tHeat\t1995\tMichael Mann\t700000\thttps://example.com/heat.jpg",
+		"tt2\tHeat\t1986\t\\N\t5000\t\\N",
+	}, "\n")
+
+	provider := &tsvProvider{ids: make(map[string]int), index: make(map[string][]int)}
+	if err := provider.loadBasics(strings.NewReader(dataset)); err != nil {
+		t.Fatal(err)
+	}
+	provider.sortKeys()
+
+	movie, err := provider.Lookup("heat", 0, context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if movie.ID != "tt1" || movie.Director != "Michael Mann" || movie.Poster != "https://example.com/heat.jpg" {
+		t.Errorf("Lookup = %+v", *movie)
+	}
+}
+
+func TestTSVProviderRequiresPrimaryTitle(t *testing.T) {
+	provider := &tsvProvider{ids: make(map[string]int), index: make(map[string][]int)}
+	if err := provider.loadBasics(strings.NewReader("tconst\ttitle\ntt1\tHeat\n")); err == nil {
+		t.Error("loaded a dataset without primaryTitle")
+	}
+}
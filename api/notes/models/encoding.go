@@ -0,0 +1,84 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+type storedNote struct {
+	BaseNote `bson:",inline"`
+	Data     map[string]any `bson:",inline"`
+}
+
+type decodedNote struct {
+	BaseNote `bson:",inline"`
+	Data     map[string]bson.RawValue `bson:",inline"`
+}
+
+func (n EmbeddedNote) MarshalBSON() ([]byte, error) {
+	doc := storedNote{BaseNote: n.BaseNote, Data: map[string]any{}}
+
+	if t, ok := Types.Get(n.Type); ok && n.Data != nil {
+		doc.Data[t.Field()] = n.Data
+	}
+
+	return bson.Marshal(doc)
+}
+
+func (n *EmbeddedNote) UnmarshalBSON(data []byte) error {
+	var doc decodedNote
+	if err := bson.Unmarshal(data, &doc); err != nil {
+		return err
+	}
+
+	n.BaseNote = doc.BaseNote
+	n.Data = nil
+
+	t, ok := Types.Get(doc.Type)
+	if !ok {
+		return nil
+	}
+
+	raw, ok := doc.Data[t.Field()]
+	if !ok {
+		return nil
+	}
+
+	n.Data = t.New()
+	return raw.Unmarshal(n.Data)
+}
+
+// MarshalJSON writes the embedded document next to the base fields, e.g. "text_note": {...}.
+func (n EmbeddedNote) MarshalJSON() ([]byte, error) {
+	base, err := json.Marshal(n.BaseNote)
+	if err != nil {
+		return nil, err
+	}
+
+	t, ok := Types.Get(n.Type)
+	if !ok || n.Data == nil {
+		return base, nil
+	}
+
+	data, err := json.Marshal(n.Data)
+	if err != nil {
+		return nil, err
+	}
+
+	field, err := json.Marshal(t.Field())
+	if err != nil {
+		return nil, err
+	}
+
+	var b bytes.Buffer
+	b.Write(base[:len(base)-1])
+	b.WriteByte(',')
+	b.Write(field)
+	b.WriteByte(':')
+	b.Write(data)
+	b.WriteByte('}')
+
+	return b.Bytes(), nil
+}
@@ -10,10 +10,39 @@ import (
 type Permission string
 
 const (
-	PermissionRead  Permission = "read"
-	PermissionWrite Permission = "write"
+	PermissionRead Permission = "read"
+	// PermissionComment reads and comments the note.
+	PermissionComment Permission = "comment"
+	PermissionWrite   Permission = "write"
+	// PermissionManage writes and shares the note with others.
+	PermissionManage Permission = "manage"
 )
 
+// Role is the role of a member in a workspace.
+type Role string
+
+const (
+	RoleOwner  Role = "owner"
+	RoleAdmin  Role = "admin"
+	RoleEditor Role = "editor"
+	RoleViewer Role = "viewer"
+)
+
+// CanWrite reports whether the members with the role edit the notes of the workspace.
+func (r Role) CanWrite() bool {
+	return r == RoleOwner || r == RoleAdmin || r == RoleEditor
+}
+
+// CanManage reports whether the members with the role manage the workspace and its members.
+func (r Role) CanManage() bool {
+	return r == RoleOwner || r == RoleAdmin
+}
+
+type Member struct {
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Role   Role               `bson:"role" json:"role"`
+}
+
 type SharedUser struct {
 	UserID     primitive.ObjectID `bson:"user_id" json:"user_id"`
 	Permission Permission         `bson:"permission" json:"permission"`
@@ -24,22 +53,73 @@ type BaseNote struct {
 	Type       string             `bson:"type" json:"type"`
 	Title      string             `bson:"title" json:"title"`
 	Tags       []string           `bson:"tags" json:"tags"`
+	Notebook   string             `bson:"notebook,omitempty" json:"notebook,omitempty"`
 	CreatedAt  time.Time          `bson:"created_at" json:"created_at"`
 	UpdatedAt  time.Time          `bson:"updated_at" json:"updated_at"`
 	UserId     primitive.ObjectID `bson:"user_id,omitempty" json:"user_id"`
 	SharedWith []SharedUser       `bson:"shared_with" json:"shared_with,omitempty"`
+	// Workspace is the workspace the note was created in, its members can access it by role.
+	Workspace primitive.ObjectID `bson:"workspace_id,omitempty" json:"workspace_id,omitempty"`
+	// Members is a copy of the members of the workspace, kept in sync when they change.
+	Members []Member `bson:"members,omitempty" json:"-"`
+	// SearchText holds the title, tags and type specific text, it's used for search.
+	SearchText string `bson:"search_text,omitempty" json:"-"`
+	// Version is the number of the last change of the note, taken from a sequence shared by all notes.
+	Version int64 `bson:"version" json:"version"`
+	// Stamps records the last change of each field, keyed by field path with "/" instead of ".".
+	Stamps map[string]Stamp `bson:"stamps,omitempty" json:"-"`
+	// ClientID is the id given by the client that created the note offline.
+	ClientID string `bson:"client_id,omitempty" json:"client_id,omitempty"`
+}
+
+// Stamp is the version and time of the last change of a field, used to resolve sync conflicts.
+type Stamp struct {
+	Version int64     `bson:"version" json:"version"`
+	Time    time.Time `bson:"time" json:"time"`
 }
 
 func (n *BaseNote) OwnedBy(user string) bool {
 	return user == n.UserId.Hex()
 }
 
-// EmbeddedNote uses embedded documents for specific note types
+// Role returns the role of the user in the workspace of the note, if they're a member.
+func (n *BaseNote) Role(user string) (Role, bool) {
+	for _, member := range n.Members {
+		if member.UserID.Hex() == user {
+			return member.Role, true
+		}
+	}
+	return "", false
+}
+
+// Readers returns the users who can read the note: its owner, the users it's shared with
+// and the members of its workspace.
+func (n *BaseNote) Readers() []primitive.ObjectID {
+	users := []primitive.ObjectID{n.UserId}
+	seen := map[primitive.ObjectID]bool{n.UserId: true}
+
+	add := func(userId primitive.ObjectID) {
+		if !seen[userId] {
+			seen[userId] = true
+			users = append(users, userId)
+		}
+	}
+
+	for _, shared := range n.SharedWith {
+		add(shared.UserID)
+	}
+	for _, member := range n.Members {
+		add(member.UserID)
+	}
+
+	return users
+}
+
+// EmbeddedNote uses embedded documents for specific note types.
+// Data is stored under the field of the note type, see NoteType.Field.
 type EmbeddedNote struct {
-	BaseNote  `bson:",inline"`
-	TextNote  *TextNoteData  `bson:"text_note,omitempty" json:"text_note,omitempty"`
-	TodoNote  *TodoNoteData  `bson:"todo_note,omitempty" json:"todo_note,omitempty"`
-	MovieNote *MovieNoteData `bson:"movie_note,omitempty" json:"movie_note,omitempty"`
+	BaseNote
+	Data any
 }
 
 type UserNote struct {
@@ -59,7 +139,22 @@ type TodoNoteData struct {
 }
 
 type MovieNoteData struct {
-	Year     int    `bson:"year" json:"year"`
-	Watched  bool   `bson:"watched" json:"watched"`
-	Director string `bson:"director" json:"director"`
+	Year     int      `bson:"year" json:"year"`
+	Watched  bool     `bson:"watched" json:"watched"`
+	Director string   `bson:"director" json:"director"`
+	Genres   []string `bson:"genres,omitempty" json:"genres,omitempty"`
+	Runtime  int      `bson:"runtime,omitempty" json:"runtime,omitempty"`
+	Poster   string   `bson:"poster,omitempty" json:"poster,omitempty"`
+	SourceID string   `bson:"source_id,omitempty" json:"source_id,omitempty"`
+}
+
+type LinkNoteData struct {
+	URL string `bson:"url" json:"url"`
+	// NormalizedURL is used to search links and detect duplicates.
+	NormalizedURL string     `bson:"normalized_url" json:"normalized_url"`
+	Title         string     `bson:"title" json:"title"`
+	Description   string     `bson:"description" json:"description"`
+	Favicon       string     `bson:"favicon" json:"favicon"`
+	Snapshot      string     `bson:"snapshot,omitempty" json:"snapshot,omitempty"`
+	FetchedAt     *time.Time `bson:"fetched_at" json:"fetched_at"`
 }
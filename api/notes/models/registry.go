@@ -0,0 +1,141 @@
+package models
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// NoteType describes a note template: how it is validated, stored, updated and searched.
+// A new kind of note is added by implementing NoteType and registering it.
+type NoteType interface {
+	// Name is the value stored in the note "type" field.
+	Name() string
+	// Field is the key of the embedded document, e.g. "text_note".
+	Field() string
+	// New returns an empty embedded document, notes are decoded into it.
+	New() any
+	// Create validates a create request and returns the embedded document.
+	// Validation problems are returned as problems, anything else as err.
+	Create(data map[string]any, userId string, ctx context.Context) (doc any, problems map[string]string, err error)
+	// Update validates an update request, applies it to note.Data and returns
+	// the fields that changed, relative to Field.
+	Update(note *EmbeddedNote, data map[string]any, ctx context.Context) (fields map[string]any, problems map[string]string, err error)
+	// SearchText returns the text of the embedded document used for search.
+	SearchText(doc any) string
+}
+
+// Renderer is implemented by note types that can be shown as html.
+type Renderer interface {
+	Render(doc any) (any, error)
+}
+
+// Copier is implemented by note types whose documents need changes when a note is duplicated,
+// new ids for instance. The other documents are copied as they are.
+type Copier interface {
+	Copy(doc any, userId string, ctx context.Context) (any, error)
+}
+
+type Registry struct {
+	mu    sync.RWMutex
+	types map[string]NoteType
+}
+
+// Types is the registry used when decoding notes, types are registered on startup.
+var Types = NewRegistry()
+
+func NewRegistry() *Registry {
+	return &Registry{types: make(map[string]NoteType)}
+}
+
+func (r *Registry) Register(types ...NoteType) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, t := range types {
+		r.types[t.Name()] = t
+	}
+}
+
+func (r *Registry) Get(name string) (NoteType, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	t, ok := r.types[name]
+	return t, ok
+}
+
+// Names returns the registered type names, sorted.
+func (r *Registry) Names() []string {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	names := make([]string, 0, len(r.types))
+	for name := range r.types {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	return names
+}
+
+// SearchText builds the text indexed for note: its title and tags followed by the type specific text.
+func (r *Registry) SearchText(note *EmbeddedNote) string {
+	parts := append([]string{note.Title}, note.Tags...)
+
+	if t, ok := r.Get(note.Type); ok && note.Data != nil {
+		parts = append(parts, t.SearchText(note.Data))
+	}
+
+	return strings.ToLower(strings.Join(parts, "\n"))
+}
+
+// Duplicate returns a deep copy of note owned by userId, without id and shares. The copy stays in
+// the notebook of the note when userId owns it, the notebooks of the others aren't theirs.
+func (r *Registry) Duplicate(note *EmbeddedNote, userId string, ctx context.Context) (*EmbeddedNote, error) {
+	t, ok := r.Get(note.Type)
+	if !ok {
+		return nil, fmt.Errorf("Unknown note type %s", note.Type)
+	}
+
+	copied := &EmbeddedNote{
+		BaseNote: BaseNote{
+			Type:      note.Type,
+			Title:     note.Title,
+			Tags:      append([]string{}, note.Tags...),
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		},
+	}
+
+	if note.OwnedBy(userId) {
+		copied.Notebook = note.Notebook
+	}
+
+	if note.Data != nil {
+		raw, err := bson.Marshal(note.Data)
+		if err != nil {
+			return nil, err
+		}
+
+		copied.Data = t.New()
+		if err := bson.Unmarshal(raw, copied.Data); err != nil {
+			return nil, err
+		}
+
+		if copier, ok := t.(Copier); ok {
+			if copied.Data, err = copier.Copy(copied.Data, userId, ctx); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	copied.SearchText = r.SearchText(copied)
+
+	return copied, nil
+}
@@ -1,15 +1,26 @@
 package notes
 
 import (
+	"context"
+	"errors"
+	"fmt"
 	"net/http"
+	"strconv"
 
+	"memo/api/authz"
+	"memo/api/notes/metadata"
+	"memo/api/notes/models"
 	"memo/api/notes/repository"
+	"memo/api/notes/types"
 	"memo/pkg/logger"
 	"memo/pkg/response"
 	"memo/pkg/validation"
 )
 
-func HandleUpdateMovie(logger logger.Logger, repo repository.MovieNotesRepository) http.HandlerFunc {
+// a movie edit is applied again this many times when the note changes while it's written.
+const maxAttempts = 3
+
+func HandleUpdateMovie(logger logger.Logger, notesRepo repository.NotesRepository, registry *models.Registry) http.HandlerFunc {
 	type movieRequest struct {
 		Year     int    `json:"year" validate:"required|numeric"`
 		Watched  bool   `json:"watched" validate:"required|boolean"`
@@ -17,22 +28,35 @@ func HandleUpdateMovie(logger logger.Logger, repo repository.MovieNotesRepositor
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		id := r.PathValue("id")
+		userId := r.Context().Value("user").(string)
+
 		data, problems := validation.DecodeValid[*movieRequest](r)
 		if len(problems) > 0 {
 			response.ValidationErr(w, problems)
 			return
 		}
 
-		updates := map[string]any{
-			"year":     data.Year,
-			"watched":  data.Watched,
-			"director": data.Director,
+		note, ok := authz.Authorize(w, r, notesRepo, userId, authz.Edit)
+		if !ok {
+			return
+		}
+
+		if note.Type != "movie" {
+			response.RespondErr(w, response.NotFound())
+			return
 		}
 
-		err := repo.Update(id, updates, r.Context())
+		_, err := updateMovie(notesRepo, registry, note, func(movie *models.MovieNoteData) map[string]any {
+			movie.Year, movie.Watched, movie.Director = data.Year, data.Watched, data.Director
+
+			return map[string]any{
+				"year":     movie.Year,
+				"watched":  movie.Watched,
+				"director": movie.Director,
+			}
+		}, r.Context())
 		if err != nil {
-			logger.Error("update movie issue " + err.Error())
+			logger.For(r.Context()).Error("update movie issue", "error", err)
 			response.RespondErr(w, response.BadRequest())
 			return
 		}
@@ -40,3 +64,109 @@ func HandleUpdateMovie(logger logger.Logger, repo repository.MovieNotesRepositor
 		response.RespondSuccess(w)
 	})
 }
+
+func HandleEnrichMovie(logger logger.Logger, notesRepo repository.NotesRepository, registry *models.Registry, movies metadata.MetadataProvider) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.PathValue("id")
+		userId := r.Context().Value("user").(string)
+
+		note, err := notesRepo.GetById(id, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		movie, ok := note.Data.(*models.MovieNoteData)
+		if !ok || note.Type != "movie" {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if !authz.Can(note, userId, authz.Edit) {
+			response.ErrMessage(w, authz.Message(authz.Edit), http.StatusForbidden)
+			return
+		}
+
+		m, err := movies.Lookup(note.Title, movie.Year, r.Context())
+		if errors.Is(err, metadata.ErrNotFound) {
+			response.ErrMessage(w, "No metadata found for this movie", http.StatusNotFound)
+			return
+		}
+
+		if err != nil {
+			logger.For(r.Context()).Error("movie lookup issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		note, err = updateMovie(notesRepo, registry, note, func(movie *models.MovieNoteData) map[string]any {
+			types.ApplyMovieMetadata(movie, m, true)
+
+			return map[string]any{
+				"year":      movie.Year,
+				"director":  movie.Director,
+				"genres":    movie.Genres,
+				"runtime":   movie.Runtime,
+				"poster":    movie.Poster,
+				"source_id": movie.SourceID,
+			}
+		}, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("enrich movie issue", "error", err)
+			response.RespondErr(w, response.BadRequest())
+			return
+		}
+
+		response.Respond(w, note, http.StatusOK)
+	})
+}
+
+// updateMovie applies change to the movie of note and saves it through the notes repository, so
+// the search text follows and the hooks and events run. change returns the movie fields it set,
+// it's applied again to the note read back when it changed meanwhile. The saved note is returned.
+func updateMovie(repo repository.NotesRepository, registry *models.Registry, note *models.EmbeddedNote, change func(movie *models.MovieNoteData) map[string]any, ctx context.Context) (*models.EmbeddedNote, error) {
+	for attempt := 1; ; attempt++ {
+		movie, ok := note.Data.(*models.MovieNoteData)
+		if !ok {
+			return nil, fmt.Errorf("note %s is not a movie", note.ID.Hex())
+		}
+
+		fields := map[string]any{}
+		for key, value := range change(movie) {
+			fields["movie_note."+key] = value
+		}
+
+		note.SearchText = registry.SearchText(note)
+
+		err := repo.Update(note, fields, ctx)
+		if err == nil {
+			return note, nil
+		}
+
+		if !errors.Is(err, repository.ErrVersionConflict) || attempt == maxAttempts {
+			return nil, err
+		}
+
+		if note, err = repo.GetById(note.ID.Hex(), ctx); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func HandleSuggestMovies(logger logger.Logger, movies metadata.MetadataProvider) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		limit, err := strconv.Atoi(r.URL.Query().Get("limit"))
+		if err != nil || limit <= 0 || limit > 20 {
+			limit = 10
+		}
+
+		suggestions, err := movies.Suggest(r.URL.Query().Get("q"), limit, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("movie suggest issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, suggestions, http.StatusOK)
+	})
+}
@@ -0,0 +1,128 @@
+package repository
+
+import (
+	"context"
+	"sync"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/pkg/logger"
+)
+
+// Hook is called after notes are written, it keeps the data derived from notes in sync.
+// Errors are logged, they don't fail the write.
+type Hook interface {
+	NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error
+	NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error
+}
+
+type hookedNotesRepository struct {
+	NotesRepository
+	logger logger.Logger
+	hooks  []Hook
+}
+
+// WithHooks wraps repo so hooks run after every add, update and delete.
+func WithHooks(repo NotesRepository, logger logger.Logger, hooks ...Hook) NotesRepository {
+	return &hookedNotesRepository{repo, logger, hooks}
+}
+
+func (r *hookedNotesRepository) Add(note models.EmbeddedNote, userId string, ctx context.Context) (string, error) {
+	id, err := r.NotesRepository.Add(note, userId, ctx)
+	if err != nil {
+		return id, err
+	}
+
+	note.ID, _ = primitive.ObjectIDFromHex(id)
+	note.UserId, _ = primitive.ObjectIDFromHex(userId)
+
+	r.notify(func(hook Hook, ctx context.Context) error {
+		return hook.NoteSaved(&note, true, ctx)
+	}, ctx)
+
+	return id, nil
+}
+
+func (r *hookedNotesRepository) Update(note *models.EmbeddedNote, fields map[string]any, ctx context.Context) error {
+	if err := r.NotesRepository.Update(note, fields, ctx); err != nil {
+		return err
+	}
+
+	r.notify(func(hook Hook, ctx context.Context) error {
+		return hook.NoteSaved(note, false, ctx)
+	}, ctx)
+
+	return nil
+}
+
+func (r *hookedNotesRepository) Delete(id string, userId string, ctx context.Context) error {
+	note, err := r.NotesRepository.GetById(id, ctx)
+	if err != nil {
+		return err
+	}
+
+	if err := r.NotesRepository.Delete(id, userId, ctx); err != nil {
+		return err
+	}
+
+	// only the owner can delete a note.
+	if !note.OwnedBy(userId) {
+		return nil
+	}
+
+	r.notify(func(hook Hook, ctx context.Context) error {
+		return hook.NoteDeleted(note, ctx)
+	}, ctx)
+
+	return nil
+}
+
+// notify calls every hook, or queues the calls when the context comes from DeferHooks.
+func (r *hookedNotesRepository) notify(call func(hook Hook, ctx context.Context) error, ctx context.Context) {
+	AfterCommit(ctx, func(ctx context.Context) {
+		for _, hook := range r.hooks {
+			if err := call(hook, ctx); err != nil {
+				r.logger.For(ctx).Error("note hook issue", "error", err)
+			}
+		}
+	})
+}
+
+// AfterCommit calls fn once the writes made with ctx are committed: right away, or with the hooks
+// when the context comes from DeferHooks. It's used for the effects of writes that aren't hooks,
+// like the notifications of a share.
+func AfterCommit(ctx context.Context, fn func(ctx context.Context)) {
+	if queue, ok := ctx.Value(deferredKey{}).(*deferred); ok {
+		queue.mu.Lock()
+		queue.calls = append(queue.calls, fn)
+		queue.mu.Unlock()
+		return
+	}
+
+	fn(ctx)
+}
+
+type deferredKey struct{}
+
+type deferred struct {
+	mu    sync.Mutex
+	calls []func(ctx context.Context)
+}
+
+// DeferHooks returns a context in which the hooks are queued instead of run, for writes made in a
+// transaction. The returned function runs the queued hooks, call it once the writes are committed.
+func DeferHooks(ctx context.Context) (context.Context, func(ctx context.Context)) {
+	queue := &deferred{}
+
+	return context.WithValue(ctx, deferredKey{}, queue), func(ctx context.Context) {
+		queue.mu.Lock()
+		calls := queue.calls
+		queue.calls = nil
+		queue.mu.Unlock()
+
+		for _, call := range calls {
+			call(ctx)
+		}
+	}
+}
@@ -3,7 +3,7 @@ package repository
 import (
 	"context"
 	"fmt"
-	"time"
+	"regexp"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -18,14 +18,32 @@ type FetchFilter struct {
 	Sort   string
 	UserId string
 	Type   string
+	URL    string
+	// Notebook lists the notes moved to a notebook.
+	Notebook string
+	// Workspace lists the notes of a workspace the user is a member of.
+	Workspace string
+	// Query is matched against the note search text.
+	Query string
 }
 
 type NotesRepository interface {
 	Add(note models.EmbeddedNote, userId string, ctx context.Context) (string, error)
 	List(filter FetchFilter, ctx context.Context) ([]*models.BaseNote, error)
 	GetById(oId string, ctx context.Context) (*models.EmbeddedNote, error)
-	Update(note *models.EmbeddedNote, ctx context.Context) error
+	FindByURL(userId, normalizedURL string, ctx context.Context) (*models.EmbeddedNote, error)
+	Update(note *models.EmbeddedNote, fields map[string]any, ctx context.Context) error
 	Delete(id string, userId string, ctx context.Context) error
+	// Each calls fn with every note owned by the user, oldest first, without loading them all in memory.
+	Each(userId string, fn func(note *models.EmbeddedNote) error, ctx context.Context) error
+	// Committed returns the version up to which every change is committed, see Committed.
+	Committed(ctx context.Context) (int64, error)
+	// Changes returns the notes the user can read that changed after version and up to until,
+	// in the order of the changes.
+	Changes(userId string, version, until int64, limit int, ctx context.Context) ([]*models.EmbeddedNote, error)
+	// Tombstones returns the notes the user could read that were deleted after version and up to until.
+	Tombstones(userId string, version, until int64, limit int, ctx context.Context) ([]*Tombstone, error)
+	FindByClientID(userId, clientId string, ctx context.Context) (*models.EmbeddedNote, error)
 }
 
 type notesRepository struct {
@@ -57,6 +75,28 @@ func (r *notesRepository) GetById(oId string, ctx context.Context) (*models.Embe
 	return note, nil
 }
 
+func (r *notesRepository) FindByURL(userId, normalizedURL string, ctx context.Context) (*models.EmbeddedNote, error) {
+	collection := r.client.Collection("notes")
+
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.D{
+		primitive.E{Key: "user_id", Value: oUserId},
+		primitive.E{Key: "type", Value: "link"},
+		primitive.E{Key: "link_note.normalized_url", Value: normalizedURL},
+	}
+
+	var note *models.EmbeddedNote
+	if err := collection.FindOne(ctx, filter).Decode(&note); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
 func (r *notesRepository) Delete(oId string, userId string, ctx context.Context) error {
 	collection := r.client.Collection("notes")
 
@@ -75,31 +115,36 @@ func (r *notesRepository) Delete(oId string, userId string, ctx context.Context)
 		primitive.E{Key: "user_id", Value: oUserId},
 	}
 
-	if _, err = collection.DeleteOne(ctx, filter); err != nil {
+	var note *models.BaseNote
+	err = collection.FindOneAndDelete(ctx, filter).Decode(&note)
+	if err == mongo.ErrNoDocuments {
+		return nil
+	}
+
+	if err != nil {
 		return err
 	}
 
-	return nil
+	return Bury(r.client, note.ID, note.Readers(), ctx)
 }
 
 func (r *notesRepository) Add(note models.EmbeddedNote, userId string, ctx context.Context) (string, error) {
 	collection := r.client.Collection("notes")
 
-	if note.Type == "todo" {
-		for i := range note.TodoNote.Tasks {
-			note.TodoNote.Tasks[i].ID = primitive.NewObjectID()
-		}
-	}
-
 	objId, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		return "", err
 	}
 
 	note.UserId = objId
-	insertResult, err := collection.InsertOne(ctx, note)
+	if note.Version, err = NextVersion(r.client, ctx); err != nil {
+		return "", err
+	}
+
+	defer Settle(r.client, note.Version, ctx)
 
-	if err != mongo.ErrNilCursor {
+	insertResult, err := collection.InsertOne(ctx, note)
+	if err != nil {
 		return "", err
 	}
 
@@ -131,8 +176,9 @@ func (r *notesRepository) List(filter FetchFilter, ctx context.Context) ([]*mode
 		return nil, err
 	}
 
+	// the notes the user owns, that are shared with them or that are in their workspaces.
 	query := bson.D{
-		primitive.E{Key: "user_id", Value: objId},
+		primitive.E{Key: "$or", Value: Readers(objId)},
 	}
 	// if filter.UserId != "" {
 	// 	objId, err := primitive.ObjectIDFromHex(filter.UserId)
@@ -147,6 +193,28 @@ func (r *notesRepository) List(filter FetchFilter, ctx context.Context) ([]*mode
 		query = append(query, primitive.E{Key: "type", Value: filter.Type})
 	}
 
+	if filter.URL != "" {
+		query = append(query, primitive.E{Key: "link_note.normalized_url", Value: filter.URL})
+	}
+
+	if filter.Notebook != "" {
+		// notebooks are personal, the notes of the others are in their own.
+		query = append(query, primitive.E{Key: "notebook", Value: filter.Notebook}, primitive.E{Key: "user_id", Value: objId})
+	}
+
+	if filter.Workspace != "" {
+		workspaceId, err := primitive.ObjectIDFromHex(filter.Workspace)
+		if err != nil {
+			return nil, err
+		}
+
+		query = append(query, primitive.E{Key: "workspace_id", Value: workspaceId})
+	}
+
+	if filter.Query != "" {
+		query = append(query, primitive.E{Key: "search_text", Value: primitive.Regex{Pattern: regexp.QuoteMeta(filter.Query)}})
+	}
+
 	cursor, err := collection.Find(ctx, query, findOptions)
 	if err != nil {
 		return nil, err
@@ -182,28 +250,140 @@ func (r *notesRepository) List(filter FetchFilter, ctx context.Context) ([]*mode
 	// return note, nil
 }
 
-func (r *notesRepository) Update(note *models.EmbeddedNote, ctx context.Context) error {
+func (r *notesRepository) Each(userId string, fn func(note *models.EmbeddedNote) error, ctx context.Context) error {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.client.Collection("notes").Find(ctx, bson.M{"user_id": oUserId}, findOptions)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var note *models.EmbeddedNote
+		if err := cursor.Decode(&note); err != nil {
+			return err
+		}
+
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
+
+func (r *notesRepository) FindByClientID(userId, clientId string, ctx context.Context) (*models.EmbeddedNote, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var note *models.EmbeddedNote
+	filter := bson.M{"user_id": oUserId, "client_id": clientId}
+	if err := r.client.Collection("notes").FindOne(ctx, filter).Decode(&note); err != nil {
+		return nil, err
+	}
+
+	return note, nil
+}
+
+func (r *notesRepository) Committed(ctx context.Context) (int64, error) {
+	return Committed(r.client, ctx)
+}
+
+func (r *notesRepository) Changes(userId string, version, until int64, limit int, ctx context.Context) ([]*models.EmbeddedNote, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
 
-	filter := bson.M{"_id": note.ID}
+	filter := bson.M{"$or": Readers(oUserId), "version": bson.M{"$gt": version, "$lte": until}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: 1}}).SetLimit(int64(limit))
 
-	update := bson.M{"$set": bson.M{}}
+	cursor, err := r.client.Collection("notes").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
 
-	if note.Type == "text" {
-		update["$set"].(bson.M)["text_note.content"] = note.TextNote.Content
-	} else if note.Type == "movie" {
-		update["$set"].(bson.M)["movie_note.year"] = note.MovieNote.Year
-		update["$set"].(bson.M)["movie_note.director"] = note.MovieNote.Director
-	} else if note.Type == "todo" {
-		// TODO: Unimplemented todo update
+	defer cursor.Close(ctx)
+
+	notes := []*models.EmbeddedNote{}
+	if err = cursor.All(ctx, &notes); err != nil {
+		return nil, err
 	}
 
-	update["$set"].(bson.M)["title"] = note.Title
-	update["$set"].(bson.M)["updated_at"] = time.Now()
+	return notes, nil
+}
 
-	_, err := r.client.Collection("notes").UpdateOne(ctx, filter, update)
+func (r *notesRepository) Tombstones(userId string, version, until int64, limit int, ctx context.Context) ([]*Tombstone, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := bson.M{"users": oUserId, "version": bson.M{"$gt": version, "$lte": until}}
+	findOptions := options.Find().SetSort(bson.D{{Key: "version", Value: 1}}).SetLimit(int64(limit))
+
+	cursor, err := r.client.Collection("tombstones").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	tombstones := []*Tombstone{}
+	if err = cursor.All(ctx, &tombstones); err != nil {
+		return nil, err
+	}
+
+	return tombstones, nil
+}
+
+// Update sets the title and search text of note and the given fields, and stamps the given fields.
+// It fails with ErrVersionConflict when the note was changed since it was read, note.Version is
+// set to the new version otherwise.
+func (r *notesRepository) Update(note *models.EmbeddedNote, fields map[string]any, ctx context.Context) error {
+	filter := bson.M{"_id": note.ID, "version": note.Version}
+	if note.Version == 0 {
+		// notes written before versions were added.
+		filter["version"] = bson.M{"$in": bson.A{nil, 0}}
+	}
+
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+
+	set, version, err := changed(r.client, keys, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer Settle(r.client, version, ctx)
+
+	for key, value := range fields {
+		set[key] = value
+	}
+
+	set["title"] = note.Title
+	set["search_text"] = note.SearchText
+
+	result, err := r.client.Collection("notes").UpdateOne(ctx, filter, bson.M{"$set": set})
 	if err != nil {
 		return err
 	}
 
+	if result.MatchedCount == 0 {
+		return ErrVersionConflict
+	}
+
+	note.Version = version
 	return nil
 }
@@ -2,6 +2,7 @@ package repository
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"memo/api/notes/models"
 
@@ -14,14 +15,20 @@ import (
 type TodoNotesRepository interface {
 	Create(noteId, content string, ctx context.Context) (string, error)
 	Update(noteId, taskId string, updates map[string]any, ctx context.Context) error
+	// Add appends task as it is, with its id.
+	Add(noteId string, task models.Task, ctx context.Context) error
+	Remove(noteId, taskId string, ctx context.Context) error
 }
 
 type todoNotesRepository struct {
 	client *mongo.Database
+	types  *models.Registry
 }
 
-func NewTodoNotes(client *mongo.Database) TodoNotesRepository {
-	return &todoNotesRepository{client}
+// NewTodoNotes returns the repository of the tasks of todo notes, types builds the search text of
+// the notes it changes.
+func NewTodoNotes(client *mongo.Database, types *models.Registry) TodoNotesRepository {
+	return &todoNotesRepository{client, types}
 }
 
 func (r *todoNotesRepository) Update(oId string, taskId string, updates map[string]any, ctx context.Context) error {
@@ -37,22 +44,20 @@ func (r *todoNotesRepository) Update(oId string, taskId string, updates map[stri
 
 	filter := bson.M{"_id": id, "todo_note.tasks._id": taskPr}
 
-	update := bson.M{"$set": bson.M{}}
-
-	for key, value := range updates {
-		update["$set"].(bson.M)["todo_note.tasks.$."+key] = value
-	}
-
-	result, err := r.client.Collection("notes").UpdateOne(ctx, filter, update)
+	set, version, err := changed(r.client, []string{TaskField(taskId)}, ctx)
 	if err != nil {
 		return err
 	}
 
-	// check if update is successfull
-	if result.MatchedCount == 0 {
-		return fmt.Errorf("no documents matched the filter")
+	defer Settle(r.client, version, ctx)
+
+	update := bson.M{"$set": set}
+
+	for key, value := range updates {
+		update["$set"].(bson.M)["todo_note.tasks.$."+key] = value
 	}
-	return nil
+
+	return r.write(filter, update, ctx)
 }
 
 func (r *todoNotesRepository) Create(todoId, content string, ctx context.Context) (string, error) {
@@ -63,20 +68,82 @@ func (r *todoNotesRepository) Create(todoId, content string, ctx context.Context
 		CompletedAt: nil,
 	}
 
+	if err := r.Add(todoId, task, ctx); err != nil {
+		return "", err
+	}
+
+	return task.ID.Hex(), nil
+}
+
+func (r *todoNotesRepository) Add(todoId string, task models.Task, ctx context.Context) error {
 	id, err := primitive.ObjectIDFromHex(todoId)
 	if err != nil {
-		return "", err
+		return err
 	}
 
+	set, version, err := changed(r.client, []string{TaskField(task.ID.Hex())}, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer Settle(r.client, version, ctx)
+
 	filter := bson.M{"_id": id}
-	update := bson.M{"$push": bson.M{"todo_note.tasks": task}}
-	opts := options.Update().SetUpsert(true)
+	update := bson.M{"$push": bson.M{"todo_note.tasks": task}, "$set": set}
+
+	return r.write(filter, update, ctx)
+}
+
+func (r *todoNotesRepository) Remove(todoId, taskId string, ctx context.Context) error {
+	id, err := primitive.ObjectIDFromHex(todoId)
+	if err != nil {
+		return err
+	}
+
+	taskPr, err := primitive.ObjectIDFromHex(taskId)
+	if err != nil {
+		return err
+	}
+
+	// the stamp of the task is kept, it tells offline clients when the task was removed.
+	set, version, err := changed(r.client, []string{TaskField(taskId)}, ctx)
+	if err != nil {
+		return err
+	}
 
-	result, err := r.client.Collection("notes").UpdateOne(ctx, filter, update, opts)
+	defer Settle(r.client, version, ctx)
 
-	if result.ModifiedCount > 0 {
-		return task.ID.Hex(), nil
-	} else {
-		return "", fmt.Errorf("The task was not inserted")
+	filter := bson.M{"_id": id, "todo_note.tasks._id": taskPr}
+	update := bson.M{"$pull": bson.M{"todo_note.tasks": bson.M{"_id": taskPr}}, "$set": set}
+
+	return r.write(filter, update, ctx)
+}
+
+// write applies a task change to the todo note matched by filter, then sets the search text from
+// the tasks the note holds after it. The search text is only set over the version it was built
+// from, a later write sets its own.
+func (r *todoNotesRepository) write(filter, update bson.M, ctx context.Context) error {
+	filter["type"] = "todo"
+
+	var note *models.EmbeddedNote
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := r.client.Collection("notes").FindOneAndUpdate(ctx, filter, update, opts).Decode(&note)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return fmt.Errorf("no documents matched the filter")
 	}
+
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Collection("notes").UpdateOne(ctx,
+		bson.M{"_id": note.ID, "version": note.Version},
+		bson.M{"$set": bson.M{"search_text": r.types.SearchText(note)}},
+	)
+	return err
+}
+
+// TaskField is the field stamped when a task is added, changed or removed.
+func TaskField(taskId string) string {
+	return "todo_note.tasks." + taskId
 }
@@ -0,0 +1,168 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"memo/api/notes/models"
+)
+
+// ErrVersionConflict is returned when a note was changed since it was read.
+var ErrVersionConflict = errors.New("The note was changed by someone else, reload it and try again")
+
+// Tombstone is left behind by a deleted note, so offline clients learn about the deletion.
+type Tombstone struct {
+	NoteID primitive.ObjectID `bson:"note_id" json:"id"`
+	// Users are the owner and the users the note was shared with.
+	Users     []primitive.ObjectID `bson:"users" json:"-"`
+	Version   int64                `bson:"version" json:"version"`
+	DeletedAt time.Time            `bson:"deleted_at" json:"deleted_at"`
+}
+
+// a version is pending from NextVersion until the write that took it is settled, the change feed
+// stops before the oldest pending version. A version that isn't settled, e.g. because its
+// transaction was aborted, stops being pending after this long.
+const pendingTimeout = 30 * time.Second
+
+// NextVersion returns the next value of the sequence that numbers every change made to notes.
+// The version is pending until Settle is called with it.
+func NextVersion(client *mongo.Database, ctx context.Context) (int64, error) {
+	// the readers must see the version as pending before the write commits, so it's never taken
+	// in the transaction of the write.
+	if mongo.SessionFromContext(ctx) != nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+	}
+
+	var counter struct {
+		Seq int64 `bson:"seq"`
+	}
+
+	// the sequence is increased and the version added to the pending ones at once, the expired
+	// ones are dropped.
+	now := time.Now()
+	update := mongo.Pipeline{
+		{{Key: "$set", Value: bson.M{"seq": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$seq", 0}}, 1}}}}},
+		{{Key: "$set", Value: bson.M{"pending": bson.M{"$concatArrays": bson.A{
+			bson.M{"$filter": bson.M{
+				"input": bson.M{"$ifNull": bson.A{"$pending", bson.A{}}},
+				"cond":  bson.M{"$gt": bson.A{"$$this.expires_at", now}},
+			}},
+			bson.A{bson.M{"version": "$seq", "expires_at": now.Add(pendingTimeout)}},
+		}}}}},
+	}
+
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+	err := client.Collection("counters").
+		FindOneAndUpdate(ctx, bson.M{"_id": "notes"}, update, opts).
+		Decode(&counter)
+	if err != nil {
+		return 0, err
+	}
+
+	return counter.Seq, nil
+}
+
+// Settle ends the pending state of a version taken by NextVersion, once the write that took it
+// succeeded or failed. In a transaction it waits for the commit, see AfterCommit.
+func Settle(client *mongo.Database, version int64, ctx context.Context) {
+	AfterCommit(ctx, func(ctx context.Context) {
+		// on an error the version stays pending until it expires.
+		client.Collection("counters").UpdateOne(ctx, bson.M{"_id": "notes"}, bson.M{
+			"$pull": bson.M{"pending": bson.M{"version": version}},
+		})
+	})
+}
+
+// Committed returns the version up to which every change is committed: the one before the oldest
+// pending version, or the last version taken. The change feed doesn't read past it, a change
+// committed later with a lower version would be skipped.
+func Committed(client *mongo.Database, ctx context.Context) (int64, error) {
+	var counter struct {
+		Seq     int64 `bson:"seq"`
+		Pending []struct {
+			Version   int64     `bson:"version"`
+			ExpiresAt time.Time `bson:"expires_at"`
+		} `bson:"pending"`
+	}
+
+	err := client.Collection("counters").FindOne(ctx, bson.M{"_id": "notes"}).Decode(&counter)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return 0, nil
+	}
+
+	if err != nil {
+		return 0, err
+	}
+
+	committed := counter.Seq
+	now := time.Now()
+	for _, pending := range counter.Pending {
+		if pending.ExpiresAt.After(now) && pending.Version <= committed {
+			committed = pending.Version - 1
+		}
+	}
+
+	return committed, nil
+}
+
+// Bury leaves a tombstone of the note for the users, they don't see it anymore. A new version
+// is taken for it, so it's returned by the change feed.
+func Bury(client *mongo.Database, noteId primitive.ObjectID, users []primitive.ObjectID, ctx context.Context) error {
+	version, err := NextVersion(client, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer Settle(client, version, ctx)
+
+	tombstone := Tombstone{
+		NoteID:    noteId,
+		Users:     users,
+		Version:   version,
+		DeletedAt: time.Now(),
+	}
+
+	_, err = client.Collection("tombstones").InsertOne(ctx, tombstone)
+	return err
+}
+
+// StampKey returns the key of field in BaseNote.Stamps.
+func StampKey(field string) string {
+	return strings.ReplaceAll(field, ".", "/")
+}
+
+// changed returns the fields to set to record a change of the given fields: the new version,
+// the update time and a stamp per field. The version is settled by the caller after the write.
+func changed(client *mongo.Database, fields []string, ctx context.Context) (bson.M, int64, error) {
+	version, err := NextVersion(client, ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	now := time.Now()
+	set := bson.M{"version": version, "updated_at": now}
+
+	for _, field := range fields {
+		set["stamps."+StampKey(field)] = models.Stamp{Version: version, Time: now}
+	}
+
+	return set, version, nil
+}
+
+// Readers matches the notes a user owns, that are shared with them or that are in one of their workspaces.
+func Readers(userId primitive.ObjectID) bson.A {
+	return bson.A{
+		bson.M{"user_id": userId},
+		bson.M{"shared_with.user_id": userId},
+		bson.M{"members.user_id": userId},
+	}
+}
@@ -1,45 +1,79 @@
 package notes
 
 import (
+	"context"
 	"encoding/json"
-	"fmt"
 	"net/http"
 	"time"
 
+	"memo/api/authz"
 	"memo/api/notes/repository"
 	"memo/pkg/logger"
 	"memo/pkg/response"
 	"memo/pkg/validation"
 )
 
-func HandleCreateTodo(logger logger.Logger, repo repository.TodoNotesRepository) http.HandlerFunc {
+// TaskEvents is told about task changes, to notify the readers of the note.
+type TaskEvents interface {
+	TaskChanged(noteId, taskId string, created bool, ctx context.Context)
+	// TaskCompleted is told when a task is ticked, after TaskChanged.
+	TaskCompleted(noteId, taskId string, ctx context.Context)
+}
+
+func HandleCreateTodo(logger logger.Logger, notes repository.NotesRepository, repo repository.TodoNotesRepository, events TaskEvents) http.HandlerFunc {
 	type taskRequest struct {
 		Content string `json:"content" validate:"required"`
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
+		userId := r.Context().Value("user").(string)
+
 		data, problems := validation.DecodeValid[*taskRequest](r)
 		if len(problems) > 0 {
 			response.ValidationErr(w, problems)
 			return
 		}
 
-		id, err := repo.Create(id, data.Content, r.Context())
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Edit)
+		if !ok {
+			return
+		}
+
+		if note.Type != "todo" {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		taskId, err := repo.Create(id, data.Content, r.Context())
 		if err != nil {
-			logger.Error("creation issue " + err.Error())
+			logger.For(r.Context()).Error("creation issue", "error", err)
 			response.RespondErr(w, response.BadRequest())
 			return
 		}
 
-		response.Respond(w, map[string]string{"task_id": id}, http.StatusOK)
+		events.TaskChanged(id, taskId, true, r.Context())
+
+		response.Respond(w, map[string]string{"task_id": taskId}, http.StatusOK)
 	})
 }
 
-func HandleUpdateTodo(logger logger.Logger, repo repository.TodoNotesRepository) http.HandlerFunc {
+func HandleUpdateTodo(logger logger.Logger, notes repository.NotesRepository, repo repository.TodoNotesRepository, events TaskEvents) http.HandlerFunc {
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		id := r.PathValue("id")
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Edit)
+		if !ok {
+			return
+		}
+
+		if note.Type != "todo" {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
 		data := make(map[string]any)
 		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
 			// NOTE: does this error needs to halt.
@@ -48,7 +82,7 @@ func HandleUpdateTodo(logger logger.Logger, repo repository.TodoNotesRepository)
 
 		taskId, ok := data["task_id"]
 		if !ok {
-			logger.Error("Task id not provided")
+			logger.For(r.Context()).Warn("task id not provided", "note_id", id)
 			response.RespondErr(w, response.NotFound())
 			return
 		}
@@ -73,19 +107,23 @@ func HandleUpdateTodo(logger logger.Logger, repo repository.TodoNotesRepository)
 		}
 
 		if len(updates) == 0 {
-			logger.Error("Nothing to update")
+			logger.For(r.Context()).Warn("nothing to update", "note_id", id, "task_id", taskId)
 			response.RespondErr(w, response.BadRequest())
 			return
 		}
 
 		err := repo.Update(id, taskId.(string), updates, r.Context())
 		if err != nil {
-			logger.Error("update issue " + err.Error())
-			logger.Info(fmt.Sprintf("id: %s, taskId: %s", id, taskId.(string)))
+			logger.For(r.Context()).Error("update issue", "error", err, "note_id", id, "task_id", taskId)
 			response.RespondErr(w, response.BadRequest())
 			return
 		}
 
+		events.TaskChanged(id, taskId.(string), false, r.Context())
+		if updates["is_completed"] == true {
+			events.TaskCompleted(id, taskId.(string), r.Context())
+		}
+
 		response.RespondSuccess(w)
 	})
 }
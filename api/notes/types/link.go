@@ -0,0 +1,150 @@
+package types
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"time"
+
+	"memo/api/notes/bookmark"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/validation"
+)
+
+type linkType struct {
+	logger logger.Logger
+	pages  bookmark.Fetcher
+	repo   repository.NotesRepository
+}
+
+// Link returns the bookmark type, pages are fetched for their title and description
+// and repo is used to reject urls that are already saved.
+func Link(logger logger.Logger, pages bookmark.Fetcher, repo repository.NotesRepository) models.NoteType {
+	return linkType{logger, pages, repo}
+}
+
+type linkRequest struct {
+	URL     string `json:"url" validate:"required"`
+	Archive bool   `json:"archive"`
+}
+
+func (linkType) Name() string  { return "link" }
+func (linkType) Field() string { return "link_note" }
+func (linkType) New() any      { return &models.LinkNoteData{} }
+
+func (t linkType) Create(data map[string]any, userId string, ctx context.Context) (any, map[string]string, error) {
+	req, problems := validation.Valid[*linkRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	normalized, err := bookmark.NormalizeURL(req.URL)
+	if err != nil {
+		return nil, map[string]string{"url": "url"}, nil
+	}
+
+	if existing, err := t.repo.FindByURL(userId, normalized, ctx); err == nil {
+		return nil, nil, duplicateLink(existing)
+	}
+
+	link := &models.LinkNoteData{URL: req.URL, NormalizedURL: normalized}
+	t.fetch(link, req.Archive, ctx)
+
+	return link, nil, nil
+}
+
+func (t linkType) Update(note *models.EmbeddedNote, data map[string]any, ctx context.Context) (map[string]any, map[string]string, error) {
+	req, problems := validation.Valid[*linkRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	normalized, err := bookmark.NormalizeURL(req.URL)
+	if err != nil {
+		return nil, map[string]string{"url": "url"}, nil
+	}
+
+	link, ok := note.Data.(*models.LinkNoteData)
+	if !ok {
+		link = &models.LinkNoteData{}
+		note.Data = link
+	}
+
+	changed := normalized != link.NormalizedURL
+	if changed {
+		if existing, err := t.repo.FindByURL(note.UserId.Hex(), normalized, ctx); err == nil && existing.ID != note.ID {
+			return nil, nil, duplicateLink(existing)
+		}
+	}
+
+	link.URL = req.URL
+	link.NormalizedURL = normalized
+
+	if changed || req.Archive {
+		t.fetch(link, req.Archive, ctx)
+	}
+
+	return map[string]any{
+		"url":            link.URL,
+		"normalized_url": link.NormalizedURL,
+		"title":          link.Title,
+		"description":    link.Description,
+		"favicon":        link.Favicon,
+		"snapshot":       link.Snapshot,
+		"fetched_at":     link.FetchedAt,
+	}, nil, nil
+}
+
+func (linkType) SearchText(doc any) string {
+	link, ok := doc.(*models.LinkNoteData)
+	if !ok {
+		return ""
+	}
+
+	return strings.Join([]string{link.NormalizedURL, link.Title, link.Description}, "\n")
+}
+
+// fetch fills the page details of a link note, the snapshot is only kept when archive is set.
+// The normalized url is fetched, it's the one validated. On error the link keeps its previous details.
+func (t linkType) fetch(link *models.LinkNoteData, archive bool, ctx context.Context) {
+	page, err := t.pages.Fetch(link.NormalizedURL, ctx)
+	if err != nil {
+		t.logger.For(ctx).Error("link fetch issue", "error", err)
+		return
+	}
+
+	now := time.Now()
+
+	link.Title = page.Title
+	link.Description = page.Description
+	link.Favicon = page.Favicon
+	link.FetchedAt = &now
+
+	if archive {
+		link.Snapshot = page.Text
+	}
+}
+
+// Copy keeps the page details, a user can't have the same link twice though.
+func (t linkType) Copy(doc any, userId string, ctx context.Context) (any, error) {
+	link, ok := doc.(*models.LinkNoteData)
+	if !ok {
+		return doc, nil
+	}
+
+	if existing, err := t.repo.FindByURL(userId, link.NormalizedURL, ctx); err == nil {
+		return nil, duplicateLink(existing)
+	}
+
+	return link, nil
+}
+
+func duplicateLink(existing *models.EmbeddedNote) error {
+	return response.ErrorResponse{
+		Status:  http.StatusConflict,
+		Message: "A link note with this url already exists: " + existing.ID.Hex(),
+	}
+}
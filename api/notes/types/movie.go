@@ -0,0 +1,117 @@
+package types
+
+import (
+	"context"
+	"errors"
+	"strings"
+
+	"memo/api/notes/metadata"
+	"memo/api/notes/models"
+	"memo/pkg/logger"
+	"memo/pkg/validation"
+)
+
+type movieType struct {
+	logger logger.Logger
+	movies metadata.MetadataProvider
+}
+
+// Movie returns the movie type, new movies are filled in from movies.
+func Movie(logger logger.Logger, movies metadata.MetadataProvider) models.NoteType {
+	return movieType{logger, movies}
+}
+
+// year and director are optional on create, they are filled in from the metadata provider.
+type movieCreateRequest struct {
+	Title    string `json:"title"`
+	Year     int    `json:"year"`
+	Watched  bool   `json:"watched" validate:"required|boolean"`
+	Director string `json:"director"`
+}
+
+type movieUpdateRequest struct {
+	Year     int    `json:"year" validate:"required|numeric"`
+	Director string `json:"director"`
+}
+
+func (movieType) Name() string  { return "movie" }
+func (movieType) Field() string { return "movie_note" }
+func (movieType) New() any      { return &models.MovieNoteData{} }
+
+func (t movieType) Create(data map[string]any, userId string, ctx context.Context) (any, map[string]string, error) {
+	req, problems := validation.Valid[*movieCreateRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	movie := &models.MovieNoteData{
+		Year:     req.Year,
+		Watched:  req.Watched,
+		Director: req.Director,
+	}
+
+	if m, err := t.movies.Lookup(req.Title, req.Year, ctx); err == nil {
+		ApplyMovieMetadata(movie, m, false)
+	} else if !errors.Is(err, metadata.ErrNotFound) {
+		t.logger.For(ctx).Error("movie lookup issue", "error", err)
+	}
+
+	return movie, nil, nil
+}
+
+func (movieType) Update(note *models.EmbeddedNote, data map[string]any, ctx context.Context) (map[string]any, map[string]string, error) {
+	req, problems := validation.Valid[*movieUpdateRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	movie, ok := note.Data.(*models.MovieNoteData)
+	if !ok {
+		movie = &models.MovieNoteData{}
+		note.Data = movie
+	}
+
+	movie.Year = req.Year
+	movie.Director = req.Director
+
+	return map[string]any{"year": req.Year, "director": req.Director}, nil, nil
+}
+
+func (movieType) SearchText(doc any) string {
+	movie, ok := doc.(*models.MovieNoteData)
+	if !ok {
+		return ""
+	}
+
+	return strings.Join(append([]string{movie.Director}, movie.Genres...), " ")
+}
+
+// ApplyMovieMetadata copies the provider data into the note.
+// Unless overwrite is set, values typed by the user are kept.
+func ApplyMovieMetadata(movie *models.MovieNoteData, m *metadata.Movie, overwrite bool) {
+	if overwrite || movie.Year == 0 {
+		if m.Year != 0 {
+			movie.Year = m.Year
+		}
+	}
+
+	if overwrite || movie.Director == "" {
+		if m.Director != "" {
+			movie.Director = m.Director
+		}
+	}
+
+	if overwrite || len(movie.Genres) == 0 {
+		movie.Genres = m.Genres
+	}
+
+	if overwrite || movie.Runtime == 0 {
+		movie.Runtime = m.Runtime
+	}
+
+	if overwrite || movie.Poster == "" {
+		movie.Poster = m.Poster
+	}
+
+	movie.SourceID = m.ID
+}
@@ -0,0 +1,60 @@
+package types
+
+import (
+	"context"
+
+	"memo/api/notes/models"
+	"memo/pkg/markdown"
+	"memo/pkg/validation"
+)
+
+type textType struct{}
+
+func Text() models.NoteType {
+	return textType{}
+}
+
+type textRequest struct {
+	Content string `json:"content" validate:"required"`
+}
+
+func (textType) Name() string  { return "text" }
+func (textType) Field() string { return "text_note" }
+func (textType) New() any      { return &models.TextNoteData{} }
+
+func (textType) Create(data map[string]any, userId string, ctx context.Context) (any, map[string]string, error) {
+	req, problems := validation.Valid[*textRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	return &models.TextNoteData{Content: req.Content}, nil, nil
+}
+
+func (textType) Update(note *models.EmbeddedNote, data map[string]any, ctx context.Context) (map[string]any, map[string]string, error) {
+	req, problems := validation.Valid[*textRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	note.Data = &models.TextNoteData{Content: req.Content}
+
+	return map[string]any{"content": req.Content}, nil, nil
+}
+
+func (textType) SearchText(doc any) string {
+	if text, ok := doc.(*models.TextNoteData); ok {
+		return text.Content
+	}
+	return ""
+}
+
+// Render returns the content as sanitised html with its outline and reading time.
+func (textType) Render(doc any) (any, error) {
+	content := ""
+	if text, ok := doc.(*models.TextNoteData); ok {
+		content = text.Content
+	}
+
+	return markdown.Render(content)
+}
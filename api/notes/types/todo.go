@@ -0,0 +1,79 @@
+package types
+
+import (
+	"context"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/pkg/validation"
+)
+
+type todoType struct{}
+
+func Todo() models.NoteType {
+	return todoType{}
+}
+
+type todoRequest struct {
+	Tasks []string `json:"tasks" validate:"required|array"`
+}
+
+func (todoType) Name() string  { return "todo" }
+func (todoType) Field() string { return "todo_note" }
+func (todoType) New() any      { return &models.TodoNoteData{} }
+
+func (todoType) Create(data map[string]any, userId string, ctx context.Context) (any, map[string]string, error) {
+	req, problems := validation.Valid[*todoRequest](data)
+	if len(problems) > 0 {
+		return nil, problems, nil
+	}
+
+	todo := &models.TodoNoteData{}
+	for _, task := range req.Tasks {
+		todo.Tasks = append(todo.Tasks, models.Task{
+			ID:          primitive.NewObjectID(),
+			Content:     task,
+			IsCompleted: false,
+			CompletedAt: nil,
+		})
+	}
+
+	return todo, nil, nil
+}
+
+// Update does nothing, tasks are changed through the todo endpoints.
+func (todoType) Update(note *models.EmbeddedNote, data map[string]any, ctx context.Context) (map[string]any, map[string]string, error) {
+	return map[string]any{}, nil, nil
+}
+
+// Copy gives the tasks new ids and resets their completion.
+func (todoType) Copy(doc any, userId string, ctx context.Context) (any, error) {
+	todo, ok := doc.(*models.TodoNoteData)
+	if !ok {
+		return doc, nil
+	}
+
+	for i := range todo.Tasks {
+		todo.Tasks[i].ID = primitive.NewObjectID()
+		todo.Tasks[i].IsCompleted = false
+		todo.Tasks[i].CompletedAt = nil
+	}
+
+	return todo, nil
+}
+
+func (todoType) SearchText(doc any) string {
+	todo, ok := doc.(*models.TodoNoteData)
+	if !ok {
+		return ""
+	}
+
+	tasks := make([]string, 0, len(todo.Tasks))
+	for _, task := range todo.Tasks {
+		tasks = append(tasks, task.Content)
+	}
+
+	return strings.Join(tasks, "\n")
+}
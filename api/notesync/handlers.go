@@ -0,0 +1,79 @@
+package notesync
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+const (
+	defaultLimit = 200
+	maxLimit     = 1000
+	// a push can hold this many mutations at most.
+	maxMutations = 500
+)
+
+// HandlePull returns the changes made after ?since=<token>, deleted notes are returned as tombstones.
+// The client keeps the returned token for the next pull, and pulls again while more is set.
+func HandlePull(logger logger.Logger, syncer *Syncer) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		version, err := ParseToken(r.URL.Query().Get("since"))
+		if err != nil {
+			response.ValidationErr(w, map[string]string{"since": "token"})
+			return
+		}
+
+		limit := defaultLimit
+		if value := r.URL.Query().Get("limit"); value != "" {
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxLimit {
+				response.ValidationErr(w, map[string]string{"limit": "between:1," + strconv.Itoa(maxLimit)})
+				return
+			}
+		}
+
+		changes, err := syncer.Changes(userId, version, limit, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("sync pull issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, changes, http.StatusOK)
+	})
+}
+
+// HandlePush applies a batch of offline mutations in order. Each result tells whether the mutation
+// was applied, merged with conflicting server changes, rejected or failed.
+func HandlePush(logger logger.Logger, syncer *Syncer) http.HandlerFunc {
+	type pushRequest struct {
+		Mutations []Mutation `json:"mutations"`
+	}
+
+	type pushResponse struct {
+		Results []Result `json:"results"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		var req pushRequest
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil || len(req.Mutations) == 0 {
+			response.ValidationErr(w, map[string]string{"mutations": "required|array"})
+			return
+		}
+
+		if len(req.Mutations) > maxMutations {
+			response.ErrMessage(w, "A push can hold "+strconv.Itoa(maxMutations)+" mutations at most", http.StatusRequestEntityTooLarge)
+			return
+		}
+
+		results := syncer.Push(userId, req.Mutations, r.Context())
+
+		response.Respond(w, pushResponse{Results: results}, http.StatusOK)
+	})
+}
@@ -0,0 +1,244 @@
+package notesync
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+)
+
+// merger resolves a mutation against the stored note, field by field. A field the server changed
+// after the base version is a conflict, the last writer wins it. Fields without a stamp haven't
+// changed since versions were added.
+type merger struct {
+	note      *models.EmbeddedNote
+	mutation  *Mutation
+	conflicts []Conflict
+}
+
+// keep reports whether the client value of field is applied, stamp is the key the change of field
+// is stamped under.
+func (m *merger) keep(field, stamp string, client, server any) bool {
+	if sameValue(client, server) {
+		return false
+	}
+
+	changed, ok := m.note.Stamps[repository.StampKey(stamp)]
+	if !ok || changed.Version <= m.mutation.BaseVersion {
+		return true
+	}
+
+	conflict := Conflict{Field: field, Winner: "server", Client: client, Server: server}
+	if m.mutation.ModifiedAt.After(changed.Time) {
+		conflict.Winner = "client"
+	}
+	m.conflicts = append(m.conflicts, conflict)
+
+	return conflict.Winner == "client"
+}
+
+// fields returns the note fields to update, they are also applied to the note.
+func (m *merger) fields(t models.NoteType, ctx context.Context) (map[string]any, map[string]string, error) {
+	fields := map[string]any{}
+	mutation := m.mutation
+
+	if mutation.Title != nil {
+		title := strings.TrimSpace(*mutation.Title)
+		if title == "" {
+			return nil, map[string]string{"title": "required"}, nil
+		}
+
+		if m.keep("title", "title", title, m.note.Title) {
+			m.note.Title = title
+			fields["title"] = title
+		}
+	}
+
+	if mutation.Tags != nil {
+		if m.keep("tags", "tags", mutation.Tags, orEmpty(m.note.Tags)) {
+			m.note.Tags = mutation.Tags
+			fields["tags"] = mutation.Tags
+		}
+	}
+
+	if mutation.Notebook != nil {
+		notebook := strings.TrimSpace(*mutation.Notebook)
+		if m.keep("notebook", "notebook", notebook, m.note.Notebook) {
+			m.note.Notebook = notebook
+			fields["notebook"] = notebook
+		}
+	}
+
+	if len(mutation.Data) == 0 {
+		return fields, nil, nil
+	}
+
+	// the type validates the stored document with the client fields on top of it.
+	raw, err := json.Marshal(m.note.Data)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	current := map[string]any{}
+	if err := json.Unmarshal(raw, &current); err != nil {
+		return nil, nil, err
+	}
+
+	request := map[string]any{}
+	for key, value := range current {
+		request[key] = value
+	}
+	for key, value := range mutation.Data {
+		request[key] = value
+	}
+
+	copied := &models.EmbeddedNote{BaseNote: m.note.BaseNote, Data: t.New()}
+	if err := json.Unmarshal(raw, copied.Data); err != nil {
+		return nil, nil, err
+	}
+
+	updated, problems, err := t.Update(copied, request, ctx)
+	if len(problems) > 0 || err != nil {
+		return nil, problems, err
+	}
+
+	lost := false
+	for key, value := range updated {
+		field := t.Field() + "." + key
+		if m.keep(field, field, value, current[key]) {
+			fields[field] = value
+		} else if !sameValue(value, current[key]) {
+			lost = true
+		}
+	}
+
+	// the search text is built from the client document when none of its fields lost.
+	if !lost {
+		m.note.Data = copied.Data
+	}
+
+	return fields, nil, nil
+}
+
+type taskOp struct {
+	id      string
+	add     *models.Task
+	remove  bool
+	updates map[string]any
+}
+
+// tasks merges the task changes into the todo list of the note, tasks are matched by id.
+func (m *merger) tasks() ([]taskOp, map[string]string) {
+	changes := m.mutation.Tasks
+	if changes == nil {
+		return nil, nil
+	}
+
+	todo, ok := m.note.Data.(*models.TodoNoteData)
+	if !ok {
+		return nil, map[string]string{"tasks": "Only todo notes have tasks"}
+	}
+
+	stored := map[string]*models.Task{}
+	for i := range todo.Tasks {
+		stored[todo.Tasks[i].ID.Hex()] = &todo.Tasks[i]
+	}
+
+	ops := []taskOp{}
+
+	for _, change := range changes.Upsert {
+		id, err := primitive.ObjectIDFromHex(change.ID)
+		if err != nil {
+			return nil, map[string]string{"tasks.upsert": "Tasks need an ObjectID"}
+		}
+
+		field := repository.TaskField(change.ID)
+		task, ok := stored[change.ID]
+
+		if !ok {
+			if change.Content == nil || strings.TrimSpace(*change.Content) == "" {
+				return nil, map[string]string{"tasks.upsert": "New tasks need a content"}
+			}
+
+			added := &models.Task{ID: id, Content: *change.Content}
+			if change.IsCompleted != nil && *change.IsCompleted {
+				now := m.mutation.ModifiedAt
+				added.IsCompleted, added.CompletedAt = true, &now
+			}
+
+			// a task removed on the server after the base version is only added back by a later change.
+			if m.keep(field, field, added, nil) {
+				ops = append(ops, taskOp{id: change.ID, add: added})
+			}
+			continue
+		}
+
+		updates := map[string]any{}
+
+		if change.Content != nil && m.keep(field+".content", field, *change.Content, task.Content) {
+			updates["content"] = *change.Content
+		}
+
+		if change.IsCompleted != nil && m.keep(field+".is_completed", field, *change.IsCompleted, task.IsCompleted) {
+			updates["is_completed"] = *change.IsCompleted
+			updates["completed_at"] = nil
+			if *change.IsCompleted {
+				updates["completed_at"] = m.mutation.ModifiedAt
+			}
+		}
+
+		if len(updates) > 0 {
+			ops = append(ops, taskOp{id: change.ID, updates: updates})
+		}
+	}
+
+	for _, id := range changes.Delete {
+		task, ok := stored[id]
+		if !ok {
+			continue
+		}
+
+		field := repository.TaskField(id)
+		if m.keep(field, field, nil, task) {
+			ops = append(ops, taskOp{id: id, remove: true})
+		}
+	}
+
+	return ops, nil
+}
+
+// sameValue compares values by their json encoding, the client values are decoded from json.
+func sameValue(a, b any) bool {
+	ja, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+
+	jb, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	return bytes.Equal(ja, jb)
+}
+
+func orEmpty(tags []string) []string {
+	if tags == nil {
+		return []string{}
+	}
+	return tags
+}
+
+// modifiedAt defaults the client time of a mutation to now.
+func modifiedAt(t time.Time) time.Time {
+	if t.IsZero() || t.After(time.Now()) {
+		return time.Now()
+	}
+	return t
+}
@@ -0,0 +1,293 @@
+package notesync
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/api/notes/types"
+)
+
+// the client based its changes on version 10, the server changed some fields at version 12.
+const baseVersion = 10
+
+var serverChange = time.Date(2024, 5, 1, 12, 0, 0, 0, time.UTC)
+
+// stamped returns the stamps of fields changed by the server after the base version.
+func stamped(fields ...string) map[string]models.Stamp {
+	stamps := map[string]models.Stamp{
+		// changed before the client synced, never a conflict.
+		repository.StampKey("notebook"): {Version: baseVersion - 2, Time: serverChange.Add(-time.Hour)},
+	}
+	for _, field := range fields {
+		stamps[repository.StampKey(field)] = models.Stamp{Version: baseVersion + 2, Time: serverChange}
+	}
+	return stamps
+}
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestKeep(t *testing.T) {
+	tests := []struct {
+		name         string
+		client       string
+		stamps       map[string]models.Stamp
+		modifiedAt   time.Time
+		keep         bool
+		conflictWith string
+	}{
+		{"same value", "server", stamped("title"), serverChange.Add(time.Hour), false, ""},
+		{"never stamped", "client", nil, serverChange.Add(-time.Hour), true, ""},
+		{"changed before the base version", "client", stamped(), serverChange.Add(-time.Hour), true, ""},
+		{"conflict won by the client", "client", stamped("title"), serverChange.Add(time.Second), true, "client"},
+		{"conflict won by the server", "client", stamped("title"), serverChange.Add(-time.Second), false, "server"},
+		{"conflict at the same time", "client", stamped("title"), serverChange, false, "server"},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			note := &models.EmbeddedNote{BaseNote: models.BaseNote{Title: "server", Stamps: test.stamps}}
+			m := &merger{note: note, mutation: &Mutation{BaseVersion: baseVersion, ModifiedAt: test.modifiedAt}}
+
+			if got := m.keep("title", "title", test.client, note.Title); got != test.keep {
+				t.Errorf("keep = %t, want %t", got, test.keep)
+			}
+
+			if test.conflictWith == "" {
+				if len(m.conflicts) > 0 {
+					t.Errorf("conflicts %+v, want none", m.conflicts)
+				}
+				return
+			}
+
+			if len(m.conflicts) != 1 || m.conflicts[0].Winner != test.conflictWith {
+				t.Errorf("conflicts %+v, want one won by the %s", m.conflicts, test.conflictWith)
+			}
+		})
+	}
+}
+
+func TestFields(t *testing.T) {
+	before, after := serverChange.Add(-time.Minute), serverChange.Add(time.Minute)
+
+	tests := []struct {
+		name      string
+		stamps    map[string]models.Stamp
+		mutation  Mutation
+		updates   []string
+		conflicts int
+		problems  bool
+	}{
+		{
+			name:     "changes since the base version",
+			stamps:   stamped(),
+			mutation: Mutation{Title: ptr("Client"), Tags: []string{"a"}, Notebook: ptr("Work"), Data: map[string]any{"content": "client"}, ModifiedAt: before},
+			updates:  []string{"title", "tags", "notebook", "text_note.content"},
+		},
+		{
+			name:      "server changes win when older",
+			stamps:    stamped("title", "text_note.content"),
+			mutation:  Mutation{Title: ptr("Client"), Tags: []string{"a"}, Data: map[string]any{"content": "client"}, ModifiedAt: before},
+			updates:   []string{"tags"},
+			conflicts: 2,
+		},
+		{
+			name:      "client changes win when newer",
+			stamps:    stamped("title", "text_note.content"),
+			mutation:  Mutation{Title: ptr("Client"), Data: map[string]any{"content": "client"}, ModifiedAt: after},
+			updates:   []string{"title", "text_note.content"},
+			conflicts: 2,
+		},
+		{
+			name:     "unchanged values",
+			stamps:   stamped("title"),
+			mutation: Mutation{Title: ptr(" Server "), Data: map[string]any{"content": "server"}, ModifiedAt: before},
+		},
+		{
+			name:     "blank title",
+			mutation: Mutation{Title: ptr(" ")},
+			problems: true,
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			note := &models.EmbeddedNote{
+				BaseNote: models.BaseNote{Type: "text", Title: "Server", Tags: []string{}, Stamps: test.stamps},
+				Data:     &models.TextNoteData{Content: "server"},
+			}
+			mutation := test.mutation
+			mutation.BaseVersion = baseVersion
+
+			m := &merger{note: note, mutation: &mutation}
+			updates, problems, err := m.fields(types.Text(), context.Background())
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			if (len(problems) > 0) != test.problems {
+				t.Fatalf("problems %v", problems)
+			}
+
+			if len(updates) != len(test.updates) {
+				t.Errorf("updates %v, want %v", updates, test.updates)
+			}
+			for _, field := range test.updates {
+				if _, ok := updates[field]; !ok {
+					t.Errorf("%s isn't updated", field)
+				}
+			}
+
+			if len(m.conflicts) != test.conflicts {
+				t.Errorf("conflicts %+v, want %d", m.conflicts, test.conflicts)
+			}
+		})
+	}
+}
+
+func TestTasks(t *testing.T) {
+	kept, edited, removed, added := primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID(), primitive.NewObjectID()
+	before, after := serverChange.Add(-time.Minute), serverChange.Add(time.Minute)
+
+	// the server edited a task and removed another one after the base version.
+	note := func() *models.EmbeddedNote {
+		return &models.EmbeddedNote{
+			BaseNote: models.BaseNote{
+				Type:   "todo",
+				Stamps: stamped(repository.TaskField(edited.Hex()), repository.TaskField(removed.Hex())),
+			},
+			Data: &models.TodoNoteData{Tasks: []models.Task{
+				{ID: kept, Content: "kept"},
+				{ID: edited, Content: "edited on the server"},
+			}},
+		}
+	}
+
+	tests := []struct {
+		name       string
+		changes    TaskChanges
+		modifiedAt time.Time
+		// ops are the expected task operations by id: add, remove or update.
+		ops       map[primitive.ObjectID]string
+		conflicts int
+	}{
+		{
+			name:    "new task",
+			changes: TaskChanges{Upsert: []TaskChange{{ID: added.Hex(), Content: ptr("new")}}},
+			ops:     map[primitive.ObjectID]string{added: "add"},
+		},
+		{
+			name:    "task removed since the base version",
+			changes: TaskChanges{Delete: []string{kept.Hex()}},
+			ops:     map[primitive.ObjectID]string{kept: "remove"},
+		},
+		{
+			name:      "removing a task the server edited later",
+			changes:   TaskChanges{Delete: []string{edited.Hex()}},
+			ops:       map[primitive.ObjectID]string{},
+			conflicts: 1,
+		},
+		{
+			name:       "removing a task the server edited earlier",
+			changes:    TaskChanges{Delete: []string{edited.Hex()}},
+			modifiedAt: after,
+			ops:        map[primitive.ObjectID]string{edited: "remove"},
+			conflicts:  1,
+		},
+		{
+			name:      "editing a task the server removed later",
+			changes:   TaskChanges{Upsert: []TaskChange{{ID: removed.Hex(), Content: ptr("edited offline")}}},
+			ops:       map[primitive.ObjectID]string{},
+			conflicts: 1,
+		},
+		{
+			name:       "editing a task the server removed earlier",
+			changes:    TaskChanges{Upsert: []TaskChange{{ID: removed.Hex(), Content: ptr("edited offline")}}},
+			modifiedAt: after,
+			ops:        map[primitive.ObjectID]string{removed: "add"},
+			conflicts:  1,
+		},
+		{
+			name:       "editing a task the server edited at the same time",
+			changes:    TaskChanges{Upsert: []TaskChange{{ID: edited.Hex(), Content: ptr("edited offline"), IsCompleted: ptr(true)}}},
+			modifiedAt: serverChange,
+			ops:        map[primitive.ObjectID]string{},
+			conflicts:  2,
+		},
+		{
+			name:    "completing a task",
+			changes: TaskChanges{Upsert: []TaskChange{{ID: kept.Hex(), IsCompleted: ptr(true)}}},
+			ops:     map[primitive.ObjectID]string{kept: "update"},
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			modifiedAt := test.modifiedAt
+			if modifiedAt.IsZero() {
+				modifiedAt = before
+			}
+
+			changes := test.changes
+			m := &merger{note: note(), mutation: &Mutation{BaseVersion: baseVersion, ModifiedAt: modifiedAt, Tasks: &changes}}
+
+			ops, problems := m.tasks()
+			if len(problems) > 0 {
+				t.Fatalf("problems %v", problems)
+			}
+
+			got := map[primitive.ObjectID]string{}
+			for _, op := range ops {
+				id, _ := primitive.ObjectIDFromHex(op.id)
+				switch {
+				case op.add != nil:
+					got[id] = "add"
+				case op.remove:
+					got[id] = "remove"
+				default:
+					got[id] = "update"
+				}
+			}
+
+			if len(got) != len(test.ops) {
+				t.Errorf("ops %v, want %v", got, test.ops)
+			}
+			for id, op := range test.ops {
+				if got[id] != op {
+					t.Errorf("op of %s = %q, want %q", id.Hex(), got[id], op)
+				}
+			}
+
+			if len(m.conflicts) != test.conflicts {
+				t.Errorf("conflicts %+v, want %d", m.conflicts, test.conflicts)
+			}
+		})
+	}
+}
+
+func TestTasksProblems(t *testing.T) {
+	tests := []struct {
+		name    string
+		note    *models.EmbeddedNote
+		changes TaskChanges
+	}{
+		{"text note", &models.EmbeddedNote{Data: &models.TextNoteData{}}, TaskChanges{Delete: []string{primitive.NewObjectID().Hex()}}},
+		{"invalid id", &models.EmbeddedNote{Data: &models.TodoNoteData{}}, TaskChanges{Upsert: []TaskChange{{ID: "1", Content: ptr("task")}}}},
+		{"new task without content", &models.EmbeddedNote{Data: &models.TodoNoteData{}}, TaskChanges{Upsert: []TaskChange{{ID: primitive.NewObjectID().Hex()}}}},
+	}
+
+	for _, test := range tests {
+		changes := test.changes
+		m := &merger{note: test.note, mutation: &Mutation{Tasks: &changes}}
+
+		if _, problems := m.tasks(); len(problems) == 0 {
+			t.Errorf("%s: no problems", test.name)
+		}
+	}
+}
@@ -0,0 +1,96 @@
+package notesync
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+)
+
+// Mutation is a change made by a client while offline.
+type Mutation struct {
+	Op string `json:"op"`
+	// ID is the note changed by update and delete.
+	ID string `json:"id"`
+	// ClientID identifies a note created offline, creating it twice returns the first note.
+	ClientID string `json:"client_id"`
+	// BaseVersion is the version of the note the client changed.
+	BaseVersion int64 `json:"base_version"`
+	// ModifiedAt is when the client made the change, the last writer wins a conflict.
+	ModifiedAt time.Time `json:"modified_at"`
+	Type       string    `json:"type"`
+	// Title, Tags and Notebook are left as they are when nil.
+	Title    *string  `json:"title"`
+	Tags     []string `json:"tags"`
+	Notebook *string  `json:"notebook"`
+	// Data holds the type specific fields, e.g. "content" for text notes.
+	Data  map[string]any `json:"data"`
+	Tasks *TaskChanges   `json:"tasks"`
+}
+
+// TaskChanges are the changes of a todo list, tasks are matched by id.
+type TaskChanges struct {
+	Upsert []TaskChange `json:"upsert"`
+	Delete []string     `json:"delete"`
+}
+
+// TaskChange adds a task, or changes the given fields of an existing one.
+// New tasks are given an ObjectID by the client.
+type TaskChange struct {
+	ID          string  `json:"id"`
+	Content     *string `json:"content"`
+	IsCompleted *bool   `json:"is_completed"`
+}
+
+// Conflict is a field changed both on the server and by the client since the base version.
+type Conflict struct {
+	Field string `json:"field"`
+	// Winner is "client" or "server".
+	Winner string `json:"winner"`
+	Client any    `json:"client"`
+	Server any    `json:"server"`
+}
+
+// Result reports what happened to a mutation.
+type Result struct {
+	Op       string `json:"op"`
+	ID       string `json:"id,omitempty"`
+	ClientID string `json:"client_id,omitempty"`
+	// Status is applied, merged when there were conflicts, rejected, failed or partial when it
+	// failed after some changes were saved.
+	Status    string            `json:"status"`
+	Error     string            `json:"error,omitempty"`
+	Problems  map[string]string `json:"problems,omitempty"`
+	Conflicts []Conflict        `json:"conflicts,omitempty"`
+	// Note is the note as stored after the mutation, the client replaces its copy with it.
+	Note *models.EmbeddedNote `json:"note,omitempty"`
+}
+
+// ChangeSet is the answer to a pull: the changes after the sync token, in the order they were made.
+type ChangeSet struct {
+	Notes   []*models.EmbeddedNote  `json:"notes"`
+	Deleted []*repository.Tombstone `json:"deleted"`
+	// Token is sent by the next pull, More is set when the changes didn't fit in this one.
+	Token string `json:"token"`
+	More  bool   `json:"more"`
+}
+
+// ParseToken returns the version a sync token stands for, the empty token is a full sync.
+func ParseToken(token string) (int64, error) {
+	if token == "" {
+		return 0, nil
+	}
+
+	version, err := strconv.ParseInt(token, 10, 64)
+	if err != nil || version < 0 {
+		return 0, fmt.Errorf("Invalid sync token")
+	}
+
+	return version, nil
+}
+
+func formatToken(version int64) string {
+	return strconv.FormatInt(version, 10)
+}
@@ -0,0 +1,356 @@
+package notesync
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/mongo"
+
+	"memo/api/authz"
+	"memo/api/notes"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+// an update is merged again this many times when the note changes while it's written.
+const maxAttempts = 3
+
+// Syncer serves the change feed of offline clients and applies the changes they made offline.
+type Syncer struct {
+	logger logger.Logger
+	notes  repository.NotesRepository
+	todos  repository.TodoNotesRepository
+	types  *models.Registry
+	events notes.TaskEvents
+}
+
+func NewSyncer(logger logger.Logger, notes repository.NotesRepository, todos repository.TodoNotesRepository, types *models.Registry, events notes.TaskEvents) *Syncer {
+	return &Syncer{logger, notes, todos, types, events}
+}
+
+// Changes returns at most limit notes and tombstones changed after version, oldest change first.
+// The changes that may still be followed by the commit of a lower version are left for the next pull.
+func (s *Syncer) Changes(userId string, version int64, limit int, ctx context.Context) (*ChangeSet, error) {
+	until, err := s.notes.Committed(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	changed, err := s.notes.Changes(userId, version, until, limit+1, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	deleted, err := s.notes.Tombstones(userId, version, until, limit+1, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	set := &ChangeSet{Notes: []*models.EmbeddedNote{}, Deleted: []*repository.Tombstone{}}
+	last := version
+
+	// both lists are sorted by version, the oldest changes are taken from both.
+	for len(set.Notes)+len(set.Deleted) < limit && (len(changed) > 0 || len(deleted) > 0) {
+		if len(deleted) == 0 || (len(changed) > 0 && changed[0].Version < deleted[0].Version) {
+			set.Notes = append(set.Notes, changed[0])
+			last, changed = changed[0].Version, changed[1:]
+		} else {
+			set.Deleted = append(set.Deleted, deleted[0])
+			last, deleted = deleted[0].Version, deleted[1:]
+		}
+	}
+
+	set.More = len(changed) > 0 || len(deleted) > 0
+	set.Token = formatToken(last)
+
+	return set, nil
+}
+
+// Push applies the mutations in order and reports the result of each.
+func (s *Syncer) Push(userId string, mutations []Mutation, ctx context.Context) []Result {
+	results := make([]Result, 0, len(mutations))
+
+	for i := range mutations {
+		mutation := &mutations[i]
+		mutation.ModifiedAt = modifiedAt(mutation.ModifiedAt)
+
+		var result Result
+		switch mutation.Op {
+		case "create":
+			result = s.create(userId, mutation, ctx)
+		case "update":
+			result = s.update(userId, mutation, ctx)
+		case "delete":
+			result = s.delete(userId, mutation, ctx)
+		default:
+			result = Result{Status: "rejected", Problems: map[string]string{"op": "in:create,update,delete"}}
+		}
+
+		result.Op = mutation.Op
+		if result.ID == "" {
+			result.ID = mutation.ID
+		}
+		results = append(results, result)
+	}
+
+	return results
+}
+
+func (s *Syncer) create(userId string, mutation *Mutation, ctx context.Context) Result {
+	result := Result{ClientID: mutation.ClientID}
+
+	if mutation.ClientID != "" {
+		if note, err := s.notes.FindByClientID(userId, mutation.ClientID, ctx); err == nil {
+			result.Status, result.ID, result.Note = "applied", note.ID.Hex(), note
+			return result
+		}
+	}
+
+	noteType, ok := s.types.Get(mutation.Type)
+	if !ok {
+		return s.rejected(result, map[string]string{"type": "in:" + strings.Join(s.types.Names(), ",")})
+	}
+
+	if mutation.Title == nil || strings.TrimSpace(*mutation.Title) == "" {
+		return s.rejected(result, map[string]string{"title": "required"})
+	}
+
+	data := map[string]any{}
+	for key, value := range mutation.Data {
+		data[key] = value
+	}
+	data["type"], data["title"] = mutation.Type, strings.TrimSpace(*mutation.Title)
+
+	doc, problems, err := noteType.Create(data, userId, ctx)
+	if len(problems) > 0 {
+		return s.rejected(result, problems)
+	}
+
+	if err != nil {
+		return s.failed(result, err)
+	}
+
+	note := models.EmbeddedNote{
+		BaseNote: models.BaseNote{
+			Type:      mutation.Type,
+			Title:     data["title"].(string),
+			Tags:      orEmpty(mutation.Tags),
+			ClientID:  mutation.ClientID,
+			CreatedAt: mutation.ModifiedAt,
+			UpdatedAt: time.Now(),
+		},
+		Data: doc,
+	}
+	if mutation.Notebook != nil {
+		note.Notebook = strings.TrimSpace(*mutation.Notebook)
+	}
+	note.SearchText = s.types.SearchText(&note)
+
+	id, err := s.notes.Add(note, userId, ctx)
+	if err != nil {
+		return s.failed(result, err)
+	}
+
+	result.ID = id
+	return s.applied(result, nil, ctx)
+}
+
+func (s *Syncer) update(userId string, mutation *Mutation, ctx context.Context) Result {
+	result := Result{ID: mutation.ID}
+
+	note, err := s.notes.GetById(mutation.ID, ctx)
+	if err != nil {
+		return s.missing(result, err)
+	}
+
+	if !authz.Can(note, userId, authz.Edit) {
+		result.Status, result.Error = "rejected", authz.Message(authz.Edit)
+		return result
+	}
+
+	noteType, ok := s.types.Get(note.Type)
+	if !ok {
+		result.Status, result.Error = "rejected", "Unknown note type"
+		return result
+	}
+
+	if mutation.Title != nil && strings.TrimSpace(*mutation.Title) == "" {
+		return s.rejected(result, map[string]string{"title": "required"})
+	}
+
+	// the tasks are merged against the note the client saw, they are written last.
+	tasks := &merger{note: note, mutation: mutation}
+	ops, problems := tasks.tasks()
+	if len(problems) > 0 {
+		return s.rejected(result, problems)
+	}
+
+	// the fields are written first, a version conflict retries them before any task is written.
+	var conflicts []Conflict
+	written := false
+	for attempt := 1; ; attempt++ {
+		if attempt > 1 {
+			if note, err = s.notes.GetById(mutation.ID, ctx); err != nil {
+				return s.missing(result, err)
+			}
+		}
+
+		fields := &merger{note: note, mutation: mutation}
+		updates, problems, err := fields.fields(noteType, ctx)
+		if len(problems) > 0 {
+			return s.rejected(result, problems)
+		}
+
+		if err != nil {
+			return s.failed(result, err)
+		}
+
+		conflicts = fields.conflicts
+		if len(updates) == 0 {
+			break
+		}
+
+		note.SearchText = s.types.SearchText(note)
+
+		err = s.notes.Update(note, updates, ctx)
+		if err == nil {
+			written = true
+			break
+		}
+
+		if !errors.Is(err, repository.ErrVersionConflict) || attempt == maxAttempts {
+			return s.failed(result, err)
+		}
+	}
+
+	// the todo repository keeps the search text of the tasks.
+	for _, op := range ops {
+		if err := s.applyTask(mutation.ID, op, ctx); err != nil {
+			if written {
+				return s.partial(result, err, ctx)
+			}
+			return s.failed(result, err)
+		}
+		written = true
+	}
+
+	return s.applied(result, append(tasks.conflicts, conflicts...), ctx)
+}
+
+func (s *Syncer) applyTask(noteId string, op taskOp, ctx context.Context) error {
+	var err error
+	switch {
+	case op.add != nil:
+		err = s.todos.Add(noteId, *op.add, ctx)
+	case op.remove:
+		err = s.todos.Remove(noteId, op.id, ctx)
+	default:
+		err = s.todos.Update(noteId, op.id, op.updates, ctx)
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if !op.remove {
+		s.events.TaskChanged(noteId, op.id, op.add != nil, ctx)
+		if op.updates["is_completed"] == true {
+			s.events.TaskCompleted(noteId, op.id, ctx)
+		}
+	}
+
+	return nil
+}
+
+func (s *Syncer) delete(userId string, mutation *Mutation, ctx context.Context) Result {
+	result := Result{ID: mutation.ID}
+
+	note, err := s.notes.GetById(mutation.ID, ctx)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		// deleted already.
+		result.Status = "applied"
+		return result
+	}
+
+	if err != nil {
+		return s.missing(result, err)
+	}
+
+	if !authz.Can(note, userId, authz.Delete) {
+		result.Status, result.Error = "rejected", authz.Message(authz.Delete)
+		return result
+	}
+
+	// a note changed on the server after the client deleted it is kept.
+	if note.Version > mutation.BaseVersion && note.UpdatedAt.After(mutation.ModifiedAt) {
+		result.Status, result.Note = "rejected", note
+		result.Conflicts = []Conflict{{Field: "note", Winner: "server", Server: note.Version}}
+		return result
+	}
+
+	if err := s.notes.Delete(mutation.ID, userId, ctx); err != nil {
+		return s.failed(result, err)
+	}
+
+	result.Status = "applied"
+	return result
+}
+
+// applied reads the note back for the result.
+func (s *Syncer) applied(result Result, conflicts []Conflict, ctx context.Context) Result {
+	note, err := s.notes.GetById(result.ID, ctx)
+	if err != nil {
+		return s.failed(result, err)
+	}
+
+	result.Status, result.Note, result.Conflicts = "applied", note, conflicts
+	if len(conflicts) > 0 {
+		result.Status = "merged"
+	}
+
+	return result
+}
+
+// partial reports a mutation that failed after some of its changes were saved, the result holds
+// the note as it is now.
+func (s *Syncer) partial(result Result, err error, ctx context.Context) Result {
+	s.logger.Error("sync issue", "error", err)
+
+	result.Status, result.Error = "partial", "Some of the changes could not be saved"
+	if note, err := s.notes.GetById(result.ID, ctx); err == nil {
+		result.Note = note
+	}
+
+	return result
+}
+
+func (s *Syncer) rejected(result Result, problems map[string]string) Result {
+	result.Status, result.Problems = "rejected", problems
+	return result
+}
+
+func (s *Syncer) missing(result Result, err error) Result {
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		result.Status, result.Error = "rejected", "Note not found"
+		return result
+	}
+
+	return s.failed(result, err)
+}
+
+// failed hides unexpected errors, error responses are returned as rejections.
+func (s *Syncer) failed(result Result, err error) Result {
+	var errResponse response.ErrorResponse
+	if errors.As(err, &errResponse) {
+		result.Status, result.Error = "rejected", errResponse.Message
+		return result
+	}
+
+	s.logger.Error("sync issue", "error", err)
+	result.Status, result.Error = "failed", "The change could not be saved"
+	return result
+}
@@ -0,0 +1,186 @@
+package notifications
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+const (
+	defaultLimit = 50
+	maxLimit     = 200
+)
+
+// HandleList returns the inbox of the user, newest first, with the number of unread notifications.
+// ?unread=true lists only the unread ones, ?before=<id> returns the page after that notification.
+func HandleList(logger logger.Logger, repo NotificationRepository) http.HandlerFunc {
+	type listResponse struct {
+		Notifications []*Notification `json:"notifications"`
+		Unread        int64           `json:"unread"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+		query := r.URL.Query()
+
+		filter := ListFilter{UnreadOnly: query.Get("unread") == "true", Limit: defaultLimit}
+
+		if value := query.Get("limit"); value != "" {
+			limit, err := strconv.Atoi(value)
+			if err != nil || limit < 1 || limit > maxLimit {
+				response.ValidationErr(w, map[string]string{"limit": "between:1," + strconv.Itoa(maxLimit)})
+				return
+			}
+			filter.Limit = int64(limit)
+		}
+
+		if value := query.Get("before"); value != "" {
+			before, err := primitive.ObjectIDFromHex(value)
+			if err != nil {
+				response.ValidationErr(w, map[string]string{"before": "id"})
+				return
+			}
+			filter.Before = before
+		}
+
+		notifications, err := repo.List(userId, filter, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("notifications issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		unread, err := repo.Unread(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("notifications issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, listResponse{notifications, unread}, http.StatusOK)
+	})
+}
+
+func HandleMarkRead(logger logger.Logger, repo NotificationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		if err := repo.MarkRead(r.PathValue("id"), userId, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleMarkAllRead marks the whole inbox as read, the response tells how many were unread.
+func HandleMarkAllRead(logger logger.Logger, repo NotificationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		marked, err := repo.MarkAllRead(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("notifications issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, map[string]int64{"marked": marked}, http.StatusOK)
+	})
+}
+
+func HandleDelete(logger logger.Logger, repo NotificationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		if err := repo.Delete(r.PathValue("id"), userId, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandlePreferences returns whether each kind of notification is on for the user.
+func HandlePreferences(logger logger.Logger, repo NotificationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		preferences, err := repo.Preferences(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("notification preferences issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, preferences.Settings(), http.StatusOK)
+	})
+}
+
+// HandleSavePreferences turns kinds of notifications on or off, {"mentioned": false}. The kinds left
+// out keep their setting.
+func HandleSavePreferences(logger logger.Logger, repo NotificationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data := map[Kind]bool{}
+		if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+			response.RespondErr(w, response.BadRequest())
+			return
+		}
+
+		problems := map[string]string{}
+		for kind := range data {
+			if !known(kind) {
+				problems[string(kind)] = "kind"
+			}
+		}
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		preferences, err := repo.Preferences(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("notification preferences issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		settings := preferences.Settings()
+		for kind, enabled := range data {
+			settings[kind] = enabled
+		}
+
+		preferences.Disabled = []Kind{}
+		for _, kind := range Kinds {
+			if !settings[kind] {
+				preferences.Disabled = append(preferences.Disabled, kind)
+			}
+		}
+
+		if err := repo.SavePreferences(preferences, r.Context()); err != nil {
+			logger.For(r.Context()).Error("notification preferences issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, preferences.Settings(), http.StatusOK)
+	})
+}
+
+func known(kind Kind) bool {
+	for _, k := range Kinds {
+		if k == kind {
+			return true
+		}
+	}
+	return false
+}
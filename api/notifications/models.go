@@ -0,0 +1,73 @@
+package notifications
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Kind is the event a notification tells about, users choose the kinds they're notified of.
+type Kind string
+
+const (
+	// KindShared is a note shared with the user, or their permission changed.
+	KindShared Kind = "note_shared"
+	// KindInvited is an invitation to a note sent to the email of the user.
+	KindInvited Kind = "note_invited"
+	// KindTransferred is a note given to the user.
+	KindTransferred Kind = "note_transferred"
+	// KindMentioned is a comment mentioning the user.
+	KindMentioned Kind = "mentioned"
+	// KindWorkspaceInvited is an invitation to join a workspace.
+	KindWorkspaceInvited Kind = "workspace_invited"
+)
+
+// Kinds are all the kinds of notifications.
+var Kinds = []Kind{KindShared, KindInvited, KindTransferred, KindMentioned, KindWorkspaceInvited}
+
+// Notice is what a subsystem tells a user about, see Notifier.
+type Notice struct {
+	UserID string
+	Kind   Kind
+	NoteID string
+	// Data holds what the client shows besides the note, the title of the note or the id of a comment.
+	Data map[string]string
+}
+
+// Notification is a notice in the inbox of a user.
+type Notification struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"-"`
+	Kind      Kind               `bson:"kind" json:"kind"`
+	NoteID    string             `bson:"note_id,omitempty" json:"note_id,omitempty"`
+	ActorID   string             `bson:"actor_id,omitempty" json:"actor_id,omitempty"`
+	Data      map[string]string  `bson:"data,omitempty" json:"data,omitempty"`
+	Read      bool               `bson:"read" json:"read"`
+	ReadAt    *time.Time         `bson:"read_at,omitempty" json:"read_at,omitempty"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Preferences are the kinds of notifications a user turned off, the other kinds notify.
+type Preferences struct {
+	UserID   primitive.ObjectID `bson:"_id" json:"-"`
+	Disabled []Kind             `bson:"disabled" json:"-"`
+}
+
+// Enabled reports whether the user is notified of kind.
+func (p *Preferences) Enabled(kind Kind) bool {
+	for _, disabled := range p.Disabled {
+		if disabled == kind {
+			return false
+		}
+	}
+	return true
+}
+
+// Settings returns whether each kind notifies.
+func (p *Preferences) Settings() map[Kind]bool {
+	settings := map[Kind]bool{}
+	for _, kind := range Kinds {
+		settings[kind] = p.Enabled(kind)
+	}
+	return settings
+}
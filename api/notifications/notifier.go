@@ -0,0 +1,71 @@
+package notifications
+
+import (
+	"context"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/pkg/events"
+	"memo/pkg/logger"
+)
+
+// NotificationCreated is the event sent to a user with each new notification.
+const NotificationCreated = "notification.created"
+
+// Notifier puts notices in the inbox of users, the subsystems notify through it.
+type Notifier interface {
+	Notify(notice Notice, ctx context.Context)
+}
+
+// Inbox stores the notices the users want and streams them as events. The user of the request
+// is the actor, users aren't notified of what they do themselves.
+type Inbox struct {
+	logger logger.Logger
+	repo   NotificationRepository
+	hub    *events.Hub
+}
+
+func NewInbox(logger logger.Logger, repo NotificationRepository, hub *events.Hub) *Inbox {
+	return &Inbox{logger, repo, hub}
+}
+
+func (i *Inbox) Notify(notice Notice, ctx context.Context) {
+	actor, _ := ctx.Value("user").(string)
+	if notice.UserID == actor {
+		return
+	}
+
+	userId, err := primitive.ObjectIDFromHex(notice.UserID)
+	if err != nil {
+		return
+	}
+
+	preferences, err := i.repo.Preferences(notice.UserID, ctx)
+	if err != nil {
+		i.logger.For(ctx).Error("notification issue", "error", err)
+		return
+	}
+
+	if !preferences.Enabled(notice.Kind) {
+		return
+	}
+
+	notification := &Notification{
+		UserID:    userId,
+		Kind:      notice.Kind,
+		NoteID:    notice.NoteID,
+		ActorID:   actor,
+		Data:      notice.Data,
+		CreatedAt: time.Now(),
+	}
+
+	if err := i.repo.Insert(notification, ctx); err != nil {
+		i.logger.For(ctx).Error("notification issue", "error", err)
+		return
+	}
+
+	if err := i.hub.Publish(NotificationCreated, []string{notice.UserID}, notification, ctx); err != nil {
+		i.logger.For(ctx).Error("notification issue", "error", err)
+	}
+}
@@ -0,0 +1,190 @@
+package notifications
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ListFilter selects the notifications of a user, newest first.
+type ListFilter struct {
+	UnreadOnly bool
+	// Before pages through the inbox, only the notifications older than this one are listed.
+	Before primitive.ObjectID
+	Limit  int64
+}
+
+type NotificationRepository interface {
+	Insert(notification *Notification, ctx context.Context) error
+	List(userId string, filter ListFilter, ctx context.Context) ([]*Notification, error)
+	Unread(userId string, ctx context.Context) (int64, error)
+	MarkRead(id, userId string, ctx context.Context) error
+	// MarkAllRead marks every notification of the user as read and returns how many were unread.
+	MarkAllRead(userId string, ctx context.Context) (int64, error)
+	Delete(id, userId string, ctx context.Context) error
+	Preferences(userId string, ctx context.Context) (*Preferences, error)
+	SavePreferences(preferences *Preferences, ctx context.Context) error
+}
+
+type notificationRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) NotificationRepository {
+	return &notificationRepository{client}
+}
+
+func (r *notificationRepository) Insert(notification *Notification, ctx context.Context) error {
+	result, err := r.client.Collection("notifications").InsertOne(ctx, notification)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		notification.ID = id
+	}
+
+	return nil
+}
+
+func (r *notificationRepository) List(userId string, filter ListFilter, ctx context.Context) ([]*Notification, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	query := bson.M{"user_id": oUserId}
+	if filter.UnreadOnly {
+		query["read"] = false
+	}
+	if !filter.Before.IsZero() {
+		query["_id"] = bson.M{"$lt": filter.Before}
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(filter.Limit)
+
+	cursor, err := r.client.Collection("notifications").Find(ctx, query, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	notifications := []*Notification{}
+	if err = cursor.All(ctx, &notifications); err != nil {
+		return nil, err
+	}
+
+	return notifications, nil
+}
+
+func (r *notificationRepository) Unread(userId string, ctx context.Context) (int64, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	return r.client.Collection("notifications").CountDocuments(ctx, bson.M{"user_id": oUserId, "read": false})
+}
+
+func (r *notificationRepository) MarkRead(id, userId string, ctx context.Context) error {
+	filter, err := owned(id, userId)
+	if err != nil {
+		return err
+	}
+
+	update := bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}}
+
+	result, err := r.client.Collection("notifications").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *notificationRepository) MarkAllRead(userId string, ctx context.Context) (int64, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return 0, err
+	}
+
+	filter := bson.M{"user_id": oUserId, "read": false}
+	update := bson.M{"$set": bson.M{"read": true, "read_at": time.Now()}}
+
+	result, err := r.client.Collection("notifications").UpdateMany(ctx, filter, update)
+	if err != nil {
+		return 0, err
+	}
+
+	return result.ModifiedCount, nil
+}
+
+func (r *notificationRepository) Delete(id, userId string, ctx context.Context) error {
+	filter, err := owned(id, userId)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.client.Collection("notifications").DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+// Preferences returns the preferences of the user, every kind is enabled until they're saved.
+func (r *notificationRepository) Preferences(userId string, ctx context.Context) (*Preferences, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	preferences := &Preferences{UserID: oUserId, Disabled: []Kind{}}
+
+	err = r.client.Collection("notification_preferences").FindOne(ctx, bson.M{"_id": oUserId}).Decode(preferences)
+	if err != nil && err != mongo.ErrNoDocuments {
+		return nil, err
+	}
+
+	return preferences, nil
+}
+
+func (r *notificationRepository) SavePreferences(preferences *Preferences, ctx context.Context) error {
+	_, err := r.client.Collection("notification_preferences").ReplaceOne(
+		ctx,
+		bson.M{"_id": preferences.UserID},
+		preferences,
+		options.Replace().SetUpsert(true),
+	)
+	return err
+}
+
+// owned is the filter of a notification of the user.
+func owned(id, userId string) (bson.M, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"_id": oId, "user_id": oUserId}, nil
+}
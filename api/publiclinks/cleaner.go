@@ -0,0 +1,24 @@
+package publiclinks
+
+import (
+	"context"
+
+	"memo/api/notes/models"
+)
+
+// Cleaner revokes the links of deleted notes, it's registered as a notes repository hook.
+type Cleaner struct {
+	repo LinkRepository
+}
+
+func NewCleaner(repo LinkRepository) *Cleaner {
+	return &Cleaner{repo}
+}
+
+func (c *Cleaner) NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error {
+	return nil
+}
+
+func (c *Cleaner) NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error {
+	return c.repo.DeleteByNote(note.ID, ctx)
+}
@@ -0,0 +1,287 @@
+package publiclinks
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/security"
+	"memo/pkg/validation"
+)
+
+const (
+	minPasswordLength = 8
+	// bcrypt doesn't hash longer passwords.
+	maxPasswordLength = 72
+)
+
+// HandleCreate creates a public link of a note, only its owner can publish it. The token is
+// only returned here, with the url of the link.
+func HandleCreate(logger logger.Logger, notes repository.NotesRepository, repo LinkRepository, config Config) http.HandlerFunc {
+	type linkRequest struct {
+		// ExpiresAt is a RFC 3339 time, the link never expires without it.
+		ExpiresAt string `json:"expires_at"`
+		Password  string `json:"password"`
+	}
+
+	type createdLink struct {
+		*Link
+		Token string `json:"token"`
+		URL   string `json:"url"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*linkRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		note, ok := ownedNote(w, r, notes, userId)
+		if !ok {
+			return
+		}
+
+		link := &Link{
+			NoteID:    note.ID,
+			UserID:    note.UserId,
+			CreatedAt: time.Now(),
+		}
+
+		problems = map[string]string{}
+		if data.ExpiresAt != "" {
+			expiresAt, err := time.Parse(time.RFC3339, data.ExpiresAt)
+			if err != nil || !expiresAt.After(time.Now()) {
+				problems["expires_at"] = "must be a future RFC 3339 time"
+			}
+			link.ExpiresAt = &expiresAt
+		}
+
+		if data.Password != "" && (len(data.Password) < minPasswordLength || len(data.Password) > maxPasswordLength) {
+			problems["password"] = "length must be between 8 and 72"
+		}
+
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		if data.Password != "" {
+			hash, err := security.HashPassword(data.Password)
+			if err != nil {
+				logger.For(r.Context()).Error("public link issue", "error", err)
+				response.RespondErr(w, response.InternalServerError())
+				return
+			}
+			link.PasswordHash, link.Protected = hash, true
+		}
+
+		token, err := security.GenerateSecureToken()
+		if err != nil {
+			logger.For(r.Context()).Error("public link issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+		link.TokenHash = token.Token
+
+		if err := repo.Insert(link, r.Context()); err != nil {
+			logger.For(r.Context()).Error("public link issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, createdLink{
+			Link:  link,
+			Token: token.Plain,
+			URL:   config.BaseURL + "/s/" + token.Plain,
+		}, http.StatusCreated)
+	})
+}
+
+// HandleList lists the public links of a note, for its owner.
+func HandleList(logger logger.Logger, notes repository.NotesRepository, repo LinkRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := ownedNote(w, r, notes, userId)
+		if !ok {
+			return
+		}
+
+		links, err := repo.ListByNote(note.ID, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("public link issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, links, http.StatusOK)
+	})
+}
+
+// HandleRevoke deletes a public link of a note, its url stops working.
+func HandleRevoke(logger logger.Logger, notes repository.NotesRepository, repo LinkRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := ownedNote(w, r, notes, userId)
+		if !ok {
+			return
+		}
+
+		link, err := repo.Get(r.PathValue("linkId"), r.Context())
+		if err != nil || link.NoteID != note.ID {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if err := repo.Delete(link.ID, r.Context()); err != nil {
+			logger.For(r.Context()).Error("public link issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleView shows the note of a public link to anyone, without authentication. It answers
+// with json when asked by ?format=json or the Accept header, with an html page otherwise.
+// The password of a protected link is sent in the X-Link-Password header, or posted by the
+// form of the page.
+func HandleView(logger logger.Logger, notes repository.NotesRepository, types *models.Registry, repo LinkRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// the token is in the url, it's not sent to the sites linked by the note.
+		w.Header().Set("Referrer-Policy", "no-referrer")
+		w.Header().Set("Cache-Control", "no-store")
+		w.Header().Set("X-Robots-Tag", "noindex")
+
+		asJSON := wantsJSON(r)
+
+		link, err := repo.GetByToken(security.HashToken(r.PathValue("token")), r.Context())
+		if err != nil {
+			fail(w, asJSON, "This link doesn't exist or was revoked", http.StatusNotFound)
+			return
+		}
+
+		if link.Expired() {
+			fail(w, asJSON, "This link has expired", http.StatusGone)
+			return
+		}
+
+		if link.Protected {
+			password := r.Header.Get("X-Link-Password")
+			if password == "" && r.Method == http.MethodPost {
+				r.Body = http.MaxBytesReader(w, r.Body, 1<<16)
+				password = r.PostFormValue("password")
+			}
+
+			if password == "" {
+				locked(w, asJSON, "This note is protected by a password")
+				return
+			}
+
+			// the link stays locked for a while after too many wrong passwords in a row.
+			if link.Locked() {
+				w.Header().Set("Retry-After", strconv.Itoa(int(time.Until(*link.LockedUntil).Seconds())+1))
+				fail(w, asJSON, "Too many wrong passwords, try again later", http.StatusTooManyRequests)
+				return
+			}
+
+			if security.CompareHashToPassword(link.PasswordHash, password) != nil {
+				if err := repo.CountFailure(link.ID, r.Context()); err != nil {
+					logger.For(r.Context()).Error("public link issue", "error", err)
+				}
+				locked(w, asJSON, "Wrong password")
+				return
+			}
+
+			if link.FailedAttempts > 0 {
+				if err := repo.ResetFailures(link.ID, r.Context()); err != nil {
+					logger.For(r.Context()).Error("public link issue", "error", err)
+				}
+			}
+		}
+
+		note, err := notes.GetById(link.NoteID.Hex(), r.Context())
+		if err != nil {
+			fail(w, asJSON, "This link doesn't exist or was revoked", http.StatusNotFound)
+			return
+		}
+
+		view := &View{
+			Title:     note.Title,
+			Type:      note.Type,
+			Tags:      note.Tags,
+			CreatedAt: note.CreatedAt,
+			UpdatedAt: note.UpdatedAt,
+			Data:      note.Data,
+		}
+
+		if t, ok := types.Get(note.Type); ok {
+			if renderer, ok := t.(models.Renderer); ok {
+				if view.Rendered, err = renderer.Render(note.Data); err != nil {
+					logger.For(r.Context()).Error("render issue", "error", err)
+					fail(w, asJSON, "Internal Server Error", http.StatusInternalServerError)
+					return
+				}
+			}
+		}
+
+		if err := repo.CountView(link.ID, r.Context()); err != nil {
+			logger.For(r.Context()).Error("public link issue", "error", err)
+		}
+
+		if asJSON {
+			response.Respond(w, view, http.StatusOK)
+			return
+		}
+
+		renderPage(w, page{View: view}, http.StatusOK)
+	})
+}
+
+func wantsJSON(r *http.Request) bool {
+	return r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json")
+}
+
+func fail(w http.ResponseWriter, asJSON bool, msg string, status int) {
+	if asJSON {
+		response.ErrMessage(w, msg, status)
+		return
+	}
+
+	renderPage(w, page{Message: msg}, status)
+}
+
+// locked asks for the password of the link, the page shows a form to send it.
+func locked(w http.ResponseWriter, asJSON bool, msg string) {
+	if asJSON {
+		response.ErrMessage(w, msg, http.StatusUnauthorized)
+		return
+	}
+
+	renderPage(w, page{Message: msg, Locked: true}, http.StatusUnauthorized)
+}
+
+func ownedNote(w http.ResponseWriter, r *http.Request, notes repository.NotesRepository, userId string) (*models.EmbeddedNote, bool) {
+	note, err := notes.GetById(r.PathValue("id"), r.Context())
+	if err != nil {
+		response.RespondErr(w, response.NotFound())
+		return nil, false
+	}
+
+	if !note.OwnedBy(userId) {
+		response.ErrMessage(w, "Only the owner can publish this note", http.StatusForbidden)
+		return nil, false
+	}
+
+	return note, true
+}
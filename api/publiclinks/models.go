@@ -0,0 +1,63 @@
+package publiclinks
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Link opens a read-only view of a note to anyone knowing its token, without an account.
+type Link struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	NoteID primitive.ObjectID `bson:"note_id" json:"note_id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"user_id"`
+	// TokenHash is the sha256 of the token, the token itself is only shown when the link is created.
+	TokenHash    string `bson:"token_hash" json:"-"`
+	PasswordHash string `bson:"password_hash,omitempty" json:"-"`
+	// Protected is set when the link needs a password.
+	Protected    bool       `bson:"protected" json:"protected"`
+	ExpiresAt    *time.Time `bson:"expires_at,omitempty" json:"expires_at,omitempty"`
+	Views        int64      `bson:"views" json:"views"`
+	LastViewedAt *time.Time `bson:"last_viewed_at,omitempty" json:"last_viewed_at,omitempty"`
+	CreatedAt    time.Time  `bson:"created_at" json:"created_at"`
+	// FailedAttempts counts the wrong passwords in a row, the link is locked until LockedUntil
+	// once they reach MaxFailedAttempts.
+	FailedAttempts int        `bson:"failed_attempts" json:"-"`
+	LockedUntil    *time.Time `bson:"locked_until,omitempty" json:"-"`
+}
+
+const (
+	MaxFailedAttempts = 5
+	LockDuration      = 15 * time.Minute
+)
+
+func (l *Link) Expired() bool {
+	return l.ExpiresAt != nil && !l.ExpiresAt.After(time.Now())
+}
+
+func (l *Link) Locked() bool {
+	return l.LockedUntil != nil && l.LockedUntil.After(time.Now())
+}
+
+// View is the read-only note shown by a link, without its owner, shares or notebook.
+type View struct {
+	Title     string    `json:"title"`
+	Type      string    `json:"type"`
+	Tags      []string  `json:"tags"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+	Data      any       `json:"data,omitempty"`
+	// Rendered is the sanitised html of the note types that can be rendered.
+	Rendered any `json:"rendered,omitempty"`
+}
+
+type Config struct {
+	// BaseURL prefixes the urls of the links, e.g. https://memo.example.com.
+	BaseURL string
+}
+
+// LoadConfig reads PUBLIC_URL.
+func LoadConfig(getEnv func(string) string) Config {
+	return Config{BaseURL: strings.TrimSuffix(getEnv("PUBLIC_URL"), "/")}
+}
@@ -0,0 +1,93 @@
+package publiclinks
+
+import (
+	"html/template"
+	"net/http"
+
+	"memo/api/notes/models"
+	"memo/pkg/markdown"
+)
+
+// page is the html shown by a public link: the note, or a message and the password form.
+type page struct {
+	View    *View
+	Message string
+	Locked  bool
+}
+
+// HTML returns the rendered note, the markdown renderer already sanitised it.
+func (p page) HTML() template.HTML {
+	if doc, ok := p.View.Rendered.(*markdown.Document); ok {
+		return template.HTML(doc.HTML)
+	}
+	return ""
+}
+
+func (p page) Tasks() []models.Task {
+	if todo, ok := p.View.Data.(*models.TodoNoteData); ok {
+		return todo.Tasks
+	}
+	return nil
+}
+
+func (p page) Movie() *models.MovieNoteData {
+	movie, _ := p.View.Data.(*models.MovieNoteData)
+	return movie
+}
+
+func (p page) Bookmark() *models.LinkNoteData {
+	link, _ := p.View.Data.(*models.LinkNoteData)
+	return link
+}
+
+var pageTemplate = template.Must(template.New("page").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex">
+<title>{{if .View}}{{.View.Title}}{{else}}memo{{end}}</title>
+<style>
+body { font-family: system-ui, sans-serif; max-width: 42rem; margin: 2rem auto; padding: 0 1rem; line-height: 1.6; color: #222; }
+.meta, .tags { color: #777; font-size: .9rem; }
+ul.tasks { list-style: none; padding: 0; }
+.done { text-decoration: line-through; color: #777; }
+img { max-width: 100%; }
+pre { overflow-x: auto; background: #f5f5f5; padding: .5rem; }
+</style>
+</head>
+<body>
+{{if .View}}
+<h1>{{.View.Title}}</h1>
+<p class="meta">Updated {{.View.UpdatedAt.Format "January 2, 2006"}}</p>
+{{with .View.Tags}}<p class="tags">{{range .}}#{{.}} {{end}}</p>{{end}}
+{{if .HTML}}{{.HTML}}{{end}}
+{{with .Tasks}}<ul class="tasks">{{range .}}
+<li{{if .IsCompleted}} class="done"{{end}}>{{if .IsCompleted}}&#9745;{{else}}&#9744;{{end}} {{.Content}}</li>{{end}}
+</ul>{{end}}
+{{with .Movie}}<dl>
+{{if .Year}}<dt>Year</dt><dd>{{.Year}}</dd>{{end}}
+{{if .Director}}<dt>Director</dt><dd>{{.Director}}</dd>{{end}}
+{{with .Genres}}<dt>Genres</dt><dd>{{range $i, $g := .}}{{if $i}}, {{end}}{{$g}}{{end}}</dd>{{end}}
+{{if .Runtime}}<dt>Runtime</dt><dd>{{.Runtime}} min</dd>{{end}}
+<dt>Watched</dt><dd>{{if .Watched}}yes{{else}}no{{end}}</dd>
+</dl>{{end}}
+{{with .Bookmark}}<p><a href="{{.URL}}" rel="nofollow noopener">{{if .Title}}{{.Title}}{{else}}{{.URL}}{{end}}</a></p>
+{{with .Description}}<p>{{.}}</p>{{end}}{{end}}
+{{else}}
+<p>{{.Message}}</p>
+{{if .Locked}}<form method="post">
+<input type="password" name="password" placeholder="Password" autofocus required>
+<button type="submit">Open</button>
+</form>{{end}}
+{{end}}
+</body>
+</html>
+`))
+
+func renderPage(w http.ResponseWriter, p page, status int) {
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; img-src https: data:")
+	w.WriteHeader(status)
+	pageTemplate.Execute(w, p)
+}
@@ -0,0 +1,142 @@
+package publiclinks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type LinkRepository interface {
+	Insert(link *Link, ctx context.Context) error
+	Get(id string, ctx context.Context) (*Link, error)
+	// GetByToken returns the link with the given token hash.
+	GetByToken(tokenHash string, ctx context.Context) (*Link, error)
+	ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Link, error)
+	Delete(id primitive.ObjectID, ctx context.Context) error
+	DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error
+	// CountView increments the views of the link.
+	CountView(id primitive.ObjectID, ctx context.Context) error
+	// CountFailure counts a wrong password, the link is locked for LockDuration after
+	// MaxFailedAttempts in a row.
+	CountFailure(id primitive.ObjectID, ctx context.Context) error
+	ResetFailures(id primitive.ObjectID, ctx context.Context) error
+}
+
+type linkRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) LinkRepository {
+	return &linkRepository{client}
+}
+
+func (r *linkRepository) Insert(link *Link, ctx context.Context) error {
+	result, err := r.client.Collection("public_links").InsertOne(ctx, link)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		link.ID = id
+	}
+
+	return nil
+}
+
+func (r *linkRepository) Get(id string, ctx context.Context) (*Link, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.findOne(bson.M{"_id": oId}, ctx)
+}
+
+func (r *linkRepository) GetByToken(tokenHash string, ctx context.Context) (*Link, error) {
+	return r.findOne(bson.M{"token_hash": tokenHash}, ctx)
+}
+
+func (r *linkRepository) findOne(filter bson.M, ctx context.Context) (*Link, error) {
+	var link *Link
+	if err := r.client.Collection("public_links").FindOne(ctx, filter).Decode(&link); err != nil {
+		return nil, err
+	}
+
+	return link, nil
+}
+
+func (r *linkRepository) ListByNote(noteId primitive.ObjectID, ctx context.Context) ([]*Link, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.client.Collection("public_links").Find(ctx, bson.M{"note_id": noteId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	links := []*Link{}
+	if err = cursor.All(ctx, &links); err != nil {
+		return nil, err
+	}
+
+	return links, nil
+}
+
+func (r *linkRepository) Delete(id primitive.ObjectID, ctx context.Context) error {
+	result, err := r.client.Collection("public_links").DeleteOne(ctx, bson.M{"_id": id})
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *linkRepository) DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error {
+	_, err := r.client.Collection("public_links").DeleteMany(ctx, bson.M{"note_id": noteId})
+	return err
+}
+
+func (r *linkRepository) CountView(id primitive.ObjectID, ctx context.Context) error {
+	update := bson.M{
+		"$inc": bson.M{"views": 1},
+		"$set": bson.M{"last_viewed_at": time.Now()},
+	}
+
+	_, err := r.client.Collection("public_links").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *linkRepository) CountFailure(id primitive.ObjectID, ctx context.Context) error {
+	// a pipeline, so concurrent attempts can't go past the limit without locking the link.
+	locking := bson.M{"$gte": bson.A{"$failed_attempts", MaxFailedAttempts}}
+	update := bson.A{
+		bson.M{"$set": bson.M{"failed_attempts": bson.M{"$add": bson.A{bson.M{"$ifNull": bson.A{"$failed_attempts", 0}}, 1}}}},
+		bson.M{"$set": bson.M{
+			"locked_until":    bson.M{"$cond": bson.A{locking, time.Now().Add(LockDuration), "$locked_until"}},
+			"failed_attempts": bson.M{"$cond": bson.A{locking, 0, "$failed_attempts"}},
+		}},
+	}
+
+	_, err := r.client.Collection("public_links").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+func (r *linkRepository) ResetFailures(id primitive.ObjectID, ctx context.Context) error {
+	update := bson.M{
+		"$set":   bson.M{"failed_attempts": 0},
+		"$unset": bson.M{"locked_until": ""},
+	}
+
+	_, err := r.client.Collection("public_links").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
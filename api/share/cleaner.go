@@ -0,0 +1,24 @@
+package share
+
+import (
+	"context"
+
+	"memo/api/notes/models"
+)
+
+// Cleaner deletes the invitations of deleted notes, it's registered as a notes repository hook.
+type Cleaner struct {
+	invitations InvitationRepository
+}
+
+func NewCleaner(invitations InvitationRepository) *Cleaner {
+	return &Cleaner{invitations}
+}
+
+func (c *Cleaner) NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error {
+	return nil
+}
+
+func (c *Cleaner) NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error {
+	return c.invitations.DeleteByNote(note.ID, ctx)
+}
@@ -1,8 +1,14 @@
 package share
 
 import (
+	"context"
 	"net/http"
 
+	"memo/api/audit"
+	"memo/api/authz"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/api/notifications"
 	"memo/pkg/logger"
 	"memo/pkg/response"
 	"memo/pkg/validation"
@@ -24,7 +30,15 @@ func HandleGetShared(logger logger.Logger, repo ShareRepository) http.HandlerFun
 	})
 }
 
-func HandleShareNote(logger logger.Logger, repo ShareRepository) http.HandlerFunc {
+// ShareEvents is told when a note is shared, or when a user loses access to it.
+type ShareEvents interface {
+	NoteShared(noteId, userId string, permission models.Permission, ctx context.Context)
+	NoteUnshared(noteId, userId string, ctx context.Context)
+}
+
+// HandleShareNote shares a note with a user id right away. The owner shares it with any
+// permission, the collaborators who manage it with the lower ones.
+func HandleShareNote(logger logger.Logger, notes repository.NotesRepository, sharer *Sharer) http.HandlerFunc {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		currentUserId := r.Context().Value("user").(string)
 
@@ -34,6 +48,16 @@ func HandleShareNote(logger logger.Logger, repo ShareRepository) http.HandlerFun
 			return
 		}
 
+		note, err := notes.GetById(data.NoteID, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if !canGrant(w, note, currentUserId, data.Permission) {
+			return
+		}
+
 		if currentUserId == data.UserID {
 			response.RespondErr(w, response.ErrorResponse{
 				Status:  http.StatusBadGateway,
@@ -42,7 +66,7 @@ func HandleShareNote(logger logger.Logger, repo ShareRepository) http.HandlerFun
 			return
 		}
 
-		if err := repo.ShareNote(data, r.Context()); err != nil {
+		if err := sharer.Share(note, data.UserID, data.Permission, r.Context()); err != nil {
 			response.RespondErr(w, response.ErrorResponse{
 				Status:  http.StatusBadGateway,
 				Message: err.Error(),
@@ -53,3 +77,190 @@ func HandleShareNote(logger logger.Logger, repo ShareRepository) http.HandlerFun
 		response.RespondSuccess(w)
 	})
 }
+
+// HandleCollaborators lists the users a note is shared with and their permission.
+func HandleCollaborators(logger logger.Logger, repo ShareRepository, notes repository.NotesRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.View)
+		if !ok {
+			return
+		}
+
+		shared, err := repo.Collaborators(note.ID.Hex(), r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("collaborators issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, shared.SharedWith, http.StatusOK)
+	})
+}
+
+// HandleChangePermission changes the permission of a collaborator. The owner changes anyone's,
+// the collaborators who manage the note change the ones of the collaborators below them.
+func HandleChangePermission(logger logger.Logger, repo ShareRepository, notes repository.NotesRepository, events ShareEvents, notifier notifications.Notifier, recorder audit.Recorder) http.HandlerFunc {
+	type permissionRequest struct {
+		Permission models.Permission `json:"permission" validate:"required|in:read,comment,write,manage"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*permissionRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Share)
+		if !ok {
+			return
+		}
+
+		collaborator := r.PathValue("userId")
+		if !authz.CanManage(note, userId, collaborator) {
+			response.ErrMessage(w, "You can't change the permission of this collaborator", http.StatusForbidden)
+			return
+		}
+
+		if !canGrant(w, note, userId, data.Permission) {
+			return
+		}
+
+		if err := repo.SetPermission(note.ID.Hex(), collaborator, data.Permission, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		events.NoteShared(note.ID.Hex(), collaborator, data.Permission, r.Context())
+		notifyShared(notifier, note, collaborator, data.Permission, r.Context())
+		record(recorder, audit.NotePermissionChanged, note.ID.Hex(), collaborator, data.Permission, r.Context())
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleRevoke removes a collaborator from a note. The owner can remove anyone, the collaborators
+// who manage the note remove the ones below them, and everyone can remove themselves to leave the note.
+func HandleRevoke(logger logger.Logger, repo ShareRepository, notes repository.NotesRepository, events ShareEvents, recorder audit.Recorder) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+		collaborator := r.PathValue("userId")
+
+		note, err := notes.GetById(r.PathValue("id"), r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if !authz.CanRevoke(note, userId, collaborator) {
+			response.ErrMessage(w, "You can't remove this collaborator", http.StatusForbidden)
+			return
+		}
+
+		if err := repo.Revoke(note.ID.Hex(), collaborator, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		events.NoteUnshared(note.ID.Hex(), collaborator, r.Context())
+		record(recorder, audit.NoteUnshared, note.ID.Hex(), collaborator, "", r.Context())
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleTransfer gives a note to another user who can already read it, only the owner can
+// transfer it. The previous owner keeps managing the note.
+func HandleTransfer(logger logger.Logger, repo ShareRepository, notes repository.NotesRepository, events ShareEvents, notifier notifications.Notifier, recorder audit.Recorder) http.HandlerFunc {
+	type transferRequest struct {
+		UserID string `json:"user_id" validate:"required"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*transferRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Transfer)
+		if !ok {
+			return
+		}
+
+		if data.UserID == userId {
+			response.ErrMessage(w, "You already own this note", http.StatusBadRequest)
+			return
+		}
+
+		if !authz.Can(note, data.UserID, authz.View) {
+			response.ErrMessage(w, "The note can only be transferred to a user who can read it", http.StatusBadRequest)
+			return
+		}
+
+		if err := repo.Transfer(note.ID.Hex(), userId, data.UserID, r.Context()); err != nil {
+			// the note was transferred or deleted meanwhile.
+			logger.For(r.Context()).Error("transfer issue", "error", err)
+			response.ErrMessage(w, "The note can't be transferred", http.StatusConflict)
+			return
+		}
+
+		events.NoteShared(note.ID.Hex(), userId, models.PermissionManage, r.Context())
+		notifier.Notify(notifications.Notice{
+			UserID: data.UserID,
+			Kind:   notifications.KindTransferred,
+			NoteID: note.ID.Hex(),
+			Data:   map[string]string{"title": note.Title},
+		}, r.Context())
+		record(recorder, audit.NoteTransferred, note.ID.Hex(), data.UserID, "", r.Context())
+
+		response.RespondSuccess(w)
+	})
+}
+
+// notifyShared tells the user the note was shared with them with the permission.
+func notifyShared(notifier notifications.Notifier, note *models.EmbeddedNote, userId string, permission models.Permission, ctx context.Context) {
+	notifier.Notify(notifications.Notice{
+		UserID: userId,
+		Kind:   notifications.KindShared,
+		NoteID: note.ID.Hex(),
+		Data:   map[string]string{"title": note.Title, "permission": string(permission)},
+	}, ctx)
+}
+
+// record adds a change of the access of the user to the note to the audit log.
+func record(recorder audit.Recorder, action audit.Action, noteId, userId string, permission models.Permission, ctx context.Context) {
+	details := map[string]string{"user_id": userId}
+	if permission != "" {
+		details["permission"] = string(permission)
+	}
+
+	recorder.Record(audit.Entry{
+		Action:     action,
+		Users:      []string{userId},
+		TargetType: "note",
+		TargetID:   noteId,
+		Details:    details,
+	}, ctx)
+}
+
+// canGrant answers the request when the user can't share the note with the permission.
+func canGrant(w http.ResponseWriter, note *models.EmbeddedNote, userId string, permission models.Permission) bool {
+	if !authz.Can(note, userId, authz.Share) {
+		response.ErrMessage(w, authz.Message(authz.Share), http.StatusForbidden)
+		return false
+	}
+
+	if !authz.CanGrant(note, userId, permission) {
+		response.ErrMessage(w, "You can't share this note with the "+string(permission)+" permission", http.StatusForbidden)
+		return false
+	}
+
+	return true
+}
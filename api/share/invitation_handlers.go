@@ -0,0 +1,275 @@
+package share
+
+import (
+	"net/http"
+	"strings"
+	"time"
+
+	"memo/api/audit"
+	"memo/api/auth"
+	"memo/api/authz"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/api/notifications"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/security"
+	"memo/pkg/validation"
+)
+
+// HandleInvite invites an email address to a note, for the users who can share it with the
+// permission. The invitation is pending until the invited user accepts or declines it, the
+// token in the response is passed on to them to accept it.
+func HandleInvite(logger logger.Logger, notes repository.NotesRepository, users auth.AuthStore, invitations InvitationRepository, notifier notifications.Notifier, recorder audit.Recorder) http.HandlerFunc {
+	type inviteRequest struct {
+		Email      string            `json:"email" validate:"required|email"`
+		Permission models.Permission `json:"permission" validate:"required|in:read,comment,write,manage"`
+	}
+
+	type inviteResponse struct {
+		*Invitation
+		Token string `json:"token"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*inviteRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Share)
+		if !ok {
+			return
+		}
+
+		if !canGrant(w, note, userId, data.Permission) {
+			return
+		}
+
+		email := strings.ToLower(strings.TrimSpace(data.Email))
+
+		inviter, err := users.GetUserById(userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.Unauthorized())
+			return
+		}
+
+		if strings.ToLower(inviter.Email) == email {
+			response.ErrMessage(w, "Can't share the note with yourself.", http.StatusBadRequest)
+			return
+		}
+
+		invited, err := users.GetUserByEmail(email, r.Context())
+		registered := err == nil
+		if registered && authz.Can(note, invited.ID.Hex(), authz.View) {
+			response.ErrMessage(w, "User already has access to this note", http.StatusConflict)
+			return
+		}
+
+		token, err := security.GenerateSecureToken()
+		if err != nil {
+			logger.For(r.Context()).Error("invitation issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		invitation, err := invitations.Invite(Invitation{
+			NoteID:     note.ID,
+			NoteTitle:  note.Title,
+			InvitedBy:  inviter.ID,
+			Email:      email,
+			Permission: data.Permission,
+			TokenHash:  token.Token,
+		}, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("invitation issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		entry := audit.Entry{
+			Action:     audit.NoteInvited,
+			TargetType: "note",
+			TargetID:   note.ID.Hex(),
+			Details:    map[string]string{"email": email, "permission": string(data.Permission)},
+		}
+		if registered {
+			entry.Users = []string{invited.ID.Hex()}
+		}
+		recorder.Record(entry, r.Context())
+
+		// the invitation is also in the inbox of a registered user.
+		if registered {
+			notifier.Notify(notifications.Notice{
+				UserID: invited.ID.Hex(),
+				Kind:   notifications.KindInvited,
+				NoteID: note.ID.Hex(),
+				Data: map[string]string{
+					"title":         note.Title,
+					"invitation_id": invitation.ID.Hex(),
+					"permission":    string(invitation.Permission),
+				},
+			}, r.Context())
+		}
+
+		response.Respond(w, inviteResponse{invitation, token.Plain}, http.StatusCreated)
+	})
+}
+
+// HandleNoteInvitations lists the pending invitations of a note, for the users who can share it.
+func HandleNoteInvitations(logger logger.Logger, notes repository.NotesRepository, invitations InvitationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Share)
+		if !ok {
+			return
+		}
+
+		list, err := invitations.ForNote(note.ID.Hex(), r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("invitation issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, list, http.StatusOK)
+	})
+}
+
+// HandleCancelInvitation deletes an invitation of the note that wasn't answered yet.
+func HandleCancelInvitation(logger logger.Logger, notes repository.NotesRepository, invitations InvitationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		note, ok := authz.Authorize(w, r, notes, userId, authz.Share)
+		if !ok {
+			return
+		}
+
+		invitation, err := invitations.Get(r.PathValue("invitationId"), r.Context())
+		if err != nil || invitation.NoteID != note.ID || invitation.Status != InvitationPending {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if err := invitations.Delete(invitation.ID.Hex(), r.Context()); err != nil {
+			logger.For(r.Context()).Error("invitation issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleMyInvitations lists the pending invitations sent to the email of the user.
+func HandleMyInvitations(logger logger.Logger, users auth.AuthStore, invitations InvitationRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		user, err := users.GetUserById(userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.Unauthorized())
+			return
+		}
+
+		list, err := invitations.ForEmail(strings.ToLower(user.Email), r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("invitation issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, list, http.StatusOK)
+	})
+}
+
+// HandleRespondInvitation accepts or declines an invitation sent to the email of the user.
+// Accepting it takes the token of the invitation, and shares the note with them if the inviter
+// can still grant the permission.
+func HandleRespondInvitation(logger logger.Logger, notes repository.NotesRepository, users auth.AuthStore, invitations InvitationRepository, sharer *Sharer, accept bool) http.HandlerFunc {
+	type acceptRequest struct {
+		Token string `json:"token" validate:"required"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		user, err := users.GetUserById(userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.Unauthorized())
+			return
+		}
+
+		invitation, err := invitations.Get(r.PathValue("id"), r.Context())
+		if err != nil || invitation.Email != strings.ToLower(user.Email) {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if invitation.Status != InvitationPending {
+			response.ErrMessage(w, "The invitation was already answered", http.StatusConflict)
+			return
+		}
+
+		if !accept {
+			if err := invitations.Respond(invitation.ID.Hex(), InvitationDeclined, r.Context()); err != nil {
+				response.ErrMessage(w, err.Error(), http.StatusConflict)
+				return
+			}
+
+			response.RespondSuccess(w)
+			return
+		}
+
+		data, problems := validation.DecodeValid[*acceptRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		// the email of the account isn't verified, the token proves the invitation reached its owner.
+		if !security.HashEquals(invitation.TokenHash, data.Token) {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if invitation.Expired() {
+			response.ErrMessage(w, "The invitation expired", http.StatusGone)
+			return
+		}
+
+		note, err := notes.GetById(invitation.NoteID.Hex(), r.Context())
+		if err != nil {
+			response.ErrMessage(w, "The note can't be shared anymore", http.StatusGone)
+			return
+		}
+
+		// the inviter may have lost the right to share the note since.
+		if !authz.CanGrant(note, invitation.InvitedBy.Hex(), invitation.Permission) {
+			response.ErrMessage(w, "The note can't be shared anymore", http.StatusGone)
+			return
+		}
+
+		if err := invitations.Respond(invitation.ID.Hex(), InvitationAccepted, r.Context()); err != nil {
+			response.ErrMessage(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		if err := sharer.Share(note, userId, invitation.Permission, r.Context()); err != nil {
+			// the note was deleted, or shared with the user meanwhile.
+			logger.For(r.Context()).Error("invitation issue", "error", err)
+			response.ErrMessage(w, "The note can't be shared anymore", http.StatusGone)
+			return
+		}
+
+		now := time.Now()
+		invitation.Status, invitation.RespondedAt = InvitationAccepted, &now
+
+		response.Respond(w, invitation, http.StatusOK)
+	})
+}
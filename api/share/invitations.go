@@ -0,0 +1,175 @@
+package share
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"memo/api/notes/models"
+)
+
+const (
+	InvitationPending  = "pending"
+	InvitationAccepted = "accepted"
+	InvitationDeclined = "declined"
+)
+
+// InvitationTTL is how long an invitation can be accepted.
+const InvitationTTL = 7 * 24 * time.Hour
+
+// Invitation shares a note with an email address once its user accepts it.
+// People without an account see it after registering with that address. Emails aren't
+// verified, so accepting also takes the token the inviter passes on to the invited person.
+type Invitation struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	NoteID    primitive.ObjectID `bson:"note_id" json:"note_id"`
+	NoteTitle string             `bson:"note_title" json:"note_title"`
+	InvitedBy primitive.ObjectID `bson:"invited_by" json:"invited_by"`
+	// Email is stored in lower case.
+	Email      string            `bson:"email" json:"email"`
+	Permission models.Permission `bson:"permission" json:"permission"`
+	Status     string            `bson:"status" json:"status"`
+	// TokenHash is the sha256 of the token, the token itself is only shown to the inviter.
+	TokenHash   string     `bson:"token_hash" json:"-"`
+	CreatedAt   time.Time  `bson:"created_at" json:"created_at"`
+	ExpiresAt   time.Time  `bson:"expires_at" json:"expires_at"`
+	RespondedAt *time.Time `bson:"responded_at,omitempty" json:"responded_at,omitempty"`
+}
+
+type InvitationRepository interface {
+	// Invite creates a pending invitation, or changes the permission, the token and the expiry
+	// of the pending one for the same email.
+	Invite(invitation Invitation, ctx context.Context) (*Invitation, error)
+	Get(id string, ctx context.Context) (*Invitation, error)
+	// ForNote returns the pending invitations of a note that didn't expire.
+	ForNote(noteId string, ctx context.Context) ([]*Invitation, error)
+	// ForEmail returns the pending invitations sent to an email that didn't expire.
+	ForEmail(email string, ctx context.Context) ([]*Invitation, error)
+	// Respond accepts or declines a pending invitation.
+	Respond(id string, status string, ctx context.Context) error
+	Delete(id string, ctx context.Context) error
+	// DeleteByNote deletes the invitations of a note.
+	DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error
+}
+
+type invitationRepo struct {
+	client *mongo.Database
+}
+
+func NewInvitationRepo(client *mongo.Database) InvitationRepository {
+	return &invitationRepo{client}
+}
+
+func (r *invitationRepo) Invite(invitation Invitation, ctx context.Context) (*Invitation, error) {
+	filter := bson.M{"note_id": invitation.NoteID, "email": invitation.Email, "status": InvitationPending}
+	update := bson.M{
+		"$set": bson.M{
+			"permission": invitation.Permission,
+			"invited_by": invitation.InvitedBy,
+			"token_hash": invitation.TokenHash,
+			"expires_at": time.Now().Add(InvitationTTL),
+		},
+		"$setOnInsert": bson.M{
+			"note_title": invitation.NoteTitle,
+			"created_at": time.Now(),
+		},
+	}
+	opts := options.FindOneAndUpdate().SetUpsert(true).SetReturnDocument(options.After)
+
+	var invited *Invitation
+	if err := r.client.Collection("invitations").FindOneAndUpdate(ctx, filter, update, opts).Decode(&invited); err != nil {
+		return nil, err
+	}
+
+	return invited, nil
+}
+
+func (r *invitationRepo) Get(id string, ctx context.Context) (*Invitation, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var invitation *Invitation
+	if err := r.client.Collection("invitations").FindOne(ctx, bson.M{"_id": oId}).Decode(&invitation); err != nil {
+		return nil, err
+	}
+
+	return invitation, nil
+}
+
+func (r *invitationRepo) ForNote(noteId string, ctx context.Context) ([]*Invitation, error) {
+	noteID, err := primitive.ObjectIDFromHex(noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.find(bson.M{"note_id": noteID, "status": InvitationPending, "expires_at": bson.M{"$gt": time.Now()}}, ctx)
+}
+
+func (r *invitationRepo) ForEmail(email string, ctx context.Context) ([]*Invitation, error) {
+	return r.find(bson.M{"email": email, "status": InvitationPending, "expires_at": bson.M{"$gt": time.Now()}}, ctx)
+}
+
+func (r *invitationRepo) find(filter bson.M, ctx context.Context) ([]*Invitation, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}})
+
+	cursor, err := r.client.Collection("invitations").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	invitations := []*Invitation{}
+	if err = cursor.All(ctx, &invitations); err != nil {
+		return nil, err
+	}
+
+	return invitations, nil
+}
+
+func (r *invitationRepo) Respond(id string, status string, ctx context.Context) error {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	filter := bson.M{"_id": oId, "status": InvitationPending}
+	update := bson.M{"$set": bson.M{"status": status, "responded_at": time.Now()}}
+
+	result, err := r.client.Collection("invitations").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("The invitation was already answered")
+	}
+	return nil
+}
+
+func (r *invitationRepo) Delete(id string, ctx context.Context) error {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Collection("invitations").DeleteOne(ctx, bson.M{"_id": oId})
+	return err
+}
+
+func (r *invitationRepo) DeleteByNote(noteId primitive.ObjectID, ctx context.Context) error {
+	_, err := r.client.Collection("invitations").DeleteMany(ctx, bson.M{"note_id": noteId})
+	return err
+}
+
+// Expired tells whether the invitation can't be accepted anymore.
+func (i *Invitation) Expired() bool {
+	return !i.ExpiresAt.After(time.Now())
+}
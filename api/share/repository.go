@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"memo/api/notes/models"
+	"memo/api/notes/repository"
 
 	"go.mongodb.org/mongo-driver/bson"
 	"go.mongodb.org/mongo-driver/bson/primitive"
@@ -13,6 +14,15 @@ import (
 type ShareRepository interface {
 	List(userId string, ctx context.Context) ([]*models.UserNote, error)
 	ShareNote(request *shareRequest, ctx context.Context) error
+	// Share gives userId access to the note.
+	Share(noteId, userId string, permission models.Permission, ctx context.Context) error
+	// Collaborators returns the note with the users it's shared with.
+	Collaborators(noteId string, ctx context.Context) (*models.UserNote, error)
+	SetPermission(noteId, userId string, permission models.Permission, ctx context.Context) error
+	// Revoke removes the access of userId to the note.
+	Revoke(noteId, userId string, ctx context.Context) error
+	// Transfer gives the note owned by from to the user to, from manages it afterwards.
+	Transfer(noteId, from, to string, ctx context.Context) error
 }
 
 type shareRepo struct {
@@ -22,7 +32,7 @@ type shareRepo struct {
 type shareRequest struct {
 	UserID     string            `json:"user_id" validate:"required"`
 	NoteID     string            `json:"note_id" validate:"required"`
-	Permission models.Permission `json:"permission" validate:"required|in:read,write"`
+	Permission models.Permission `json:"permission" validate:"required|in:read,comment,write,manage"`
 }
 
 func NewShareRepo(client *mongo.Database) ShareRepository {
@@ -35,12 +45,34 @@ func (r *shareRepo) List(userId string, ctx context.Context) ([]*models.UserNote
 		return nil, err
 	}
 
+	return r.withUsers(bson.M{
+		"shared_with.user_id": userID,
+		"owner_id":            bson.M{"$ne": userID},
+	}, ctx)
+}
+
+func (r *shareRepo) Collaborators(noteId string, ctx context.Context) (*models.UserNote, error) {
+	noteID, err := primitive.ObjectIDFromHex(noteId)
+	if err != nil {
+		return nil, err
+	}
+
+	notes, err := r.withUsers(bson.M{"_id": noteID}, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(notes) == 0 {
+		return nil, mongo.ErrNoDocuments
+	}
+
+	return notes[0], nil
+}
+
+// withUsers returns the notes matching match, with the users they're shared with.
+func (r *shareRepo) withUsers(match bson.M, ctx context.Context) ([]*models.UserNote, error) {
 	pipeline := mongo.Pipeline{
-		// {{Key: "$match", Value: bson.M{"user_id": userID}}},
-		{{Key: "$match", Value: bson.M{
-			"shared_with.user_id": userID,
-			"owner_id":            bson.M{"$ne": userID},
-		}}},
+		{{Key: "$match", Value: match}},
 		{{Key: "$lookup", Value: bson.M{
 			"from":         "users",
 			"localField":   "shared_with.user_id",
@@ -103,12 +135,16 @@ func (r *shareRepo) List(userId string, ctx context.Context) ([]*models.UserNote
 }
 
 func (r *shareRepo) ShareNote(request *shareRequest, ctx context.Context) error {
-	noteID, err := primitive.ObjectIDFromHex(request.NoteID)
+	return r.Share(request.NoteID, request.UserID, request.Permission, ctx)
+}
+
+func (r *shareRepo) Share(noteId, userId string, permission models.Permission, ctx context.Context) error {
+	noteID, err := primitive.ObjectIDFromHex(noteId)
 	if err != nil {
 		return err
 	}
 
-	userID, err := primitive.ObjectIDFromHex(request.UserID)
+	userID, err := primitive.ObjectIDFromHex(userId)
 	if err != nil {
 		return err
 	}
@@ -127,16 +163,148 @@ func (r *shareRepo) ShareNote(request *shareRequest, ctx context.Context) error
 		}
 	}
 
+	// a new version puts the note in the change feed of the user it's shared with.
+	version, err := repository.NextVersion(r.client, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer repository.Settle(r.client, version, ctx)
+
 	update := bson.M{
 		"$addToSet": bson.M{
 			"shared_with": models.SharedUser{
 				UserID:     userID,
-				Permission: request.Permission,
+				Permission: permission,
 			},
 		},
+		"$set": bson.M{"version": version},
 	}
 
-	_, err = r.client.Collection("notes").UpdateOne(context.Background(), filter, update)
+	_, err = r.client.Collection("notes").UpdateOne(ctx, filter, update)
 
 	return err
 }
+
+func (r *shareRepo) SetPermission(noteId, userId string, permission models.Permission, ctx context.Context) error {
+	noteID, err := primitive.ObjectIDFromHex(noteId)
+	if err != nil {
+		return err
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	version, err := repository.NextVersion(r.client, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer repository.Settle(r.client, version, ctx)
+
+	filter := bson.M{"_id": noteID, "shared_with.user_id": userID}
+	update := bson.M{"$set": bson.M{"shared_with.$.permission": permission, "version": version}}
+
+	result, err := r.client.Collection("notes").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+	return nil
+}
+
+func (r *shareRepo) Revoke(noteId, userId string, ctx context.Context) error {
+	noteID, err := primitive.ObjectIDFromHex(noteId)
+	if err != nil {
+		return err
+	}
+
+	userID, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return err
+	}
+
+	version, err := repository.NextVersion(r.client, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer repository.Settle(r.client, version, ctx)
+
+	filter := bson.M{"_id": noteID, "shared_with.user_id": userID}
+	update := bson.M{
+		"$pull": bson.M{"shared_with": bson.M{"user_id": userID}},
+		"$set":  bson.M{"version": version},
+	}
+
+	result, err := r.client.Collection("notes").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	// offline clients of the user drop the note.
+	return repository.Bury(r.client, noteID, []primitive.ObjectID{userID}, ctx)
+}
+
+func (r *shareRepo) Transfer(noteId, from, to string, ctx context.Context) error {
+	noteID, err := primitive.ObjectIDFromHex(noteId)
+	if err != nil {
+		return err
+	}
+
+	fromID, err := primitive.ObjectIDFromHex(from)
+	if err != nil {
+		return err
+	}
+
+	toID, err := primitive.ObjectIDFromHex(to)
+	if err != nil {
+		return err
+	}
+
+	version, err := repository.NextVersion(r.client, ctx)
+	if err != nil {
+		return err
+	}
+
+	defer repository.Settle(r.client, version, ctx)
+
+	// the new owner leaves the collaborators and the previous one joins them, the notebook was theirs.
+	collaborators := bson.M{"$filter": bson.M{
+		"input": bson.M{"$ifNull": bson.A{"$shared_with", bson.A{}}},
+		"cond":  bson.M{"$ne": bson.A{"$$this.user_id", toID}},
+	}}
+
+	update := bson.A{
+		bson.M{"$set": bson.M{
+			"user_id": toID,
+			"version": version,
+			"shared_with": bson.M{"$concatArrays": bson.A{
+				collaborators,
+				bson.A{bson.M{"user_id": fromID, "permission": models.PermissionManage}},
+			}},
+		}},
+		bson.M{"$unset": "notebook"},
+	}
+
+	filter := bson.M{"_id": noteID, "user_id": fromID}
+
+	result, err := r.client.Collection("notes").UpdateOne(ctx, filter, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+	return nil
+}
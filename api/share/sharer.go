@@ -0,0 +1,41 @@
+package share
+
+import (
+	"context"
+
+	"memo/api/audit"
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/api/notifications"
+)
+
+// Sharer shares notes and tells about it: the share event (streams and webhooks), the notification
+// of the user and the audit log. The single and the bulk shares go through it.
+type Sharer struct {
+	repo     ShareRepository
+	events   ShareEvents
+	notifier notifications.Notifier
+	recorder audit.Recorder
+}
+
+func NewSharer(repo ShareRepository, events ShareEvents, notifier notifications.Notifier, recorder audit.Recorder) *Sharer {
+	return &Sharer{repo, events, notifier, recorder}
+}
+
+// Share gives the user the permission on note, the caller checks it's allowed. The others are
+// told once the write is committed, see repository.AfterCommit.
+func (s *Sharer) Share(note *models.EmbeddedNote, userId string, permission models.Permission, ctx context.Context) error {
+	noteId := note.ID.Hex()
+
+	if err := s.repo.Share(noteId, userId, permission, ctx); err != nil {
+		return err
+	}
+
+	repository.AfterCommit(ctx, func(ctx context.Context) {
+		s.events.NoteShared(noteId, userId, permission, ctx)
+		notifyShared(s.notifier, note, userId, permission, ctx)
+		record(s.recorder, audit.NoteShared, noteId, userId, permission, ctx)
+	})
+
+	return nil
+}
@@ -0,0 +1,145 @@
+package api
+
+import (
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// names containing a content hash, e.g. avatars/3f2a9c0d1e4b5a69-128.png, never change.
+var contentAddressed = regexp.MustCompile(`(^|[/.-])[0-9a-f]{16,}([.-]|$)`)
+
+type FileServerOptions struct {
+	// Precompressed serves the .br or .gz sibling of a file when the client accepts it.
+	Precompressed bool
+}
+
+type fileServer struct {
+	root http.FileSystem
+	opts FileServerOptions
+}
+
+// FileServer serves the files under root with strong ETags, conditional and range requests.
+// Directories and dot files are not served.
+func FileServer(root http.FileSystem, opts FileServerOptions) http.Handler {
+	return &fileServer{root: root, opts: opts}
+}
+
+func (s *fileServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := path.Clean("/" + r.URL.Path)
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	file, info, err := s.open(name)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+
+	defer file.Close()
+
+	header := w.Header()
+	if contentAddressed.MatchString(path.Base(name)) {
+		header.Set("Cache-Control", "public, max-age=31536000, immutable")
+	} else {
+		header.Set("Cache-Control", "public, no-cache")
+	}
+
+	if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+		header.Set("Content-Type", ctype)
+	}
+
+	if s.opts.Precompressed {
+		header.Add("Vary", "Accept-Encoding")
+
+		if encoded, encodedInfo, encoding := s.precompressed(name, r); encoded != nil {
+			defer encoded.Close()
+			file, info = encoded, encodedInfo
+			header.Set("Content-Encoding", encoding)
+		}
+	}
+
+	header.Set("ETag", etag(info, header.Get("Content-Encoding")))
+
+	// handles Range, If-None-Match, If-Modified-Since and HEAD.
+	http.ServeContent(w, r, name, info.ModTime(), file)
+}
+
+func (s *fileServer) open(name string) (http.File, fs.FileInfo, error) {
+	file, err := s.root.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil || info.IsDir() {
+		file.Close()
+		return nil, nil, fs.ErrNotExist
+	}
+
+	return file, info, nil
+}
+
+// precompressed opens the brotli or gzip version of name, if the client accepts it.
+func (s *fileServer) precompressed(name string, r *http.Request) (http.File, fs.FileInfo, string) {
+	accepted := r.Header.Get("Accept-Encoding")
+
+	for _, candidate := range []struct{ ext, encoding string }{{".br", "br"}, {".gz", "gzip"}} {
+		if !acceptsEncoding(accepted, candidate.encoding) {
+			continue
+		}
+
+		if file, info, err := s.open(name + candidate.ext); err == nil {
+			return file, info, candidate.encoding
+		}
+	}
+
+	return nil, nil, ""
+}
+
+// etag returns a strong ETag from the modification time and the size of the file, the encoding
+// tells the precompressed versions apart. Nothing is kept between requests.
+func etag(info fs.FileInfo, encoding string) string {
+	tag := strconv.FormatInt(info.ModTime().UnixNano(), 16) + "-" + strconv.FormatInt(info.Size(), 16)
+	if encoding != "" {
+		tag += "-" + encoding
+	}
+
+	return `"` + tag + `"`
+}
+
+func acceptsEncoding(header, encoding string) bool {
+	for _, part := range strings.Split(header, ",") {
+		fields := strings.Split(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(fields[0]), encoding) {
+			continue
+		}
+
+		// "gzip;q=0" means not accepted.
+		for _, param := range fields[1:] {
+			if q, ok := strings.CutPrefix(strings.TrimSpace(param), "q="); ok {
+				if weight, err := strconv.ParseFloat(q, 64); err == nil && weight == 0 {
+					return false
+				}
+			}
+		}
+
+		return true
+	}
+
+	return false
+}
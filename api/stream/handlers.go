@@ -0,0 +1,86 @@
+package stream
+
+import (
+	"fmt"
+	"net/http"
+	"time"
+
+	"memo/pkg/events"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+)
+
+// heartbeat keeps idle connections open through proxies.
+const heartbeat = 15 * time.Second
+
+// HandleStream sends the events of the user as server-sent events. A client reconnecting with
+// Last-Event-ID (or ?last_event_id=) gets the events it missed, or a "reset" event when they
+// are not known anymore and it should reload its notes.
+func HandleStream(logger logger.Logger, hub *events.Hub) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			response.ErrMessage(w, "Streaming is not supported", http.StatusNotImplemented)
+			return
+		}
+
+		lastEventId := r.Header.Get("Last-Event-ID")
+		if lastEventId == "" {
+			lastEventId = r.URL.Query().Get("last_event_id")
+		}
+
+		sub, missed, resumed := hub.Subscribe(userId, lastEventId)
+		defer hub.Unsubscribe(sub)
+
+		// the stream outlives the server write timeout.
+		http.NewResponseController(w).SetWriteDeadline(time.Time{})
+
+		header := w.Header()
+		header.Set("Content-Type", "text/event-stream")
+		header.Set("Cache-Control", "no-cache")
+		header.Set("Connection", "keep-alive")
+		header.Set("X-Accel-Buffering", "no")
+		w.WriteHeader(http.StatusOK)
+
+		fmt.Fprint(w, "retry: 3000\n\n")
+		if !resumed {
+			fmt.Fprint(w, "event: reset\ndata: {}\n\n")
+		}
+
+		for _, event := range missed {
+			write(w, event)
+		}
+		flusher.Flush()
+
+		ticker := time.NewTicker(heartbeat)
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-r.Context().Done():
+				return
+			case <-ticker.C:
+				if _, err := fmt.Fprint(w, ": ping\n\n"); err != nil {
+					return
+				}
+			case event, ok := <-sub.Events():
+				if !ok {
+					return
+				}
+
+				if err := write(w, event); err != nil {
+					return
+				}
+			}
+
+			flusher.Flush()
+		}
+	})
+}
+
+func write(w http.ResponseWriter, event events.Event) error {
+	_, err := fmt.Fprintf(w, "id: %s\nevent: %s\ndata: %s\n\n", event.ID, event.Type, event.Data)
+	return err
+}
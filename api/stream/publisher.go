@@ -0,0 +1,166 @@
+package stream
+
+import (
+	"context"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/events"
+	"memo/pkg/logger"
+)
+
+const (
+	NoteCreated   = "note.created"
+	NoteUpdated   = "note.updated"
+	NoteDeleted   = "note.deleted"
+	NoteShared    = "note.shared"
+	NoteUnshared  = "note.unshared"
+	TaskCreated   = "task.created"
+	TaskUpdated   = "task.updated"
+	TaskCompleted = "task.completed"
+)
+
+type noteEvent struct {
+	NoteID string               `json:"note_id"`
+	By     string               `json:"by,omitempty"`
+	Note   *models.EmbeddedNote `json:"note,omitempty"`
+}
+
+type taskEvent struct {
+	NoteID string       `json:"note_id"`
+	By     string       `json:"by,omitempty"`
+	Task   *models.Task `json:"task,omitempty"`
+}
+
+type commentEvent struct {
+	NoteID    string `json:"note_id"`
+	CommentID string `json:"comment_id"`
+	By        string `json:"by,omitempty"`
+}
+
+type shareEvent struct {
+	NoteID     string            `json:"note_id"`
+	By         string            `json:"by,omitempty"`
+	UserID     string            `json:"user_id"`
+	Permission models.Permission `json:"permission,omitempty"`
+}
+
+// Publisher turns note changes into events for the users who can read the note.
+// It's a notes repository hook, todo and share handlers call it for their own changes.
+type Publisher struct {
+	logger logger.Logger
+	hub    *events.Hub
+	notes  repository.NotesRepository
+}
+
+func NewPublisher(logger logger.Logger, hub *events.Hub, notes repository.NotesRepository) *Publisher {
+	return &Publisher{logger, hub, notes}
+}
+
+func (p *Publisher) NoteSaved(note *models.EmbeddedNote, created bool, ctx context.Context) error {
+	eventType := NoteUpdated
+	if created {
+		eventType = NoteCreated
+	}
+
+	return p.hub.Publish(eventType, Audience(note), noteEvent{NoteID: note.ID.Hex(), By: actor(ctx), Note: note}, ctx)
+}
+
+func (p *Publisher) NoteDeleted(note *models.EmbeddedNote, ctx context.Context) error {
+	return p.hub.Publish(NoteDeleted, Audience(note), noteEvent{NoteID: note.ID.Hex(), By: actor(ctx)}, ctx)
+}
+
+// TaskChanged publishes the task of a todo note after it was created or updated.
+func (p *Publisher) TaskChanged(noteId, taskId string, created bool, ctx context.Context) {
+	eventType := TaskUpdated
+	if created {
+		eventType = TaskCreated
+	}
+
+	p.publishTask(eventType, noteId, taskId, ctx)
+}
+
+// TaskCompleted publishes a task of a todo note that was ticked.
+func (p *Publisher) TaskCompleted(noteId, taskId string, ctx context.Context) {
+	p.publishTask(TaskCompleted, noteId, taskId, ctx)
+}
+
+func (p *Publisher) publishTask(eventType, noteId, taskId string, ctx context.Context) {
+	note, err := p.notes.GetById(noteId, ctx)
+	if err != nil {
+		p.logger.For(ctx).Error("task event issue", "error", err)
+		return
+	}
+
+	event := taskEvent{NoteID: noteId, By: actor(ctx)}
+	if todo, ok := note.Data.(*models.TodoNoteData); ok {
+		for i := range todo.Tasks {
+			if todo.Tasks[i].ID.Hex() == taskId {
+				event.Task = &todo.Tasks[i]
+			}
+		}
+	}
+
+	if err := p.hub.Publish(eventType, Audience(note), event, ctx); err != nil {
+		p.logger.For(ctx).Error("task event issue", "error", err)
+	}
+}
+
+// CommentChanged publishes a change of a comment of a note, change is created, updated, deleted,
+// resolved or unresolved.
+func (p *Publisher) CommentChanged(noteId, commentId, change string, ctx context.Context) {
+	note, err := p.notes.GetById(noteId, ctx)
+	if err != nil {
+		p.logger.For(ctx).Error("comment event issue", "error", err)
+		return
+	}
+
+	event := commentEvent{NoteID: noteId, CommentID: commentId, By: actor(ctx)}
+	if err := p.hub.Publish("comment."+change, Audience(note), event, ctx); err != nil {
+		p.logger.For(ctx).Error("comment event issue", "error", err)
+	}
+}
+
+// NoteShared publishes a new share of a note, the user it's shared with is in the audience.
+func (p *Publisher) NoteShared(noteId, userId string, permission models.Permission, ctx context.Context) {
+	note, err := p.notes.GetById(noteId, ctx)
+	if err != nil {
+		p.logger.For(ctx).Error("share event issue", "error", err)
+		return
+	}
+
+	event := shareEvent{NoteID: noteId, By: actor(ctx), UserID: userId, Permission: permission}
+	if err := p.hub.Publish(NoteShared, Audience(note), event, ctx); err != nil {
+		p.logger.For(ctx).Error("share event issue", "error", err)
+	}
+}
+
+// NoteUnshared publishes the removal of a user from a note, the removed user is told too.
+func (p *Publisher) NoteUnshared(noteId, userId string, ctx context.Context) {
+	note, err := p.notes.GetById(noteId, ctx)
+	if err != nil {
+		p.logger.For(ctx).Error("share event issue", "error", err)
+		return
+	}
+
+	event := shareEvent{NoteID: noteId, By: actor(ctx), UserID: userId}
+	if err := p.hub.Publish(NoteUnshared, append(Audience(note), userId), event, ctx); err != nil {
+		p.logger.For(ctx).Error("share event issue", "error", err)
+	}
+}
+
+// Audience returns the users who can read note: its owner, the users it's shared with and
+// the members of its workspace.
+func Audience(note *models.EmbeddedNote) []string {
+	audience := []string{}
+	for _, userId := range note.Readers() {
+		audience = append(audience, userId.Hex())
+	}
+
+	return audience
+}
+
+func actor(ctx context.Context) string {
+	userId, _ := ctx.Value("user").(string)
+	return userId
+}
@@ -0,0 +1,275 @@
+package templates
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/validation"
+)
+
+type templateRequest struct {
+	Name  string `json:"name" validate:"required"`
+	Type  string `json:"type" validate:"required"`
+	Title string `json:"title" validate:"required"`
+}
+
+func HandleList(logger logger.Logger, repo TemplateRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		templates, err := repo.List(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("templates list issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, templates, http.StatusOK)
+	})
+}
+
+func HandleGet(logger logger.Logger, repo TemplateRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := loadTemplate(w, r, repo)
+		if !ok {
+			return
+		}
+
+		response.Respond(w, template, http.StatusOK)
+	})
+}
+
+// HandleAdd saves a template, data is checked when the template is used.
+func HandleAdd(logger logger.Logger, repo TemplateRepository, types *models.Registry) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		template, problems := decodeTemplate(r, types)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		template.UserID, _ = primitive.ObjectIDFromHex(userId)
+		template.CreatedAt = time.Now()
+		template.UpdatedAt = template.CreatedAt
+
+		if err := repo.Add(template, r.Context()); err != nil {
+			logger.For(r.Context()).Error("template add issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, template, http.StatusCreated)
+	})
+}
+
+func HandleUpdate(logger logger.Logger, repo TemplateRepository, types *models.Registry) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := loadTemplate(w, r, repo)
+		if !ok {
+			return
+		}
+
+		changed, problems := decodeTemplate(r, types)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		template.Name, template.Type, template.Title = changed.Name, changed.Type, changed.Title
+		template.Tags, template.Data = changed.Tags, changed.Data
+		template.UpdatedAt = time.Now()
+
+		if err := repo.Update(template, r.Context()); err != nil {
+			logger.For(r.Context()).Error("template update issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, template, http.StatusOK)
+	})
+}
+
+func HandleDelete(logger logger.Logger, repo TemplateRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		template, ok := loadTemplate(w, r, repo)
+		if !ok {
+			return
+		}
+
+		if err := repo.Delete(template.ID, r.Context()); err != nil {
+			logger.For(r.Context()).Error("template delete issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleInstantiate creates a note from a template. The body can set the {{title}} variable,
+// custom variables and the timezone used for the date variables.
+func HandleInstantiate(logger logger.Logger, repo TemplateRepository, notes repository.NotesRepository, types *models.Registry) http.HandlerFunc {
+	type instantiateRequest struct {
+		Title     string            `json:"title"`
+		Variables map[string]string `json:"variables"`
+		Timezone  string            `json:"timezone"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		template, ok := loadTemplate(w, r, repo)
+		if !ok {
+			return
+		}
+
+		var req instantiateRequest
+		// the body is optional.
+		_ = json.NewDecoder(r.Body).Decode(&req)
+
+		location := time.Local
+		if req.Timezone != "" {
+			var err error
+			if location, err = time.LoadLocation(req.Timezone); err != nil {
+				response.ValidationErr(w, map[string]string{"timezone": "timezone"})
+				return
+			}
+		}
+
+		title := strings.TrimSpace(req.Title)
+		if title == "" {
+			title = template.Name
+		}
+
+		vars := Variables(time.Now().In(location), title, req.Variables)
+
+		noteType, ok := types.Get(template.Type)
+		if !ok {
+			response.ValidationErr(w, map[string]string{"type": "in:" + strings.Join(types.Names(), ",")})
+			return
+		}
+
+		// the type validation expects json values.
+		data := map[string]any{}
+		raw, err := json.Marshal(expandAll(template.Data, vars))
+		if err == nil {
+			err = json.Unmarshal(raw, &data)
+		}
+
+		if err != nil {
+			logger.For(r.Context()).Error("template issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		doc, problems, err := noteType.Create(data, userId, r.Context())
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		if err != nil {
+			if !errors.As(err, new(response.ErrorResponse)) {
+				logger.For(r.Context()).Error("template issue", "error", err)
+			}
+			response.RespondErr(w, err)
+			return
+		}
+
+		note := models.EmbeddedNote{
+			BaseNote: models.BaseNote{
+				Type:      template.Type,
+				Title:     Expand(template.Title, vars),
+				Tags:      []string{},
+				CreatedAt: time.Now(),
+				UpdatedAt: time.Now(),
+			},
+			Data: doc,
+		}
+
+		for _, tag := range template.Tags {
+			note.Tags = append(note.Tags, Expand(tag, vars))
+		}
+
+		note.SearchText = types.SearchText(&note)
+
+		id, err := notes.Add(note, userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("template issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		created, err := notes.GetById(id, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("template issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, created, http.StatusCreated)
+	})
+}
+
+func decodeTemplate(r *http.Request, types *models.Registry) (*Template, map[string]string) {
+	data := make(map[string]any)
+	if err := json.NewDecoder(r.Body).Decode(&data); err != nil {
+		// the validation below reports the missing fields.
+	}
+
+	req, problems := validation.Valid[*templateRequest](data)
+	if len(problems) > 0 {
+		return nil, problems
+	}
+
+	if _, ok := types.Get(req.Type); !ok {
+		return nil, map[string]string{"type": "in:" + strings.Join(types.Names(), ",")}
+	}
+
+	template := &Template{Name: req.Name, Type: req.Type, Title: req.Title, Tags: []string{}, Data: map[string]any{}}
+
+	if tags, ok := data["tags"]; ok && tags != nil {
+		list, ok := tags.([]any)
+		if !ok {
+			return nil, map[string]string{"tags": "array"}
+		}
+
+		for _, tag := range list {
+			if tag, ok := tag.(string); ok && strings.TrimSpace(tag) != "" {
+				template.Tags = append(template.Tags, tag)
+			}
+		}
+	}
+
+	if doc, ok := data["data"]; ok && doc != nil {
+		if template.Data, ok = doc.(map[string]any); !ok {
+			return nil, map[string]string{"data": "object"}
+		}
+	}
+
+	return template, nil
+}
+
+// loadTemplate returns the template of the request, templates are only visible to their owner.
+func loadTemplate(w http.ResponseWriter, r *http.Request, repo TemplateRepository) (*Template, bool) {
+	userId := r.Context().Value("user").(string)
+
+	template, err := repo.Get(r.PathValue("id"), r.Context())
+	if err != nil || !template.OwnedBy(userId) {
+		response.RespondErr(w, response.NotFound())
+		return nil, false
+	}
+
+	return template, true
+}
@@ -0,0 +1,25 @@
+package templates
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Template is a note structure saved by a user. Data is the type specific part of a create
+// request (e.g. {"content": ...} or {"tasks": [...]}), its strings can hold {{variables}}.
+type Template struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"user_id"`
+	Name      string             `bson:"name" json:"name"`
+	Type      string             `bson:"type" json:"type"`
+	Title     string             `bson:"title" json:"title"`
+	Tags      []string           `bson:"tags" json:"tags"`
+	Data      map[string]any     `bson:"data" json:"data"`
+	CreatedAt time.Time          `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time          `bson:"updated_at" json:"updated_at"`
+}
+
+func (t *Template) OwnedBy(userId string) bool {
+	return t.UserID.Hex() == userId
+}
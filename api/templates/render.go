@@ -0,0 +1,75 @@
+package templates
+
+import (
+	"regexp"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+var placeholder = regexp.MustCompile(`{{\s*([a-zA-Z0-9_]+)\s*}}`)
+
+// Variables returns the built in variables at now: date, time, datetime, weekday, year, month
+// and day, plus title. Custom variables are added to them and can't replace them.
+func Variables(now time.Time, title string, custom map[string]string) map[string]string {
+	vars := make(map[string]string, len(custom)+8)
+	for name, value := range custom {
+		vars[name] = value
+	}
+
+	vars["title"] = title
+	vars["date"] = now.Format("2006-01-02")
+	vars["time"] = now.Format("15:04")
+	vars["datetime"] = now.Format("2006-01-02 15:04")
+	vars["weekday"] = now.Weekday().String()
+	vars["year"] = now.Format("2006")
+	vars["month"] = now.Format("01")
+	vars["day"] = now.Format("02")
+
+	return vars
+}
+
+// Expand replaces the {{name}} placeholders of s, unknown ones are left as they are.
+func Expand(s string, vars map[string]string) string {
+	if !strings.Contains(s, "{{") {
+		return s
+	}
+
+	return placeholder.ReplaceAllStringFunc(s, func(match string) string {
+		name := placeholder.FindStringSubmatch(match)[1]
+		if value, ok := vars[name]; ok {
+			return value
+		}
+		return match
+	})
+}
+
+// expandAll expands the strings found in maps and lists, as decoded from json or bson.
+// Bson documents and arrays are turned into maps and slices.
+func expandAll(value any, vars map[string]string) any {
+	switch v := value.(type) {
+	case string:
+		return Expand(v, vars)
+	case primitive.D:
+		return expandAll(v.Map(), vars)
+	case primitive.M:
+		return expandAll(map[string]any(v), vars)
+	case primitive.A:
+		return expandAll([]any(v), vars)
+	case map[string]any:
+		expanded := make(map[string]any, len(v))
+		for key, item := range v {
+			expanded[key] = expandAll(item, vars)
+		}
+		return expanded
+	case []any:
+		expanded := make([]any, len(v))
+		for i, item := range v {
+			expanded[i] = expandAll(item, vars)
+		}
+		return expanded
+	}
+
+	return value
+}
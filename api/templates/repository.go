@@ -0,0 +1,102 @@
+package templates
+
+import (
+	"context"
+	"fmt"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type TemplateRepository interface {
+	Add(template *Template, ctx context.Context) error
+	List(userId string, ctx context.Context) ([]*Template, error)
+	Get(id string, ctx context.Context) (*Template, error)
+	Update(template *Template, ctx context.Context) error
+	Delete(id primitive.ObjectID, ctx context.Context) error
+}
+
+type templateRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) TemplateRepository {
+	return &templateRepository{client}
+}
+
+func (r *templateRepository) Add(template *Template, ctx context.Context) error {
+	result, err := r.client.Collection("templates").InsertOne(ctx, template)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		template.ID = id
+	}
+
+	return nil
+}
+
+func (r *templateRepository) List(userId string, ctx context.Context) ([]*Template, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	cursor, err := r.client.Collection("templates").Find(ctx, bson.M{"user_id": oUserId}, options.Find().SetSort(bson.M{"name": 1}))
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	templates := []*Template{}
+	if err := cursor.All(ctx, &templates); err != nil {
+		return nil, err
+	}
+
+	return templates, nil
+}
+
+func (r *templateRepository) Get(id string, ctx context.Context) (*Template, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var template *Template
+	if err := r.client.Collection("templates").FindOne(ctx, bson.M{"_id": oId}).Decode(&template); err != nil {
+		return nil, err
+	}
+
+	return template, nil
+}
+
+func (r *templateRepository) Update(template *Template, ctx context.Context) error {
+	update := bson.M{"$set": bson.M{
+		"name":       template.Name,
+		"type":       template.Type,
+		"title":      template.Title,
+		"tags":       template.Tags,
+		"data":       template.Data,
+		"updated_at": template.UpdatedAt,
+	}}
+
+	result, err := r.client.Collection("templates").UpdateByID(ctx, template.ID, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *templateRepository) Delete(id primitive.ObjectID, ctx context.Context) error {
+	_, err := r.client.Collection("templates").DeleteOne(ctx, bson.M{"_id": id})
+	return err
+}
@@ -0,0 +1,249 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"memo/pkg/events"
+	"memo/pkg/logger"
+	"memo/pkg/security"
+)
+
+// queue is the number of published events waiting to be matched with webhooks.
+const queue = 1024
+
+// Dispatcher delivers the events published by this instance to the webhooks subscribed to them.
+// Each delivery is stored before it's attempted, a pool of workers sends the pending ones and
+// retries the failed attempts with an exponential backoff.
+type Dispatcher struct {
+	logger logger.Logger
+	repo   WebhookRepository
+	client *http.Client
+	config Config
+	events chan events.Event
+	wake   chan struct{}
+}
+
+// NewDispatcher returns a Dispatcher sending the deliveries with client. When nil, a client that
+// only connects to public addresses is used, the webhook urls are given by the users.
+func NewDispatcher(logger logger.Logger, repo WebhookRepository, client *http.Client, config Config) *Dispatcher {
+	if client == nil {
+		client = security.PublicClient(config.Timeout)
+	}
+
+	return &Dispatcher{
+		logger: logger,
+		repo:   repo,
+		client: client,
+		config: config,
+		events: make(chan events.Event, queue),
+		wake:   make(chan struct{}, config.Workers),
+	}
+}
+
+// Tap queues a published event, it's registered with events.Hub.Tap.
+func (d *Dispatcher) Tap(event events.Event) {
+	select {
+	case d.events <- event:
+	default:
+		d.logger.Warn("webhook queue full, event dropped", "event_id", event.ID)
+	}
+}
+
+// Run starts the workers and matches the queued events with the webhooks until ctx is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	var wg sync.WaitGroup
+	for i := 0; i < d.config.Workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			d.work(ctx)
+		}()
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			wg.Wait()
+			return
+		case event := <-d.events:
+			if err := d.enqueue(event, ctx); err != nil {
+				d.logger.For(ctx).Error("webhook issue", "error", err)
+			}
+		}
+	}
+}
+
+// enqueue stores a pending delivery of the event for each webhook subscribed to it.
+func (d *Dispatcher) enqueue(event events.Event, ctx context.Context) error {
+	webhooks, err := d.repo.Subscribers(event.Audience, event.Type, ctx)
+	if err != nil || len(webhooks) == 0 {
+		return err
+	}
+
+	payload, err := json.Marshal(map[string]any{
+		"id":         event.ID,
+		"type":       event.Type,
+		"created_at": event.Time,
+		"data":       json.RawMessage(event.Data),
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, webhook := range webhooks {
+		delivery := &Delivery{
+			WebhookID:     webhook.ID,
+			UserID:        webhook.UserID,
+			EventID:       event.ID,
+			Event:         event.Type,
+			Payload:       string(payload),
+			Status:        DeliveryPending,
+			Attempts:      []Attempt{},
+			NextAttemptAt: time.Now(),
+			CreatedAt:     time.Now(),
+		}
+
+		if err := d.repo.InsertDelivery(delivery, ctx); err != nil {
+			return err
+		}
+	}
+
+	d.signal()
+
+	return nil
+}
+
+// Replay delivers the event of a delivery again, as a new delivery.
+func (d *Dispatcher) Replay(delivery *Delivery, ctx context.Context) (*Delivery, error) {
+	replay := &Delivery{
+		WebhookID:     delivery.WebhookID,
+		UserID:        delivery.UserID,
+		EventID:       delivery.EventID,
+		Event:         delivery.Event,
+		Payload:       delivery.Payload,
+		Status:        DeliveryPending,
+		Attempts:      []Attempt{},
+		NextAttemptAt: time.Now(),
+		ReplayOf:      delivery.ID,
+		CreatedAt:     time.Now(),
+	}
+
+	if err := d.repo.InsertDelivery(replay, ctx); err != nil {
+		return nil, err
+	}
+
+	d.signal()
+
+	return replay, nil
+}
+
+// signal wakes a worker up for a new delivery.
+func (d *Dispatcher) signal() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// work attempts the due deliveries, then waits for a new one or for the next poll.
+func (d *Dispatcher) work(ctx context.Context) {
+	ticker := time.NewTicker(d.config.Poll)
+	defer ticker.Stop()
+
+	for {
+		for ctx.Err() == nil {
+			// the lease outlasts an attempt, a delivery left by a stopped instance is retried after it.
+			delivery, err := d.repo.Claim(2*d.config.Timeout, ctx)
+			if err != nil {
+				d.logger.For(ctx).Error("webhook issue", "error", err)
+				break
+			}
+			if delivery == nil {
+				break
+			}
+
+			if err := d.Deliver(delivery, ctx); err != nil {
+				d.logger.For(ctx).Error("webhook issue", "error", err)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		case <-d.wake:
+		}
+	}
+}
+
+// Deliver makes an attempt of the delivery and logs it. The delivery is retried later when the
+// attempt fails, until it reaches the maximum number of attempts.
+func (d *Dispatcher) Deliver(delivery *Delivery, ctx context.Context) error {
+	var attempt Attempt
+
+	webhook, err := d.repo.Get(delivery.WebhookID.Hex(), delivery.UserID.Hex(), ctx)
+	switch {
+	case err != nil:
+		attempt = Attempt{At: time.Now(), Error: "webhook not found"}
+	case !webhook.Active:
+		attempt = Attempt{At: time.Now(), Error: "webhook disabled"}
+	default:
+		attempt = d.Send(webhook, delivery, ctx)
+	}
+
+	status, next := DeliverySucceeded, time.Now()
+	if !attempt.Succeeded() {
+		status = DeliveryFailed
+
+		attempts := len(delivery.Attempts) + 1
+		if webhook != nil && webhook.Active && attempts < d.config.MaxAttempts {
+			status, next = DeliveryPending, next.Add(d.config.backoff(attempts))
+		}
+	}
+
+	return d.repo.RecordAttempt(delivery.ID, attempt, status, next, ctx)
+}
+
+// Send posts the payload of the delivery to the webhook, signed with its secret.
+func (d *Dispatcher) Send(webhook *Webhook, delivery *Delivery, ctx context.Context) Attempt {
+	ctx, cancel := context.WithTimeout(ctx, d.config.Timeout)
+	defer cancel()
+
+	attempt := Attempt{At: time.Now()}
+	body := []byte(delivery.Payload)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, webhook.URL, bytes.NewReader(body))
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "memo-webhooks")
+	req.Header.Set(HeaderEvent, delivery.Event)
+	req.Header.Set(HeaderDelivery, delivery.ID.Hex())
+	req.Header.Set(HeaderTimestamp, strconv.FormatInt(attempt.At.Unix(), 10))
+	req.Header.Set(HeaderSignature, Sign(webhook.Secret, attempt.At.Unix(), body))
+
+	resp, err := d.client.Do(req)
+	attempt.Duration = time.Since(attempt.At).Milliseconds()
+	if err != nil {
+		attempt.Error = err.Error()
+		return attempt
+	}
+
+	defer resp.Body.Close()
+
+	snippet, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	attempt.StatusCode = resp.StatusCode
+	attempt.Response = string(snippet)
+
+	return attempt
+}
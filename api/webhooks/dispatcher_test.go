@@ -0,0 +1,398 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/pkg/logger"
+)
+
+// memRepo keeps the webhooks and their deliveries in memory.
+type memRepo struct {
+	mu         sync.Mutex
+	webhooks   map[primitive.ObjectID]*Webhook
+	deliveries map[primitive.ObjectID]*Delivery
+}
+
+func newMemRepo() *memRepo {
+	return &memRepo{webhooks: map[primitive.ObjectID]*Webhook{}, deliveries: map[primitive.ObjectID]*Delivery{}}
+}
+
+func (r *memRepo) Create(webhook *Webhook, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if webhook.ID.IsZero() {
+		webhook.ID = primitive.NewObjectID()
+	}
+	r.webhooks[webhook.ID] = webhook
+	return nil
+}
+
+func (r *memRepo) Get(id, userId string, ctx context.Context) (*Webhook, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, webhook := range r.webhooks {
+		if webhook.ID.Hex() == id && webhook.UserID.Hex() == userId {
+			copied := *webhook
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("no documents matched the filter")
+}
+
+func (r *memRepo) List(userId string, ctx context.Context) ([]*Webhook, error) {
+	return nil, nil
+}
+
+func (r *memRepo) Update(webhook *Webhook, ctx context.Context) error {
+	return r.Create(webhook, ctx)
+}
+
+func (r *memRepo) Delete(id, userId string, ctx context.Context) error {
+	return nil
+}
+
+func (r *memRepo) Subscribers(userIds []string, eventType string, ctx context.Context) ([]*Webhook, error) {
+	return nil, nil
+}
+
+func (r *memRepo) InsertDelivery(delivery *Delivery, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery.ID = primitive.NewObjectID()
+	copied := *delivery
+	r.deliveries[delivery.ID] = &copied
+	return nil
+}
+
+func (r *memRepo) GetDelivery(id string, webhookId primitive.ObjectID, ctx context.Context) (*Delivery, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	for _, delivery := range r.deliveries {
+		if delivery.ID.Hex() == id && delivery.WebhookID == webhookId {
+			copied := *delivery
+			return &copied, nil
+		}
+	}
+	return nil, fmt.Errorf("no documents matched the filter")
+}
+
+func (r *memRepo) Deliveries(webhookId primitive.ObjectID, limit int64, ctx context.Context) ([]*Delivery, error) {
+	return nil, nil
+}
+
+func (r *memRepo) Claim(lease time.Duration, ctx context.Context) (*Delivery, error) {
+	return nil, nil
+}
+
+func (r *memRepo) RecordAttempt(id primitive.ObjectID, attempt Attempt, status DeliveryStatus, next time.Time, ctx context.Context) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	delivery := r.deliveries[id]
+	delivery.Attempts = append(delivery.Attempts, attempt)
+	delivery.Status, delivery.NextAttemptAt = status, next
+	return nil
+}
+
+// delivery returns the stored delivery, as the next worker claiming it would get it.
+func (r *memRepo) delivery(id primitive.ObjectID) *Delivery {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	copied := *r.deliveries[id]
+	return &copied
+}
+
+// received is a request made to a test webhook.
+type received struct {
+	header http.Header
+	body   string
+}
+
+// receiver is a webhook endpoint answering with the given statuses in turn, then 200.
+type receiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []received
+}
+
+func (rc *receiver) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	body, _ := io.ReadAll(r.Body)
+
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.requests = append(rc.requests, received{r.Header.Clone(), string(body)})
+
+	status := http.StatusOK
+	if len(rc.statuses) > 0 {
+		status, rc.statuses = rc.statuses[0], rc.statuses[1:]
+	}
+	w.WriteHeader(status)
+	io.WriteString(w, http.StatusText(status))
+}
+
+var testConfig = Config{
+	Workers:     1,
+	MaxAttempts: 3,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  time.Minute,
+	Timeout:     5 * time.Second,
+	Poll:        time.Second,
+}
+
+// setup returns a dispatcher sending to a test server, with a webhook on it and a pending delivery.
+func setup(t *testing.T, statuses ...int) (*Dispatcher, *memRepo, *receiver, *Webhook, *Delivery) {
+	rc := &receiver{statuses: statuses}
+	server := httptest.NewServer(rc)
+	t.Cleanup(server.Close)
+
+	repo := newMemRepo()
+	webhook := &Webhook{
+		UserID: primitive.NewObjectID(),
+		URL:    server.URL + "/hook",
+		Events: []string{"note.created"},
+		Secret: "s3cret",
+		Active: true,
+	}
+	repo.Create(webhook, context.Background())
+
+	delivery := &Delivery{
+		WebhookID: webhook.ID,
+		UserID:    webhook.UserID,
+		EventID:   "event-1",
+		Event:     "note.created",
+		Payload:   `{"id":"event-1","type":"note.created","data":{"id":"n1"}}`,
+		Status:    DeliveryPending,
+		Attempts:  []Attempt{},
+	}
+	repo.InsertDelivery(delivery, context.Background())
+
+	// the test server listens on a loopback address, the default client refuses it.
+	dispatcher := NewDispatcher(logger.New(io.Discard, logger.Config{}), repo, server.Client(), testConfig)
+
+	return dispatcher, repo, rc, webhook, delivery
+}
+
+func TestDeliverySignature(t *testing.T) {
+	dispatcher, repo, rc, webhook, delivery := setup(t)
+
+	if err := dispatcher.Deliver(delivery, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	if stored := repo.delivery(delivery.ID); stored.Status != DeliverySucceeded {
+		t.Fatalf("status %s, want %s", stored.Status, DeliverySucceeded)
+	}
+
+	if len(rc.requests) != 1 {
+		t.Fatalf("%d requests, want 1", len(rc.requests))
+	}
+	req := rc.requests[0]
+
+	if req.body != delivery.Payload {
+		t.Errorf("body %s, want the payload", req.body)
+	}
+	if req.header.Get(HeaderEvent) != "note.created" || req.header.Get(HeaderDelivery) != delivery.ID.Hex() {
+		t.Errorf("headers %v", req.header)
+	}
+
+	timestamp, signature := req.header.Get(HeaderTimestamp), req.header.Get(HeaderSignature)
+	if !strings.HasPrefix(signature, "sha256=") {
+		t.Errorf("signature %q", signature)
+	}
+
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp %q", timestamp)
+	}
+
+	tests := []struct {
+		name      string
+		secret    string
+		timestamp string
+		body      string
+		valid     bool
+	}{
+		{"as sent", webhook.Secret, timestamp, req.body, true},
+		{"other secret", "other", timestamp, req.body, false},
+		{"changed body", webhook.Secret, timestamp, strings.Replace(req.body, "n1", "n2", 1), false},
+		{"changed timestamp", webhook.Secret, fmt.Sprint(sent + 1), req.body, false},
+		{"no timestamp", webhook.Secret, "", req.body, false},
+	}
+
+	for _, test := range tests {
+		if got := Verify(test.secret, test.timestamp, signature, []byte(test.body), 5*time.Minute); got != test.valid {
+			t.Errorf("%s: Verify = %t, want %t", test.name, got, test.valid)
+		}
+	}
+}
+
+func TestVerifyRefusesOldDeliveries(t *testing.T) {
+	body := []byte(`{"id":"event-1"}`)
+
+	for _, age := range []time.Duration{-10 * time.Minute, 10 * time.Minute, time.Hour} {
+		sent := time.Now().Add(-age).Unix()
+		if Verify("s3cret", fmt.Sprint(sent), Sign("s3cret", sent, body), body, 5*time.Minute) {
+			t.Errorf("a delivery sent %s ago was accepted", age)
+		}
+	}
+}
+
+func TestDeliverRetriesWithBackoff(t *testing.T) {
+	dispatcher, repo, rc, _, delivery := setup(t, http.StatusInternalServerError, http.StatusBadGateway)
+
+	for attempt, wantDelay := range []time.Duration{30 * time.Second, time.Minute} {
+		before := time.Now()
+		if err := dispatcher.Deliver(repo.delivery(delivery.ID), context.Background()); err != nil {
+			t.Fatal(err)
+		}
+
+		stored := repo.delivery(delivery.ID)
+		if stored.Status != DeliveryPending || len(stored.Attempts) != attempt+1 {
+			t.Fatalf("attempt %d: status %s with %d attempts", attempt+1, stored.Status, len(stored.Attempts))
+		}
+
+		if delay := stored.NextAttemptAt.Sub(before); delay < wantDelay || delay > wantDelay+time.Second {
+			t.Errorf("attempt %d: retried after %s, want %s", attempt+1, delay, wantDelay)
+		}
+
+		if last := stored.Attempts[attempt]; last.Succeeded() || last.StatusCode == 0 || last.Response == "" {
+			t.Errorf("attempt %d logged as %+v", attempt+1, last)
+		}
+	}
+
+	// the third attempt is accepted.
+	if err := dispatcher.Deliver(repo.delivery(delivery.ID), context.Background()); err != nil {
+		t.Fatal(err)
+	}
+	if stored := repo.delivery(delivery.ID); stored.Status != DeliverySucceeded || len(stored.Attempts) != 3 {
+		t.Errorf("status %s with %d attempts, want %s with 3", stored.Status, len(stored.Attempts), DeliverySucceeded)
+	}
+
+	// each attempt is signed again, with its own timestamp.
+	if len(rc.requests) != 3 {
+		t.Fatalf("%d requests, want 3", len(rc.requests))
+	}
+}
+
+func TestDeliverGivesUp(t *testing.T) {
+	dispatcher, repo, _, _, delivery := setup(t, 500, 500, 500, 500)
+
+	for i := 0; i < testConfig.MaxAttempts; i++ {
+		if err := dispatcher.Deliver(repo.delivery(delivery.ID), context.Background()); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if stored := repo.delivery(delivery.ID); stored.Status != DeliveryFailed || len(stored.Attempts) != testConfig.MaxAttempts {
+		t.Errorf("status %s with %d attempts, want %s with %d", stored.Status, len(stored.Attempts), DeliveryFailed, testConfig.MaxAttempts)
+	}
+}
+
+func TestDeliverToADisabledWebhook(t *testing.T) {
+	dispatcher, repo, rc, webhook, delivery := setup(t)
+
+	webhook.Active = false
+	repo.Update(webhook, context.Background())
+
+	if err := dispatcher.Deliver(delivery, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := repo.delivery(delivery.ID)
+	if stored.Status != DeliveryFailed || stored.Attempts[0].Error != "webhook disabled" {
+		t.Errorf("status %s, attempts %+v", stored.Status, stored.Attempts)
+	}
+	if len(rc.requests) != 0 {
+		t.Errorf("a disabled webhook got %d requests", len(rc.requests))
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	config := Config{Backoff: 30 * time.Second, MaxBackoff: 5 * time.Minute}
+
+	want := []time.Duration{30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute, 5 * time.Minute, 5 * time.Minute}
+	for i, delay := range want {
+		if got := config.backoff(i + 1); got != delay {
+			t.Errorf("backoff(%d) = %s, want %s", i+1, got, delay)
+		}
+	}
+}
+
+func TestReplay(t *testing.T) {
+	dispatcher, repo, rc, _, delivery := setup(t)
+	ctx := context.Background()
+
+	if err := dispatcher.Deliver(delivery, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	replay, err := dispatcher.Replay(repo.delivery(delivery.ID), ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if replay.ID == delivery.ID || replay.ReplayOf != delivery.ID || replay.Status != DeliveryPending || len(replay.Attempts) != 0 {
+		t.Fatalf("replay %+v", replay)
+	}
+
+	if err := dispatcher.Deliver(repo.delivery(replay.ID), ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(rc.requests) != 2 {
+		t.Fatalf("%d requests, want 2", len(rc.requests))
+	}
+
+	// the same event, under the id of the new delivery.
+	first, second := rc.requests[0], rc.requests[1]
+	if second.body != first.body || second.header.Get(HeaderEvent) != first.header.Get(HeaderEvent) {
+		t.Errorf("replayed %s, want %s", second.body, first.body)
+	}
+	if second.header.Get(HeaderDelivery) != replay.ID.Hex() {
+		t.Errorf("replayed as delivery %s, want %s", second.header.Get(HeaderDelivery), replay.ID.Hex())
+	}
+
+	// the original delivery is left as it was.
+	if original := repo.delivery(delivery.ID); original.Status != DeliverySucceeded || len(original.Attempts) != 1 {
+		t.Errorf("original status %s with %d attempts", original.Status, len(original.Attempts))
+	}
+}
+
+func TestDefaultClientRefusesPrivateAddresses(t *testing.T) {
+	_, repo, rc, _, delivery := setup(t)
+
+	dispatcher := NewDispatcher(logger.New(io.Discard, logger.Config{}), repo, nil, testConfig)
+	if err := dispatcher.Deliver(delivery, context.Background()); err != nil {
+		t.Fatal(err)
+	}
+
+	stored := repo.delivery(delivery.ID)
+	if attempt := stored.Attempts[0]; !strings.Contains(attempt.Error, "address is not public") {
+		t.Errorf("attempt %+v, want the address refused", attempt)
+	}
+	if len(rc.requests) != 0 {
+		t.Errorf("the loopback server got %d requests", len(rc.requests))
+	}
+}
+
+func TestValidWebhookRefusesPrivateAddresses(t *testing.T) {
+	for _, target := range []string{"http://127.0.0.1/hook", "http://169.254.169.254/latest", "http://[::1]:8080/", "http://10.0.0.2/", "ftp://example.com/"} {
+		if problems := validWebhook(&webhookRequest{target, []string{"note.created"}}); problems["url"] == "" {
+			t.Errorf("%s was accepted", target)
+		}
+	}
+
+	if problems := validWebhook(&webhookRequest{"https://example.com/hook", []string{"note.created"}}); len(problems) > 0 {
+		t.Errorf("problems %v for a public url", problems)
+	}
+}
@@ -0,0 +1,274 @@
+package webhooks
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/security"
+	"memo/pkg/validation"
+)
+
+const (
+	defaultDeliveries = 50
+	maxDeliveries     = 200
+)
+
+type webhookRequest struct {
+	URL    string   `json:"url" validate:"required"`
+	Events []string `json:"events" validate:"required|array"`
+}
+
+func HandleList(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		webhooks, err := repo.List(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("webhooks issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, webhooks, http.StatusOK)
+	})
+}
+
+// HandleCreate registers a webhook, the response holds the secret signing its deliveries.
+// It's only shown then.
+func HandleCreate(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	type createResponse struct {
+		*Webhook
+		Secret string `json:"secret"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*webhookRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		if problems := validWebhook(data); len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		secret, err := security.GenerateSecureToken()
+		if err != nil {
+			logger.For(r.Context()).Error("webhook secret issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		oUserId, _ := primitive.ObjectIDFromHex(userId)
+		webhook := &Webhook{
+			UserID:    oUserId,
+			URL:       data.URL,
+			Events:    data.Events,
+			Secret:    secret.Plain,
+			Active:    true,
+			CreatedAt: time.Now(),
+			UpdatedAt: time.Now(),
+		}
+
+		if err := repo.Create(webhook, r.Context()); err != nil {
+			logger.For(r.Context()).Error("webhooks issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, createResponse{webhook, webhook.Secret}, http.StatusCreated)
+	})
+}
+
+func HandleGet(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		webhook, err := repo.Get(r.PathValue("id"), userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		response.Respond(w, webhook, http.StatusOK)
+	})
+}
+
+// HandleUpdate changes the url and the events of a webhook, and turns it on or off with active.
+// The pending deliveries of an inactive webhook fail.
+func HandleUpdate(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	type updateRequest struct {
+		URL    string   `json:"url" validate:"required"`
+		Events []string `json:"events" validate:"required|array"`
+		Active bool     `json:"active" validate:"boolean"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*updateRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		if problems := validWebhook(&webhookRequest{data.URL, data.Events}); len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		webhook, err := repo.Get(r.PathValue("id"), userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		webhook.URL, webhook.Events, webhook.Active = data.URL, data.Events, data.Active
+		webhook.UpdatedAt = time.Now()
+
+		if err := repo.Update(webhook, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		response.Respond(w, webhook, http.StatusOK)
+	})
+}
+
+func HandleDelete(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		if err := repo.Delete(r.PathValue("id"), userId, r.Context()); err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleDeliveries returns the last deliveries of a webhook with their attempts, newest first.
+func HandleDeliveries(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		limit := defaultDeliveries
+		if value := r.URL.Query().Get("limit"); value != "" {
+			var err error
+			if limit, err = strconv.Atoi(value); err != nil || limit < 1 || limit > maxDeliveries {
+				response.ValidationErr(w, map[string]string{"limit": "between:1," + strconv.Itoa(maxDeliveries)})
+				return
+			}
+		}
+
+		webhook, err := repo.Get(r.PathValue("id"), userId, r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		deliveries, err := repo.Deliveries(webhook.ID, int64(limit), r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("webhook deliveries issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, deliveries, http.StatusOK)
+	})
+}
+
+func HandleDelivery(logger logger.Logger, repo WebhookRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		if _, delivery, ok := loadDelivery(w, r, repo, userId); ok {
+			response.Respond(w, delivery, http.StatusOK)
+		}
+	})
+}
+
+// HandleReplay sends the event of a delivery again, the response is the new delivery.
+func HandleReplay(logger logger.Logger, repo WebhookRepository, dispatcher *Dispatcher) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		webhook, delivery, ok := loadDelivery(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		if !webhook.Active {
+			response.ErrMessage(w, "The webhook is disabled", http.StatusConflict)
+			return
+		}
+
+		replay, err := dispatcher.Replay(delivery, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("webhook replay issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, replay, http.StatusAccepted)
+	})
+}
+
+// loadDelivery returns the webhook of the {id} path value and its delivery of the {deliveryId}
+// path value, or answers the request when they're not found.
+func loadDelivery(w http.ResponseWriter, r *http.Request, repo WebhookRepository, userId string) (*Webhook, *Delivery, bool) {
+	webhook, err := repo.Get(r.PathValue("id"), userId, r.Context())
+	if err != nil {
+		response.RespondErr(w, response.NotFound())
+		return nil, nil, false
+	}
+
+	delivery, err := repo.GetDelivery(r.PathValue("deliveryId"), webhook.ID, r.Context())
+	if err != nil {
+		response.RespondErr(w, response.NotFound())
+		return nil, nil, false
+	}
+
+	return webhook, delivery, true
+}
+
+func validWebhook(data *webhookRequest) map[string]string {
+	problems := map[string]string{}
+
+	// host names resolving to private addresses are refused when the deliveries are sent.
+	if target, err := url.Parse(data.URL); err != nil || target.Host == "" || security.CheckURL(target) != nil {
+		problems["url"] = "url"
+	}
+
+	if len(data.Events) == 0 {
+		problems["events"] = "required"
+	}
+
+	for _, event := range data.Events {
+		if !known(event) {
+			problems["events"] = "in:" + strings.Join(Events, ",")
+		}
+	}
+
+	return problems
+}
+
+func known(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,137 @@
+package webhooks
+
+import (
+	"strconv"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// Events are the event types a webhook subscribes to.
+var Events = []string{
+	"note.created",
+	"note.updated",
+	"note.deleted",
+	"note.shared",
+	"note.unshared",
+	"task.created",
+	"task.updated",
+	"task.completed",
+	"comment.created",
+	"comment.updated",
+	"comment.deleted",
+	"comment.resolved",
+	"comment.unresolved",
+}
+
+// Webhook is an endpoint of a user receiving the events of the notes they can read.
+type Webhook struct {
+	ID     primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	UserID primitive.ObjectID `bson:"user_id" json:"-"`
+	URL    string             `bson:"url" json:"url"`
+	Events []string           `bson:"events" json:"events"`
+	// Secret signs the deliveries, it's only shown when the webhook is created.
+	Secret    string    `bson:"secret" json:"-"`
+	Active    bool      `bson:"active" json:"active"`
+	CreatedAt time.Time `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time `bson:"updated_at" json:"updated_at"`
+}
+
+// Subscribed reports whether the webhook receives events of eventType.
+func (w *Webhook) Subscribed(eventType string) bool {
+	for _, event := range w.Events {
+		if event == eventType {
+			return true
+		}
+	}
+	return false
+}
+
+type DeliveryStatus string
+
+const (
+	DeliveryPending   DeliveryStatus = "pending"
+	DeliverySucceeded DeliveryStatus = "succeeded"
+	DeliveryFailed    DeliveryStatus = "failed"
+)
+
+// Delivery is an event sent to a webhook, with each attempt. A pending delivery is attempted
+// again at NextAttemptAt.
+type Delivery struct {
+	ID        primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	WebhookID primitive.ObjectID `bson:"webhook_id" json:"webhook_id"`
+	UserID    primitive.ObjectID `bson:"user_id" json:"-"`
+	// EventID is the id of the event, a webhook gets each event once.
+	EventID string `bson:"event_id" json:"event_id"`
+	Event   string `bson:"event" json:"event"`
+	// Payload is the json body sent to the webhook.
+	Payload       string             `bson:"payload" json:"payload"`
+	Status        DeliveryStatus     `bson:"status" json:"status"`
+	Attempts      []Attempt          `bson:"attempts" json:"attempts"`
+	NextAttemptAt time.Time          `bson:"next_attempt_at" json:"next_attempt_at"`
+	ReplayOf      primitive.ObjectID `bson:"replay_of,omitempty" json:"replay_of,omitempty"`
+	CreatedAt     time.Time          `bson:"created_at" json:"created_at"`
+}
+
+// Attempt is a request made to deliver an event.
+type Attempt struct {
+	At         time.Time `bson:"at" json:"at"`
+	StatusCode int       `bson:"status_code,omitempty" json:"status_code,omitempty"`
+	Error      string    `bson:"error,omitempty" json:"error,omitempty"`
+	// Response is the beginning of the response body.
+	Response string `bson:"response,omitempty" json:"response,omitempty"`
+	Duration int64  `bson:"duration_ms" json:"duration_ms"`
+}
+
+// Succeeded reports whether the webhook accepted the event.
+func (a Attempt) Succeeded() bool {
+	return a.Error == "" && a.StatusCode >= 200 && a.StatusCode < 300
+}
+
+type Config struct {
+	// Workers is the number of deliveries made at the same time.
+	Workers int
+	// MaxAttempts is the number of attempts before a delivery fails.
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, it doubles after each attempt.
+	Backoff time.Duration
+	// MaxBackoff caps the delay between two attempts.
+	MaxBackoff time.Duration
+	// Timeout is the time a webhook has to answer.
+	Timeout time.Duration
+	// Poll is how often the workers look for the deliveries to retry.
+	Poll time.Duration
+}
+
+var DefaultConfig = Config{
+	Workers:     4,
+	MaxAttempts: 6,
+	Backoff:     30 * time.Second,
+	MaxBackoff:  time.Hour,
+	Timeout:     10 * time.Second,
+	Poll:        5 * time.Second,
+}
+
+// LoadConfig reads WEBHOOK_WORKERS and WEBHOOK_MAX_ATTEMPTS, missing values keep the default.
+func LoadConfig(getEnv func(string) string) Config {
+	config := DefaultConfig
+
+	if workers, err := strconv.Atoi(getEnv("WEBHOOK_WORKERS")); err == nil && workers > 0 {
+		config.Workers = workers
+	}
+
+	if attempts, err := strconv.Atoi(getEnv("WEBHOOK_MAX_ATTEMPTS")); err == nil && attempts > 0 {
+		config.MaxAttempts = attempts
+	}
+
+	return config
+}
+
+// backoff returns the delay before the attempt following the nth one.
+func (c Config) backoff(n int) time.Duration {
+	delay := c.Backoff
+	for i := 1; i < n && delay < c.MaxBackoff; i++ {
+		delay *= 2
+	}
+	return min(delay, c.MaxBackoff)
+}
@@ -0,0 +1,241 @@
+package webhooks
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+type WebhookRepository interface {
+	Create(webhook *Webhook, ctx context.Context) error
+	Get(id, userId string, ctx context.Context) (*Webhook, error)
+	List(userId string, ctx context.Context) ([]*Webhook, error)
+	Update(webhook *Webhook, ctx context.Context) error
+	// Delete deletes a webhook and its deliveries.
+	Delete(id, userId string, ctx context.Context) error
+	// Subscribers returns the active webhooks of the users subscribed to eventType.
+	Subscribers(userIds []string, eventType string, ctx context.Context) ([]*Webhook, error)
+
+	InsertDelivery(delivery *Delivery, ctx context.Context) error
+	GetDelivery(id string, webhookId primitive.ObjectID, ctx context.Context) (*Delivery, error)
+	// Deliveries returns the last deliveries of a webhook, newest first.
+	Deliveries(webhookId primitive.ObjectID, limit int64, ctx context.Context) ([]*Delivery, error)
+	// Claim returns the pending delivery due the longest, and puts its next attempt off by lease so
+	// no other worker takes it meanwhile. It returns nil when no delivery is due.
+	Claim(lease time.Duration, ctx context.Context) (*Delivery, error)
+	// RecordAttempt adds an attempt to the log of a delivery and sets its status.
+	RecordAttempt(id primitive.ObjectID, attempt Attempt, status DeliveryStatus, next time.Time, ctx context.Context) error
+}
+
+type webhookRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) WebhookRepository {
+	return &webhookRepository{client}
+}
+
+func (r *webhookRepository) Create(webhook *Webhook, ctx context.Context) error {
+	result, err := r.client.Collection("webhooks").InsertOne(ctx, webhook)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		webhook.ID = id
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) Get(id, userId string, ctx context.Context) (*Webhook, error) {
+	filter, err := owned(id, userId)
+	if err != nil {
+		return nil, err
+	}
+
+	var webhook *Webhook
+	if err := r.client.Collection("webhooks").FindOne(ctx, filter).Decode(&webhook); err != nil {
+		return nil, err
+	}
+
+	return webhook, nil
+}
+
+func (r *webhookRepository) List(userId string, ctx context.Context) ([]*Webhook, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return r.find(bson.M{"user_id": oUserId}, ctx)
+}
+
+func (r *webhookRepository) Update(webhook *Webhook, ctx context.Context) error {
+	update := bson.M{"$set": bson.M{
+		"url":        webhook.URL,
+		"events":     webhook.Events,
+		"active":     webhook.Active,
+		"updated_at": webhook.UpdatedAt,
+	}}
+
+	result, err := r.client.Collection("webhooks").UpdateOne(ctx, bson.M{"_id": webhook.ID, "user_id": webhook.UserID}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) Delete(id, userId string, ctx context.Context) error {
+	filter, err := owned(id, userId)
+	if err != nil {
+		return err
+	}
+
+	result, err := r.client.Collection("webhooks").DeleteOne(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	if result.DeletedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	_, err = r.client.Collection("webhook_deliveries").DeleteMany(ctx, bson.M{"webhook_id": filter["_id"]})
+	return err
+}
+
+func (r *webhookRepository) Subscribers(userIds []string, eventType string, ctx context.Context) ([]*Webhook, error) {
+	users := bson.A{}
+	for _, userId := range userIds {
+		if oUserId, err := primitive.ObjectIDFromHex(userId); err == nil {
+			users = append(users, oUserId)
+		}
+	}
+
+	if len(users) == 0 {
+		return []*Webhook{}, nil
+	}
+
+	return r.find(bson.M{"user_id": bson.M{"$in": users}, "active": true, "events": eventType}, ctx)
+}
+
+func (r *webhookRepository) find(filter bson.M, ctx context.Context) ([]*Webhook, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}})
+
+	cursor, err := r.client.Collection("webhooks").Find(ctx, filter, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	webhooks := []*Webhook{}
+	if err = cursor.All(ctx, &webhooks); err != nil {
+		return nil, err
+	}
+
+	return webhooks, nil
+}
+
+func (r *webhookRepository) InsertDelivery(delivery *Delivery, ctx context.Context) error {
+	result, err := r.client.Collection("webhook_deliveries").InsertOne(ctx, delivery)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		delivery.ID = id
+	}
+
+	return nil
+}
+
+func (r *webhookRepository) GetDelivery(id string, webhookId primitive.ObjectID, ctx context.Context) (*Delivery, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var delivery *Delivery
+	filter := bson.M{"_id": oId, "webhook_id": webhookId}
+	if err := r.client.Collection("webhook_deliveries").FindOne(ctx, filter).Decode(&delivery); err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (r *webhookRepository) Deliveries(webhookId primitive.ObjectID, limit int64, ctx context.Context) ([]*Delivery, error) {
+	findOptions := options.Find().SetSort(bson.D{{Key: "_id", Value: -1}}).SetLimit(limit)
+
+	cursor, err := r.client.Collection("webhook_deliveries").Find(ctx, bson.M{"webhook_id": webhookId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	deliveries := []*Delivery{}
+	if err = cursor.All(ctx, &deliveries); err != nil {
+		return nil, err
+	}
+
+	return deliveries, nil
+}
+
+func (r *webhookRepository) Claim(lease time.Duration, ctx context.Context) (*Delivery, error) {
+	now := time.Now()
+
+	filter := bson.M{"status": DeliveryPending, "next_attempt_at": bson.M{"$lte": now}}
+	update := bson.M{"$set": bson.M{"next_attempt_at": now.Add(lease)}}
+	opts := options.FindOneAndUpdate().
+		SetSort(bson.D{{Key: "next_attempt_at", Value: 1}}).
+		SetReturnDocument(options.After)
+
+	var delivery *Delivery
+	err := r.client.Collection("webhook_deliveries").FindOneAndUpdate(ctx, filter, update, opts).Decode(&delivery)
+	if err == mongo.ErrNoDocuments {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return delivery, nil
+}
+
+func (r *webhookRepository) RecordAttempt(id primitive.ObjectID, attempt Attempt, status DeliveryStatus, next time.Time, ctx context.Context) error {
+	update := bson.M{
+		"$push": bson.M{"attempts": attempt},
+		"$set":  bson.M{"status": status, "next_attempt_at": next},
+	}
+
+	_, err := r.client.Collection("webhook_deliveries").UpdateOne(ctx, bson.M{"_id": id}, update)
+	return err
+}
+
+// owned is the filter of a webhook of the user.
+func owned(id, userId string) (bson.M, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	return bson.M{"_id": oId, "user_id": oUserId}, nil
+}
@@ -0,0 +1,42 @@
+package webhooks
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"strconv"
+	"time"
+)
+
+// The headers of a delivery. The signature is "sha256=" followed by the hex HMAC-SHA256 of
+// "<timestamp>.<body>" keyed with the secret of the webhook.
+const (
+	HeaderEvent     = "X-Memo-Event"
+	HeaderDelivery  = "X-Memo-Delivery"
+	HeaderTimestamp = "X-Memo-Timestamp"
+	HeaderSignature = "X-Memo-Signature"
+)
+
+// Sign returns the signature of a body sent at timestamp (unix seconds).
+func Sign(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(body)
+
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the one of the body, for the receivers of the webhooks.
+// Deliveries older than tolerance are refused to prevent replays.
+func Verify(secret, timestamp, signature string, body []byte, tolerance time.Duration) bool {
+	sent, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+
+	if age := time.Since(time.Unix(sent, 0)); age > tolerance || age < -tolerance {
+		return false
+	}
+
+	return hmac.Equal([]byte(Sign(secret, sent, body)), []byte(signature))
+}
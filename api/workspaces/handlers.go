@@ -0,0 +1,375 @@
+package workspaces
+
+import (
+	"net/http"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/auth"
+	"memo/api/notes/models"
+	"memo/api/notifications"
+	"memo/pkg/logger"
+	"memo/pkg/response"
+	"memo/pkg/validation"
+)
+
+type workspaceRequest struct {
+	Name string `json:"name" validate:"required"`
+}
+
+// HandleList lists the workspaces the user is a member of.
+func HandleList(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		workspaces, err := repo.ForUser(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, workspaces, http.StatusOK)
+	})
+}
+
+// HandleCreate creates a workspace owned by the user.
+func HandleCreate(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*workspaceRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		ownerId, err := primitive.ObjectIDFromHex(userId)
+		if err != nil {
+			response.RespondErr(w, response.Unauthorized())
+			return
+		}
+
+		workspace := &Workspace{Name: strings.TrimSpace(data.Name), OwnerID: ownerId}
+		if err := repo.Create(workspace, r.Context()); err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, workspace, http.StatusCreated)
+	})
+}
+
+// HandleGet returns a workspace and its members, to its members.
+func HandleGet(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		workspace, _, ok := member(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		response.Respond(w, workspace, http.StatusOK)
+	})
+}
+
+// HandleRename renames a workspace, for its owner and admins.
+func HandleRename(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*workspaceRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		workspace, role, ok := member(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		if !role.CanManage() {
+			response.ErrMessage(w, "Only the owner and admins can manage this workspace", http.StatusForbidden)
+			return
+		}
+
+		workspace.Name = strings.TrimSpace(data.Name)
+		if err := repo.Rename(workspace.ID, workspace.Name, r.Context()); err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, workspace, http.StatusOK)
+	})
+}
+
+// HandleDelete deletes a workspace, only its owner can. The notes go back to their authors.
+func HandleDelete(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		workspace, role, ok := member(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		if role != models.RoleOwner {
+			response.ErrMessage(w, "Only the owner can delete this workspace", http.StatusForbidden)
+			return
+		}
+
+		if err := repo.Delete(workspace, r.Context()); err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.RespondSuccess(w)
+	})
+}
+
+// HandleInvite invites a registered user to a workspace by email, they become a member once they
+// accept. The owner invites admins, editors and viewers, admins invite editors and viewers.
+func HandleInvite(logger logger.Logger, repo WorkspaceRepository, users auth.AuthStore, notifier notifications.Notifier) http.HandlerFunc {
+	type memberRequest struct {
+		Email string      `json:"email" validate:"required|email"`
+		Role  models.Role `json:"role" validate:"required|in:admin,editor,viewer"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*memberRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		workspace, role, ok := member(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		if !canManage(role, data.Role) {
+			response.ErrMessage(w, "You can't add a member with this role", http.StatusForbidden)
+			return
+		}
+
+		user, err := users.GetUserByEmail(strings.ToLower(strings.TrimSpace(data.Email)), r.Context())
+		if err != nil {
+			response.ErrMessage(w, "No user is registered with this email", http.StatusNotFound)
+			return
+		}
+
+		workspace, err = repo.Invite(workspace.ID, models.Member{UserID: user.ID, Role: data.Role}, r.Context())
+		if err != nil {
+			response.ErrMessage(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		notifier.Notify(notifications.Notice{
+			UserID: user.ID.Hex(),
+			Kind:   notifications.KindWorkspaceInvited,
+			Data: map[string]string{
+				"workspace_id": workspace.ID.Hex(),
+				"name":         workspace.Name,
+				"role":         string(data.Role),
+			},
+		}, r.Context())
+
+		response.Respond(w, workspace, http.StatusCreated)
+	})
+}
+
+// HandleInvitations lists the workspaces the user is invited to.
+func HandleInvitations(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		workspaces, err := repo.InvitedTo(userId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, workspaces, http.StatusOK)
+	})
+}
+
+// HandleRespond accepts or declines the invitation of the user to a workspace, accepting it makes
+// them a member with the role they were invited with.
+func HandleRespond(logger logger.Logger, repo WorkspaceRepository, accept bool) http.HandlerFunc {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		workspace, err := repo.Get(r.PathValue("id"), r.Context())
+		if err != nil {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if _, ok := workspace.InvitedAs(userId); !ok {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		oUserId, _ := primitive.ObjectIDFromHex(userId)
+
+		if !accept {
+			if _, err := repo.Uninvite(workspace.ID, oUserId, r.Context()); err != nil {
+				logger.For(r.Context()).Error("workspace issue", "error", err)
+				response.RespondErr(w, response.InternalServerError())
+				return
+			}
+
+			response.RespondSuccess(w)
+			return
+		}
+
+		workspace, err = repo.AddMember(workspace.ID, oUserId, r.Context())
+		if err != nil {
+			response.ErrMessage(w, err.Error(), http.StatusConflict)
+			return
+		}
+
+		response.Respond(w, workspace, http.StatusOK)
+	})
+}
+
+// HandleChangeRole changes the role of a member, the owner's role can't change.
+func HandleChangeRole(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	type roleRequest struct {
+		Role models.Role `json:"role" validate:"required|in:admin,editor,viewer"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		data, problems := validation.DecodeValid[*roleRequest](r)
+		if len(problems) > 0 {
+			response.ValidationErr(w, problems)
+			return
+		}
+
+		workspace, role, ok := member(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		memberId := r.PathValue("userId")
+		current, ok := workspace.Role(memberId)
+		if !ok {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		if !canManage(role, current) || !canManage(role, data.Role) {
+			response.ErrMessage(w, "You can't change the role of this member", http.StatusForbidden)
+			return
+		}
+
+		oMemberId, _ := primitive.ObjectIDFromHex(memberId)
+		workspace, err := repo.SetRole(workspace.ID, oMemberId, data.Role, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, workspace, http.StatusOK)
+	})
+}
+
+// HandleRemoveMember removes a member from a workspace, or lets a member leave it. The owner
+// can't leave, they delete the workspace instead. The notes the member wrote in the workspace
+// stay in it and are given to its owner, the response tells how many. The invitation of a user
+// who didn't answer it yet is canceled the same way.
+func HandleRemoveMember(logger logger.Logger, repo WorkspaceRepository) http.HandlerFunc {
+	type removeResponse struct {
+		Message    string `json:"message"`
+		OwnerID    string `json:"owner_id"`
+		NotesGiven int    `json:"notes_given"`
+	}
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		userId := r.Context().Value("user").(string)
+
+		workspace, role, ok := member(w, r, repo, userId)
+		if !ok {
+			return
+		}
+
+		memberId := r.PathValue("userId")
+		oMemberId, _ := primitive.ObjectIDFromHex(memberId)
+
+		if invited, ok := workspace.InvitedAs(memberId); ok {
+			if !canManage(role, invited) {
+				response.ErrMessage(w, "You can't remove this member", http.StatusForbidden)
+				return
+			}
+
+			if _, err := repo.Uninvite(workspace.ID, oMemberId, r.Context()); err != nil {
+				logger.For(r.Context()).Error("workspace issue", "error", err)
+				response.RespondErr(w, response.InternalServerError())
+				return
+			}
+
+			response.RespondSuccess(w)
+			return
+		}
+
+		current, ok := workspace.Role(memberId)
+		if !ok {
+			response.RespondErr(w, response.NotFound())
+			return
+		}
+
+		leaving := memberId == userId
+		if leaving && current == models.RoleOwner {
+			response.ErrMessage(w, "The owner can't leave the workspace", http.StatusBadRequest)
+			return
+		}
+
+		if !leaving && !canManage(role, current) {
+			response.ErrMessage(w, "You can't remove this member", http.StatusForbidden)
+			return
+		}
+
+		_, given, err := repo.RemoveMember(workspace.ID, oMemberId, r.Context())
+		if err != nil {
+			logger.For(r.Context()).Error("workspace issue", "error", err)
+			response.RespondErr(w, response.InternalServerError())
+			return
+		}
+
+		response.Respond(w, removeResponse{
+			Message:    "The notes the member wrote in the workspace were given to its owner",
+			OwnerID:    workspace.OwnerID.Hex(),
+			NotesGiven: given,
+		}, http.StatusOK)
+	})
+}
+
+// member loads the workspace of the request and the role of the user in it, the workspaces of
+// the others are not found.
+func member(w http.ResponseWriter, r *http.Request, repo WorkspaceRepository, userId string) (*Workspace, models.Role, bool) {
+	workspace, err := repo.Get(r.PathValue("id"), r.Context())
+	if err != nil {
+		response.RespondErr(w, response.NotFound())
+		return nil, "", false
+	}
+
+	role, ok := workspace.Role(userId)
+	if !ok {
+		response.RespondErr(w, response.NotFound())
+		return nil, "", false
+	}
+
+	return workspace, role, true
+}
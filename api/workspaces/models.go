@@ -0,0 +1,54 @@
+package workspaces
+
+import (
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+
+	"memo/api/notes/models"
+)
+
+// Workspace groups the notes of a team, its members access them according to their role.
+type Workspace struct {
+	ID      primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Name    string             `bson:"name" json:"name"`
+	OwnerID primitive.ObjectID `bson:"owner_id" json:"owner_id"`
+	Members []models.Member    `bson:"members" json:"members"`
+	// Invited are the users asked to join with a role, they become members once they accept.
+	Invited   []models.Member `bson:"invited" json:"invited"`
+	CreatedAt time.Time       `bson:"created_at" json:"created_at"`
+	UpdatedAt time.Time       `bson:"updated_at" json:"updated_at"`
+}
+
+// Role returns the role of the user, if they're a member.
+func (w *Workspace) Role(userId string) (models.Role, bool) {
+	for _, member := range w.Members {
+		if member.UserID.Hex() == userId {
+			return member.Role, true
+		}
+	}
+	return "", false
+}
+
+// InvitedAs returns the role the user is invited with, if they're invited.
+func (w *Workspace) InvitedAs(userId string) (models.Role, bool) {
+	for _, invited := range w.Invited {
+		if invited.UserID.Hex() == userId {
+			return invited.Role, true
+		}
+	}
+	return "", false
+}
+
+// canManage reports whether a member with the role actor adds, changes or removes a member with
+// the role target: the owner manages everyone else, admins manage the editors and viewers.
+func canManage(actor, target models.Role) bool {
+	switch actor {
+	case models.RoleOwner:
+		return target != models.RoleOwner
+	case models.RoleAdmin:
+		return target == models.RoleEditor || target == models.RoleViewer
+	default:
+		return false
+	}
+}
@@ -0,0 +1,354 @@
+package workspaces
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+
+	"memo/api/notes/models"
+	"memo/api/notes/repository"
+)
+
+type WorkspaceRepository interface {
+	// Create inserts the workspace with its owner as the only member.
+	Create(workspace *Workspace, ctx context.Context) error
+	Get(id string, ctx context.Context) (*Workspace, error)
+	// ForUser returns the workspaces the user is a member of.
+	ForUser(userId string, ctx context.Context) ([]*Workspace, error)
+	// InvitedTo returns the workspaces the user is invited to.
+	InvitedTo(userId string, ctx context.Context) ([]*Workspace, error)
+	Rename(id primitive.ObjectID, name string, ctx context.Context) error
+	// Delete deletes the workspace, its notes go back to their authors.
+	Delete(workspace *Workspace, ctx context.Context) error
+	// Invite asks a user who isn't a member yet to join with a role.
+	Invite(id primitive.ObjectID, member models.Member, ctx context.Context) (*Workspace, error)
+	// Uninvite cancels or declines the invitation of the user.
+	Uninvite(id, userId primitive.ObjectID, ctx context.Context) (*Workspace, error)
+	// AddMember makes an invited user a member with the role they were invited with.
+	AddMember(id, userId primitive.ObjectID, ctx context.Context) (*Workspace, error)
+	SetRole(id, userId primitive.ObjectID, role models.Role, ctx context.Context) (*Workspace, error)
+	// RemoveMember removes the user, the notes they wrote in the workspace are given to its owner.
+	// It returns the number of notes given.
+	RemoveMember(id, userId primitive.ObjectID, ctx context.Context) (*Workspace, int, error)
+	// Members returns the members of a workspace.
+	Members(id string, ctx context.Context) ([]models.Member, error)
+}
+
+type workspaceRepository struct {
+	client *mongo.Database
+}
+
+func NewRepo(client *mongo.Database) WorkspaceRepository {
+	return &workspaceRepository{client}
+}
+
+func (r *workspaceRepository) Create(workspace *Workspace, ctx context.Context) error {
+	workspace.Members = []models.Member{{UserID: workspace.OwnerID, Role: models.RoleOwner}}
+	workspace.Invited = []models.Member{}
+	workspace.CreatedAt = time.Now()
+	workspace.UpdatedAt = workspace.CreatedAt
+
+	result, err := r.client.Collection("workspaces").InsertOne(ctx, workspace)
+	if err != nil {
+		return err
+	}
+
+	if id, ok := result.InsertedID.(primitive.ObjectID); ok {
+		workspace.ID = id
+	}
+
+	return nil
+}
+
+func (r *workspaceRepository) Get(id string, ctx context.Context) (*Workspace, error) {
+	oId, err := primitive.ObjectIDFromHex(id)
+	if err != nil {
+		return nil, err
+	}
+
+	var workspace *Workspace
+	if err := r.client.Collection("workspaces").FindOne(ctx, bson.M{"_id": oId}).Decode(&workspace); err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+func (r *workspaceRepository) ForUser(userId string, ctx context.Context) ([]*Workspace, error) {
+	return r.find("members.user_id", userId, ctx)
+}
+
+func (r *workspaceRepository) InvitedTo(userId string, ctx context.Context) ([]*Workspace, error) {
+	return r.find("invited.user_id", userId, ctx)
+}
+
+// find returns the workspaces where the user is at key, by name.
+func (r *workspaceRepository) find(key, userId string, ctx context.Context) ([]*Workspace, error) {
+	oUserId, err := primitive.ObjectIDFromHex(userId)
+	if err != nil {
+		return nil, err
+	}
+
+	findOptions := options.Find().SetSort(bson.D{{Key: "name", Value: 1}})
+
+	cursor, err := r.client.Collection("workspaces").Find(ctx, bson.M{key: oUserId}, findOptions)
+	if err != nil {
+		return nil, err
+	}
+
+	defer cursor.Close(ctx)
+
+	workspaces := []*Workspace{}
+	if err = cursor.All(ctx, &workspaces); err != nil {
+		return nil, err
+	}
+
+	return workspaces, nil
+}
+
+func (r *workspaceRepository) Rename(id primitive.ObjectID, name string, ctx context.Context) error {
+	update := bson.M{"$set": bson.M{"name": name, "updated_at": time.Now()}}
+
+	result, err := r.client.Collection("workspaces").UpdateOne(ctx, bson.M{"_id": id}, update)
+	if err != nil {
+		return err
+	}
+
+	if result.MatchedCount == 0 {
+		return fmt.Errorf("no documents matched the filter")
+	}
+
+	return nil
+}
+
+func (r *workspaceRepository) Delete(workspace *Workspace, ctx context.Context) error {
+	err := r.eachNote(workspace.ID, func(note *models.BaseNote) error {
+		version, err := repository.NextVersion(r.client, ctx)
+		if err != nil {
+			return err
+		}
+
+		defer repository.Settle(r.client, version, ctx)
+
+		update := bson.M{
+			"$set":   bson.M{"version": version},
+			"$unset": bson.M{"workspace_id": "", "members": ""},
+		}
+		if _, err := r.client.Collection("notes").UpdateOne(ctx, bson.M{"_id": note.ID}, update); err != nil {
+			return err
+		}
+
+		// the members only keep the notes they wrote or that are shared with them.
+		note.Members = nil
+		return r.bury(note, workspace.Members, ctx)
+	}, ctx)
+	if err != nil {
+		return err
+	}
+
+	_, err = r.client.Collection("workspaces").DeleteOne(ctx, bson.M{"_id": workspace.ID})
+	return err
+}
+
+func (r *workspaceRepository) Invite(id primitive.ObjectID, member models.Member, ctx context.Context) (*Workspace, error) {
+	filter := bson.M{
+		"_id":             id,
+		"members.user_id": bson.M{"$ne": member.UserID},
+		"invited.user_id": bson.M{"$ne": member.UserID},
+	}
+	update := bson.M{
+		"$push": bson.M{"invited": member},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	workspace, err := r.change(filter, update, ctx)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("User is already a member of this workspace or invited to it")
+	}
+
+	return workspace, err
+}
+
+func (r *workspaceRepository) Uninvite(id, userId primitive.ObjectID, ctx context.Context) (*Workspace, error) {
+	filter := bson.M{"_id": id, "invited.user_id": userId}
+	update := bson.M{
+		"$pull": bson.M{"invited": bson.M{"user_id": userId}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	return r.change(filter, update, ctx)
+}
+
+func (r *workspaceRepository) AddMember(id, userId primitive.ObjectID, ctx context.Context) (*Workspace, error) {
+	workspace, err := r.Get(id.Hex(), ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	role, ok := workspace.InvitedAs(userId.Hex())
+	if !ok {
+		return nil, fmt.Errorf("User isn't invited to this workspace")
+	}
+
+	// the invitation is matched with its role, a changed invitation isn't accepted.
+	filter := bson.M{
+		"_id":             id,
+		"invited":         bson.M{"$elemMatch": bson.M{"user_id": userId, "role": role}},
+		"members.user_id": bson.M{"$ne": userId},
+	}
+	update := bson.M{
+		"$pull": bson.M{"invited": bson.M{"user_id": userId}},
+		"$push": bson.M{"members": models.Member{UserID: userId, Role: role}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	workspace, err = r.change(filter, update, ctx)
+	if err == mongo.ErrNoDocuments {
+		return nil, fmt.Errorf("User isn't invited to this workspace")
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.syncNotes(workspace, nil, ctx)
+	return workspace, err
+}
+
+func (r *workspaceRepository) SetRole(id, userId primitive.ObjectID, role models.Role, ctx context.Context) (*Workspace, error) {
+	filter := bson.M{"_id": id, "members.user_id": userId}
+	update := bson.M{"$set": bson.M{"members.$.role": role, "updated_at": time.Now()}}
+
+	workspace, err := r.change(filter, update, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	_, err = r.syncNotes(workspace, nil, ctx)
+	return workspace, err
+}
+
+func (r *workspaceRepository) RemoveMember(id, userId primitive.ObjectID, ctx context.Context) (*Workspace, int, error) {
+	filter := bson.M{"_id": id, "members.user_id": userId}
+	update := bson.M{
+		"$pull": bson.M{"members": bson.M{"user_id": userId}},
+		"$set":  bson.M{"updated_at": time.Now()},
+	}
+
+	workspace, err := r.change(filter, update, ctx)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	given, err := r.syncNotes(workspace, &userId, ctx)
+	return workspace, given, err
+}
+
+func (r *workspaceRepository) Members(id string, ctx context.Context) ([]models.Member, error) {
+	workspace, err := r.Get(id, ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	return workspace.Members, nil
+}
+
+// change updates the workspace matched by filter and returns it.
+func (r *workspaceRepository) change(filter, update bson.M, ctx context.Context) (*Workspace, error) {
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+
+	var workspace *Workspace
+	if err := r.client.Collection("workspaces").FindOneAndUpdate(ctx, filter, update, opts).Decode(&workspace); err != nil {
+		return nil, err
+	}
+
+	return workspace, nil
+}
+
+// syncNotes copies the members of the workspace into its notes. The notes written by a removed
+// member are given to the owner of the workspace, and the removed member gets their tombstones.
+// It returns the number of notes given to the owner.
+func (r *workspaceRepository) syncNotes(workspace *Workspace, removed *primitive.ObjectID, ctx context.Context) (int, error) {
+	given := 0
+
+	err := r.eachNote(workspace.ID, func(note *models.BaseNote) error {
+		// a new version per note puts it in the change feed of the members.
+		version, err := repository.NextVersion(r.client, ctx)
+		if err != nil {
+			return err
+		}
+
+		defer repository.Settle(r.client, version, ctx)
+
+		set := bson.M{"members": workspace.Members, "version": version}
+		if removed != nil && note.UserId == *removed {
+			set["user_id"] = workspace.OwnerID
+			note.UserId = workspace.OwnerID
+			given++
+		}
+
+		if _, err := r.client.Collection("notes").UpdateOne(ctx, bson.M{"_id": note.ID}, bson.M{"$set": set}); err != nil {
+			return err
+		}
+
+		if removed == nil {
+			return nil
+		}
+
+		note.Members = workspace.Members
+		return r.bury(note, []models.Member{{UserID: *removed}}, ctx)
+	}, ctx)
+
+	return given, err
+}
+
+// bury leaves a tombstone of note for the members who can't read it anymore.
+func (r *workspaceRepository) bury(note *models.BaseNote, members []models.Member, ctx context.Context) error {
+	readers := map[primitive.ObjectID]bool{}
+	for _, userId := range note.Readers() {
+		readers[userId] = true
+	}
+
+	users := []primitive.ObjectID{}
+	for _, member := range members {
+		if !readers[member.UserID] {
+			users = append(users, member.UserID)
+		}
+	}
+
+	if len(users) == 0 {
+		return nil
+	}
+
+	return repository.Bury(r.client, note.ID, users, ctx)
+}
+
+// eachNote calls fn with the notes of the workspace, without their type specific documents.
+func (r *workspaceRepository) eachNote(id primitive.ObjectID, fn func(note *models.BaseNote) error, ctx context.Context) error {
+	findOptions := options.Find().SetProjection(bson.M{"user_id": 1, "shared_with": 1})
+
+	cursor, err := r.client.Collection("notes").Find(ctx, bson.M{"workspace_id": id}, findOptions)
+	if err != nil {
+		return err
+	}
+
+	defer cursor.Close(ctx)
+
+	for cursor.Next(ctx) {
+		var note *models.BaseNote
+		if err := cursor.Decode(&note); err != nil {
+			return err
+		}
+
+		if err := fn(note); err != nil {
+			return err
+		}
+	}
+
+	return cursor.Err()
+}
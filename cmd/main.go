@@ -8,11 +8,33 @@ import (
 	"log"
 
 	"memo/api"
+	"memo/api/attachments"
+	"memo/api/audit"
 	"memo/api/auth"
+	"memo/api/backlinks"
+	"memo/api/collab"
+	"memo/api/comments"
+	"memo/api/export"
+	"memo/api/imports"
+	"memo/api/notes"
+	"memo/api/notes/bookmark"
+	"memo/api/notes/metadata"
+	"memo/api/notes/models"
 	"memo/api/notes/repository"
+	"memo/api/notes/types"
+	"memo/api/notesync"
+	"memo/api/notifications"
+	"memo/api/publiclinks"
 	"memo/api/share"
+	"memo/api/stream"
+	"memo/api/templates"
+	"memo/api/webhooks"
+	"memo/api/workspaces"
+	"memo/pkg/avatar"
 	"memo/pkg/database"
+	"memo/pkg/events"
 	"memo/pkg/logger"
+	"memo/pkg/storage"
 
 	"net"
 	"net/http"
@@ -32,7 +54,7 @@ func run(ctx context.Context, _ io.Reader, out, stderr io.Writer) error {
 	ctx, cancel := signal.NotifyContext(ctx, os.Interrupt)
 	defer cancel()
 
-	logger := logger.New(out)
+	logger := logger.New(out, logger.LoadConfig(getEnv))
 
 	db, err := database.New(getEnv)
 	if err != nil {
@@ -41,13 +63,129 @@ func run(ctx context.Context, _ io.Reader, out, stderr io.Writer) error {
 
 	defer database.Close(db)
 
+	var movies metadata.MetadataProvider = metadata.NopProvider{}
+	if path := getEnv("MOVIE_DATASET"); path != "" {
+		if movies, err = metadata.NewTSVProvider(path); err != nil {
+			return err
+		}
+	}
+
+	blobs, err := storage.New(getEnv)
+	if err != nil {
+		return err
+	}
+
+	attachmentRepo := attachments.NewRepo(db)
+	attachmentService := attachments.NewService(attachmentRepo, blobs, attachments.LoadConfig(getEnv))
+
+	// EVENTS_BACKEND=mongo shares the events between instances.
+	backend := events.NewMemoryBackend()
+	if getEnv("EVENTS_BACKEND") == "mongo" {
+		if backend, err = events.NewMongoBackend(db, ctx); err != nil {
+			return err
+		}
+	}
+
+	hub := events.NewHub(backend)
+	go hub.Run(ctx)
+
+	// the events published here are delivered to the webhooks by a pool of workers.
+	webhookRepo := webhooks.NewRepo(db)
+	dispatcher := webhooks.NewDispatcher(logger, webhookRepo, nil, webhooks.LoadConfig(getEnv))
+	hub.Tap(dispatcher.Tap)
+
+	notesRepo := repository.NewNotes(db)
+	publisher := stream.NewPublisher(logger, hub, notesRepo)
+	notificationRepo := notifications.NewRepo(db)
+	auditRepo := audit.NewRepo(db)
+	auditLog := audit.NewLog(logger, auditRepo)
+
+	linkRepo := backlinks.NewRepo(db)
+	publicLinkRepo := publiclinks.NewRepo(db)
+	commentRepo := comments.NewRepo(db)
+	invitationRepo := share.NewInvitationRepo(db)
+	indexer := backlinks.NewIndexer(linkRepo, models.Types)
+	noteRepo := repository.WithHooks(
+		notesRepo,
+		logger,
+		indexer,
+		attachmentService,
+		publiclinks.NewCleaner(publicLinkRepo),
+		comments.NewCleaner(commentRepo),
+		share.NewCleaner(invitationRepo),
+		notes.NewAuditor(auditLog),
+		publisher,
+	)
+	indexer.Use(noteRepo)
+
+	// note templates, a new type of note only needs to be registered here.
+	models.Types.Register(
+		types.Text(),
+		types.Todo(),
+		types.Movie(logger, movies),
+		types.Link(logger, bookmark.NewHTTPFetcher(nil), noteRepo),
+	)
+
+	// imports left running by a previous process can't resume.
+	importRepo := imports.NewRepo(db)
+	if err := importRepo.FailRunning(ctx); err != nil {
+		return err
+	}
+
+	todoRepo := repository.NewTodoNotes(db, models.Types)
+
+	// the text edited together is saved into the notes periodically.
+	collabs := collab.NewManager(logger, noteRepo, models.Types, collab.LoadConfig(getEnv))
+
 	di := api.DI{
 		Logger:    logger,
-		NoteRepo:  repository.NewNotes(db),
-		TodoRepo:  repository.NewTodoNotes(db),
-		MovieRepo: repository.NewMovieNotes(db),
+		NoteRepo:  noteRepo,
+		TodoRepo:  todoRepo,
+		Movies:    movies,
+		NoteTypes: models.Types,
 		ShareRepo: share.NewShareRepo(db),
+		LinkRepo:  linkRepo,
 		AuthStore: auth.NewStore(auth.NewRepo(db)),
+
+		Transactor: database.NewTransactor(db, ctx),
+
+		InvitationRepo: invitationRepo,
+		WorkspaceRepo:  workspaces.NewRepo(db),
+
+		Events:    hub,
+		Publisher: publisher,
+		Collab:    collabs,
+
+		AttachmentRepo: attachmentRepo,
+		Attachments:    attachmentService,
+
+		TemplateRepo: templates.NewRepo(db),
+
+		CommentRepo: commentRepo,
+
+		NotificationRepo: notificationRepo,
+		Notifier:         notifications.NewInbox(logger, notificationRepo, hub),
+
+		WebhookRepo: webhookRepo,
+		Webhooks:    dispatcher,
+
+		AuditRepo: auditRepo,
+		Audit:     auditLog,
+
+		PublicLinkRepo: publicLinkRepo,
+		PublicLinks:    publiclinks.LoadConfig(getEnv),
+
+		Syncer: notesync.NewSyncer(logger, noteRepo, todoRepo, models.Types, publisher),
+
+		Exporter:   export.NewExporter(noteRepo, attachmentRepo, attachmentService),
+		ImportRepo: importRepo,
+		Importer:   imports.NewImporter(logger, importRepo, noteRepo, models.Types, imports.LoadConfig(getEnv)),
+	}
+
+	di.Avatars = avatar.DefaultConfig
+	di.Avatars.BaseURL = getEnv("PUBLIC_URL") + di.Avatars.BaseURL
+	if format := getEnv("AVATAR_FORMAT"); format != "" {
+		di.Avatars.Format = format
 	}
 
 	srv := api.New(di)
@@ -66,6 +204,20 @@ func run(ctx context.Context, _ io.Reader, out, stderr io.Writer) error {
 	}()
 
 	var wg sync.WaitGroup
+
+	// the edited notes are saved before exiting.
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		collabs.Run(ctx)
+	}()
+
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		dispatcher.Run(ctx)
+	}()
+
 	wg.Add(1)
 	go func() {
 		defer wg.Done()
@@ -0,0 +1,178 @@
+package avatar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"golang.org/x/image/draw"
+)
+
+type Variant struct {
+	Size int    `bson:"size" json:"size"`
+	URL  string `bson:"url" json:"url"`
+	Path string `bson:"path" json:"-"`
+}
+
+type Config struct {
+	// Dir is where the variants are written, BaseURL is the public url of Dir.
+	Dir     string
+	BaseURL string
+	Sizes   []int
+	// Format is "png" or "jpeg".
+	Format string
+}
+
+var DefaultConfig = Config{
+	Dir:     "public/images/avatars",
+	BaseURL: "/public/images/avatars",
+	Sizes:   []int{64, 128, 256},
+	Format:  "png",
+}
+
+// Generate crops the image at src to a centered square and writes it in every configured size.
+// Names are derived from owner and the source content, so the same image always has
+// the same urls and they can be cached forever.
+func Generate(src, owner string, config Config) ([]Variant, error) {
+	data, err := os.ReadFile(src)
+	if err != nil {
+		return nil, err
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, err
+	}
+
+	if err := os.MkdirAll(config.Dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	h := sha256.New()
+	h.Write([]byte(owner + "\x00"))
+	h.Write(data)
+	hash := hex.EncodeToString(h.Sum(nil)[:8])
+
+	ext := "png"
+	if config.Format == "jpeg" {
+		ext = "jpg"
+	}
+
+	square := crop(img)
+	variants := []Variant{}
+
+	for _, size := range config.Sizes {
+		name := fmt.Sprintf("%s-%d.%s", hash, size, ext)
+		variant := Variant{
+			Size: size,
+			URL:  strings.TrimSuffix(config.BaseURL, "/") + "/" + name,
+			Path: filepath.Join(config.Dir, name),
+		}
+
+		if err := write(variant.Path, resize(square, size), config.Format); err != nil {
+			Remove(variants)
+			return nil, err
+		}
+
+		variants = append(variants, variant)
+	}
+
+	return variants, nil
+}
+
+// Remove deletes the files of variants, files already gone are ignored.
+// Files also listed in keep are left in place.
+func Remove(variants []Variant, keep ...Variant) error {
+	kept := make(map[string]bool)
+	for _, v := range keep {
+		kept[v.Path] = true
+	}
+
+	var errs []error
+	for _, v := range variants {
+		if kept[v.Path] {
+			continue
+		}
+
+		if err := os.Remove(v.Path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			errs = append(errs, err)
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Largest returns the url of the biggest variant.
+func Largest(variants []Variant) string {
+	url, size := "", 0
+	for _, v := range variants {
+		if v.Size > size {
+			url, size = v.URL, v.Size
+		}
+	}
+
+	return url
+}
+
+func crop(img image.Image) image.Image {
+	b := img.Bounds()
+	side := min(b.Dx(), b.Dy())
+
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	square := image.NewNRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x, y), draw.Src)
+
+	return square
+}
+
+func resize(img image.Image, size int) image.Image {
+	if img.Bounds().Dx() == size {
+		return img
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, size, size))
+	draw.CatmullRom.Scale(dst, dst.Bounds(), img, img.Bounds(), draw.Src, nil)
+
+	return dst
+}
+
+func write(path string, img image.Image, format string) error {
+	// same name means same content, nothing to do.
+	if _, err := os.Stat(path); err == nil {
+		return nil
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".avatar-*")
+	if err != nil {
+		return err
+	}
+
+	defer os.Remove(tmp.Name())
+
+	if format == "jpeg" {
+		err = jpeg.Encode(tmp, img, &jpeg.Options{Quality: 90})
+	} else {
+		err = png.Encode(tmp, img)
+	}
+
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+
+	if err != nil {
+		return err
+	}
+
+	return os.Rename(tmp.Name(), path)
+}
@@ -0,0 +1,328 @@
+// Package crdt holds a replicated text document (an RGA, replicated growable array).
+// Replicas that applied the same operations have the same text, whatever the order they got them in,
+// so concurrent edits merge without a central lock.
+package crdt
+
+import (
+	"errors"
+	"strings"
+)
+
+var (
+	ErrUnknownID = errors.New("The operation refers to an unknown character")
+	ErrInvalidOp = errors.New("Invalid operation")
+)
+
+// ID identifies a character. The clock is a Lamport clock, the site is the replica that inserted it.
+type ID struct {
+	Clock uint64 `json:"clock"`
+	Site  string `json:"site"`
+}
+
+func (id ID) IsZero() bool {
+	return id.Clock == 0 && id.Site == ""
+}
+
+// Less orders the ids, concurrent inserts at the same place are sorted by descending id.
+func (id ID) Less(other ID) bool {
+	if id.Clock != other.Clock {
+		return id.Clock < other.Clock
+	}
+	return id.Site < other.Site
+}
+
+// Element is a character of the document, deleted characters are kept as tombstones
+// because later operations can refer to them.
+type Element struct {
+	ID ID `json:"id"`
+	// Origin is the character it was inserted after, zero for the start of the document.
+	Origin  ID     `json:"origin"`
+	Value   string `json:"value"`
+	Deleted bool   `json:"deleted,omitempty"`
+}
+
+const (
+	OpInsert = "insert"
+	OpDelete = "delete"
+)
+
+// Op is an insert of text after Origin, its characters get ids from ID on with increasing clocks,
+// or a delete of the Targets.
+type Op struct {
+	Type    string `json:"type"`
+	ID      ID     `json:"id"`
+	Origin  ID     `json:"origin"`
+	Text    string `json:"text,omitempty"`
+	Targets []ID   `json:"targets,omitempty"`
+}
+
+type Doc struct {
+	elements []*Element
+	byID     map[ID]*Element
+	clock    uint64
+}
+
+func New() *Doc {
+	return &Doc{byID: make(map[ID]*Element)}
+}
+
+// FromText returns a document holding text, inserted by site.
+func FromText(site, text string) *Doc {
+	doc := New()
+	if text != "" {
+		doc.Insert(site, 0, text)
+	}
+	return doc
+}
+
+// FromElements rebuilds a document from the elements of another one.
+func FromElements(elements []Element) (*Doc, error) {
+	doc := New()
+
+	for _, e := range elements {
+		if e.ID.IsZero() || doc.byID[e.ID] != nil {
+			return nil, ErrInvalidOp
+		}
+
+		if !e.Origin.IsZero() && e.ID.Clock <= e.Origin.Clock {
+			return nil, ErrInvalidOp
+		}
+
+		if !e.Origin.IsZero() && doc.byID[e.Origin] == nil {
+			return nil, ErrUnknownID
+		}
+
+		element := e
+		doc.elements = append(doc.elements, &element)
+		doc.byID[e.ID] = &element
+		doc.tick(e.ID.Clock)
+	}
+
+	return doc, nil
+}
+
+// Clock is the highest clock seen, the next local operation uses a greater one.
+func (d *Doc) Clock() uint64 {
+	return d.clock
+}
+
+func (d *Doc) Text() string {
+	var b strings.Builder
+	for _, e := range d.elements {
+		if !e.Deleted {
+			b.WriteString(e.Value)
+		}
+	}
+	return b.String()
+}
+
+// Len is the number of visible characters.
+func (d *Doc) Len() int {
+	n := 0
+	for _, e := range d.elements {
+		if !e.Deleted {
+			n++
+		}
+	}
+	return n
+}
+
+// Elements returns a copy of the document state, tombstones included.
+func (d *Doc) Elements() []Element {
+	elements := make([]Element, 0, len(d.elements))
+	for _, e := range d.elements {
+		elements = append(elements, *e)
+	}
+	return elements
+}
+
+// Apply integrates an operation made by any replica. Operations already applied are ignored.
+func (d *Doc) Apply(op Op) error {
+	switch op.Type {
+	case OpInsert:
+		return d.insert(op)
+	case OpDelete:
+		return d.delete(op)
+	default:
+		return ErrInvalidOp
+	}
+}
+
+func (d *Doc) insert(op Op) error {
+	if op.Text == "" || op.ID.Site == "" || op.ID.Clock == 0 {
+		return ErrInvalidOp
+	}
+
+	// the clock of a character is greater than the one of the character it follows.
+	if !op.Origin.IsZero() && op.ID.Clock <= op.Origin.Clock {
+		return ErrInvalidOp
+	}
+
+	if !op.Origin.IsZero() && d.byID[op.Origin] == nil {
+		return ErrUnknownID
+	}
+
+	runes := []rune(op.Text)
+	run := make([]*Element, len(runes))
+
+	origin, known := op.Origin, 0
+	for i, r := range runes {
+		id := ID{Clock: op.ID.Clock + uint64(i), Site: op.ID.Site}
+		if d.byID[id] != nil {
+			known++
+		}
+
+		run[i] = &Element{ID: id, Origin: origin, Value: string(r)}
+		origin = id
+	}
+
+	// an operation is applied whole, some of its ids already known means it conflicts with another one.
+	switch known {
+	case 0:
+		d.integrate(run)
+		return nil
+	case len(run):
+		return nil
+	default:
+		return ErrInvalidOp
+	}
+}
+
+// integrate places the characters of an insert after their origin, concurrent inserts at the same
+// place are ordered by descending id. The characters after the origin with a greater id were
+// inserted concurrently or after them, they stay first. Each character of the run has a greater
+// id than the characters that follow the previous one, so the run is placed as one block.
+func (d *Doc) integrate(run []*Element) {
+	first := run[0]
+
+	pos := 0
+	if !first.Origin.IsZero() {
+		pos = d.index(first.Origin) + 1
+	}
+
+	for pos < len(d.elements) && first.ID.Less(d.elements[pos].ID) {
+		pos++
+	}
+
+	d.elements = append(d.elements, run...)
+	copy(d.elements[pos+len(run):], d.elements[pos:])
+	copy(d.elements[pos:], run)
+
+	for _, e := range run {
+		d.byID[e.ID] = e
+	}
+	d.tick(run[len(run)-1].ID.Clock)
+}
+
+func (d *Doc) delete(op Op) error {
+	if len(op.Targets) == 0 {
+		return ErrInvalidOp
+	}
+
+	for _, id := range op.Targets {
+		if d.byID[id] == nil {
+			return ErrUnknownID
+		}
+	}
+
+	for _, id := range op.Targets {
+		d.byID[id].Deleted = true
+	}
+
+	return nil
+}
+
+// Insert inserts text at the visible position pos and returns the operation to send to the other replicas.
+func (d *Doc) Insert(site string, pos int, text string) (Op, error) {
+	if pos < 0 || pos > d.Len() {
+		return Op{}, ErrInvalidOp
+	}
+
+	op := Op{
+		Type:   OpInsert,
+		ID:     ID{Clock: d.clock + 1, Site: site},
+		Origin: d.Anchor(pos),
+		Text:   text,
+	}
+
+	return op, d.Apply(op)
+}
+
+// Delete deletes length characters from the visible position pos.
+func (d *Doc) Delete(pos, length int) (Op, error) {
+	if pos < 0 || length <= 0 || pos+length > d.Len() {
+		return Op{}, ErrInvalidOp
+	}
+
+	op := Op{Type: OpDelete}
+
+	i := 0
+	for _, e := range d.elements {
+		if e.Deleted {
+			continue
+		}
+
+		if i >= pos && i < pos+length {
+			op.Targets = append(op.Targets, e.ID)
+		}
+		i++
+	}
+
+	return op, d.Apply(op)
+}
+
+// Anchor returns the id of the visible character before pos, zero for the start of the document.
+// Unlike positions, anchors don't move when text is inserted or deleted elsewhere.
+func (d *Doc) Anchor(pos int) ID {
+	i := 0
+	anchor := ID{}
+
+	for _, e := range d.elements {
+		if i == pos {
+			break
+		}
+
+		if !e.Deleted {
+			anchor = e.ID
+			i++
+		}
+	}
+
+	return anchor
+}
+
+// Position returns the visible position after the anchor, -1 when the anchor is unknown.
+// A deleted anchor stands for the position it had.
+func (d *Doc) Position(anchor ID) int {
+	if anchor.IsZero() {
+		return 0
+	}
+
+	pos := 0
+	for _, e := range d.elements {
+		if !e.Deleted {
+			pos++
+		}
+
+		if e.ID == anchor {
+			return pos
+		}
+	}
+
+	return -1
+}
+
+func (d *Doc) index(id ID) int {
+	for i, e := range d.elements {
+		if e.ID == id {
+			return i
+		}
+	}
+	return -1
+}
+
+func (d *Doc) tick(clock uint64) {
+	if clock > d.clock {
+		d.clock = clock
+	}
+}
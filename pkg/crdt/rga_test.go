@@ -0,0 +1,322 @@
+package crdt
+
+import (
+	"errors"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// replicas returns n documents holding the same text.
+func replicas(t *testing.T, text string, n int) []*Doc {
+	base := FromText("base", text)
+
+	docs := make([]*Doc, n)
+	for i := range docs {
+		doc, err := FromElements(base.Elements())
+		if err != nil {
+			t.Fatal(err)
+		}
+		docs[i] = doc
+	}
+
+	return docs
+}
+
+// deliver applies the operations in the given order, the ones that refer to characters not
+// received yet are applied again once the others are, like a client buffering them.
+func deliver(t *testing.T, doc *Doc, ops []Op) {
+	t.Helper()
+
+	pending := ops
+	for len(pending) > 0 {
+		var later []Op
+		for _, op := range pending {
+			err := doc.Apply(op)
+			if errors.Is(err, ErrUnknownID) {
+				later = append(later, op)
+				continue
+			}
+			if err != nil {
+				t.Fatalf("Apply(%+v) = %s", op, err)
+			}
+		}
+
+		if len(later) == len(pending) {
+			t.Fatalf("%d operations refer to characters that were never inserted", len(later))
+		}
+		pending = later
+	}
+}
+
+func mustInsert(t *testing.T, doc *Doc, site string, pos int, text string) Op {
+	t.Helper()
+
+	op, err := doc.Insert(site, pos, text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return op
+}
+
+func mustDelete(t *testing.T, doc *Doc, pos, length int) Op {
+	t.Helper()
+
+	op, err := doc.Delete(pos, length)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return op
+}
+
+func TestConcurrentInsertsAtTheSamePosition(t *testing.T) {
+	tests := []struct {
+		name     string
+		pos      int
+		a, b     string
+		contains []string
+	}{
+		{"start", 0, "X", "Y", []string{"X", "Y"}},
+		{"middle", 2, "one", "two", []string{"one", "two"}},
+		{"end", 4, "!", "?", []string{"!", "?"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs := replicas(t, "text", 2)
+			a, b := docs[0], docs[1]
+
+			// both inserts get the same clock, the sites break the tie.
+			opA := mustInsert(t, a, "a", test.pos, test.a)
+			opB := mustInsert(t, b, "b", test.pos, test.b)
+			if opA.ID.Clock != opB.ID.Clock {
+				t.Fatalf("clocks %d and %d, want the same", opA.ID.Clock, opB.ID.Clock)
+			}
+
+			deliver(t, a, []Op{opB})
+			deliver(t, b, []Op{opA})
+
+			if a.Text() != b.Text() {
+				t.Fatalf("replicas diverged: %q and %q", a.Text(), b.Text())
+			}
+
+			// the inserted texts aren't interleaved.
+			for _, text := range test.contains {
+				if !strings.Contains(a.Text(), text) {
+					t.Errorf("%q doesn't hold %q", a.Text(), text)
+				}
+			}
+			if len(a.Text()) != len("text")+len(test.a)+len(test.b) {
+				t.Errorf("%q lost characters", a.Text())
+			}
+		})
+	}
+}
+
+func TestInsertAfterAConcurrentInsert(t *testing.T) {
+	docs := replicas(t, "ac", 3)
+	a, b, c := docs[0], docs[1], docs[2]
+
+	// b sees the insert of a and types after it, c inserts at the same place without seeing it.
+	opA := mustInsert(t, a, "a", 1, "b")
+	deliver(t, b, []Op{opA})
+	opB := mustInsert(t, b, "b", 2, "B")
+	opC := mustInsert(t, c, "c", 1, "x")
+
+	deliver(t, a, []Op{opC, opB})
+	deliver(t, b, []Op{opC})
+	deliver(t, c, []Op{opB, opA})
+
+	if a.Text() != b.Text() || b.Text() != c.Text() {
+		t.Fatalf("replicas diverged: %q, %q and %q", a.Text(), b.Text(), c.Text())
+	}
+
+	// B was typed right after b, nothing concurrent comes between them.
+	if !strings.Contains(a.Text(), "bB") {
+		t.Errorf("%q split the text typed by b", a.Text())
+	}
+}
+
+func TestDeleteAndInsertInterleavings(t *testing.T) {
+	tests := []struct {
+		name string
+		// edits of a and b on "hello world", run concurrently.
+		a, b func(t *testing.T, doc *Doc) Op
+		want string
+	}{
+		{
+			name: "insert in a deleted range",
+			a:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 0, 6) },
+			b:    func(t *testing.T, doc *Doc) Op { return mustInsert(t, doc, "b", 3, "X") },
+			want: "Xworld",
+		},
+		{
+			name: "insert after a deleted character",
+			a:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 4, 1) },
+			b:    func(t *testing.T, doc *Doc) Op { return mustInsert(t, doc, "b", 5, "!") },
+			want: "hell! world",
+		},
+		{
+			name: "both delete the same characters",
+			a:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 5, 6) },
+			b:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 0, 6) },
+			want: "",
+		},
+		{
+			name: "overlapping deletes",
+			a:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 0, 7) },
+			b:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 4, 7) },
+			want: "",
+		},
+		{
+			name: "insert at the end of a deleted text",
+			a:    func(t *testing.T, doc *Doc) Op { return mustDelete(t, doc, 0, 11) },
+			b:    func(t *testing.T, doc *Doc) Op { return mustInsert(t, doc, "b", 11, "!") },
+			want: "!",
+		},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			docs := replicas(t, "hello world", 2)
+			a, b := docs[0], docs[1]
+
+			opA := test.a(t, a)
+			opB := test.b(t, b)
+
+			deliver(t, a, []Op{opB})
+			deliver(t, b, []Op{opA})
+
+			if a.Text() != test.want || b.Text() != test.want {
+				t.Errorf("texts %q and %q, want %q", a.Text(), b.Text(), test.want)
+			}
+		})
+	}
+}
+
+func TestDeleteOfAConcurrentInsert(t *testing.T) {
+	docs := replicas(t, "ab", 2)
+	a, b := docs[0], docs[1]
+
+	insert := mustInsert(t, a, "a", 1, "XYZ")
+	deliver(t, b, []Op{insert})
+
+	// b deletes part of the insert while a types after it.
+	remove := mustDelete(t, b, 2, 1)
+	typed := mustInsert(t, a, "a", 4, "!")
+
+	// the delete can reach a third replica before the insert it refers to.
+	c := replicas(t, "ab", 1)[0]
+	deliver(t, c, []Op{remove, typed, insert})
+	deliver(t, a, []Op{remove})
+	deliver(t, b, []Op{typed})
+
+	for _, doc := range []*Doc{a, b, c} {
+		if doc.Text() != "aXZ!b" {
+			t.Errorf("text %q, want %q", doc.Text(), "aXZ!b")
+		}
+	}
+}
+
+// TestConvergence makes random edits on a few replicas that sync now and then, then checks that
+// any order of delivery of all the operations gives the same text.
+func TestConvergence(t *testing.T) {
+	const (
+		sites = 3
+		steps = 300
+	)
+
+	rng := rand.New(rand.NewSource(1))
+	names := []string{"a", "b", "c"}
+	docs := replicas(t, "shared", sites)
+
+	var log []Op
+	seen := make([]int, sites)
+
+	for step := 0; step < steps; step++ {
+		i := rng.Intn(sites)
+		doc := docs[i]
+
+		switch {
+		case rng.Intn(5) == 0:
+			// the replica catches up with everything made so far, in a random order.
+			ops := append([]Op{}, log[seen[i]:]...)
+			rng.Shuffle(len(ops), func(x, y int) { ops[x], ops[y] = ops[y], ops[x] })
+			deliver(t, doc, ops)
+			seen[i] = len(log)
+		case doc.Len() > 0 && rng.Intn(3) == 0:
+			pos := rng.Intn(doc.Len())
+			length := 1 + rng.Intn(min(3, doc.Len()-pos))
+			log = append(log, mustDelete(t, doc, pos, length))
+		default:
+			text := string(rune('A' + rng.Intn(26)))
+			if rng.Intn(4) == 0 {
+				text += "xy"
+			}
+			log = append(log, mustInsert(t, doc, names[i], rng.Intn(doc.Len()+1), text))
+		}
+	}
+
+	for i, doc := range docs {
+		deliver(t, doc, log[seen[i]:])
+	}
+
+	want := docs[0].Text()
+	for i, doc := range docs[1:] {
+		if doc.Text() != want {
+			t.Fatalf("replica %s has %q, want %q", names[i+1], doc.Text(), want)
+		}
+	}
+
+	// fresh replicas get the whole log in random orders, some operations twice.
+	for run := 0; run < 20; run++ {
+		ops := append([]Op{}, log...)
+		ops = append(ops, log[rng.Intn(len(log))])
+		rng.Shuffle(len(ops), func(x, y int) { ops[x], ops[y] = ops[y], ops[x] })
+
+		doc := replicas(t, "shared", 1)[0]
+		deliver(t, doc, ops)
+
+		if doc.Text() != want {
+			t.Fatalf("run %d: %q, want %q", run, doc.Text(), want)
+		}
+	}
+
+	// the state survives a copy.
+	copied, err := FromElements(docs[0].Elements())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if copied.Text() != want {
+		t.Errorf("copy has %q, want %q", copied.Text(), want)
+	}
+}
+
+func TestInvalidInserts(t *testing.T) {
+	doc := FromText("a", "abc")
+	last := doc.Anchor(3)
+
+	tests := []struct {
+		name string
+		op   Op
+	}{
+		{"clock of the origin", Op{Type: OpInsert, ID: ID{Clock: last.Clock, Site: "b"}, Origin: last, Text: "x"}},
+		{"clock before the origin", Op{Type: OpInsert, ID: ID{Clock: last.Clock - 1, Site: "b"}, Origin: last, Text: "x"}},
+		{"ids partly known", Op{Type: OpInsert, ID: ID{Clock: last.Clock, Site: "a"}, Text: "xy"}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			if err := doc.Apply(test.op); !errors.Is(err, ErrInvalidOp) {
+				t.Errorf("Apply = %v, want %v", err, ErrInvalidOp)
+			}
+			if doc.Text() != "abc" {
+				t.Errorf("text %q, want %q", doc.Text(), "abc")
+			}
+		})
+	}
+
+	if _, err := FromElements([]Element{{ID: ID{Clock: 2, Site: "a"}, Value: "a"}, {ID: ID{Clock: 2, Site: "b"}, Origin: ID{Clock: 2, Site: "a"}, Value: "b"}}); !errors.Is(err, ErrInvalidOp) {
+		t.Errorf("FromElements = %v, want %v", err, ErrInvalidOp)
+	}
+}
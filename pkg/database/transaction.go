@@ -0,0 +1,59 @@
+package database
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Transactor runs functions in a transaction when the deployment supports them.
+// Standalone servers don't, there the function runs without one.
+type Transactor struct {
+	client    *mongo.Client
+	supported bool
+}
+
+// NewTransactor checks once if the server is part of a replica set or a sharded cluster.
+func NewTransactor(db *mongo.Database, ctx context.Context) *Transactor {
+	var hello struct {
+		SetName string `bson:"setName"`
+		Msg     string `bson:"msg"`
+	}
+
+	err := db.RunCommand(ctx, bson.D{{Key: "hello", Value: 1}}).Decode(&hello)
+	if err != nil {
+		// servers before 4.4 only know isMaster.
+		err = db.RunCommand(ctx, bson.D{{Key: "isMaster", Value: 1}}).Decode(&hello)
+	}
+
+	return &Transactor{
+		client:    db.Client(),
+		supported: err == nil && (hello.SetName != "" || hello.Msg == "isdbgrid"),
+	}
+}
+
+func (t *Transactor) Supported() bool {
+	return t != nil && t.supported
+}
+
+// Run calls fn in a transaction, the writes made with the ctx given to fn are rolled back
+// when it returns an error. fn can be called again when the transaction is retried.
+func (t *Transactor) Run(fn func(ctx context.Context) error, ctx context.Context) error {
+	if !t.Supported() {
+		return fn(ctx)
+	}
+
+	session, err := t.client.StartSession()
+	if err != nil {
+		return err
+	}
+
+	defer session.EndSession(ctx)
+
+	_, err = session.WithTransaction(ctx, func(sc mongo.SessionContext) (any, error) {
+		return nil, fn(sc)
+	})
+
+	return err
+}
@@ -0,0 +1,192 @@
+package events
+
+import (
+	"context"
+	"encoding/json"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// history is the number of events kept to resume streams after a reconnect.
+const history = 1000
+
+// buffer is the number of events a slow subscriber can be behind before it's dropped.
+const buffer = 64
+
+type Event struct {
+	// ID increases with time, it's the id of the server-sent event.
+	ID   string    `bson:"_id" json:"id"`
+	Type string    `bson:"type" json:"type"`
+	Time time.Time `bson:"time" json:"time"`
+	// Audience are the ids of the users receiving the event.
+	Audience []string `bson:"audience" json:"-"`
+	// Data is the json encoded payload.
+	Data []byte `bson:"data" json:"-"`
+}
+
+// Backend carries the events between the instances of the api.
+type Backend interface {
+	Publish(event Event, ctx context.Context) error
+	// Listen calls fn with the events published by every instance, until ctx is done.
+	Listen(fn func(event Event), ctx context.Context) error
+}
+
+type Subscription struct {
+	userId string
+	events chan Event
+}
+
+// Events is closed when the hub stops or drops the subscription because it fell behind.
+func (s *Subscription) Events() <-chan Event {
+	return s.events
+}
+
+// Hub publishes events to the backend and dispatches the ones it receives to the local subscribers.
+type Hub struct {
+	backend Backend
+	mu      sync.Mutex
+	subs    map[*Subscription]struct{}
+	recent  []Event
+	stopped bool
+	taps    []func(event Event)
+}
+
+func NewHub(backend Backend) *Hub {
+	return &Hub{backend: backend, subs: make(map[*Subscription]struct{})}
+}
+
+// Run dispatches the events until ctx is done, then closes the subscriptions.
+func (h *Hub) Run(ctx context.Context) error {
+	err := h.backend.Listen(h.dispatch, ctx)
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.stopped = true
+	for sub := range h.subs {
+		close(sub.events)
+		delete(h.subs, sub)
+	}
+
+	return err
+}
+
+// Publish sends an event to the audience, data is encoded as json.
+func (h *Hub) Publish(eventType string, audience []string, data any, ctx context.Context) error {
+	payload, err := json.Marshal(data)
+	if err != nil {
+		return err
+	}
+
+	event := Event{
+		ID:       primitive.NewObjectID().Hex(),
+		Type:     eventType,
+		Time:     time.Now(),
+		Audience: audience,
+		Data:     payload,
+	}
+
+	if err := h.backend.Publish(event, ctx); err != nil {
+		return err
+	}
+
+	h.mu.Lock()
+	taps := h.taps
+	h.mu.Unlock()
+
+	for _, tap := range taps {
+		tap(event)
+	}
+
+	return nil
+}
+
+// Tap calls fn with the events published by this instance, once the backend accepted them.
+// Unlike the subscriptions, each event reaches the taps of a single instance. fn must not block.
+func (h *Hub) Tap(fn func(event Event)) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.taps = append(h.taps, fn)
+}
+
+// Subscribe registers a subscriber for the events of userId. When lastEventId is set, the events
+// of the user since then are returned as missed; resumed is false if they are not known anymore.
+func (h *Hub) Subscribe(userId, lastEventId string) (sub *Subscription, missed []Event, resumed bool) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	sub = &Subscription{userId: userId, events: make(chan Event, buffer)}
+	if h.stopped {
+		close(sub.events)
+		return sub, nil, false
+	}
+
+	h.subs[sub] = struct{}{}
+
+	if lastEventId == "" {
+		return sub, nil, true
+	}
+
+	for i := len(h.recent) - 1; i >= 0; i-- {
+		if h.recent[i].ID != lastEventId {
+			continue
+		}
+
+		for _, event := range h.recent[i+1:] {
+			if event.For(userId) {
+				missed = append(missed, event)
+			}
+		}
+
+		return sub, missed, true
+	}
+
+	return sub, nil, false
+}
+
+func (h *Hub) Unsubscribe(sub *Subscription) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	if _, ok := h.subs[sub]; ok {
+		delete(h.subs, sub)
+		close(sub.events)
+	}
+}
+
+func (h *Hub) dispatch(event Event) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+
+	h.recent = append(h.recent, event)
+	if len(h.recent) > history {
+		h.recent = append(h.recent[:0], h.recent[len(h.recent)-history:]...)
+	}
+
+	for sub := range h.subs {
+		if !event.For(sub.userId) {
+			continue
+		}
+
+		select {
+		case sub.events <- event:
+		default:
+			// too slow, the client reconnects and resumes from its last event.
+			delete(h.subs, sub)
+			close(sub.events)
+		}
+	}
+}
+
+// For reports if userId is in the audience of the event.
+func (e Event) For(userId string) bool {
+	for _, id := range e.Audience {
+		if id == userId {
+			return true
+		}
+	}
+	return false
+}
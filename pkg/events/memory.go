@@ -0,0 +1,32 @@
+package events
+
+import "context"
+
+type memoryBackend struct {
+	events chan Event
+}
+
+// NewMemoryBackend keeps the events in process, for a single instance.
+func NewMemoryBackend() Backend {
+	return &memoryBackend{events: make(chan Event, 256)}
+}
+
+func (b *memoryBackend) Publish(event Event, ctx context.Context) error {
+	select {
+	case b.events <- event:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (b *memoryBackend) Listen(fn func(event Event), ctx context.Context) error {
+	for {
+		select {
+		case event := <-b.events:
+			fn(event)
+		case <-ctx.Done():
+			return nil
+		}
+	}
+}
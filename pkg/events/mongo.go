@@ -0,0 +1,79 @@
+package events
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// events are kept in a capped collection of this size, in bytes.
+const mongoCollectionSize = 64 << 20
+
+type mongoBackend struct {
+	collection *mongo.Collection
+}
+
+// NewMongoBackend shares the events between instances through a capped collection,
+// every instance tails it. It works with a standalone server.
+func NewMongoBackend(db *mongo.Database, ctx context.Context) (Backend, error) {
+	opts := options.CreateCollection().SetCapped(true).SetSizeInBytes(mongoCollectionSize)
+
+	err := db.CreateCollection(ctx, "events", opts)
+	var cmdErr mongo.CommandError
+	// NamespaceExists
+	if err != nil && !(errors.As(err, &cmdErr) && cmdErr.Code == 48) {
+		return nil, err
+	}
+
+	return &mongoBackend{db.Collection("events")}, nil
+}
+
+func (b *mongoBackend) Publish(event Event, ctx context.Context) error {
+	_, err := b.collection.InsertOne(ctx, event)
+	return err
+}
+
+func (b *mongoBackend) Listen(fn func(event Event), ctx context.Context) error {
+	last := primitive.NewObjectIDFromTimestamp(time.Now()).Hex()
+
+	for ctx.Err() == nil {
+		last = b.tail(last, fn, ctx)
+
+		// the cursor dies when the collection is empty or on errors, start again.
+		select {
+		case <-ctx.Done():
+		case <-time.After(time.Second):
+		}
+	}
+
+	return nil
+}
+
+// tail calls fn with the events after last while the cursor is alive, it returns the last id seen.
+func (b *mongoBackend) tail(last string, fn func(event Event), ctx context.Context) string {
+	opts := options.Find().SetCursorType(options.TailableAwait).SetMaxAwaitTime(5 * time.Second)
+
+	cursor, err := b.collection.Find(ctx, bson.M{"_id": bson.M{"$gt": last}}, opts)
+	if err != nil {
+		return last
+	}
+
+	defer cursor.Close(context.Background())
+
+	for cursor.Next(ctx) {
+		var event Event
+		if err := cursor.Decode(&event); err != nil {
+			continue
+		}
+
+		last = event.ID
+		fn(event)
+	}
+
+	return last
+}
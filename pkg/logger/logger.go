@@ -1,32 +1,98 @@
 package logger
 
 import (
-	"fmt"
+	"context"
 	"io"
+	"log/slog"
+	"strings"
 )
 
+// Logger writes leveled, structured records. The arguments after the message are key-value
+// pairs, logger.Error("upload issue", "error", err, "note_id", id).
 type Logger interface {
-	Print(string)
-	Info(string)
-	Error(string)
+	Debug(msg string, args ...any)
+	Info(msg string, args ...any)
+	Warn(msg string, args ...any)
+	Error(msg string, args ...any)
+	// Print writes an informational record.
+	Print(msg string)
+	// With returns a logger adding the key-value pairs to each record.
+	With(args ...any) Logger
+	// For returns the logger of the request of ctx, see Middleware, or this one outside of a request.
+	For(ctx context.Context) Logger
+}
+
+type Config struct {
+	Level slog.Level
+	// Format is json or text.
+	Format string
+}
+
+var DefaultConfig = Config{
+	Level:  slog.LevelInfo,
+	Format: "text",
+}
+
+// LoadConfig reads LOG_LEVEL (debug, info, warn or error) and LOG_FORMAT (json or text),
+// missing values keep the default.
+func LoadConfig(getEnv func(string) string) Config {
+	config := DefaultConfig
+
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(getEnv("LOG_LEVEL"))); err == nil {
+		config.Level = level
+	}
+
+	if format := strings.ToLower(getEnv("LOG_FORMAT")); format == "json" || format == "text" {
+		config.Format = format
+	}
+
+	return config
 }
 
 type log struct {
-	writer io.Writer
+	logger *slog.Logger
 }
 
-func (l log) Print(msg string) {
+// New returns a logger writing to writer.
+func New(writer io.Writer, config Config) Logger {
+	options := &slog.HandlerOptions{Level: config.Level}
 
+	var handler slog.Handler = slog.NewTextHandler(writer, options)
+	if config.Format == "json" {
+		handler = slog.NewJSONHandler(writer, options)
+	}
+
+	return log{slog.New(handler)}
+}
+
+func (l log) Debug(msg string, args ...any) {
+	l.logger.Debug(msg, args...)
+}
+
+func (l log) Info(msg string, args ...any) {
+	l.logger.Info(msg, args...)
 }
 
-func (l log) Info(msg string) {
-	fmt.Printf("Info: %s\n", msg)
+func (l log) Warn(msg string, args ...any) {
+	l.logger.Warn(msg, args...)
+}
+
+func (l log) Error(msg string, args ...any) {
+	l.logger.Error(msg, args...)
+}
+
+func (l log) Print(msg string) {
+	l.logger.Info(msg)
 }
 
-func (l log) Error(msg string) {
-	fmt.Printf("Error: %s\n", msg)
+func (l log) With(args ...any) Logger {
+	return log{l.logger.With(args...)}
 }
 
-func New(writer io.Writer) Logger {
-	return log{writer}
+func (l log) For(ctx context.Context) Logger {
+	if state, ok := ctx.Value(requestKey{}).(*request); ok {
+		return state.logger
+	}
+	return l
 }
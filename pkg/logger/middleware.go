@@ -0,0 +1,146 @@
+package logger
+
+import (
+	"bufio"
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"net"
+	"net/http"
+	"time"
+)
+
+const RequestIDHeader = "X-Request-ID"
+
+type requestKey struct{}
+
+// request is shared by the middleware and the handlers, the authentication sets the user later on.
+type request struct {
+	id     string
+	logger Logger
+	userId string
+}
+
+// SetUser adds the user to the records of the request of ctx and to its access log.
+func SetUser(ctx context.Context, userId string) {
+	if state, ok := ctx.Value(requestKey{}).(*request); ok {
+		state.userId = userId
+		state.logger = state.logger.With("user_id", userId)
+	}
+}
+
+// RequestID returns the id of the request of ctx, empty outside of a request.
+func RequestID(ctx context.Context) string {
+	if state, ok := ctx.Value(requestKey{}).(*request); ok {
+		return state.id
+	}
+	return ""
+}
+
+// Middleware gives each request an id, the X-Request-ID header of the client when it's usable,
+// and a logger adding it to the records, see Logger.For. The id is sent back in the same header.
+// Once the request is served its method, path, status, latency and user are logged.
+func Middleware(base Logger, next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+
+		id := r.Header.Get(RequestIDHeader)
+		if !validID(id) {
+			id = newID()
+		}
+		w.Header().Set(RequestIDHeader, id)
+
+		state := &request{id: id, logger: base.With("request_id", id)}
+		ctx := context.WithValue(r.Context(), requestKey{}, state)
+
+		recorder := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(recorder, r.WithContext(ctx))
+
+		status := recorder.status
+		if status == 0 {
+			status = http.StatusOK
+		}
+
+		args := []any{
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", status,
+			"latency", time.Since(start),
+		}
+		if state.userId != "" {
+			args = append(args, "user_id", state.userId)
+		}
+
+		access := base.With("request_id", id)
+		if status >= http.StatusInternalServerError {
+			access.Error("request", args...)
+			return
+		}
+		access.Info("request", args...)
+	})
+}
+
+// validID accepts the ids of at most 128 printable ASCII characters, the others are replaced
+// so the clients can't forge the records.
+func validID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+	return true
+}
+
+func newID() string {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return fmt.Sprintf("%x", time.Now().UnixNano())
+	}
+	return hex.EncodeToString(b)
+}
+
+// statusRecorder keeps the status of the response. The streams and the websockets need the
+// Flusher and Hijacker of the underlying writer.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (s *statusRecorder) WriteHeader(status int) {
+	if s.status == 0 {
+		s.status = status
+	}
+	s.ResponseWriter.WriteHeader(status)
+}
+
+func (s *statusRecorder) Write(b []byte) (int, error) {
+	if s.status == 0 {
+		s.status = http.StatusOK
+	}
+	return s.ResponseWriter.Write(b)
+}
+
+func (s *statusRecorder) Flush() {
+	if flusher, ok := s.ResponseWriter.(http.Flusher); ok {
+		flusher.Flush()
+	}
+}
+
+func (s *statusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	hijacker, ok := s.ResponseWriter.(http.Hijacker)
+	if !ok {
+		return nil, nil, fmt.Errorf("the response writer doesn't support hijacking")
+	}
+	if s.status == 0 {
+		s.status = http.StatusSwitchingProtocols
+	}
+	return hijacker.Hijack()
+}
+
+func (s *statusRecorder) Unwrap() http.ResponseWriter {
+	return s.ResponseWriter
+}
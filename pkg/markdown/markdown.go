@@ -0,0 +1,122 @@
+package markdown
+
+import (
+	"bytes"
+	"regexp"
+	"strings"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/ast"
+	"github.com/yuin/goldmark/extension"
+	"github.com/yuin/goldmark/parser"
+	"github.com/yuin/goldmark/text"
+)
+
+// average silent reading speed, used for the reading time.
+const wordsPerMinute = 200
+
+type Heading struct {
+	Level int    `json:"level"`
+	Text  string `json:"text"`
+	ID    string `json:"id"`
+}
+
+type Document struct {
+	HTML        string    `json:"html"`
+	Outline     []Heading `json:"outline"`
+	WordCount   int       `json:"word_count"`
+	ReadingTime int       `json:"reading_time"` // minutes
+}
+
+var md = goldmark.New(
+	// CommonMark plus tables, task lists, strikethrough and autolinks.
+	goldmark.WithExtensions(extension.GFM),
+	goldmark.WithParserOptions(parser.WithAutoHeadingID()),
+)
+
+var policy = newPolicy()
+
+func newPolicy() *bluemonday.Policy {
+	p := bluemonday.UGCPolicy()
+
+	p.AllowAttrs("id").Matching(regexp.MustCompile(`^[\w-]+$`)).OnElements("h1", "h2", "h3", "h4", "h5", "h6")
+	p.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+
+	// task list items are rendered as disabled checkboxes.
+	p.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	p.AllowAttrs("checked", "disabled").OnElements("input")
+
+	return p
+}
+
+// Render converts markdown to sanitised html and collects its outline and word count.
+func Render(source string) (*Document, error) {
+	src := []byte(source)
+	root := md.Parser().Parse(text.NewReader(src))
+
+	var buf bytes.Buffer
+	if err := md.Renderer().Render(&buf, src, root); err != nil {
+		return nil, err
+	}
+
+	doc := &Document{
+		HTML:    policy.Sanitize(buf.String()),
+		Outline: []Heading{},
+	}
+
+	var words strings.Builder
+	ast.Walk(root, func(n ast.Node, entering bool) (ast.WalkStatus, error) {
+		if !entering {
+			return ast.WalkContinue, nil
+		}
+
+		switch node := n.(type) {
+		case *ast.Heading:
+			heading := Heading{Level: node.Level, Text: plainText(node, src)}
+			if id, ok := node.AttributeString("id"); ok {
+				if b, ok := id.([]byte); ok {
+					heading.ID = string(b)
+				}
+			}
+			doc.Outline = append(doc.Outline, heading)
+		case *ast.Text:
+			words.Write(node.Segment.Value(src))
+			words.WriteByte(' ')
+		case *ast.CodeBlock, *ast.FencedCodeBlock:
+			lines := n.Lines()
+			for i := 0; i < lines.Len(); i++ {
+				line := lines.At(i)
+				words.Write(line.Value(src))
+			}
+			words.WriteByte(' ')
+		}
+
+		return ast.WalkContinue, nil
+	})
+
+	doc.WordCount = len(strings.Fields(words.String()))
+	doc.ReadingTime = (doc.WordCount + wordsPerMinute - 1) / wordsPerMinute
+
+	return doc, nil
+}
+
+func plainText(n ast.Node, src []byte) string {
+	var b strings.Builder
+
+	ast.Walk(n, func(c ast.Node, entering bool) (ast.WalkStatus, error) {
+		if entering {
+			if t, ok := c.(*ast.Text); ok {
+				b.Write(t.Segment.Value(src))
+				if t.SoftLineBreak() {
+					b.WriteByte(' ')
+				}
+			} else if s, ok := c.(*ast.String); ok {
+				b.Write(s.Value)
+			}
+		}
+		return ast.WalkContinue, nil
+	})
+
+	return strings.TrimSpace(b.String())
+}
@@ -0,0 +1,96 @@
+package security
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+var ErrAddressForbidden = errors.New("address is not public")
+
+const maxRedirects = 5
+
+// the shared address space of carrier-grade NATs, netip doesn't count it as private.
+var sharedAddressSpace = netip.MustParsePrefix("100.64.0.0/10")
+
+// PublicAddr reports if addr can be reached by the requests made on behalf of the users:
+// loopback, private, link-local (cloud metadata), multicast and unspecified addresses can't.
+func PublicAddr(addr netip.Addr) bool {
+	addr = addr.Unmap()
+	return addr.IsValid() &&
+		!addr.IsLoopback() &&
+		!addr.IsPrivate() &&
+		!addr.IsLinkLocalUnicast() &&
+		!addr.IsLinkLocalMulticast() &&
+		!addr.IsInterfaceLocalMulticast() &&
+		!addr.IsMulticast() &&
+		!addr.IsUnspecified() &&
+		!sharedAddressSpace.Contains(addr)
+}
+
+// DialControl refuses the connections to the addresses that aren't public. It runs after the
+// name resolution, on the address actually dialed, so a host resolving to a private address
+// is refused as well.
+func DialControl(network, address string, _ syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return err
+	}
+
+	if !PublicAddr(addrPort.Addr()) {
+		return fmt.Errorf("dialing %s: %w", address, ErrAddressForbidden)
+	}
+
+	return nil
+}
+
+// CheckURL refuses the urls that aren't http or https or whose host is an address that
+// isn't public. Host names are checked when dialed, see DialControl.
+func CheckURL(u *url.URL) error {
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("unsupported scheme %q", u.Scheme)
+	}
+
+	if addr, err := netip.ParseAddr(u.Hostname()); err == nil && !PublicAddr(addr) {
+		return fmt.Errorf("%s: %w", u.Hostname(), ErrAddressForbidden)
+	}
+
+	return nil
+}
+
+// PublicClient returns a client for the requests to the urls given by the users, like link
+// previews and webhooks. It only connects to public addresses, redirects included, and ignores
+// the proxy settings of the environment so the addresses can't be dialed through a proxy.
+func PublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{Timeout: 10 * time.Second, KeepAlive: 30 * time.Second, Control: DialControl}
+
+	transport := &http.Transport{
+		Proxy:                 nil,
+		DialContext:           dialer.DialContext,
+		ForceAttemptHTTP2:     true,
+		MaxIdleConns:          100,
+		IdleConnTimeout:       90 * time.Second,
+		TLSHandshakeTimeout:   10 * time.Second,
+		ExpectContinueTimeout: time.Second,
+	}
+
+	return &http.Client{
+		Timeout:       timeout,
+		Transport:     transport,
+		CheckRedirect: CheckRedirect,
+	}
+}
+
+// CheckRedirect follows at most 5 redirects, to urls passing CheckURL.
+func CheckRedirect(req *http.Request, via []*http.Request) error {
+	if len(via) >= maxRedirects {
+		return fmt.Errorf("stopped after %d redirects", maxRedirects)
+	}
+
+	return CheckURL(req.URL)
+}
@@ -0,0 +1,92 @@
+package security
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"net/netip"
+	"testing"
+	"time"
+)
+
+func TestPublicAddr(t *testing.T) {
+	tests := []struct {
+		addr   string
+		public bool
+	}{
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"127.0.0.1", false},
+		{"::1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"fd00::1", false},
+		{"169.254.169.254", false},
+		{"fe80::1", false},
+		{"0.0.0.0", false},
+		{"::", false},
+		{"100.64.0.1", false},
+		{"224.0.0.1", false},
+		{"::ffff:127.0.0.1", false},
+		{"::ffff:169.254.169.254", false},
+	}
+
+	for _, test := range tests {
+		if public := PublicAddr(netip.MustParseAddr(test.addr)); public != test.public {
+			t.Errorf("PublicAddr(%s) = %t, want %t", test.addr, public, test.public)
+		}
+	}
+}
+
+func TestPublicClientRefusesLoopback(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("the loopback server was reached")
+	}))
+	defer server.Close()
+
+	req, _ := http.NewRequestWithContext(context.Background(), http.MethodGet, server.URL, nil)
+	_, err := PublicClient(time.Second).Do(req)
+	if !errors.Is(err, ErrAddressForbidden) {
+		t.Errorf("Do(%s) = %v, want %v", server.URL, err, ErrAddressForbidden)
+	}
+}
+
+func TestCheckRedirectRefusesPrivateTargets(t *testing.T) {
+	targets := []string{
+		"http://169.254.169.254/latest/meta-data/",
+		"http://127.0.0.1:6379/",
+		"http://[::1]/",
+		"file:///etc/passwd",
+	}
+
+	for _, target := range targets {
+		server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			http.Redirect(w, r, target, http.StatusFound)
+		}))
+
+		// the test server itself is on loopback, only the redirects are checked.
+		client := server.Client()
+		client.CheckRedirect = CheckRedirect
+
+		resp, err := client.Get(server.URL)
+		if err == nil {
+			resp.Body.Close()
+			t.Errorf("redirect to %s was followed", target)
+		}
+
+		server.Close()
+	}
+}
+
+func TestCheckRedirectLimit(t *testing.T) {
+	req := httptest.NewRequest(http.MethodGet, "http://93.184.216.34/", nil)
+
+	if err := CheckRedirect(req, make([]*http.Request, maxRedirects-1)); err != nil {
+		t.Errorf("redirect %d refused: %s", maxRedirects, err)
+	}
+	if err := CheckRedirect(req, make([]*http.Request, maxRedirects)); err == nil {
+		t.Errorf("redirect %d followed", maxRedirects+1)
+	}
+}
@@ -1,8 +1,10 @@
 package security
 
 import (
+	cryptorand "crypto/rand"
 	"crypto/sha256"
 	"crypto/subtle"
+	"encoding/base64"
 	"fmt"
 	"hash/crc32"
 	"math/rand"
@@ -55,6 +57,23 @@ func GenerateTokenString() Token {
 	return Token{Plain: plain, Token: token}
 }
 
+// GenerateSecureToken returns a token read from crypto/rand, for tokens that must not be
+// guessed like public links. Only its hash, see HashToken, is stored.
+func GenerateSecureToken() (Token, error) {
+	entropy := make([]byte, 32)
+	if _, err := cryptorand.Read(entropy); err != nil {
+		return Token{}, err
+	}
+
+	plain := base64.RawURLEncoding.EncodeToString(entropy)
+	return Token{Plain: plain, Token: HashToken(plain)}, nil
+}
+
+// HashToken returns the hash stored for a plain token.
+func HashToken(plain string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(plain)))
+}
+
 func randSeq(n int) string {
 	var letters = []rune("abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ1234567890")
 
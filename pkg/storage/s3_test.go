@@ -0,0 +1,218 @@
+package storage
+
+import (
+	"context"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const (
+	testAccessKey = "AKIDEXAMPLE"
+	testSecretKey = "wJalrXUtnFEMI/K7MDENG+bPxRfiCYEXAMPLEKEY"
+	testRegion    = "eu-west-1"
+	testBucket    = "memo"
+)
+
+// fakeS3 is a local stand-in for S3: it checks the signature v4 of the requests and keeps
+// the objects in memory.
+type fakeS3 struct {
+	t       *testing.T
+	mu      sync.Mutex
+	objects map[string]fakeObject
+}
+
+type fakeObject struct {
+	body        []byte
+	contentType string
+}
+
+func newFakeS3(t *testing.T) (*fakeS3, BlobStore) {
+	fake := &fakeS3{t: t, objects: map[string]fakeObject{}}
+
+	server := httptest.NewServer(fake)
+	t.Cleanup(server.Close)
+
+	store, err := NewS3(S3Config{
+		Endpoint:  server.URL,
+		Region:    testRegion,
+		Bucket:    testBucket,
+		AccessKey: testAccessKey,
+		SecretKey: testSecretKey,
+	}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	return fake, store
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := f.verify(r); err != nil {
+		f.t.Errorf("%s %s: %s", r.Method, r.URL.Path, err)
+		http.Error(w, "SignatureDoesNotMatch", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+testBucket+"/")
+	if !ok {
+		http.Error(w, "NoSuchBucket", http.StatusNotFound)
+		return
+	}
+
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	switch r.Method {
+	case http.MethodPut:
+		body, _ := io.ReadAll(r.Body)
+		if int64(len(body)) != r.ContentLength {
+			http.Error(w, "IncompleteBody", http.StatusBadRequest)
+			return
+		}
+		f.objects[key] = fakeObject{body, r.Header.Get("Content-Type")}
+	case http.MethodGet:
+		object, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "NoSuchKey", http.StatusNotFound)
+			return
+		}
+		w.Header().Set("Content-Type", object.contentType)
+		w.Write(object.body)
+	case http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// verify recomputes the signature of r from what was received, as S3 does.
+func (f *fakeS3) verify(r *http.Request) error {
+	auth := r.Header.Get("Authorization")
+	fields := map[string]string{}
+	for _, part := range strings.Split(strings.TrimPrefix(auth, "AWS4-HMAC-SHA256 "), ", ") {
+		if name, value, ok := strings.Cut(part, "="); ok {
+			fields[name] = value
+		}
+	}
+
+	amzDate := r.Header.Get("X-Amz-Date")
+	if len(amzDate) != len("20060102T150405Z") {
+		return errors.New("missing X-Amz-Date")
+	}
+	day := amzDate[:8]
+
+	scope := day + "/" + testRegion + "/s3/aws4_request"
+	if fields["Credential"] != testAccessKey+"/"+scope {
+		return errors.New("wrong credential " + fields["Credential"])
+	}
+
+	names := strings.Split(fields["SignedHeaders"], ";")
+	if !sort.StringsAreSorted(names) {
+		return errors.New("signed headers aren't sorted")
+	}
+
+	var headers strings.Builder
+	for _, name := range names {
+		value := r.Header.Get(name)
+		if name == "host" {
+			value = r.Host
+		}
+		headers.WriteString(name + ":" + strings.TrimSpace(value) + "\n")
+	}
+
+	canonical := strings.Join([]string{
+		r.Method,
+		r.URL.EscapedPath(),
+		r.URL.Query().Encode(),
+		headers.String(),
+		fields["SignedHeaders"],
+		r.Header.Get("X-Amz-Content-Sha256"),
+	}, "\n")
+
+	toSign := strings.Join([]string{"AWS4-HMAC-SHA256", amzDate, scope, hexSha256([]byte(canonical))}, "\n")
+
+	key := hmacSha256([]byte("AWS4"+testSecretKey), day)
+	key = hmacSha256(key, testRegion)
+	key = hmacSha256(key, "s3")
+	key = hmacSha256(key, "aws4_request")
+
+	if want := hex.EncodeToString(hmacSha256(key, toSign)); fields["Signature"] != want {
+		return errors.New("signature mismatch")
+	}
+
+	return nil
+}
+
+func TestS3PutGetDelete(t *testing.T) {
+	fake, store := newFakeS3(t)
+	ctx := context.Background()
+	key := "attachments/user/file id"
+	content := "hello attachments"
+
+	if err := store.Put(key, strings.NewReader(content), int64(len(content)), "text/plain", ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if object := fake.objects[key]; object.contentType != "text/plain" {
+		t.Errorf("stored content type %q", object.contentType)
+	}
+
+	body, err := store.Get(key, ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got, _ := io.ReadAll(body)
+	body.Close()
+
+	if string(got) != content {
+		t.Errorf("Get = %q, want %q", got, content)
+	}
+
+	if err := store.Delete(key, ctx); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := store.Get(key, ctx); !errors.Is(err, ErrNotFound) {
+		t.Errorf("Get after Delete = %v, want %v", err, ErrNotFound)
+	}
+
+	// deleting a missing blob isn't an error.
+	if err := store.Delete(key, ctx); err != nil {
+		t.Errorf("Delete of a missing blob = %v", err)
+	}
+}
+
+func TestS3RejectsInvalidKeys(t *testing.T) {
+	_, store := newFakeS3(t)
+
+	for _, key := range []string{"", "/absolute", "a/../b", "a//b", `a\b`} {
+		if err := store.Put(key, strings.NewReader("x"), 1, "", context.Background()); err == nil {
+			t.Errorf("Put(%q) succeeded", key)
+		}
+	}
+}
+
+func TestS3ReportsErrors(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "AccessDenied", http.StatusForbidden)
+	}))
+	defer server.Close()
+
+	store, err := NewS3(S3Config{Endpoint: server.URL, Bucket: testBucket}, server.Client())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	err = store.Put("key", strings.NewReader("x"), 1, "", context.Background())
+	if err == nil || !strings.Contains(err.Error(), "AccessDenied") {
+		t.Errorf("Put = %v, want the S3 error", err)
+	}
+}
@@ -0,0 +1,56 @@
+package storage
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+)
+
+var ErrNotFound = errors.New("blob not found")
+
+// BlobStore keeps the uploaded files, keys are slash separated paths.
+type BlobStore interface {
+	Put(key string, r io.Reader, size int64, contentType string, ctx context.Context) error
+	Get(key string, ctx context.Context) (io.ReadCloser, error)
+	Delete(key string, ctx context.Context) error
+}
+
+type EnvConfig func(key string) string
+
+// New returns the store selected by STORAGE_DRIVER, "local" (default) or "s3".
+func New(config EnvConfig) (BlobStore, error) {
+	switch config("STORAGE_DRIVER") {
+	case "", "local":
+		root := config("STORAGE_PATH")
+		if root == "" {
+			root = "storage"
+		}
+		return NewLocal(root)
+	case "s3":
+		return NewS3(S3Config{
+			Endpoint:  config("S3_ENDPOINT"),
+			Region:    config("S3_REGION"),
+			Bucket:    config("S3_BUCKET"),
+			AccessKey: config("S3_ACCESS_KEY"),
+			SecretKey: config("S3_SECRET_KEY"),
+		}, nil)
+	default:
+		return nil, fmt.Errorf("Unknown storage driver %s", config("STORAGE_DRIVER"))
+	}
+}
+
+func validKey(key string) error {
+	if key == "" || strings.HasPrefix(key, "/") || strings.Contains(key, "\\") {
+		return fmt.Errorf("invalid key %q", key)
+	}
+
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return fmt.Errorf("invalid key %q", key)
+		}
+	}
+
+	return nil
+}
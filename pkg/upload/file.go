@@ -1,34 +1,55 @@
 package upload
 
 import (
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
 	"fmt"
 	"io"
-	"mime/multipart"
 	"net/http"
 	"os"
-	"strings"
+	"path/filepath"
+)
+
+// form fields are kept in memory up to this size, files above it are spooled to disk.
+const maxMemory = 1 << 20
+
+var (
+	ErrTooLarge   = errors.New("file is too large")
+	ErrType       = errors.New("file type is not allowed")
+	ErrDimensions = errors.New("image dimensions are too large")
 )
 
 var headers = map[string]string{
 	"png":  "image/png",
 	"jpg":  "image/jpeg",
 	"jpeg": "image/jpeg",
+	"gif":  "image/gif",
+	"webp": "image/webp",
+	"pdf":  "application/pdf",
 }
 
 type FileInfo struct {
-	Name string `json:"name"`
-	Size int64  `json:"size"`
+	Name     string `json:"name"`
+	Size     int64  `json:"size"`
+	MimeType string `json:"mime_type"`
+	Width    int    `json:"width,omitempty"`
+	Height   int    `json:"height,omitempty"`
 }
 
 type FileUpload struct {
+	w            http.ResponseWriter
 	req          *http.Request
 	field        string
 	maxSize      int64
 	allowedTypes []string
+	maxWidth     int
+	maxHeight    int
+	parsed       bool
 }
 
-func NewUpload(r *http.Request, field string) *FileUpload {
-	return &FileUpload{req: r, field: field}
+func NewUpload(w http.ResponseWriter, r *http.Request, field string) *FileUpload {
+	return &FileUpload{w: w, req: r, field: field, maxWidth: 4096, maxHeight: 4096}
 }
 
 func (fu *FileUpload) SetMaxSize(max int64) {
@@ -39,39 +60,58 @@ func (fu *FileUpload) SetAllowedTypes(types ...string) {
 	fu.allowedTypes = types
 }
 
-func imageType(value string, options []string) bool {
-	for _, option := range options {
-		h, ok := headers[option]
+// SetMaxDimensions limits the width and height of uploaded images, in pixels.
+func (fu *FileUpload) SetMaxDimensions(width, height int) {
+	fu.maxWidth = width
+	fu.maxHeight = height
+}
 
-		if !ok {
-			return false
-		}
+// Parse reads the multipart form with the size limit applied to the request body.
+// It has to be called before any r.FormValue, which would read the body without limit.
+func (fu *FileUpload) Parse() error {
+	if fu.parsed {
+		return nil
+	}
 
-		if h == value {
-			return true
-		}
+	fu.parsed = true
+
+	if fu.maxSize > 0 {
+		// leave some room for the other fields and the multipart headers.
+		fu.req.Body = http.MaxBytesReader(fu.w, fu.req.Body, fu.maxSize+maxMemory)
 	}
 
-	return false
+	err := fu.req.ParseMultipartForm(maxMemory)
+
+	var maxBytes *http.MaxBytesError
+	if errors.As(err, &maxBytes) {
+		return ErrTooLarge
+	}
+
+	return err
 }
 
-func (fu *FileUpload) validateFile(h *multipart.FileHeader) error {
-	if len(fu.allowedTypes) > 0 {
-		if !imageType(h.Header.Get("Content-Type"), fu.allowedTypes) {
-			return fmt.Errorf("File is not in: %v", fu.allowedTypes)
-		}
+func (fu *FileUpload) allowed(mediaType string) bool {
+	if len(fu.allowedTypes) == 0 {
+		return true
 	}
 
-	if fu.maxSize > 0 {
-		if h.Size > fu.maxSize {
-			return fmt.Errorf("File is too big: %d", fu.maxSize)
+	for _, option := range fu.allowedTypes {
+		if headers[option] == mediaType {
+			return true
 		}
 	}
 
-	return nil
+	return false
 }
 
+// ValidateAndUpload checks the uploaded file and writes it in dir under a generated name.
+// The type comes from the file content, images are decoded and encoded again
+// which drops their metadata (EXIF, GPS...), webp images have their metadata chunks removed.
 func (fu *FileUpload) ValidateAndUpload(dir string) (*FileInfo, error) {
+	if err := fu.Parse(); err != nil {
+		return nil, err
+	}
+
 	file, handler, err := fu.req.FormFile(fu.field)
 	if err != nil {
 		return nil, err
@@ -79,27 +119,78 @@ func (fu *FileUpload) ValidateAndUpload(dir string) (*FileInfo, error) {
 
 	defer file.Close()
 
-	if err := fu.validateFile(handler); err != nil {
+	if fu.maxSize > 0 && handler.Size > fu.maxSize {
+		return nil, ErrTooLarge
+	}
+
+	mediaType, content, err := Sniff(file)
+	if err != nil {
 		return nil, err
 	}
 
-	fileExt := strings.Split(handler.Filename, ".")[1]
+	if !fu.allowed(mediaType) {
+		return nil, fmt.Errorf("%w: %s is not in %v", ErrType, mediaType, fu.allowedTypes)
+	}
 
-	// Create a temporary file within our temp-images directory that follows a particular naming pattern
-	tempFile, err := os.CreateTemp(dir, fmt.Sprintf("%s-*.%s", "image", fileExt))
+	tempFile, err := os.CreateTemp(dir, ".upload-*")
 	if err != nil {
 		return nil, err
 	}
 
-	defer tempFile.Close()
+	defer os.Remove(tempFile.Name())
 
-	// read all of the contents of our uploaded file into a byte array
-	if fileBytes, err := io.ReadAll(file); err != nil {
-		return nil, err
+	info := &FileInfo{MimeType: mediaType}
+	if isImage(mediaType) {
+		err = fu.reencode(content, tempFile, info)
 	} else {
-		// write this byte array to our temporary file
-		tempFile.Write(fileBytes)
+		err = fu.copy(content, tempFile, info)
+	}
 
-		return &FileInfo{Name: tempFile.Name(), Size: handler.Size}, nil
+	if closeErr := tempFile.Close(); err == nil {
+		err = closeErr
 	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	name, err := randomName(Extension(mediaType))
+	if err != nil {
+		return nil, err
+	}
+
+	info.Name = filepath.Join(dir, name)
+	if err := os.Rename(tempFile.Name(), info.Name); err != nil {
+		return nil, err
+	}
+
+	return info, nil
+}
+
+// copy streams r into w, failing once more than maxSize bytes were read.
+func (fu *FileUpload) copy(r io.Reader, w io.Writer, info *FileInfo) error {
+	if fu.maxSize > 0 {
+		r = io.LimitReader(r, fu.maxSize+1)
+	}
+
+	size, err := io.Copy(w, r)
+	if err != nil {
+		return err
+	}
+
+	if fu.maxSize > 0 && size > fu.maxSize {
+		return ErrTooLarge
+	}
+
+	info.Size = size
+	return nil
+}
+
+func randomName(ext string) (string, error) {
+	b := make([]byte, 16)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b) + "." + ext, nil
 }
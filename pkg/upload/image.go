@@ -0,0 +1,397 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/binary"
+	"image"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+
+	"golang.org/x/image/webp"
+)
+
+// the pixels of all the frames of a gif, each one is decoded in full.
+const maxGIFPixels = 64 * 1000 * 1000
+
+func isImage(mediaType string) bool {
+	return mediaType == "image/png" || mediaType == "image/jpeg" || mediaType == "image/gif" || mediaType == "image/webp"
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+type countingWriter struct {
+	w io.Writer
+	n int64
+}
+
+func (c *countingWriter) Write(p []byte) (int, error) {
+	n, err := c.w.Write(p)
+	c.n += int64(n)
+	return n, err
+}
+
+// reencode decodes the image in r and writes it again to w, dropping its metadata.
+// The dimensions are checked from the image header before anything is decoded,
+// so a small file claiming a huge size (decompression bomb) is rejected early.
+func (fu *FileUpload) reencode(r io.Reader, w io.Writer, info *FileInfo) error {
+	if fu.maxSize > 0 {
+		r = io.LimitReader(r, fu.maxSize+1)
+	}
+
+	counter := &countingReader{r: r}
+
+	var header bytes.Buffer
+	config, format, err := image.DecodeConfig(io.TeeReader(counter, &header))
+	if err != nil {
+		return ErrType
+	}
+
+	if config.Width <= 0 || config.Height <= 0 || config.Width > fu.maxWidth || config.Height > fu.maxHeight {
+		return ErrDimensions
+	}
+
+	content := io.MultiReader(&header, counter)
+	out := &countingWriter{w: w}
+
+	info.Width, info.Height = config.Width, config.Height
+
+	switch format {
+	case "gif":
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+
+		if err := fu.checkSize(counter); err != nil {
+			return err
+		}
+
+		// every frame is decoded in full, a small file can hold thousands of them.
+		pixels, err := gifPixels(data)
+		if err != nil {
+			return ErrType
+		}
+
+		if pixels > maxGIFPixels {
+			return ErrDimensions
+		}
+
+		// keep every frame of animated gifs.
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil {
+			return ErrType
+		}
+
+		if err := gif.EncodeAll(out, g); err != nil {
+			return err
+		}
+	case "jpeg":
+		img, err := jpeg.Decode(content)
+		if err != nil {
+			return ErrType
+		}
+
+		if err := fu.checkSize(counter); err != nil {
+			return err
+		}
+
+		img = orient(img, exifOrientation(header.Bytes()))
+		info.Width, info.Height = img.Bounds().Dx(), img.Bounds().Dy()
+		if err := jpeg.Encode(out, img, &jpeg.Options{Quality: 90}); err != nil {
+			return err
+		}
+	case "png":
+		img, err := png.Decode(content)
+		if err != nil {
+			return ErrType
+		}
+
+		if err := fu.checkSize(counter); err != nil {
+			return err
+		}
+
+		if err := png.Encode(out, img); err != nil {
+			return err
+		}
+	case "webp":
+		data, err := io.ReadAll(content)
+		if err != nil {
+			return err
+		}
+
+		if err := fu.checkSize(counter); err != nil {
+			return err
+		}
+
+		// there's no webp encoder, the image is decoded to check it and its metadata is dropped.
+		if _, err := webp.Decode(bytes.NewReader(data)); err != nil {
+			return ErrType
+		}
+
+		stripped, err := stripWebP(data)
+		if err != nil {
+			return err
+		}
+
+		if _, err := out.Write(stripped); err != nil {
+			return err
+		}
+	default:
+		return ErrType
+	}
+
+	info.Size = out.n
+
+	return nil
+}
+
+func (fu *FileUpload) checkSize(counter *countingReader) error {
+	if fu.maxSize > 0 && counter.n > fu.maxSize {
+		return ErrTooLarge
+	}
+	return nil
+}
+
+// gifPixels returns the pixels of all the frames of a gif, read from their descriptors
+// without decoding them.
+func gifPixels(data []byte) (int64, error) {
+	// header and logical screen descriptor.
+	if len(data) < 13 {
+		return 0, ErrType
+	}
+
+	i := 13
+	if flags := data[10]; flags&0x80 != 0 {
+		i += 3 << ((flags & 0x07) + 1)
+	}
+
+	// skipBlocks skips data sub-blocks up to the block terminator.
+	skipBlocks := func() error {
+		for {
+			if i >= len(data) {
+				return ErrType
+			}
+
+			size := int(data[i])
+			i++
+			if size == 0 {
+				return nil
+			}
+			i += size
+		}
+	}
+
+	var pixels int64
+	for i < len(data) {
+		switch data[i] {
+		case 0x21: // extension
+			i += 2
+			if err := skipBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if i+10 > len(data) {
+				return 0, ErrType
+			}
+
+			width, height := binary.LittleEndian.Uint16(data[i+5:]), binary.LittleEndian.Uint16(data[i+7:])
+			pixels += int64(width) * int64(height)
+
+			flags := data[i+9]
+			i += 10
+			if flags&0x80 != 0 {
+				i += 3 << ((flags & 0x07) + 1)
+			}
+
+			// the lzw minimum code size, then the image data.
+			i++
+			if err := skipBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x3B: // trailer
+			return pixels, nil
+		default:
+			return 0, ErrType
+		}
+	}
+
+	return pixels, nil
+}
+
+// stripWebP drops the EXIF and XMP chunks of a webp file and clears their flags in the VP8X
+// chunk, the image and color profile chunks are kept as they are.
+func stripWebP(data []byte) ([]byte, error) {
+	if len(data) < 12 || string(data[:4]) != "RIFF" || string(data[8:12]) != "WEBP" {
+		return nil, ErrType
+	}
+
+	if size := int(binary.LittleEndian.Uint32(data[4:])); size+8 < len(data) {
+		data = data[:size+8]
+	}
+
+	var out bytes.Buffer
+	out.Write(data[:12])
+
+	for i := 12; i < len(data); {
+		if i+8 > len(data) {
+			return nil, ErrType
+		}
+
+		name := string(data[i : i+4])
+		end := i + 8 + int(binary.LittleEndian.Uint32(data[i+4:]))
+		if end > len(data) {
+			return nil, ErrType
+		}
+
+		// chunks are padded to an even size.
+		if end%2 == 1 && end < len(data) {
+			end++
+		}
+
+		chunk := data[i:end]
+		i = end
+
+		switch name {
+		case "EXIF", "XMP ":
+			continue
+		case "VP8X":
+			if len(chunk) < 9 {
+				return nil, ErrType
+			}
+			chunk = append([]byte{}, chunk...)
+			chunk[8] &^= 0x08 | 0x04 // the EXIF and XMP flags
+		}
+
+		out.Write(chunk)
+	}
+
+	stripped := out.Bytes()
+	binary.LittleEndian.PutUint32(stripped[4:], uint32(len(stripped)-8))
+
+	return stripped, nil
+}
+
+// exifOrientation returns the orientation tag of the EXIF block of a jpeg, 1 when there's none.
+func exifOrientation(data []byte) int {
+	if len(data) < 4 || data[0] != 0xFF || data[1] != 0xD8 {
+		return 1
+	}
+
+	for i := 2; i+4 <= len(data); {
+		if data[i] != 0xFF {
+			return 1
+		}
+
+		marker := data[i+1]
+		length := int(binary.BigEndian.Uint16(data[i+2:]))
+		if length < 2 || i+2+length > len(data) {
+			return 1
+		}
+
+		segment := data[i+4 : i+2+length]
+		if marker == 0xE1 && len(segment) > 14 && string(segment[:6]) == "Exif\x00\x00" {
+			return tiffOrientation(segment[6:])
+		}
+
+		// start of scan, the metadata segments are before it.
+		if marker == 0xDA {
+			return 1
+		}
+
+		i += 2 + length
+	}
+
+	return 1
+}
+
+func tiffOrientation(tiff []byte) int {
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return 1
+	}
+
+	offset := int(order.Uint32(tiff[4:]))
+	if offset+2 > len(tiff) {
+		return 1
+	}
+
+	count := int(order.Uint16(tiff[offset:]))
+	for e := 0; e < count; e++ {
+		entry := offset + 2 + e*12
+		if entry+12 > len(tiff) {
+			return 1
+		}
+
+		if order.Uint16(tiff[entry:]) == 0x0112 {
+			value := int(order.Uint16(tiff[entry+8:]))
+			if value >= 1 && value <= 8 {
+				return value
+			}
+			return 1
+		}
+	}
+
+	return 1
+}
+
+// orient applies the EXIF orientation to img, since the metadata is dropped on encode.
+func orient(img image.Image, orientation int) image.Image {
+	if orientation <= 1 || orientation > 8 {
+		return img
+	}
+
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+
+	src := image.NewNRGBA(image.Rect(0, 0, w, h))
+	draw.Draw(src, src.Bounds(), img, b.Min, draw.Src)
+
+	dw, dh := w, h
+	if orientation >= 5 {
+		dw, dh = h, w
+	}
+
+	dst := image.NewNRGBA(image.Rect(0, 0, dw, dh))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			var dx, dy int
+			switch orientation {
+			case 2: // mirrored
+				dx, dy = w-1-x, y
+			case 3: // rotated 180
+				dx, dy = w-1-x, h-1-y
+			case 4: // mirrored vertically
+				dx, dy = x, h-1-y
+			case 5: // transposed
+				dx, dy = y, x
+			case 6: // rotated 90 clockwise
+				dx, dy = h-1-y, x
+			case 7: // transversed
+				dx, dy = h-1-y, w-1-x
+			case 8: // rotated 90 counter clockwise
+				dx, dy = y, w-1-x
+			}
+
+			dst.SetNRGBA(dx, dy, src.NRGBAAt(x, y))
+		}
+	}
+
+	return dst
+}
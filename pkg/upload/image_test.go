@@ -0,0 +1,164 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/binary"
+	"errors"
+	"image"
+	"image/color"
+	"image/gif"
+	"testing"
+
+	"golang.org/x/image/webp"
+)
+
+func newTestUpload() *FileUpload {
+	return &FileUpload{maxSize: 10 * 1000 * 1000, maxWidth: 4096, maxHeight: 4096}
+}
+
+func encodeGIF(t *testing.T, width, height, frames int) []byte {
+	palette := color.Palette{color.Black, color.White}
+
+	g := &gif.GIF{Config: image.Config{Width: width, Height: height, ColorModel: palette}}
+	for i := 0; i < frames; i++ {
+		g.Image = append(g.Image, image.NewPaletted(image.Rect(0, 0, width, height), palette))
+		g.Delay = append(g.Delay, 10)
+	}
+
+	var buf bytes.Buffer
+	if err := gif.EncodeAll(&buf, g); err != nil {
+		t.Fatal(err)
+	}
+
+	return buf.Bytes()
+}
+
+func TestGIFPixels(t *testing.T) {
+	for _, frames := range []int{1, 3, 40} {
+		got, err := gifPixels(encodeGIF(t, 16, 8, frames))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if want := int64(frames * 16 * 8); got != want {
+			t.Errorf("gifPixels = %d, want %d", got, want)
+		}
+	}
+
+	if _, err := gifPixels([]byte("GIF89a")); err == nil {
+		t.Error("gifPixels accepted a truncated gif")
+	}
+}
+
+func TestReencodeAnimatedGIF(t *testing.T) {
+	var out bytes.Buffer
+	info := &FileInfo{}
+
+	if err := newTestUpload().reencode(bytes.NewReader(encodeGIF(t, 32, 32, 5)), &out, info); err != nil {
+		t.Fatal(err)
+	}
+
+	g, err := gif.DecodeAll(&out)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(g.Image) != 5 || info.Width != 32 || info.Height != 32 {
+		t.Errorf("re-encoded %d frames of %dx%d", len(g.Image), info.Width, info.Height)
+	}
+}
+
+func TestReencodeRejectsGIFFrameBombs(t *testing.T) {
+	// the blank frame of a 2000x2000 gif compresses to a few kilobytes, repeated 20 times it
+	// takes 80 megapixels once decoded.
+	single := encodeGIF(t, 2000, 2000, 1)
+	start := 13 + 3*2 // header, screen descriptor and the palette of 2 colors
+	frame := single[start : len(single)-1]
+
+	bomb := append([]byte{}, single[:start]...)
+	for i := 0; i < 20; i++ {
+		bomb = append(bomb, frame...)
+	}
+	bomb = append(bomb, 0x3B)
+
+	err := newTestUpload().reencode(bytes.NewReader(bomb), &bytes.Buffer{}, &FileInfo{})
+	if !errors.Is(err, ErrDimensions) {
+		t.Errorf("reencode = %v, want %v", err, ErrDimensions)
+	}
+}
+
+// a 1x1 lossless webp.
+const webpPixel = "UklGRhoAAABXRUJQVlA4TA0AAAAvAAAAEAcQERGIiP4HAA=="
+
+func chunk(name string, data []byte) []byte {
+	out := append([]byte(name), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(data)))
+	out = append(out, data...)
+	if len(data)%2 == 1 {
+		out = append(out, 0)
+	}
+	return out
+}
+
+// extendedWebP wraps the image of webpPixel in the extended format, with EXIF and XMP chunks.
+func extendedWebP(t *testing.T) []byte {
+	pixel, err := base64.StdEncoding.DecodeString(webpPixel)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// flags: EXIF and XMP, a canvas of 1x1 (stored minus one).
+	vp8x := []byte{0x08 | 0x04, 0, 0, 0, 0, 0, 0, 0, 0, 0}
+
+	body := []byte("WEBP")
+	body = append(body, chunk("VP8X", vp8x)...)
+	body = append(body, pixel[12:]...)
+	body = append(body, chunk("EXIF", []byte("Exif\x00\x00GPS 48.8584 N 2.2945 E"))...)
+	body = append(body, chunk("XMP ", []byte("<x:xmpmeta>secret</x:xmpmeta>"))...)
+
+	out := append([]byte("RIFF"), 0, 0, 0, 0)
+	binary.LittleEndian.PutUint32(out[4:], uint32(len(body)))
+	return append(out, body...)
+}
+
+func TestReencodeStripsWebPMetadata(t *testing.T) {
+	var out bytes.Buffer
+	info := &FileInfo{}
+
+	if err := newTestUpload().reencode(bytes.NewReader(extendedWebP(t)), &out, info); err != nil {
+		t.Fatal(err)
+	}
+
+	stripped := out.Bytes()
+	for _, leak := range []string{"EXIF", "GPS", "XMP ", "secret"} {
+		if bytes.Contains(stripped, []byte(leak)) {
+			t.Errorf("%q is left in the webp", leak)
+		}
+	}
+
+	if flags := stripped[20]; flags&(0x08|0x04) != 0 {
+		t.Errorf("VP8X flags %#x still announce metadata", flags)
+	}
+	if size := binary.LittleEndian.Uint32(stripped[4:]); int(size) != len(stripped)-8 {
+		t.Errorf("RIFF size %d for %d bytes", size, len(stripped))
+	}
+
+	if _, err := webp.Decode(bytes.NewReader(stripped)); err != nil {
+		t.Errorf("stripped webp doesn't decode: %s", err)
+	}
+	if info.Width != 1 || info.Height != 1 || info.Size != int64(len(stripped)) {
+		t.Errorf("info = %+v", *info)
+	}
+}
+
+func TestReencodeRejectsLargeWebP(t *testing.T) {
+	fu := newTestUpload()
+	fu.maxWidth, fu.maxHeight = 1, 1
+
+	data := extendedWebP(t)
+	// a canvas of 5000x5000.
+	copy(data[24:30], []byte{0x87, 0x13, 0, 0x87, 0x13, 0})
+
+	if err := fu.reencode(bytes.NewReader(data), &bytes.Buffer{}, &FileInfo{}); !errors.Is(err, ErrDimensions) {
+		t.Errorf("reencode = %v, want %v", err, ErrDimensions)
+	}
+}
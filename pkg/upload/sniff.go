@@ -0,0 +1,52 @@
+package upload
+
+import (
+	"bytes"
+	"io"
+	"mime"
+	"net/http"
+)
+
+// canonical extension of the detected types.
+var extensions = map[string]string{
+	"image/png":       "png",
+	"image/jpeg":      "jpg",
+	"image/gif":       "gif",
+	"image/webp":      "webp",
+	"application/pdf": "pdf",
+	"application/zip": "zip",
+	"text/plain":      "txt",
+	"audio/mpeg":      "mp3",
+	"video/mp4":       "mp4",
+}
+
+// Sniff detects the media type of r from its first bytes (magic numbers).
+// The returned reader replays the whole content, sniffed bytes included.
+func Sniff(r io.Reader) (string, io.Reader, error) {
+	head := make([]byte, 512)
+
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return "", nil, err
+	}
+	head = head[:n]
+
+	if n == 0 {
+		return "", nil, io.EOF
+	}
+
+	mediaType, _, err := mime.ParseMediaType(http.DetectContentType(head))
+	if err != nil {
+		return "", nil, err
+	}
+
+	return mediaType, io.MultiReader(bytes.NewReader(head), r), nil
+}
+
+// Extension returns the canonical file extension of a media type, without the dot.
+func Extension(mediaType string) string {
+	if ext, ok := extensions[mediaType]; ok {
+		return ext
+	}
+	return "bin"
+}